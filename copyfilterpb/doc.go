@@ -0,0 +1,5 @@
+// Package copyfilterpb is the gRPC protocol of external copy filters (copyfilter.proto), for
+// implementing a filter service in Go
+package copyfilterpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative copyfilter.proto
@@ -0,0 +1,5 @@
+// Package deploypb is the gRPC service of the serve daemon (deploy.proto), with the generated
+// client for integrating deploys in Go services
+package deploypb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative deploy.proto
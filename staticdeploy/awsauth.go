@@ -0,0 +1,340 @@
+package staticdeploy
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// awsKeySource returns the keys requests to AWS are signed with, fetching new temporary keys
+// when the cached ones expire
+type awsKeySource struct {
+	name    string                             // where keys come from, for messages
+	fetch   func() (awsKeys, time.Time, error) // the keys and their expiry, zero if they don't expire
+	mu      sync.Mutex
+	keys    awsKeys
+	expires time.Time
+}
+
+// Keys returns valid keys
+func (s *awsKeySource) Keys() (awsKeys, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys.accessKey != "" && (s.expires.IsZero() || time.Now().Before(s.expires)) {
+		return s.keys, nil
+	}
+	keys, expires, err := s.fetch()
+	if err != nil {
+		return awsKeys{}, fmt.Errorf("AWS credentials of %s: %w", s.name, err)
+	}
+	s.keys, s.expires = keys, time.Time{}
+	if !expires.IsZero() {
+		s.expires = expires.Add(-tokenRefreshMargin)
+	}
+	return keys, nil
+}
+
+// staticAWSKeySource returns keys that don't expire, e.g. ones given as credentials
+func staticAWSKeySource(name string, keys awsKeys) *awsKeySource {
+	return &awsKeySource{name: name, fetch: func() (awsKeys, time.Time, error) {
+		return keys, time.Time{}, nil
+	}}
+}
+
+// awsKeyChain finds AWS keys like the default credential chain of the AWS SDKs: the
+// s3.access-key and s3.secret-key credentials, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, a
+// web identity token (EKS IAM roles for service accounts), the keys of the AWS_PROFILE profile
+// in the shared credentials and config files, the ECS (or EKS Pod Identity) container
+// credentials, else the instance profile of the EC2 instance
+func awsKeyChain(client httpDoer, credentials *Credentials) (*awsKeySource, error) {
+	if credentials.Has("s3.access-key") || credentials.Has("s3.secret-key") {
+		accessKey, err := s3Credential(credentials, "s3.access-key", "AWS_ACCESS_KEY_ID")
+		if err != nil {
+			return nil, err
+		}
+		secretKey, err := s3Credential(credentials, "s3.secret-key", "AWS_SECRET_ACCESS_KEY")
+		if err != nil {
+			return nil, err
+		}
+		return staticAWSKeySource("credentials", awsKeys{accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN")}), nil
+	}
+	if accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); accessKey != "" && secretKey != "" {
+		return staticAWSKeySource("environment", awsKeys{accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN")}), nil
+	}
+
+	if tokenFile, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN"); tokenFile != "" && role != "" {
+		return &awsKeySource{name: "web identity " + role, fetch: func() (awsKeys, time.Time, error) {
+			return webIdentityKeys(client, tokenFile, role)
+		}}, nil
+	}
+
+	profile, keys, err := awsProfileKeys()
+	if err != nil {
+		return nil, err
+	}
+	if keys.accessKey != "" {
+		return staticAWSKeySource("profile "+profile, keys), nil
+	}
+
+	if os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" {
+		return &awsKeySource{name: "container credentials", fetch: containerKeys}, nil
+	}
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return nil, errors.New("no AWS credentials: set the s3.access-key and s3.secret-key credentials, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or AWS_PROFILE")
+	}
+	return &awsKeySource{name: "EC2 instance profile", fetch: instanceProfileKeys}, nil
+}
+
+// awsProfileKeys returns the static keys of the AWS_PROFILE profile (default "default") in the
+// shared credentials file, else in the config file. A profile given with AWS_PROFILE must have
+// keys; profiles assuming roles or using SSO aren't supported
+func awsProfileKeys() (string, awsKeys, error) {
+	profile := os.Getenv("AWS_PROFILE")
+	explicit := profile != ""
+	if !explicit {
+		profile = "default"
+	}
+
+	home, _ := os.UserHomeDir()
+	credentialsFile := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsFile == "" {
+		credentialsFile = filepath.Join(home, ".aws", "credentials")
+	}
+	configFile := os.Getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		configFile = filepath.Join(home, ".aws", "config")
+	}
+	configSection := "profile " + profile
+	if profile == "default" {
+		configSection = profile
+	}
+
+	found := false
+	for _, source := range [][2]string{{credentialsFile, profile}, {configFile, configSection}} {
+		values, ok, err := readINISection(source[0], source[1])
+		if err != nil {
+			return profile, awsKeys{}, fmt.Errorf("AWS profile %s: %w", profile, err)
+		}
+		found = found || ok
+		if values["aws_access_key_id"] != "" && values["aws_secret_access_key"] != "" {
+			return profile, awsKeys{values["aws_access_key_id"], values["aws_secret_access_key"], values["aws_session_token"]}, nil
+		}
+	}
+	if explicit {
+		if found {
+			return profile, awsKeys{}, fmt.Errorf("AWS profile %s has no aws_access_key_id and aws_secret_access_key, only profiles with keys are supported", profile)
+		}
+		return profile, awsKeys{}, fmt.Errorf("AWS profile %s not found in %s or %s", profile, credentialsFile, configFile)
+	}
+	return profile, awsKeys{}, nil
+}
+
+// readINISection returns the keys of a section of an INI file like those of the AWS tools; a
+// missing file has no sections
+func readINISection(path string, section string) (map[string]string, bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	found, inSection := false, false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			inSection = strings.Join(strings.Fields(line[1:len(line)-1]), " ") == section
+			found = found || inSection
+		case inSection:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return values, found, scanner.Err()
+}
+
+// awsKeysResponse is the response of the ECS container and EC2 instance metadata endpoints
+type awsKeysResponse struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// requestAWSKeys sends a request to a metadata endpoint and returns the keys of its response
+func requestAWSKeys(client httpDoer, req *http.Request) (awsKeys, time.Time, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return awsKeys{}, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return awsKeys{}, time.Time{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return awsKeys{}, time.Time{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var keys awsKeysResponse
+	if err := json.Unmarshal(data, &keys); err != nil || keys.AccessKeyID == "" {
+		return awsKeys{}, time.Time{}, fmt.Errorf("unexpected credentials response (%s)", resp.Status)
+	}
+	return awsKeys{keys.AccessKeyID, keys.SecretAccessKey, keys.Token}, keys.Expiration, nil
+}
+
+// containerKeys fetches the keys of the task role of an ECS task, or of the service account of
+// an EKS pod with Pod Identity
+func containerKeys() (awsKeys, time.Time, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = "http://169.254.170.2" + relative
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return awsKeys{}, time.Time{}, err
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if tokenFile := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return awsKeys{}, time.Time{}, err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return requestAWSKeys(&http.Client{Timeout: metadataTimeout}, req)
+}
+
+// instanceProfileKeys fetches the keys of the instance profile role of an EC2 instance from the
+// instance metadata service, with a session token (IMDSv2) where the instance issues one
+func instanceProfileKeys() (awsKeys, time.Time, error) {
+	const metadata = "http://169.254.169.254/latest"
+	client := &http.Client{Timeout: metadataTimeout}
+
+	var token string
+	req, err := http.NewRequest(http.MethodPut, metadata+"/api/token", nil)
+	if err != nil {
+		return awsKeys{}, time.Time{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	resp, err := client.Do(req)
+	if err != nil {
+		return awsKeys{}, time.Time{}, err
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		token = strings.TrimSpace(string(data))
+	}
+
+	get := func(path string) (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, metadata+"/meta-data/iam/security-credentials/"+path, nil)
+		if err == nil && token != "" {
+			req.Header.Set("X-aws-ec2-metadata-token", token)
+		}
+		return req, err
+	}
+	req, err = get("")
+	if err != nil {
+		return awsKeys{}, time.Time{}, err
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		return awsKeys{}, time.Time{}, err
+	}
+	data, _ = io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	role, _, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+	if resp.StatusCode != http.StatusOK || role == "" {
+		return awsKeys{}, time.Time{}, fmt.Errorf("no instance profile (%s)", resp.Status)
+	}
+
+	if req, err = get(url.PathEscape(role)); err != nil {
+		return awsKeys{}, time.Time{}, err
+	}
+	return requestAWSKeys(client, req)
+}
+
+// webIdentityKeys exchanges the web identity token of a file, e.g. the service account token
+// EKS mounts into pods, for the keys of a role with STS AssumeRoleWithWebIdentity
+func webIdentityKeys(client httpDoer, tokenFile string, role string) (awsKeys, time.Time, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsKeys{}, time.Time{}, err
+	}
+	session := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if session == "" {
+		session = "magento2-static-deploy"
+	}
+	endpoint := "https://sts.amazonaws.com/"
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		endpoint = "https://sts." + region + ".amazonaws.com/"
+	}
+	req, err := postForm(endpoint, url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	})
+	if err != nil {
+		return awsKeys{}, time.Time{}, err
+	}
+
+	// Assuming a role has no side effects, so the shared client retries it
+	do := client.Do
+	if shared, ok := client.(*HTTPClient); ok {
+		do = shared.DoIdempotent
+	}
+	resp, err := do(req)
+	if err != nil {
+		return awsKeys{}, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return awsKeys{}, time.Time{}, err
+	}
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+		Error struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+	}
+	if err := xml.Unmarshal(data, &result); err != nil {
+		return awsKeys{}, time.Time{}, fmt.Errorf("unexpected STS response (%s)", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || result.Credentials.AccessKeyID == "" {
+		if result.Error.Code != "" {
+			return awsKeys{}, time.Time{}, fmt.Errorf("%s: %s %s", resp.Status, result.Error.Code, result.Error.Message)
+		}
+		return awsKeys{}, time.Time{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	creds := result.Credentials
+	return awsKeys{creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken}, creds.Expiration, nil
+}
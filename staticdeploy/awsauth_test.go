@@ -0,0 +1,71 @@
+package staticdeploy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// clearAWSEnv leaves the AWS variables of the test process out of the chain
+func clearAWSEnv(t *testing.T) {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+		"STATIC_DEPLOY_S3_ACCESS_KEY", "STATIC_DEPLOY_S3_SECRET_KEY"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+}
+
+func TestAWSKeyChainProfile(t *testing.T) {
+	clearAWSEnv(t)
+	config := filepath.Join(t.TempDir(), "config")
+	os.WriteFile(config, []byte("[default]\nregion = eu-west-1\n\n[profile deploy]\naws_access_key_id = AKIDPROFILE\naws_secret_access_key = secret\n"), 0600)
+	t.Setenv("AWS_CONFIG_FILE", config)
+	t.Setenv("AWS_PROFILE", "deploy")
+
+	source, err := awsKeyChain(http.DefaultClient, NewCredentials(t.TempDir(), &Config{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := source.Keys(); err != nil || keys.accessKey != "AKIDPROFILE" {
+		t.Errorf("Keys() = %v, %v, want the keys of the deploy profile", keys, err)
+	}
+
+	t.Setenv("AWS_PROFILE", "missing")
+	if _, err := awsKeyChain(http.DefaultClient, NewCredentials(t.TempDir(), &Config{})); err == nil {
+		t.Error("a missing AWS_PROFILE profile is no error")
+	}
+}
+
+func TestAWSKeyChainContainer(t *testing.T) {
+	clearAWSEnv(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "pod-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"AccessKeyId":"ASIACONTAINER","SecretAccessKey":"secret","Token":"session","Expiration":"2099-01-01T00:00:00Z"}`))
+	}))
+	defer server.Close()
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", server.URL+"/v1/credentials")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "pod-token")
+
+	source, err := awsKeyChain(http.DefaultClient, NewCredentials(t.TempDir(), &Config{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := source.Keys()
+	if err != nil || keys.accessKey != "ASIACONTAINER" || keys.token != "session" {
+		t.Errorf("Keys() = %v, %v, want the container credentials", keys, err)
+	}
+
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+	if _, err := awsKeyChain(http.DefaultClient, NewCredentials(t.TempDir(), &Config{})); err == nil {
+		t.Error("no credentials with the instance metadata disabled is no error")
+	}
+}
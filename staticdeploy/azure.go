@@ -0,0 +1,434 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Uploads of Azure blobs: files above azureBlockSize are uploaded in blocks of that size,
+// azureBlockConcurrency at a time
+const (
+	azureBlockSize        = 8 * 1024 * 1024
+	azureBlockConcurrency = 4
+	azureAPIVersion       = "2021-08-06"
+	azureStorageResource  = "https://storage.azure.com"
+)
+
+// AzureConfig configures Azure Blob Storage (the remote.azure section of the config file)
+// Requests are authorized with, in order: the azure.sas-token credential or
+// AZURE_STORAGE_SAS_TOKEN, the azure.account-key credential or AZURE_STORAGE_KEY, else an
+// Azure AD token of the environment (see azureTokenSource)
+type AzureConfig struct {
+	Endpoint string `yaml:"endpoint" json:"endpoint"` // default https://{account}.blob.core.windows.net, e.g. Azurite's http://127.0.0.1:10000/devstoreaccount1
+}
+
+// azureRemoteStore is a remote target in an Azure Blob Storage container, below an optional
+// prefix
+type azureRemoteStore struct {
+	account    string
+	container  string
+	prefix     string // "" or ending in a slash
+	endpoint   *url.URL
+	sasToken   string
+	accountKey []byte
+	tokens     *tokenSource
+	client     *HTTPClient
+}
+
+// newAzureRemoteStore opens an azure://account/container/prefix target
+func newAzureRemoteStore(u *url.URL, magentoRoot string, cfg *Config) (*azureRemoteStore, error) {
+	container, prefix, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if u.Host == "" || container == "" {
+		return nil, fmt.Errorf("invalid remote target %q, expected azure://account/container/prefix", u.Redacted())
+	}
+	s := &azureRemoteStore{account: u.Host, container: container, prefix: prefix}
+	if s.prefix != "" {
+		s.prefix += "/"
+	}
+
+	endpoint := cfg.Remote.Azure.Endpoint
+	if endpoint == "" {
+		endpoint = "https://" + s.account + ".blob.core.windows.net"
+	}
+	var err error
+	if s.endpoint, err = url.Parse(strings.TrimSuffix(endpoint, "/")); err != nil || s.endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid remote.azure.endpoint %q", endpoint)
+	}
+	if s.client, err = NewHTTPClient(cfg.HTTP); err != nil {
+		return nil, err
+	}
+
+	credentials := NewCredentials(magentoRoot, cfg)
+	switch {
+	case credentials.Has("azure.sas-token"):
+		if s.sasToken, err = credentials.Get("azure.sas-token"); err != nil {
+			return nil, err
+		}
+	case os.Getenv("AZURE_STORAGE_SAS_TOKEN") != "":
+		s.sasToken = os.Getenv("AZURE_STORAGE_SAS_TOKEN")
+	case credentials.Has("azure.account-key") || os.Getenv("AZURE_STORAGE_KEY") != "":
+		key := os.Getenv("AZURE_STORAGE_KEY")
+		if credentials.Has("azure.account-key") {
+			if key, err = credentials.Get("azure.account-key"); err != nil {
+				return nil, err
+			}
+		}
+		if s.accountKey, err = base64.StdEncoding.DecodeString(key); err != nil {
+			return nil, fmt.Errorf("invalid Azure account key: %w", err)
+		}
+	default:
+		s.tokens = azureTokenSource(s.client, azureStorageResource)
+	}
+	s.sasToken = strings.TrimPrefix(s.sasToken, "?")
+	return s, nil
+}
+
+func (s *azureRemoteStore) String() string {
+	return "azure://" + s.account + "/" + s.container + "/" + s.prefix
+}
+
+// azureBlob is a blob of a listing
+type azureBlob struct {
+	Name       string `xml:"Name"`
+	Properties struct {
+		LastModified string `xml:"Last-Modified"`
+		ContentMD5   string `xml:"Content-MD5"`
+	} `xml:"Properties"`
+}
+
+// list returns the blobs below the prefix of the target and the given prefix
+func (s *azureRemoteStore) list(prefix string) ([]azureBlob, error) {
+	var blobs []azureBlob
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {s.prefix + prefix}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Blobs      []azureBlob `xml:"Blobs>Blob"`
+			NextMarker string      `xml:"NextMarker"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid listing: %w", err)
+		}
+		for _, blob := range result.Blobs {
+			blob.Name = strings.TrimPrefix(blob.Name, s.prefix)
+			blobs = append(blobs, blob)
+		}
+		if result.NextMarker == "" {
+			return blobs, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+func (s *azureRemoteStore) ListVersions() ([]RemoteVersion, error) {
+	blobs, err := s.list("")
+	if err != nil {
+		return nil, err
+	}
+	modified := make(map[string]time.Time, len(blobs))
+	for _, blob := range blobs {
+		modified[blob.Name], _ = time.Parse(time.RFC1123, blob.Properties.LastModified)
+	}
+	return remoteVersionsOf(modified), nil
+}
+
+func (s *azureRemoteStore) CurrentVersion() (string, error) {
+	resp, err := s.do(http.MethodGet, "deployed_version.txt", nil, nil, nil)
+	if err != nil {
+		if e, ok := err.(*azureError); ok && e.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return strings.TrimSpace(string(data)), err
+}
+
+// DeleteVersion deletes the blobs of a version prefix
+func (s *azureRemoteStore) DeleteVersion(name string) error {
+	if !remoteVersionPattern.MatchString(name) {
+		return fmt.Errorf("refusing to delete %q: not a version prefix", name)
+	}
+	blobs, err := s.list(name + "/")
+	if err != nil {
+		return err
+	}
+	keys := make([]string, len(blobs))
+	for i, blob := range blobs {
+		keys[i] = blob.Name
+	}
+	return forEachKey(keys, defaultRemoteConcurrency, s.DeleteObject)
+}
+
+// ListObjects fingerprints blobs by their Content-MD5, which PutObject sets
+func (s *azureRemoteStore) ListObjects() (map[string]string, error) {
+	blobs, err := s.list("")
+	if err != nil {
+		return nil, err
+	}
+	fingerprints := make(map[string]string, len(blobs))
+	for _, blob := range blobs {
+		fingerprints[blob.Name] = base64ToHex(blob.Properties.ContentMD5)
+	}
+	return fingerprints, nil
+}
+
+func (s *azureRemoteStore) Fingerprint(path string) (string, error) {
+	return fileMD5(path)
+}
+
+// PutObject uploads small files with one Put Blob request and larger ones as blocks committed
+// with Put Block List; both set the MD5 of the whole file
+func (s *azureRemoteStore) PutObject(key string, path string, contentType string, cacheControl string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	sum, err := fileMD5(path)
+	if err != nil {
+		return err
+	}
+	md5Hash, _ := hex.DecodeString(sum)
+	contentMD5 := base64.StdEncoding.EncodeToString(md5Hash)
+
+	if info.Size() > azureBlockSize {
+		return s.putBlocks(key, path, info.Size(), http.Header{
+			"X-Ms-Blob-Content-Type":  {contentType},
+			"X-Ms-Blob-Cache-Control": {cacheControl},
+			"X-Ms-Blob-Content-Md5":   {contentMD5},
+			"Content-Type":            {"application/xml"},
+		})
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPut, key, nil, body, http.Header{
+		"X-Ms-Blob-Type":          {"BlockBlob"},
+		"Content-Type":            {contentType},
+		"X-Ms-Blob-Cache-Control": {cacheControl},
+		"Content-Md5":             {contentMD5},
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// putBlocks uploads a large file in blocks and commits them; uncommitted blocks of a failed
+// upload are discarded by Azure after a week
+func (s *azureRemoteStore) putBlocks(key string, path string, size int64, header http.Header) error {
+	ids := make([]string, (size+azureBlockSize-1)/azureBlockSize)
+	errs := make([]error, len(ids))
+	sem := make(chan struct{}, azureBlockConcurrency)
+	var wg sync.WaitGroup
+	for i := range ids {
+		ids[i] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", i)))
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			errs[i] = s.putBlock(key, path, ids[i], int64(i)*azureBlockSize, size)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("block %d: %w", i+1, err)
+		}
+	}
+
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for _, id := range ids {
+		body.WriteString("<Latest>" + id + "</Latest>")
+	}
+	body.WriteString("</BlockList>")
+	resp, err := s.do(http.MethodPut, key, url.Values{"comp": {"blocklist"}}, body.Bytes(), header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// putBlock uploads the block of a file at offset
+func (s *azureRemoteStore) putBlock(key string, path string, id string, offset int64, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	body := make([]byte, min(azureBlockSize, size-offset))
+	if _, err := f.ReadAt(body, offset); err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPut, key, url.Values{"comp": {"block"}, "blockid": {id}}, body, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *azureRemoteStore) DeleteObject(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		if e, ok := err.(*azureError); ok && e.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// azureError is an error response of Blob Storage
+type azureError struct {
+	StatusCode int
+	Status     string
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *azureError) Error() string {
+	if e.Code == "" {
+		return e.Status
+	}
+	message, _, _ := strings.Cut(e.Message, "\n")
+	return fmt.Sprintf("%s: %s (%s)", e.Status, message, e.Code)
+}
+
+// do sends an authorized request for a blob (or the container for "") and returns the
+// response of a successful request; error responses are returned as *azureError
+func (s *azureRemoteStore) do(method string, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path += "/" + s.container
+	if key != "" {
+		u.Path += "/" + s.prefix + key
+	}
+	u.RawPath = ""
+	u.RawQuery = query.Encode()
+	if s.sasToken != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += s.sasToken
+	}
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body, req.GetBody = nil, nil
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("X-Ms-Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("X-Ms-Version", azureAPIVersion)
+
+	switch {
+	case s.accountKey != nil:
+		req.Header.Set("Authorization", "SharedKey "+s.account+":"+s.sharedKeySignature(req))
+	case s.tokens != nil:
+		token, err := s.tokens.Token()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		e := &azureError{StatusCode: resp.StatusCode, Status: resp.Status}
+		xml.Unmarshal(data, e)
+		return nil, e
+	}
+	return resp, nil
+}
+
+// sharedKeySignature signs a request with the account key (Shared Key authorization)
+func (s *azureRemoteStore) sharedKeySignature(req *http.Request) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = fmt.Sprint(req.ContentLength)
+	}
+
+	var msHeaders []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower)
+		}
+	}
+	sort.Strings(msHeaders)
+	var canonical strings.Builder
+	for _, name := range msHeaders {
+		canonical.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+
+	canonical.WriteString("/" + s.account + req.URL.EscapedPath())
+	query := req.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := append([]string{}, query[name]...)
+		sort.Strings(values)
+		canonical.WriteString("\n" + strings.ToLower(name) + ":" + strings.Join(values, ","))
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-Md5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonical.String(),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, s.accountKey)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
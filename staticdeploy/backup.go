@@ -0,0 +1,206 @@
+package staticdeploy
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupDir holds the pre-deploy backups of pub/static (--backup), one per run
+const backupDir = "var/static-backups"
+
+// defaultBackupKeep is the number of backups kept when no retention is configured
+const defaultBackupKeep = 3
+
+// backupMode is the --backup format: "link" (hard linked copy) or "tar" (gzipped tarball)
+var backupMode string
+
+// BackupConfig configures the retention of --backup backups
+type BackupConfig struct {
+	Retention RetentionConfig `yaml:"retention" json:"retention"`
+}
+
+// backupStaticTree backs up pub/static to var/static-backups/<timestamp> (or .tar.gz) and
+// removes the backups outside the retention policy
+// Hard linked files share their content with pub/static, which is safe as deploys replace
+// files instead of writing into them; with copyFiles (e.g. when bin/magento deploys Luma
+// themes, which writes in place) files are copied instead, as clones where supported
+func backupStaticTree(magentoRoot string, mode string, copyFiles bool, retention RetentionConfig, verbose bool) (string, error) {
+	staticRoot := filepath.Join(magentoRoot, "pub/static")
+	if _, err := os.Stat(staticRoot); os.IsNotExist(err) {
+		return "", nil
+	}
+
+	name := time.Now().Format("20060102-150405")
+	if mode == "tar" {
+		name += ".tar.gz"
+	}
+	dest := filepath.Join(magentoRoot, backupDir, name)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+
+	// Written under a temporary name, so an interrupted backup is never mistaken for a complete one
+	tmp := filepath.Join(filepath.Dir(dest), tempArtifactPrefix+name)
+	tempArtifacts.Track(tmp)
+	defer tempArtifacts.Remove(tmp)
+
+	var err error
+	switch mode {
+	case "link":
+		err = linkTree(staticRoot, tmp, copyFiles)
+	case "tar":
+		err = tarTree(staticRoot, tmp)
+	default:
+		err = fmt.Errorf("--backup must be 'link' or 'tar', got '%s'", mode)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return "", err
+	}
+
+	if err := removeExpiredBackups(magentoRoot, name, retention, verbose); err != nil {
+		return dest, fmt.Errorf("failed to remove expired backups: %w", err)
+	}
+	return dest, nil
+}
+
+// linkTree recreates the tree at src in dst with hard links to its files (copies when
+// copyFiles is set or linking fails, e.g. across filesystems)
+func linkTree(src string, dst string, copyFiles bool) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(src, path)
+		if strings.HasPrefix(info.Name(), tempArtifactPrefix) {
+			return nil
+		}
+		target := filepath.Join(dst, relPath)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+
+		if !copyFiles && os.Link(path, target) == nil {
+			return nil
+		}
+		if err := copyFile(path, target); err != nil {
+			return err
+		}
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+}
+
+// tarTree writes the tree at src as a gzipped tarball to dst
+func tarTree(src string, dst string) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(src, path)
+		if relPath == "." || strings.HasPrefix(info.Name(), tempArtifactPrefix) {
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// removeExpiredBackups deletes the backups outside the retention policy (default: the newest
+// defaultBackupKeep); the backup just made is always kept
+func removeExpiredBackups(magentoRoot string, latest string, retention RetentionConfig, verbose bool) error {
+	keep := retention.Keep
+	if keep <= 0 {
+		keep = defaultBackupKeep
+	}
+	maxAge, err := parseAge(retention.MaxAge)
+	if err != nil {
+		return fmt.Errorf("invalid backup.retention.max_age: %w", err)
+	}
+
+	dir := filepath.Join(magentoRoot, backupDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var backups []RemoteVersion
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, RemoteVersion{Name: entry.Name(), Modified: info.ModTime()})
+	}
+
+	for _, backup := range expiredVersions(backups, latest, keep, maxAge, time.Now()) {
+		if err := os.RemoveAll(filepath.Join(dir, backup.Name)); err != nil {
+			return err
+		}
+		if verbose {
+			logDebugf("  Removed expired backup %s", backup.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package staticdeploy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+func init() {
+	registerCommand(Command{
+		Name:        "bench",
+		Description: "Benchmark copy methods, worker counts and buffer sizes on a tree",
+		Run:         runBench,
+	})
+}
+
+// benchMethods are the copy mechanisms bench compares: plain is a userspace copy with a buffer,
+// the others are what the deploy uses (see copyFile and copyFileContents)
+var benchMethods = []string{"plain", "copy", "reflink"}
+
+// benchFile is a regular file of the benchmarked tree
+type benchFile struct {
+	rel  string
+	size int64
+}
+
+// benchResult is the throughput of one combination of method, buffer size and workers
+type benchResult struct {
+	method  string
+	buffer  int // plain only
+	workers int
+	elapsed time.Duration // best of the rounds
+	err     error
+}
+
+func runBench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	workers := flags.IntSlice("workers", defaultBenchWorkers(), "Worker counts to compare")
+	buffers := flags.StringSlice("buffer-sizes", []string{"32k", "128k", "1m"}, "Buffer sizes of the plain method to compare")
+	methods := flags.StringSlice("methods", benchMethods, "Copy methods to compare: "+strings.Join(benchMethods, ", "))
+	dest := flags.String("dest", "", "Directory to copy to: the copies go to a temporary directory created in it and removed afterwards (default: next to the tree, on the same filesystem)")
+	rounds := flags.Int("rounds", 1, "Runs per combination; the fastest counts")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s bench [options] <directory>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Copies the files of a directory (e.g. vendor or pub/static) with every combination of\n")
+		fmt.Fprintf(os.Stderr, "copy method, buffer size and worker count, and reports the throughput to tune --jobs\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("bench needs the directory to copy")
+	}
+	source := flags.Arg(0)
+	if *rounds < 1 {
+		return fmt.Errorf("--rounds must be at least 1")
+	}
+	for _, n := range *workers {
+		if n < 1 {
+			return fmt.Errorf("--workers must be at least 1, got %d", n)
+		}
+	}
+	for _, method := range *methods {
+		if !slices.Contains(benchMethods, method) {
+			return fmt.Errorf("unknown copy method '%s', expected one of %s", method, strings.Join(benchMethods, ", "))
+		}
+	}
+	var bufferSizes []int
+	for _, value := range *buffers {
+		size, err := parseByteSize(value)
+		if err != nil {
+			return fmt.Errorf("--buffer-sizes: %w", err)
+		}
+		bufferSizes = append(bufferSizes, size)
+	}
+
+	files, dirs, total, err := scanBenchTree(source)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files in %s", source)
+	}
+
+	// Only a directory of our own is emptied between runs, never files of --dest
+	parent := *dest
+	if parent == "" {
+		parent = filepath.Dir(filepath.Clean(source))
+	} else if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+	destDir, err := os.MkdirTemp(parent, ".static-deploy-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(destDir)
+
+	fmt.Printf("Benchmarking %d files (%s) from %s to %s\n", len(files), formatBytes(uint64(total)), source, destDir)
+	// Read everything once, so the first combination doesn't pay for a cold page cache
+	warmBenchTree(source, files)
+
+	var results []benchResult
+	for _, method := range *methods {
+		methodBuffers := []int{0}
+		if method == "plain" {
+			methodBuffers = bufferSizes
+		}
+		for _, buffer := range methodBuffers {
+			for _, n := range *workers {
+				result := benchResult{method: method, buffer: buffer, workers: n}
+				for round := 0; round < *rounds && result.err == nil; round++ {
+					elapsed, err := benchCopy(source, destDir, files, dirs, method, buffer, n)
+					if err != nil {
+						result.err = err
+					} else if result.elapsed == 0 || elapsed < result.elapsed {
+						result.elapsed = elapsed
+					}
+				}
+				results = append(results, result)
+				if errors.Is(result.err, errCloneUnsupported) {
+					break // the other worker counts won't fare better
+				}
+			}
+		}
+	}
+
+	printBenchResults(os.Stdout, results, len(files), total)
+	return nil
+}
+
+// defaultBenchWorkers returns 1, 2, 4, ... up to twice the CPUs
+func defaultBenchWorkers() []int {
+	var workers []int
+	for n := 1; n < 2*runtime.NumCPU(); n *= 2 {
+		workers = append(workers, n)
+	}
+	return append(workers, 2*runtime.NumCPU())
+}
+
+// parseByteSize parses a size like 4096, 64k or 1m
+func parseByteSize(value string) (int, error) {
+	number := strings.ToLower(strings.TrimSpace(value))
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(number, "k"):
+		multiplier, number = 1024, strings.TrimSuffix(number, "k")
+	case strings.HasSuffix(number, "m"):
+		multiplier, number = 1024*1024, strings.TrimSuffix(number, "m")
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid size '%s'", value)
+	}
+	return n * multiplier, nil
+}
+
+// scanBenchTree lists the regular files and the directories of root
+func scanBenchTree(root string) (files []benchFile, dirs []string, total int64, err error) {
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		if d.IsDir() {
+			dirs = append(dirs, rel)
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, benchFile{rel: rel, size: info.Size()})
+		total += info.Size()
+		return nil
+	})
+	return files, dirs, total, err
+}
+
+// warmBenchTree reads all files, loading them into the page cache
+func warmBenchTree(root string, files []benchFile) {
+	for _, file := range files {
+		if f, err := os.Open(filepath.Join(root, file.rel)); err == nil {
+			copyBuffered(io.Discard, f)
+			f.Close()
+		}
+	}
+}
+
+// benchCopy copies files into destDir, a directory of the benchmark emptied first, with workers, returning the time the copies
+// took; creating the directories isn't measured
+func benchCopy(source, destDir string, files []benchFile, dirs []string, method string, buffer int, workers int) (time.Duration, error) {
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(destDir, entry.Name())); err != nil {
+			return 0, err
+		}
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(destDir, dir), 0755); err != nil {
+			return 0, err
+		}
+	}
+
+	var next atomic.Int64
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, buffer)
+			for {
+				idx := int(next.Add(1)) - 1
+				if idx >= len(files) {
+					return
+				}
+				rel := files[idx].rel
+				if err := benchCopyFile(filepath.Join(source, rel), filepath.Join(destDir, rel), method, buf); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					next.Store(int64(len(files))) // stop the other workers
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return time.Since(start), firstErr
+}
+
+// benchCopyFile copies src to dst with method
+func benchCopyFile(src, dst string, method string, buf []byte) error {
+	if method == "reflink" {
+		return cloneFile(src, dst)
+	}
+
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	if method == "plain" {
+		// Hide ReaderFrom/WriterTo, which would copy in the kernel or with their own buffer
+		_, err = io.CopyBuffer(struct{ io.Writer }{destination}, struct{ io.Reader }{source}, buf)
+		return err
+	}
+	return copyFileContents(destination, source)
+}
+
+// printBenchResults prints the throughput of every combination, fastest first, and the
+// --jobs of the fastest one
+func printBenchResults(w io.Writer, results []benchResult, fileCount int, total int64) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].err == nil) != (results[j].err == nil) {
+			return results[i].err == nil
+		}
+		return results[i].elapsed < results[j].elapsed
+	})
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tBUFFER\tWORKERS\tTIME\tFILES/SEC\tMB/SEC")
+	for _, result := range results {
+		buffer := "-"
+		if result.buffer > 0 {
+			buffer = formatBytes(uint64(result.buffer))
+		}
+		if result.err != nil {
+			reason := result.err.Error()
+			if errors.Is(result.err, errCloneUnsupported) {
+				reason = "not supported here"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s %s\t\t\n", result.method, buffer, result.workers, symSkip, reason)
+			continue
+		}
+		seconds := result.elapsed.Seconds()
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.2fs\t%.0f\t%.1f\n", result.method, buffer, result.workers, seconds,
+			float64(fileCount)/seconds, float64(total)/1024/1024/seconds)
+	}
+	tw.Flush()
+
+	if len(results) > 0 && results[0].err == nil {
+		best := results[0]
+		fmt.Fprintf(w, "\nFastest: %s with %d workers; deploy with --jobs %d\n", best.method, best.workers, best.workers)
+	}
+}
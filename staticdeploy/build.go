@@ -0,0 +1,116 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// buildScriptName is the package.json script run as theme build hook
+const buildScriptName = "static-deploy"
+
+// ThemeBuild is a build command run in a theme directory before its files are deployed
+type ThemeBuild struct {
+	Command string `yaml:"command" json:"command"`
+	Dir     string `yaml:"dir" json:"dir"` // relative to the theme directory
+}
+
+// themeBuildHook returns the build hook of a theme, in order of precedence from:
+//   - the theme_builds section of the config file
+//   - extra.static-deploy.build (and build-dir) in the theme's composer.json
+//   - a "static-deploy" script in the theme's package.json or web/tailwind/package.json
+//
+// The hooks of composer.json and package.json are only used with theme_build_hooks enabled
+func themeBuildHook(themePath string, theme string, cfg *Config) (ThemeBuild, bool) {
+	if build, ok := cfg.ThemeBuilds[theme]; ok && build.Command != "" {
+		return build, true
+	}
+	if !cfg.ThemeBuildHooks {
+		return ThemeBuild{}, false
+	}
+
+	if data, err := os.ReadFile(filepath.Join(themePath, "composer.json")); err == nil {
+		var composer struct {
+			Extra struct {
+				StaticDeploy struct {
+					Build    string `json:"build"`
+					BuildDir string `json:"build-dir"`
+				} `json:"static-deploy"`
+			} `json:"extra"`
+		}
+		if json.Unmarshal(data, &composer) == nil && composer.Extra.StaticDeploy.Build != "" {
+			return ThemeBuild{Command: composer.Extra.StaticDeploy.Build, Dir: composer.Extra.StaticDeploy.BuildDir}, true
+		}
+	}
+
+	for _, dir := range []string{".", "web/tailwind"} {
+		data, err := os.ReadFile(filepath.Join(themePath, dir, "package.json"))
+		if err != nil {
+			continue
+		}
+		var pkg struct {
+			Scripts map[string]string `json:"scripts"`
+		}
+		if json.Unmarshal(data, &pkg) == nil && pkg.Scripts[buildScriptName] != "" {
+			return ThemeBuild{Command: "npm run " + buildScriptName, Dir: dir}, true
+		}
+	}
+
+	return ThemeBuild{}, false
+}
+
+// runThemeBuilds runs the build hooks of the themes of the given jobs, once per theme directory
+// The hooks write into the theme's web directory, so their output is part of the deployment
+func runThemeBuilds(magentoRoot string, jobs []DeployJob, cfg *Config, verbose bool) error {
+	built := make(map[string]bool)
+
+	for _, job := range jobs {
+		themePath := getThemePath(magentoRoot, job.Area, job.Theme)
+		if themePath == "" || built[themePath] {
+			continue
+		}
+		built[themePath] = true
+
+		build, ok := themeBuildHook(themePath, job.Theme, cfg)
+		if !ok {
+			continue
+		}
+
+		// The hook must build the theme, not something next to it
+		if build.Dir != "" && !filepath.IsLocal(build.Dir) {
+			return fmt.Errorf("build of theme %s: directory %q is outside the theme directory", job.Theme, build.Dir)
+		}
+		dir := filepath.Join(themePath, build.Dir)
+		if verbose {
+			logDebugf("Building %s: %s (in %s)", job.Theme, build.Command, dir)
+		}
+
+		start := time.Now()
+		cmd := exec.Command("sh", "-c", build.Command)
+		cmd.Dir = dir
+		if offlineMode {
+			// Make npm use its cache only instead of the registry
+			cmd.Env = append(os.Environ(), "npm_config_offline=true")
+		}
+		var out bytes.Buffer
+		if verbose {
+			cmd.Stdout = runStdout
+			cmd.Stderr = runStderr
+		} else {
+			cmd.Stdout = &out
+			cmd.Stderr = &out
+		}
+		if err := cmd.Run(); err != nil {
+			runStderr.Write(out.Bytes())
+			return fmt.Errorf("build of theme %s failed: %w", job.Theme, err)
+		}
+
+		logger.Info(fmt.Sprintf("%s Built %s - %.1fs", symOK, job.Theme, time.Since(start).Seconds()), "theme", job.Theme, "duration", time.Since(start).Seconds())
+	}
+
+	return nil
+}
@@ -0,0 +1,290 @@
+package staticdeploy
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// flushCache flushes the cache entries referencing static content URLs from Magento's Redis
+// cache after a successful deploy (--flush-cache)
+var flushCache bool
+
+// defaultCacheFlushTags are the tags of the config, layout, block_html and full_page caches,
+// which hold URLs of the previous static content version
+var defaultCacheFlushTags = []string{"CONFIG", "LAYOUT_GENERAL_CACHE_TAG", "BLOCK_HTML", "FPC"}
+
+// redisTimeout limits connecting to and every command of the Redis connection
+const redisTimeout = 10 * time.Second
+
+// CacheFlushConfig configures --flush-cache (the cache_flush section of the config file)
+type CacheFlushConfig struct {
+	Frontends []string `yaml:"frontends" json:"frontends"` // cache frontends of env.php, default: default and page_cache
+	Tags      []string `yaml:"tags" json:"tags"`           // default: CONFIG, LAYOUT_GENERAL_CACHE_TAG, BLOCK_HTML, FPC
+}
+
+// RedisCache is a cache frontend of app/etc/env.php with a Redis backend
+type RedisCache struct {
+	Frontend string
+	Network  string // tcp or unix
+	Addr     string
+	Password string
+	Database int
+	Prefix   string // id_prefix, which Magento prepends to ids and tags
+}
+
+// CacheFlusher removes tagged entries from Magento's Redis caches
+type CacheFlusher struct {
+	caches []RedisCache
+	tags   []string
+}
+
+// NewCacheFlusher creates the flusher when --flush-cache is given, nil otherwise. The Redis
+// backends are resolved from app/etc/env.php up front, so a misconfiguration fails before deploying
+func NewCacheFlusher(magentoRoot string, cfg *Config) (*CacheFlusher, error) {
+	if !flushCache {
+		return nil, nil
+	}
+	env, err := readPHPArrayFile(filepath.Join(magentoRoot, "app/etc/env.php"))
+	if err != nil {
+		return nil, fmt.Errorf("--flush-cache: %w", err)
+	}
+
+	frontends := cfg.CacheFlush.Frontends
+	explicit := len(frontends) > 0
+	if !explicit {
+		frontends = []string{"default", "page_cache"}
+	}
+	flusher := &CacheFlusher{tags: cfg.CacheFlush.Tags}
+	if len(flusher.tags) == 0 {
+		flusher.tags = defaultCacheFlushTags
+	}
+
+	for _, frontend := range frontends {
+		options := phpArrayPath(env, "cache", "frontend", frontend)
+		backend := phpArrayPathString(options, "backend")
+		if !strings.HasSuffix(backend, "Redis") {
+			// The full page cache is often Varnish or the file system; only complain when asked for
+			if explicit {
+				return nil, fmt.Errorf("--flush-cache: cache frontend %s has no Redis backend in app/etc/env.php", frontend)
+			}
+			continue
+		}
+		cache, err := redisCacheFromEnv(magentoRoot, frontend, options)
+		if err != nil {
+			return nil, fmt.Errorf("--flush-cache: cache frontend %s: %w", frontend, err)
+		}
+		if cache.Network == "tcp" {
+			if err := requireNetwork("--flush-cache"); err != nil {
+				return nil, err
+			}
+		}
+		flusher.caches = append(flusher.caches, cache)
+	}
+	if len(flusher.caches) == 0 {
+		return nil, fmt.Errorf("--flush-cache: no cache frontend of app/etc/env.php uses Redis")
+	}
+	return flusher, nil
+}
+
+// redisCacheFromEnv reads the connection of a cache frontend from its backend_options
+func redisCacheFromEnv(magentoRoot, frontend string, options interface{}) (RedisCache, error) {
+	cache := RedisCache{Frontend: frontend, Prefix: phpArrayPathString(options, "id_prefix")}
+	if cache.Prefix == "" {
+		// Magento's default: the first characters of the md5 of the app/etc path
+		root := magentoRoot
+		if phpExecRoot != "" {
+			root = phpExecRoot
+		}
+		abs, _ := filepath.Abs(root)
+		sum := md5.Sum([]byte(filepath.Join(abs, "app/etc") + "/"))
+		cache.Prefix = hex.EncodeToString(sum[:])[:3] + "_"
+	}
+
+	server := phpArrayPathString(options, "backend_options", "server")
+	port := phpArrayPathString(options, "backend_options", "port")
+	switch {
+	case strings.HasPrefix(server, "tls://"):
+		return cache, fmt.Errorf("TLS connections to Redis aren't supported")
+	case strings.HasPrefix(server, "/"):
+		cache.Network, cache.Addr = "unix", server
+	default:
+		server = strings.TrimPrefix(server, "tcp://")
+		if server == "" {
+			server = "127.0.0.1"
+		}
+		if port == "" {
+			port = "6379"
+		}
+		cache.Network, cache.Addr = "tcp", net.JoinHostPort(server, port)
+	}
+	cache.Password = phpArrayPathString(options, "backend_options", "password")
+	if database := phpArrayPathString(options, "backend_options", "database"); database != "" {
+		n, err := strconv.Atoi(database)
+		if err != nil {
+			return cache, fmt.Errorf("invalid database '%s'", database)
+		}
+		cache.Database = n
+	}
+	return cache, nil
+}
+
+// Flush removes the entries with any of the tags from every cache, returning how many were
+// removed per frontend; a nil flusher does nothing
+func (f *CacheFlusher) Flush() (map[string]int, error) {
+	if f == nil {
+		return nil, nil
+	}
+	removed := make(map[string]int)
+	for _, cache := range f.caches {
+		n, err := flushRedisTags(cache, f.tags)
+		if err != nil {
+			return removed, fmt.Errorf("cache frontend %s (%s): %w", cache.Frontend, cache.Addr, err)
+		}
+		removed[cache.Frontend] = n
+	}
+	return removed, nil
+}
+
+// flushRedisTags removes the entries with any of the tags the way the Redis backend of
+// Magento (Cm_Cache_Backend_Redis) does: the ids of a tag are in the set zc:ti:<tag>, the
+// entries in the hashes zc:k:<id>, and all tags in the set zc:tags
+func flushRedisTags(cache RedisCache, tags []string) (int, error) {
+	conn, err := dialRedis(cache)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	removed := 0
+	for _, tag := range tags {
+		// Magento uppercases tags and prefixes them like ids
+		tag = cache.Prefix + strings.ToUpper(strings.ReplaceAll(tag, ".", "__"))
+		reply, err := conn.Do("SMEMBERS", "zc:ti:"+tag)
+		if err != nil {
+			return removed, err
+		}
+		ids, _ := reply.([]interface{})
+		for start := 0; start < len(ids); start += 500 {
+			end := min(start+500, len(ids))
+			args := []string{"DEL"}
+			for _, id := range ids[start:end] {
+				if id, ok := id.(string); ok {
+					args = append(args, "zc:k:"+id)
+				}
+			}
+			reply, err := conn.Do(args...)
+			if err != nil {
+				return removed, err
+			}
+			if n, ok := reply.(int64); ok {
+				removed += int(n)
+			}
+		}
+		if _, err := conn.Do("DEL", "zc:ti:"+tag); err != nil {
+			return removed, err
+		}
+		if _, err := conn.Do("SREM", "zc:tags", tag); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// redisConn is a minimal Redis (RESP) connection, enough for flushing cache tags
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialRedis connects to the cache, authenticates and selects its database
+func dialRedis(cache RedisCache) (*redisConn, error) {
+	conn, err := net.DialTimeout(cache.Network, cache.Addr, redisTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if cache.Password != "" {
+		if _, err := c.Do("AUTH", cache.Password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if cache.Database != 0 {
+		if _, err := c.Do("SELECT", strconv.Itoa(cache.Database)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Do sends a command and returns its reply: a string, int64, []interface{} or nil
+func (c *redisConn) Do(args ...string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(redisTimeout))
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, command.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply reads one RESP reply
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply from Redis")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unexpected reply from Redis: %q", line)
+}
+
+// Close closes the connection
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,308 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// invalidateCDN invalidates the objects replaced or deleted by the uploads of --target in
+// CloudFront or Cloudflare (--invalidate-cdn)
+var invalidateCDN bool
+
+// APIs of the CDNs
+const (
+	cloudFrontAPI = "https://cloudfront.amazonaws.com/2020-05-31"
+	cloudflareAPI = "https://api.cloudflare.com/client/v4"
+)
+
+// Limits of invalidations: paths collapse into wildcards above defaultCDNMaxPaths, and
+// CloudFront processes at most 15 wildcard paths at a time; Cloudflare accepts 30 URLs or
+// prefixes per purge request
+const (
+	defaultCDNMaxPaths  = 100
+	maxCDNWildcards     = 15
+	maxCloudflarePurges = 30
+)
+
+// CDNConfig configures --invalidate-cdn (the cdn section of the config file)
+type CDNConfig struct {
+	MaxPaths   int               `yaml:"max_paths" json:"max_paths"` // collapse into wildcards above this (default 100)
+	CloudFront *CloudFrontConfig `yaml:"cloudfront" json:"cloudfront"`
+	Cloudflare *CloudflareConfig `yaml:"cloudflare" json:"cloudflare"`
+}
+
+// CloudFrontConfig configures CloudFront invalidations, signed with the keys of S3 (see
+// S3Config)
+type CloudFrontConfig struct {
+	DistributionID string `yaml:"distribution_id" json:"distribution_id"`
+	PathPrefix     string `yaml:"path_prefix" json:"path_prefix"` // URL path of the uploaded tree (default /static)
+}
+
+// CloudflareConfig configures Cloudflare cache purges; the API token is the cloudflare.token
+// credential
+type CloudflareConfig struct {
+	ZoneID  string `yaml:"zone_id" json:"zone_id"`
+	BaseURL string `yaml:"base_url" json:"base_url"` // URL of the uploaded tree, e.g. https://cdn.example.com/static
+}
+
+// CDNInvalidator invalidates changed objects in CloudFront and Cloudflare
+type CDNInvalidator struct {
+	client          *HTTPClient
+	maxPaths        int
+	cloudFront      *CloudFrontConfig
+	awsKeys         *awsKeySource
+	cloudflare      *CloudflareConfig
+	cloudflareBase  *url.URL
+	cloudflareToken string
+}
+
+// NewCDNInvalidator creates the invalidator when --invalidate-cdn is given, nil otherwise.
+// Like NewPurger, credentials and the HTTP client are resolved up front
+func NewCDNInvalidator(magentoRoot string, cfg *Config, stores []RemoteStore) (*CDNInvalidator, error) {
+	if !invalidateCDN {
+		return nil, nil
+	}
+	if len(stores) == 0 {
+		return nil, fmt.Errorf("--invalidate-cdn: needs an object storage --target")
+	}
+	if cfg.CDN.CloudFront == nil && cfg.CDN.Cloudflare == nil {
+		return nil, fmt.Errorf("--invalidate-cdn: configure cdn.cloudfront or cdn.cloudflare")
+	}
+	client, err := NewHTTPClient(cfg.HTTP)
+	if err != nil {
+		return nil, fmt.Errorf("--invalidate-cdn: %w", err)
+	}
+	c := &CDNInvalidator{client: client, maxPaths: cfg.CDN.MaxPaths}
+	if c.maxPaths <= 0 {
+		c.maxPaths = defaultCDNMaxPaths
+	}
+	credentials := NewCredentials(magentoRoot, cfg)
+
+	if cloudFront := cfg.CDN.CloudFront; cloudFront != nil {
+		if cloudFront.DistributionID == "" {
+			return nil, fmt.Errorf("--invalidate-cdn: cdn.cloudfront.distribution_id is required")
+		}
+		if c.awsKeys, err = awsKeyChain(client, credentials); err != nil {
+			return nil, fmt.Errorf("--invalidate-cdn: %w", err)
+		}
+		c.cloudFront = cloudFront
+	}
+
+	if cloudflare := cfg.CDN.Cloudflare; cloudflare != nil {
+		if cloudflare.ZoneID == "" {
+			return nil, fmt.Errorf("--invalidate-cdn: cdn.cloudflare.zone_id is required")
+		}
+		if c.cloudflareBase, err = url.Parse(strings.TrimSuffix(cloudflare.BaseURL, "/")); err != nil || c.cloudflareBase.Host == "" {
+			return nil, fmt.Errorf("--invalidate-cdn: invalid cdn.cloudflare.base_url %q", cloudflare.BaseURL)
+		}
+		if c.cloudflareToken, err = credentials.Get("cloudflare.token"); err != nil {
+			return nil, fmt.Errorf("--invalidate-cdn: %w", err)
+		}
+		c.cloudflare = cloudflare
+	}
+	return c, nil
+}
+
+// Invalidate invalidates the given object keys, returning a line per CDN for the summary; a
+// nil invalidator or no keys do nothing
+func (c *CDNInvalidator) Invalidate(keys []string) ([]string, error) {
+	if c == nil || len(keys) == 0 {
+		return nil, nil
+	}
+	paths := cdnInvalidationPaths(keys, c.maxPaths)
+	var invalidated []string
+	if c.cloudFront != nil {
+		id, err := c.invalidateCloudFront(paths)
+		if err != nil {
+			return invalidated, fmt.Errorf("CloudFront distribution %s: %w", c.cloudFront.DistributionID, err)
+		}
+		invalidated = append(invalidated, fmt.Sprintf("CloudFront distribution %s (%d path(s), invalidation %s)", c.cloudFront.DistributionID, len(paths), id))
+	}
+	if c.cloudflare != nil {
+		if err := c.purgeCloudflare(paths); err != nil {
+			return invalidated, fmt.Errorf("Cloudflare zone %s: %w", c.cloudflare.ZoneID, err)
+		}
+		invalidated = append(invalidated, fmt.Sprintf("Cloudflare zone %s (%d path(s))", c.cloudflare.ZoneID, len(paths)))
+	}
+	return invalidated, nil
+}
+
+// cdnInvalidationPaths returns the keys to invalidate, or when there are more than maxPaths
+// (or too many wildcards), wildcards of their directories: the locale directories, up to
+// the version prefix, else "*" for everything. Wildcards end in "/*"
+func cdnInvalidationPaths(keys []string, maxPaths int) []string {
+	if len(keys) <= maxPaths {
+		return keys
+	}
+	for depth := 4; depth > 0; depth-- {
+		var paths []string
+		seen := make(map[string]bool)
+		wildcards := 0
+		for _, key := range keys {
+			segments := strings.Split(key, "/")
+			path := key
+			if len(segments) > depth {
+				path = strings.Join(segments[:depth], "/") + "/*"
+			}
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			paths = append(paths, path)
+			if strings.HasSuffix(path, "*") {
+				wildcards++
+			}
+		}
+		if len(paths) <= maxPaths && wildcards <= maxCDNWildcards {
+			return paths
+		}
+	}
+	return []string{"*"}
+}
+
+// escapeCDNPath escapes a URL path, keeping the asterisk of a wildcard
+func escapeCDNPath(path string) string {
+	if prefix, ok := strings.CutSuffix(path, "*"); ok {
+		return (&url.URL{Path: prefix}).EscapedPath() + "*"
+	}
+	return (&url.URL{Path: path}).EscapedPath()
+}
+
+// cloudFrontInvalidationBatch is the body of a CreateInvalidation request
+type cloudFrontInvalidationBatch struct {
+	XMLName         xml.Name `xml:"http://cloudfront.amazonaws.com/doc/2020-05-31/ InvalidationBatch"`
+	CallerReference string   `xml:"CallerReference"`
+	Quantity        int      `xml:"Paths>Quantity"`
+	Items           []string `xml:"Paths>Items>Path"`
+}
+
+// invalidateCloudFront creates an invalidation of the paths below the path prefix and
+// returns its ID; CloudFront completes it in the background
+func (c *CDNInvalidator) invalidateCloudFront(paths []string) (string, error) {
+	prefix := "/"
+	if trimmed := strings.Trim(c.cloudFront.PathPrefix, "/"); trimmed != "" {
+		prefix += trimmed + "/"
+	} else if c.cloudFront.PathPrefix == "" {
+		prefix = "/static/"
+	}
+	batch := cloudFrontInvalidationBatch{
+		CallerReference: fmt.Sprintf("magento2-static-deploy-%d", time.Now().UnixNano()),
+		Quantity:        len(paths),
+	}
+	for _, path := range paths {
+		batch.Items = append(batch.Items, escapeCDNPath(prefix+path))
+	}
+	body, err := xml.Marshal(batch)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := cloudFrontAPI + "/distribution/" + url.PathEscape(c.cloudFront.DistributionID) + "/invalidation"
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	req.Header.Set("User-Agent", "magento2-static-deploy")
+	// CloudFront is a global service, signed for us-east-1
+	keys, err := c.awsKeys.Keys()
+	if err != nil {
+		return "", err
+	}
+	signAWSRequest(req, req.URL.EscapedPath(), body, keys, s3DefaultRegion, "cloudfront", time.Now().UTC())
+
+	// A retry has the same CallerReference, so CloudFront doesn't create a second invalidation
+	resp, err := c.client.DoIdempotent(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusCreated {
+		var response struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(data, &response) == nil && response.Code != "" {
+			return "", fmt.Errorf("%s: %s %s", resp.Status, response.Code, response.Message)
+		}
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var invalidation struct {
+		ID string `xml:"Id"`
+	}
+	xml.Unmarshal(data, &invalidation)
+	return invalidation.ID, nil
+}
+
+// purgeCloudflare purges the URLs of the paths below the base URL, and wildcards by prefix
+func (c *CDNInvalidator) purgeCloudflare(paths []string) error {
+	var files, prefixes []string
+	for _, path := range paths {
+		if prefix, ok := strings.CutSuffix(path, "*"); ok {
+			// Prefixes are matched without the scheme
+			prefixes = append(prefixes, c.cloudflareBase.Host+escapeCDNPath(c.cloudflareBase.Path+"/"+prefix))
+		} else {
+			files = append(files, c.cloudflareBase.Scheme+"://"+c.cloudflareBase.Host+escapeCDNPath(c.cloudflareBase.Path+"/"+path))
+		}
+	}
+	// A request purges either files or prefixes
+	for _, batch := range []struct {
+		field  string
+		values []string
+	}{{"files", files}, {"prefixes", prefixes}} {
+		for start := 0; start < len(batch.values); start += maxCloudflarePurges {
+			end := min(start+maxCloudflarePurges, len(batch.values))
+			if err := c.sendCloudflarePurge(map[string][]string{batch.field: batch.values[start:end]}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sendCloudflarePurge sends a purge_cache request and checks its result
+func (c *CDNInvalidator) sendCloudflarePurge(payload map[string][]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	endpoint := cloudflareAPI + "/zones/" + url.PathEscape(c.cloudflare.ZoneID) + "/purge_cache"
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.cloudflareToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "magento2-static-deploy")
+
+	resp, err := c.client.DoIdempotent(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&result); err != nil && resp.StatusCode < 300 {
+		return fmt.Errorf("unexpected response (%s)", resp.Status)
+	}
+	if !result.Success || resp.StatusCode >= 300 {
+		if len(result.Errors) > 0 {
+			return fmt.Errorf("%s: %d %s", resp.Status, result.Errors[0].Code, result.Errors[0].Message)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package staticdeploy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// checksumsFileName stores the content hashes of deployed files for --compare=checksum,
+// in the manifest format, next to the deployed tree
+const checksumsFileName = ".static-deploy-checksums.json"
+
+// deployChecksums holds the hashes of deployed files with --compare=checksum, nil otherwise
+var deployChecksums *checksumStore
+
+// checksumStore tracks the content hashes of the deployed files of pub/static across runs
+type checksumStore struct {
+	staticRoot string
+	algorithm  string
+	mu         sync.Mutex
+	files      map[string]ManifestFile // keyed by path relative to pub/static
+}
+
+// loadChecksumStore reads the hashes of the previous run; a missing or unusable file
+// (or one written with another algorithm) yields an empty store
+func loadChecksumStore(staticRoot string, algorithm string) *checksumStore {
+	store := &checksumStore{
+		staticRoot: staticRoot,
+		algorithm:  algorithm,
+		files:      make(map[string]ManifestFile),
+	}
+	manifest, err := loadManifest(filepath.Join(staticRoot, checksumsFileName))
+	if err == nil && manifest.Algorithm == algorithm {
+		store.files = manifest.Files
+	}
+	return store
+}
+
+// UpToDate reports whether the regular file dst has the content of src, and records the
+// hash of src as the hash of dst (which it has after an update). The hash of dst is taken
+// from the previous run when its size still matches, else dst is hashed
+func (s *checksumStore) UpToDate(src string, dst string, dstInfo os.FileInfo) (bool, error) {
+	srcHash, err := hashFile(src, s.algorithm)
+	if err != nil {
+		return false, err
+	}
+
+	key := s.key(dst)
+	s.mu.Lock()
+	stored, ok := s.files[key]
+	s.mu.Unlock()
+
+	upToDate := false
+	if dstInfo != nil && dstInfo.Mode().IsRegular() {
+		dstHash := stored.Hash
+		if !ok || stored.Link != "" || stored.Size != dstInfo.Size() {
+			dstHash, _ = hashFile(dst, s.algorithm)
+		}
+		upToDate = dstHash == srcHash
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	s.files[key] = ManifestFile{Size: info.Size(), Hash: srcHash}
+	s.mu.Unlock()
+	return upToDate, nil
+}
+
+// Forget removes the hash of dst, e.g. when it's deployed as symlink
+func (s *checksumStore) Forget(dst string) {
+	s.mu.Lock()
+	delete(s.files, s.key(dst))
+	s.mu.Unlock()
+}
+
+// key returns the store key of a deployed path
+func (s *checksumStore) key(dst string) string {
+	relPath, _ := filepath.Rel(s.staticRoot, dst)
+	return filepath.ToSlash(relPath)
+}
+
+// Save writes the hashes for the next run, dropping files that no longer exist
+func (s *checksumStore) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.files {
+		if _, err := os.Lstat(filepath.Join(s.staticRoot, filepath.FromSlash(key))); err != nil {
+			delete(s.files, key)
+		}
+	}
+
+	data, err := json.MarshalIndent(&Manifest{
+		Format:    manifestFormat,
+		Algorithm: s.algorithm,
+		Generated: time.Now().UTC(),
+		Files:     s.files,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.staticRoot, checksumsFileName), data, 0644)
+}
@@ -0,0 +1,237 @@
+package staticdeploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// generatedLocaleFiles are created in locale directories by Magento rather than copied from
+// a source, so clean keeps them
+var generatedLocaleFiles = map[string]bool{
+	"js-translation.json":       true,
+	"requirejs-config.js":       true,
+	"requirejs-min-resolver.js": true,
+	"requirejs-map.js":          true,
+	"sri-hashes.json":           true,
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "clean",
+		Description: "Delete deployed files that no longer have a source",
+		Run:         runClean,
+	})
+}
+
+// errUnreadableSources is returned when sources of a locale couldn't be read: their deployed
+// files can't be told from stale ones, so nothing of the locale may be deleted
+var errUnreadableSources = errors.New("unreadable sources, its deployed files can't be told from stale ones")
+
+// runClean implements the clean subcommand
+func runClean(args []string) error {
+	flags := flag.NewFlagSet("clean", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory")
+	configPath := flags.StringP("config", "c", "", "Path to config file")
+	dryRun := flags.Bool("dry-run", false, "Only list the files that would be deleted")
+	verbose := flags.BoolP("verbose", "v", false, "List every deleted file")
+	exclude := flags.StringArray("exclude", nil, "Patterns excluded from the deploy with --exclude, their files aren't expected either")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s clean [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Compares every deployed Hyvä theme locale in pub/static with what the current sources\n")
+		fmt.Fprintf(os.Stderr, "would deploy and deletes the files that no longer have a source\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*root, *configPath)
+	if err != nil {
+		return err
+	}
+	excludes := runExcludePatterns(cfg, *exclude)
+	localeAliases = cfg.LocaleAliases
+	if err := validateThemeSources(*root, cfg.ThemeSources); err != nil {
+		return err
+	}
+	themeSources = cfg.ThemeSources
+	if copyFilters, err = openCopyFilters(cfg.CopyFilters); err != nil {
+		return err
+	}
+
+	staticRoot := currentDeployRoot(*root)
+	localeDirs, _ := filepath.Glob(filepath.Join(staticRoot, "*", "*", "*", "*"))
+	index := loadVendorIndex(*root, 0, true)
+	// Files of unreadable packages would all look stale
+	if vendorScanErrors.Report(*verbose) {
+		return fmt.Errorf("refusing to clean while vendor paths are unreadable, fix their ownership first")
+	}
+
+	var total int
+	for _, localeDir := range localeDirs {
+		relPath, _ := filepath.Rel(staticRoot, localeDir)
+		parts := strings.Split(filepath.ToSlash(relPath), "/")
+		job := DeployJob{Area: parts[0], Theme: parts[1] + "/" + parts[2], Locale: parts[3]}
+
+		// Only real locale directories (not --symlink=locale links) of existing Hyvä themes;
+		// Luma themes are deployed by bin/magento
+		if info, err := os.Lstat(localeDir); err != nil || !info.IsDir() || strings.HasPrefix(job.Area, "_") || strings.HasPrefix(job.Area, "version") {
+			continue
+		}
+		if !themeExists(*root, job.Area, job.Theme) {
+			fmt.Printf("%s %s/%s (%s): theme no longer exists, remove %s to clean it\n", symSkip, job.Theme, job.Area, job.Locale, localeDir)
+			continue
+		}
+		if !isHyvaTheme(*root, job.Area, job.Theme, make(map[string]bool)) {
+			continue
+		}
+
+		stale, err := staleThemeFiles(*root, job, localeDir, index, excludes)
+		if errors.Is(err, errUnreadableSources) {
+			fmt.Printf("%s %s/%s (%s): skipped, %v\n", symSkip, job.Theme, job.Area, job.Locale, err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s/%s (%s): %w", job.Theme, job.Area, job.Locale, err)
+		}
+		for _, path := range stale {
+			if *dryRun || *verbose {
+				prefix := "Deleted"
+				if *dryRun {
+					prefix = "Would delete"
+				}
+				fmt.Printf("%s %s\n", prefix, path)
+			}
+			if !*dryRun {
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+			}
+		}
+		if !*dryRun {
+			removeEmptyDirs(localeDir)
+		}
+		if len(stale) > 0 {
+			fmt.Printf("%s %s/%s (%s): %d stale file(s)\n", symOK, job.Theme, job.Area, job.Locale, len(stale))
+		}
+		total += len(stale)
+	}
+
+	if *dryRun {
+		fmt.Printf("%d stale file(s) would be deleted\n", total)
+	} else {
+		fmt.Printf("%d stale file(s) deleted\n", total)
+	}
+	return nil
+}
+
+// staleThemeFiles returns the files in the locale directory of a job that the current sources
+// wouldn't deploy, except compiled CSS and files generated by Magento
+func staleThemeFiles(magentoRoot string, job DeployJob, localeDir string, index *VendorIndex, excludes []string) ([]string, error) {
+	expected, err := plannedThemeFiles(magentoRoot, job, localeDir, index, excludes)
+	if err != nil {
+		return nil, err
+	}
+	for _, entryPoint := range findCSSEntryPoints(magentoRoot, job.Area, job.Theme) {
+		expected[filepath.Join(localeDir, strings.TrimSuffix(entryPoint, ".less")+".css")] = true
+	}
+
+	deployed := func(path string) bool {
+		relPath, _ := filepath.Rel(localeDir, path)
+		return expected[path] || generatedLocaleFiles[filepath.ToSlash(relPath)]
+	}
+
+	var stale []string
+	err = filepath.Walk(localeDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		// The --precompress copies of deployed files aren't stale either
+		if deployed(path) || isPrecompressedCopy(path, deployed) {
+			return nil
+		}
+		stale = append(stale, path)
+		return nil
+	})
+	sort.Strings(stale)
+	return stale, err
+}
+
+// plannedThemeFiles returns the destination paths a deploy of job would write, without copying
+func plannedThemeFiles(magentoRoot string, job DeployJob, destDir string, index *VendorIndex, excludes []string) (map[string]bool, error) {
+	unreadable := vendorScanErrors.Count()
+	copier := newFileCopier(context.Background(), nil, false, job)
+	copier.dryRun = true
+	copier.excludes = excludes
+	if _, err := queueThemeFiles(magentoRoot, job, destDir, copier, index); err != nil {
+		return nil, err
+	}
+	// A failing copy filter leaves files out of the plan, they mustn't be deleted as stale
+	if err := copier.Wait(magentoRoot); err != nil {
+		return nil, err
+	}
+	// Likewise for sources skipped as unreadable
+	if len(copier.unreadable) > 0 || vendorScanErrors.Count() > unreadable {
+		return nil, errUnreadableSources
+	}
+	return copier.planned, nil
+}
+
+// removeEmptyDirs removes the empty directories below root (not root itself)
+func removeEmptyDirs(root string) {
+	var dirs []string
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	// Deepest first, so parents of removed directories can be removed too
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+}
+
+// pruneResults deletes the stale files of the successfully deployed (not symlinked) locales
+// of results, returning the number of deleted files. Nothing is pruned when the deploy
+// skipped unreadable vendor paths, and locales with unreadable sources are skipped
+func pruneResults(magentoRoot string, results []DeployResult, excludes []string) (int, error) {
+	if !vendorScanErrors.Empty() {
+		logWarnf("Not pruning stale files: unreadable vendor paths were skipped, their deployed files would look stale")
+		return 0, nil
+	}
+	index := loadVendorIndex(magentoRoot, scanJobsFlag, !noCache)
+
+	var pruned int
+	for _, result := range results {
+		if result.Error != "" || result.Symlinked || result.FilesCount == 0 {
+			continue
+		}
+		job := result.Job
+		localeDir := filepath.Join(currentDeployRoot(magentoRoot), job.Area, job.Theme, job.Locale)
+		stale, err := staleThemeFiles(magentoRoot, job, localeDir, index, excludes)
+		if errors.Is(err, errUnreadableSources) {
+			logWarnf("Not pruning %s/%s (%s): %v", job.Theme, job.Area, job.Locale, err)
+			continue
+		}
+		if err != nil {
+			return pruned, err
+		}
+		for _, path := range stale {
+			if err := os.Remove(path); err != nil {
+				return pruned, err
+			}
+			pruned++
+		}
+		removeEmptyDirs(localeDir)
+	}
+	return pruned, nil
+}
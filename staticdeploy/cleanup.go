@@ -0,0 +1,203 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// tempArtifactPrefix starts the names of the temporary files written next to their final
+// location (atomic replacements in pub/static, var/ and the progress file)
+const tempArtifactPrefix = ".static-deploy-tmp-"
+
+// rootTempPatterns are the temporary files and directories created in the Magento root,
+// where a containerized PHP can read them
+var rootTempPatterns = []string{".less-compile-*.php", ".less-staging-*", ".less-output-*", tempArtifactPrefix + "*"}
+
+// tempArtifacts holds the temporary files and directories of the running process, removed
+// when they're no longer needed or when the process is interrupted
+var tempArtifacts = &cleanupRegistry{paths: make(map[string]bool)}
+
+// cleanupRegistry tracks temporary paths until they are removed or moved into place
+type cleanupRegistry struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+// Track registers a temporary path
+func (r *cleanupRegistry) Track(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paths[path] = true
+}
+
+// Untrack unregisters a path that was moved to its final location
+func (r *cleanupRegistry) Untrack(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.paths, path)
+}
+
+// Remove deletes a temporary path (recursively) and unregisters it
+func (r *cleanupRegistry) Remove(path string) error {
+	r.Untrack(path)
+	return os.RemoveAll(path)
+}
+
+// RemoveAll deletes all registered paths, returning the number removed
+func (r *cleanupRegistry) RemoveAll() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed := 0
+	for path := range r.paths {
+		if os.RemoveAll(path) == nil {
+			removed++
+		}
+		delete(r.paths, path)
+	}
+	return removed
+}
+
+// createTempFile creates a registered temporary file, see os.CreateTemp
+func createTempFile(dir string, pattern string) (*os.File, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err == nil {
+		tempArtifacts.Track(f.Name())
+	}
+	return f, err
+}
+
+// makeTempDir creates a registered temporary directory, see os.MkdirTemp
+func makeTempDir(dir string, pattern string) (string, error) {
+	path, err := os.MkdirTemp(dir, pattern)
+	if err == nil {
+		tempArtifacts.Track(path)
+	}
+	return path, err
+}
+
+// writeFileAtomic writes data to path through a temporary file renamed over it, so readers
+// and crashes never leave a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := createTempFile(filepath.Dir(path), tempArtifactPrefix+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer tempArtifacts.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "cleanup",
+		Description: "Remove temporary files left behind by interrupted or crashed runs",
+		Run:         runCleanup,
+	})
+}
+
+// runCleanup implements the cleanup subcommand
+func runCleanup(args []string) error {
+	flags := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory")
+	minAge := flags.Duration("min-age", time.Hour, "Only remove leftovers older than this, so running deploys keep theirs")
+	dryRun := flags.Bool("dry-run", false, "Only list the leftovers that would be removed")
+	verbose := flags.BoolP("verbose", "v", false, "List every removed leftover")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s cleanup [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Removes LESS compile scripts, staging directories and partially written files of\n")
+		fmt.Fprintf(os.Stderr, "runs that didn't finish from the Magento root, pub/static and var/\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	leftovers, err := findTempLeftovers(*root, time.Now().Add(-*minAge))
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for _, path := range leftovers {
+		if *dryRun || *verbose {
+			fmt.Println(path)
+		}
+		if *dryRun {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			logWarnf("failed to remove %s: %v", path, err)
+			continue
+		}
+		removed++
+	}
+
+	if *dryRun {
+		fmt.Printf("%d leftover(s) would be removed\n", len(leftovers))
+	} else {
+		fmt.Printf("Removed %d leftover(s)\n", removed)
+	}
+	return nil
+}
+
+// findTempLeftovers lists the temporary artifacts in the Magento root, pub/static and var/
+// last modified before cutoff
+func findTempLeftovers(magentoRoot string, cutoff time.Time) ([]string, error) {
+	var leftovers []string
+	add := func(path string) {
+		if info, err := os.Lstat(path); err == nil && info.ModTime().Before(cutoff) {
+			leftovers = append(leftovers, path)
+		}
+	}
+
+	for _, pattern := range rootTempPatterns {
+		matches, err := filepath.Glob(filepath.Join(magentoRoot, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range matches {
+			add(path)
+		}
+	}
+
+	for _, dir := range []string{"pub/static", "var"} {
+		err := filepath.WalkDir(filepath.Join(magentoRoot, dir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) || os.IsPermission(err) {
+					return nil
+				}
+				return err
+			}
+			if strings.HasPrefix(d.Name(), tempArtifactPrefix) {
+				add(path)
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return leftovers, nil
+}
@@ -0,0 +1,325 @@
+package staticdeploy
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metadataTimeout bounds requests to the metadata endpoints of cloud VMs, which don't exist
+// elsewhere
+const metadataTimeout = 5 * time.Second
+
+// tokenRefreshMargin renews access tokens this long before they expire
+const tokenRefreshMargin = 2 * time.Minute
+
+// tokenSource returns an OAuth access token, fetching a new one when the cached one expires
+type tokenSource struct {
+	name    string // where tokens come from, for messages
+	fetch   func() (string, time.Duration, error)
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Token returns a valid access token
+func (t *tokenSource) Token() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+	token, expiresIn, err := t.fetch()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", t.name, err)
+	}
+	t.token, t.expires = token, time.Now().Add(expiresIn-tokenRefreshMargin)
+	return token, nil
+}
+
+// staticTokenSource returns a token that doesn't expire, e.g. one given as a credential
+func staticTokenSource(name string, token string) *tokenSource {
+	return &tokenSource{name: name, fetch: func() (string, time.Duration, error) {
+		return token, 100 * 365 * 24 * time.Hour, nil
+	}}
+}
+
+// httpDoer sends requests: the shared HTTPClient, or a plain client for metadata endpoints
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// tokenResponse is the response of OAuth token endpoints
+type tokenResponse struct {
+	AccessToken string          `json:"access_token"`
+	ExpiresIn   json.RawMessage `json:"expires_in"` // a number, or a string at Azure's managed identity endpoint
+	Error       string          `json:"error"`
+	Description string          `json:"error_description"`
+}
+
+// requestToken sends a token request and returns the access token and its lifetime
+func requestToken(client httpDoer, req *http.Request) (string, time.Duration, error) {
+	// Token requests have no side effects, so the shared client retries their POSTs too
+	do := client.Do
+	if shared, ok := client.(*HTTPClient); ok {
+		do = shared.DoIdempotent
+	}
+	resp, err := do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return "", 0, err
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", 0, fmt.Errorf("unexpected token response (%s)", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		if token.Error != "" {
+			return "", 0, fmt.Errorf("%s: %s %s", resp.Status, token.Error, token.Description)
+		}
+		return "", 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var seconds int64
+	if err := json.Unmarshal(token.ExpiresIn, &seconds); err != nil {
+		var text string
+		json.Unmarshal(token.ExpiresIn, &text)
+		fmt.Sscan(text, &seconds)
+	}
+	if seconds <= 0 {
+		seconds = 3600
+	}
+	return token.AccessToken, time.Duration(seconds) * time.Second, nil
+}
+
+// postForm creates a form POST request
+func postForm(endpoint string, form url.Values) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// googleCredentialsFile is a service account key or the application default credentials of
+// gcloud auth application-default login
+type googleCredentialsFile struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// googleTokenSource finds Google credentials like the Google Cloud client libraries do: the key
+// file of GOOGLE_APPLICATION_CREDENTIALS, the application default credentials of gcloud, else
+// the metadata server of Compute Engine, GKE and Cloud Run
+func googleTokenSource(client httpDoer, scope string) (*tokenSource, error) {
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			wellKnown := filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+			if runtime.GOOS == "windows" {
+				wellKnown = filepath.Join(os.Getenv("APPDATA"), "gcloud", "application_default_credentials.json")
+			}
+			if _, err := os.Stat(wellKnown); err == nil {
+				path = wellKnown
+			}
+		}
+	}
+	if path == "" {
+		return &tokenSource{name: "GCE metadata server", fetch: func() (string, time.Duration, error) {
+			req, err := http.NewRequest(http.MethodGet, "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token?scopes="+url.QueryEscape(scope), nil)
+			if err != nil {
+				return "", 0, err
+			}
+			req.Header.Set("Metadata-Flavor", "Google")
+			return requestToken(&http.Client{Timeout: metadataTimeout}, req)
+		}}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Google credentials: %w", err)
+	}
+	var file googleCredentialsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("Google credentials %s: %w", path, err)
+	}
+
+	switch file.Type {
+	case "service_account":
+		key, err := parseRSAPrivateKey(file.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("Google credentials %s: %w", path, err)
+		}
+		if file.TokenURI == "" {
+			file.TokenURI = "https://oauth2.googleapis.com/token"
+		}
+		return &tokenSource{name: "service account " + file.ClientEmail, fetch: func() (string, time.Duration, error) {
+			assertion, err := signGoogleJWT(key, file.ClientEmail, scope, file.TokenURI, time.Now())
+			if err != nil {
+				return "", 0, err
+			}
+			req, err := postForm(file.TokenURI, url.Values{
+				"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+				"assertion":  {assertion},
+			})
+			if err != nil {
+				return "", 0, err
+			}
+			return requestToken(client, req)
+		}}, nil
+	case "authorized_user":
+		return &tokenSource{name: "application default credentials", fetch: func() (string, time.Duration, error) {
+			req, err := postForm("https://oauth2.googleapis.com/token", url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {file.ClientID},
+				"client_secret": {file.ClientSecret},
+				"refresh_token": {file.RefreshToken},
+			})
+			if err != nil {
+				return "", 0, err
+			}
+			return requestToken(client, req)
+		}}, nil
+	default:
+		return nil, fmt.Errorf("Google credentials %s: unsupported type %q", path, file.Type)
+	}
+}
+
+// signGoogleJWT creates the signed assertion a service account exchanges for an access token
+func signGoogleJWT(key *rsa.PrivateKey, email string, scope string, audience string, now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iss":   email,
+		"scope": scope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseRSAPrivateKey parses a PEM encoded PKCS#8 or PKCS#1 RSA key
+func parseRSAPrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA private key")
+	}
+	return key, nil
+}
+
+// azureTokenSource finds Azure AD credentials like the Azure SDKs' environment and managed
+// identity credentials: a service principal from AZURE_TENANT_ID, AZURE_CLIENT_ID and
+// AZURE_CLIENT_SECRET, else the managed identity of the VM, App Service or AKS pod
+func azureTokenSource(client httpDoer, resource string) *tokenSource {
+	tenant, clientID, secret := os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_CLIENT_SECRET")
+	if tenant != "" && clientID != "" && secret != "" {
+		return &tokenSource{name: "service principal " + clientID, fetch: func() (string, time.Duration, error) {
+			req, err := postForm("https://login.microsoftonline.com/"+url.PathEscape(tenant)+"/oauth2/v2.0/token", url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {clientID},
+				"client_secret": {secret},
+				"scope":         {resource + "/.default"},
+			})
+			if err != nil {
+				return "", 0, err
+			}
+			return requestToken(client, req)
+		}}
+	}
+
+	return &tokenSource{name: "managed identity", fetch: func() (string, time.Duration, error) {
+		query := url.Values{"api-version": {"2018-02-01"}, "resource": {resource}}
+		if clientID != "" {
+			query.Set("client_id", clientID)
+		}
+		endpoint := "http://169.254.169.254/metadata/identity/oauth2/token"
+		header := "Metadata"
+		// App Service and Functions have their own endpoint
+		if identityEndpoint := os.Getenv("IDENTITY_ENDPOINT"); identityEndpoint != "" {
+			endpoint, header = identityEndpoint, "X-IDENTITY-HEADER"
+			query.Set("api-version", "2019-08-01")
+		}
+		req, err := http.NewRequest(http.MethodGet, endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return "", 0, err
+		}
+		if header == "Metadata" {
+			req.Header.Set("Metadata", "true")
+		} else {
+			req.Header.Set(header, os.Getenv("IDENTITY_HEADER"))
+		}
+		return requestToken(&http.Client{Timeout: metadataTimeout}, req)
+	}}
+}
+
+// fileMD5 returns the hex encoded MD5 of a file, the fingerprint of GCS and Azure objects
+func fileMD5(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// base64ToHex converts a base64 MD5, as GCS and Azure list them, to hex
+func base64ToHex(value string) string {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(data)
+}
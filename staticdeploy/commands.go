@@ -0,0 +1,61 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Command is a subcommand of the CLI, e.g. "export"
+// Running the binary without a subcommand deploys (Magento-compatible CLI)
+type Command struct {
+	Name        string
+	Description string
+	Run         func(args []string) error
+}
+
+// commands holds the registered subcommands by name
+var commands = make(map[string]Command)
+
+// registerCommand makes a subcommand available on the command line
+func registerCommand(cmd Command) {
+	commands[cmd.Name] = cmd
+}
+
+// runCommand runs the subcommand named by the first argument, if any
+// Returns false when the arguments don't start with a subcommand
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return false
+	}
+
+	if err := cmd.Run(args[1:]); err != nil {
+		logErrorf("%v", err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// printCommands lists the registered subcommands for usage output
+func printCommands() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-*s  %s\n", width, name, commands[name].Description)
+	}
+	fmt.Fprintf(os.Stderr, "\n")
+}
@@ -0,0 +1,190 @@
+package staticdeploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are looked up in the Magento root when --config isn't given
+var configFileNames = []string{"static-deploy.yaml", "static-deploy.yml", "static-deploy.json"}
+
+// Config represents the optional static-deploy configuration file
+type Config struct {
+	// LocaleGroups defines named locale sets usable as --language values, e.g. eu: [de_DE, fr_FR]
+	LocaleGroups map[string][]string `yaml:"locale_groups" json:"locale_groups"`
+
+	// LocaleAliases maps custom locale codes to a base locale for their locale specific files,
+	// e.g. de_CH_custom: de_CH
+	LocaleAliases map[string]string `yaml:"locale_aliases" json:"locale_aliases"`
+
+	// ThemeBuilds defines build commands per theme, e.g. Vendor/Hyva: {command: npm run build, dir: web/tailwind}
+	ThemeBuilds map[string]ThemeBuild `yaml:"theme_builds" json:"theme_builds"`
+
+	// ThemeBuildHooks also runs the build hooks themes declare themselves, in their
+	// composer.json or package.json; off by default, as they are third-party code for vendor themes
+	ThemeBuildHooks bool `yaml:"theme_build_hooks" json:"theme_build_hooks"`
+
+	// ThemeSources declares additional static source directories per theme with their priority,
+	// e.g. Vendor/Hyva: [{path: vendor/acme/design-system/dist, priority: 250}]
+	ThemeSources map[string][]ThemeSource `yaml:"theme_sources" json:"theme_sources"`
+
+	// CopyFilters are gRPC services or Go plugins deciding per file whether and where it's
+	// deployed, applied in order (see CopyFilterConfig)
+	CopyFilters []CopyFilterConfig `yaml:"copy_filters" json:"copy_filters"`
+
+	// Phases orders the deployment, e.g. the critical theme first, then adminhtml (see PhaseConfig)
+	Phases []PhaseConfig `yaml:"phases" json:"phases"`
+
+	// Exclude lists additional patterns of files not to deploy (see runExcludePatterns)
+	Exclude []string `yaml:"exclude" json:"exclude"`
+
+	// HTTP configures the outbound HTTP client of all remote integrations
+	HTTP HTTPConfig `yaml:"http" json:"http"`
+
+	// Credentials defines the sources of named secrets used by remote integrations
+	Credentials map[string]CredentialSource `yaml:"credentials" json:"credentials"`
+
+	// Hash is the hash algorithm of manifests and change detection: xxhash64 (default), sha256 or blake3
+	Hash string `yaml:"hash" json:"hash"`
+
+	// Remote configures the remote (object storage) target and its retention
+	Remote RemoteConfig `yaml:"remote" json:"remote"`
+
+	// Backup configures the retention of --backup backups
+	Backup BackupConfig `yaml:"backup" json:"backup"`
+
+	// Slack configures the message posted with --slack
+	Slack SlackConfig `yaml:"slack" json:"slack"`
+
+	// CacheFlush configures the Redis cache tags flushed with --flush-cache
+	CacheFlush CacheFlushConfig `yaml:"cache_flush" json:"cache_flush"`
+
+	// Purge configures the Varnish hosts and the Fastly service purged with --purge
+	Purge PurgeConfig `yaml:"purge" json:"purge"`
+
+	// CDN configures the CloudFront distribution and Cloudflare zone invalidated with
+	// --invalidate-cdn
+	CDN CDNConfig `yaml:"cdn" json:"cdn"`
+
+	// MagentoCommands are bin/magento calls run before or after the deployment, e.g.
+	// [{command: maintenance:enable, when: before}, {command: maintenance:disable, when: always}]
+	MagentoCommands []MagentoCommand `yaml:"magento_commands" json:"magento_commands"`
+
+	// Hooks are shell commands run before and after the deployment and every job (see Hooks)
+	Hooks Hooks `yaml:"hooks" json:"hooks"`
+
+	// Options sets deploy options by their flag name, e.g. area: [frontend, adminhtml], jobs: 8
+	// or language: [nl_NL, en_US]; options given on the command line take precedence
+	Options map[string]any `yaml:"options" json:"options"`
+
+	// Environments override the settings above per environment selected with --env, e.g.
+	// production: {options: {compare: checksum}}; maps are merged, other values replaced
+	Environments map[string]any `yaml:"environments" json:"environments"`
+}
+
+// configEnvironment is the section of environments merged over the config file (--env,
+// STATIC_DEPLOY_ENV); also applies to the commands, which don't take --env
+var configEnvironment = os.Getenv("STATIC_DEPLOY_ENV")
+
+// configOnlyFlags can't be set in options, they're needed to find and read the config file
+var configOnlyFlags = map[string]bool{"root": true, "config": true, "env": true}
+
+// loadConfig reads the configuration file at path, or the first default config file found
+// in the Magento root when path is empty. A missing default file yields an empty config
+func loadConfig(magentoRoot string, path string) (*Config, error) {
+	if path == "" {
+		for _, name := range configFileNames {
+			candidate := filepath.Join(magentoRoot, name)
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return &Config{}, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg := &Config{}
+	if strings.HasSuffix(path, ".json") {
+		err = json.Unmarshal(data, cfg)
+	} else {
+		err = yaml.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if configEnvironment != "" {
+		if err := cfg.applyEnvironment(configEnvironment); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
+
+// applyEnvironment merges the section of an environment over the config
+func (cfg *Config) applyEnvironment(name string) error {
+	overrides, ok := cfg.Environments[name]
+	if !ok {
+		names := make([]string, 0, len(cfg.Environments))
+		for n := range cfg.Environments {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown environment '%s' (available: %v)", name, names)
+	}
+	// Decoding the section into the config replaces its values and merges its maps
+	data, err := yaml.Marshal(overrides)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("environment %s: %w", name, err)
+	}
+	return nil
+}
+
+// applyConfigOptions sets the deploy flags of the options in the config file that weren't
+// given on the command line; list values set repeatable flags once per item
+func applyConfigOptions(options map[string]any) error {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := flag.CommandLine.Lookup(name)
+		if f == nil || configOnlyFlags[name] {
+			return fmt.Errorf("unknown option '%s' in the config file", name)
+		}
+		// Languages given as arguments replace those of the config file too
+		if f.Changed || (name == "language" && flag.NArg() > 0) {
+			continue
+		}
+
+		values := []any{options[name]}
+		if list, ok := options[name].([]any); ok {
+			values = list
+		}
+		for _, value := range values {
+			if err := flag.CommandLine.Set(name, fmt.Sprint(value)); err != nil {
+				return fmt.Errorf("option %s in the config file: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
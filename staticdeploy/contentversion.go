@@ -0,0 +1,105 @@
+package staticdeploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Alternative sources of the content version, for orchestrators allocating one version for
+// all nodes of a rollout (--content-version-file, --content-version-url)
+var (
+	contentVersionFile string
+	contentVersionURL  string
+)
+
+// contentVersionPattern matches the versions Magento accepts in static URLs (version{N}/)
+var contentVersionPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// maxContentVersionResponse caps the response read from --content-version-url
+const maxContentVersionResponse = 4096
+
+// resolveContentVersion returns the content version of the run: --content-version, read from
+// a file or URL, or the current timestamp. Hyvä and Luma themes share it, so every report,
+// the manifest and deployed_version.txt carry the same version
+func resolveContentVersion(explicit string, file string, url string, httpCfg HTTPConfig) (string, error) {
+	given := 0
+	for _, source := range []string{explicit, file, url} {
+		if source != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return "", fmt.Errorf("--content-version, --content-version-file and --content-version-url are mutually exclusive")
+	}
+
+	version := explicit
+	switch {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read content version: %w", err)
+		}
+		version = strings.TrimSpace(string(data))
+	case url != "":
+		var err error
+		if version, err = fetchContentVersion(url, httpCfg); err != nil {
+			return "", fmt.Errorf("failed to fetch content version from %s: %w", url, err)
+		}
+	case version == "":
+		return fmt.Sprintf("%d", time.Now().Unix()), nil
+	}
+
+	if !contentVersionPattern.MatchString(version) {
+		return "", fmt.Errorf("invalid content version %q: only letters, digits, '_', '.' and '-' are allowed", version)
+	}
+	return version, nil
+}
+
+// fetchContentVersion gets the content version from an HTTP endpoint, either as the plain
+// text body or as the "version" field of a JSON object
+func fetchContentVersion(url string, httpCfg HTTPConfig) (string, error) {
+	client, err := NewHTTPClient(httpCfg)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json, text/plain")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxContentVersionResponse))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	text := strings.TrimSpace(string(body))
+	if strings.HasPrefix(text, "{") {
+		var response struct {
+			Version json.RawMessage `json:"version"`
+		}
+		if err := json.Unmarshal([]byte(text), &response); err != nil {
+			return "", fmt.Errorf("invalid JSON response: %w", err)
+		}
+		if len(response.Version) == 0 {
+			return "", fmt.Errorf("JSON response has no \"version\" field")
+		}
+		// Accept numbers as well as strings
+		text = strings.Trim(string(response.Version), `"`)
+	}
+	return text, nil
+}
@@ -0,0 +1,411 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// imageExtensions are the files handled by --images; SVG is left out as it's often used as
+// inline icon or font source by code assets
+var imageExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".avif": true,
+	".bmp": true, ".tif": true, ".tiff": true,
+}
+
+// isImageFile reports whether path is a raster image
+func isImageFile(path string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// filePool runs file copies of all jobs on a shared set of workers, so a single
+// theme/locale job still uses all workers
+type filePool struct {
+	tasks     chan func()
+	wg        sync.WaitGroup
+	mu        sync.RWMutex  // held for reading by Submit, so Close never closes tasks under it
+	closed    chan struct{} // closed by Close, refusing further tasks
+	abandoned atomic.Bool   // workers may be stuck, see Abandon
+}
+
+// errFilePoolClosed is the error of files queued after the copies of the run ended, e.g. by a
+// job that kept walking its sources after it timed out
+var errFilePoolClosed = errors.New("file copies already ended")
+
+// newFilePool starts a pool of workers file copy workers
+func newFilePool(workers int) *filePool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &filePool{tasks: make(chan func(), workers*4), closed: make(chan struct{})}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+	return p
+}
+
+// Submit queues a task of the job of ctx, returning false when it's refused: after Close, or
+// once ctx is done, e.g. for the job abandoned by a timeout. A full queue is waited for until
+// then. On a nil pool the task runs immediately
+func (p *filePool) Submit(ctx context.Context, task func()) bool {
+	if p == nil {
+		task()
+		return true
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	select {
+	case <-p.closed:
+		return false
+	case <-ctx.Done():
+		return false
+	default:
+	}
+	select {
+	case p.tasks <- task:
+		return true
+	case <-p.closed:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Abandon makes Close return without waiting for the workers, after a job timed out on a
+// copy that may never return. The job's tasks are refused from then on, as its context is
+// done; the other jobs keep using the workers that aren't stuck
+func (p *filePool) Abandon() {
+	if p != nil {
+		p.abandoned.Store(true)
+	}
+}
+
+// Close refuses further tasks and stops the workers after the queued tasks are done, unless
+// the pool was abandoned
+func (p *filePool) Close() {
+	if p == nil {
+		return
+	}
+	// Submit calls waiting for room in the queue return first
+	close(p.closed)
+	p.mu.Lock()
+	close(p.tasks)
+	p.mu.Unlock()
+	if !p.abandoned.Load() {
+		p.wg.Wait()
+	}
+}
+
+// fileCopier places the files of one job through a filePool
+// Destinations are claimed while walking the sources, so the first source of a path
+// (child theme before parent, theme before module) wins regardless of copy order
+// Files already deployed are only replaced when their source changed (see upToDate)
+type fileCopier struct {
+	ctx        context.Context // canceled when the run is interrupted, see Place
+	pool       *filePool
+	useSymlink bool
+	force      bool            // replace up to date files too (--force)
+	job        DeployJob       // for copy filters
+	locales    []string        // job locale and its fallbacks, for i18n/{locale}/ files
+	dryRun     bool            // only record destinations in planned, see plannedThemeFiles
+	since      map[string]bool // sources changed since the --since ref, see Unchanged
+	excludes   []string        // patterns of files not deployed, see runExcludePatterns
+	wg         sync.WaitGroup
+
+	mu          sync.Mutex
+	claimed     map[string]bool
+	planned     map[string]bool
+	interrupted bool
+	unreadable  []string
+	errs        []error
+}
+
+// newFileCopier creates the copier of a job; pool may be nil to copy synchronously
+func newFileCopier(ctx context.Context, pool *filePool, useSymlink bool, job DeployJob) *fileCopier {
+	return &fileCopier{
+		ctx:        ctx,
+		pool:       pool,
+		useSymlink: useSymlink,
+		force:      forceFlag,
+		job:        job,
+		locales:    localeFallbacks(job.Locale),
+		claimed:    make(map[string]bool),
+		planned:    make(map[string]bool),
+	}
+}
+
+// Claim reserves dst for this job, returning false if it was claimed before
+func (c *fileCopier) Claim(dst string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.claimed[dst] {
+		return false
+	}
+	c.claimed[dst] = true
+	return true
+}
+
+// Place queues copying or symlinking src (with file info srcInfo) to a claimed dst
+// Up to date destinations are left alone; others are replaced atomically
+// Once the run is interrupted, copies that haven't started are dropped and the job fails
+func (c *fileCopier) Place(src string, srcInfo os.FileInfo, dst string) {
+	if c.dryRun {
+		c.plan(dst)
+		return
+	}
+	if c.Stopped() {
+		return
+	}
+	deploySources.Record(dst, src)
+	c.submit(func() {
+		if c.Stopped() {
+			return
+		}
+
+		useSymlink := c.useSymlink || (imagesMode == "symlink" && isImageFile(src))
+		err := updateFile(src, srcInfo, dst, useSymlink, c.force)
+		for retry := 1; err != nil && retry <= fileRetries && !isUnreadableSource(err, src); retry++ {
+			if _, full := isDiskFull(err); full || !sleepRetry(c.ctx, retry) {
+				break
+			}
+			err = updateFile(src, srcInfo, dst, useSymlink, c.force)
+		}
+		if err == nil {
+			filesProcessed.Add(1)
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if isUnreadableSource(err, src) {
+			c.unreadable = append(c.unreadable, src)
+		} else {
+			c.errs = append(c.errs, checkDiskFull(err, dst))
+		}
+	})
+}
+
+// Stopped reports whether the run was interrupted or the job timed out, which fails the job
+// with the copies that haven't started dropped
+func (c *fileCopier) Stopped() bool {
+	if c.ctx.Err() == nil {
+		return false
+	}
+	c.mu.Lock()
+	c.interrupted = true
+	c.mu.Unlock()
+	return true
+}
+
+// submit queues a copy on the pool, failing the job when the pool refuses it
+func (c *fileCopier) submit(task func()) {
+	c.wg.Add(1)
+	accepted := c.pool.Submit(c.ctx, func() {
+		defer c.wg.Done()
+		task()
+	})
+	if accepted {
+		return
+	}
+	c.wg.Done()
+	if !c.Stopped() {
+		c.mu.Lock()
+		c.errs = append(c.errs, errFilePoolClosed)
+		c.mu.Unlock()
+	}
+}
+
+// plan records a destination of a dry run
+func (c *fileCopier) plan(dst string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.planned[dst] = true
+}
+
+// Filter applies the copy filters to src, claimed at relPath within the locale directory
+// destDir, returning its destination and replacement content (nil to copy src); false skips
+// the file. A file moved to a path claimed before is skipped. A failing filter fails the job
+func (c *fileCopier) Filter(src string, destDir string, relPath string) (string, []byte, bool) {
+	if abs, err := filepath.Abs(src); err == nil {
+		src = abs
+	}
+	decision, err := applyCopyFilters(c.ctx, CopyFile{
+		Area:   c.job.Area,
+		Theme:  c.job.Theme,
+		Locale: c.job.Locale,
+		Path:   filepath.ToSlash(relPath),
+		Source: src,
+	})
+	if err != nil {
+		c.mu.Lock()
+		c.errs = append(c.errs, err)
+		c.mu.Unlock()
+		return "", nil, false
+	}
+	if decision.Skip {
+		return "", nil, false
+	}
+	dst := filepath.Join(destDir, relPath)
+	if decision.Path != "" && decision.Path != filepath.ToSlash(relPath) {
+		dst = filepath.Join(destDir, filepath.FromSlash(decision.Path))
+		if !c.Claim(dst) {
+			return "", nil, false
+		}
+	}
+	return dst, decision.Content, true
+}
+
+// PlaceContent queues writing content, a copy filter's replacement of src, to a claimed dst
+// unless dst already has that content
+func (c *fileCopier) PlaceContent(src string, content []byte, dst string) {
+	if c.dryRun {
+		c.plan(dst)
+		return
+	}
+	if c.Stopped() {
+		return
+	}
+	deploySources.Record(dst, src)
+	c.submit(func() {
+		if c.Stopped() {
+			return
+		}
+		if err := updateContent(dst, content, c.force); err != nil {
+			c.mu.Lock()
+			c.errs = append(c.errs, checkDiskFull(err, dst))
+			c.mu.Unlock()
+			return
+		}
+		filesProcessed.Add(1)
+	})
+}
+
+// updateContent writes content to dst unless dst is a regular file with that content and
+// force isn't set
+func updateContent(dst string, content []byte, force bool) error {
+	if deployChecksums != nil {
+		deployChecksums.Forget(dst)
+	}
+	if info, err := os.Lstat(dst); err == nil && info.Mode().IsRegular() && !force {
+		if current, err := os.ReadFile(dst); err == nil && bytes.Equal(current, content) {
+			return nil
+		}
+	}
+	os.MkdirAll(filepath.Dir(dst), 0755)
+	return writeFileAtomic(dst, content, 0644)
+}
+
+// updateFile places src at dst unless dst is up to date (by content hash with
+// --compare=checksum, otherwise see upToDate) and force (--force) isn't set. Existing destinations are replaced
+// by renaming a new file over them, so the web server never serves a partial file, and
+// copies get the modification time of their source for the next comparison
+func updateFile(src string, srcInfo os.FileInfo, dst string, useSymlink bool, force bool) error {
+	if srcInfo.Mode()&os.ModeSymlink != 0 {
+		// Compare with the file the source symlink points to
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		srcInfo = info
+	}
+
+	dstInfo, err := os.Lstat(dst)
+	if err != nil {
+		dstInfo = nil
+	}
+
+	var current bool
+	if deployChecksums != nil && !useSymlink {
+		if current, err = deployChecksums.UpToDate(src, dst, dstInfo); err != nil {
+			return err
+		}
+	} else {
+		if deployChecksums != nil {
+			deployChecksums.Forget(dst)
+		}
+		current = dstInfo != nil && upToDate(src, srcInfo, dst, dstInfo, useSymlink)
+	}
+	// --force replaces every deployed file
+	if current && !force {
+		return nil
+	}
+	if dstInfo == nil {
+		os.MkdirAll(filepath.Dir(dst), 0755)
+		return placeAndStamp(src, srcInfo, dst, useSymlink)
+	}
+
+	tmp := filepath.Join(filepath.Dir(dst), tempArtifactPrefix+filepath.Base(dst))
+	os.Remove(tmp)
+	tempArtifacts.Track(tmp)
+	defer tempArtifacts.Remove(tmp)
+	if err := placeAndStamp(src, srcInfo, tmp, useSymlink); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// placeAndStamp copies or symlinks src to dst, setting the modification time of copies to that of src
+func placeAndStamp(src string, srcInfo os.FileInfo, dst string, useSymlink bool) error {
+	if err := placeFile(src, dst, useSymlink); err != nil {
+		return err
+	}
+	if useSymlink {
+		return nil
+	}
+	return os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime())
+}
+
+// upToDate reports whether a deployed file matches its source: a symlink to src in symlink
+// mode, otherwise a regular file with the size and modification time of src
+func upToDate(src string, srcInfo os.FileInfo, dst string, dstInfo os.FileInfo, useSymlink bool) bool {
+	isLink := dstInfo.Mode()&os.ModeSymlink != 0
+	if useSymlink {
+		if !isLink {
+			return false
+		}
+		target, err := os.Readlink(dst)
+		expected, relErr := filepath.Rel(filepath.Dir(dst), src)
+		return err == nil && relErr == nil && target == expected
+	}
+	return !isLink && dstInfo.Size() == srcInfo.Size() && dstInfo.ModTime().Equal(srcInfo.ModTime())
+}
+
+// Wait blocks until all queued files are placed
+// Unreadable vendor files are recorded in vendorScanErrors; other failures are returned
+func (c *fileCopier) Wait(magentoRoot string) error {
+	c.wg.Wait()
+
+	vendorDir := filepath.Join(magentoRoot, "vendor") + string(filepath.Separator)
+	for _, path := range c.unreadable {
+		if rel, found := strings.CutPrefix(path, vendorDir); found {
+			vendorName, _, _ := strings.Cut(rel, string(filepath.Separator))
+			vendorScanErrors.Record(vendorName, path, &unreadableError{Paths: []string{path}})
+			continue
+		}
+		c.errs = append(c.errs, fmt.Errorf("%s is not readable", path))
+	}
+
+	if c.interrupted {
+		return errInterrupted
+	}
+	if full := firstDiskFull(c.errs); full != nil {
+		return fmt.Errorf("%d file(s) failed to copy: %w", len(c.errs), full)
+	}
+	if len(c.errs) > 0 {
+		return fmt.Errorf("%d file(s) failed to copy, first error: %w", len(c.errs), c.errs[0])
+	}
+	return nil
+}
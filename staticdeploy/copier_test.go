@@ -0,0 +1,76 @@
+package staticdeploy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFilePoolSubmitAfterClose(t *testing.T) {
+	pool := newFilePool(2)
+	ran := make(chan struct{}, 1)
+	if !pool.Submit(context.Background(), func() { ran <- struct{}{} }) {
+		t.Fatal("Submit() refused a task of an open pool")
+	}
+	pool.Close()
+	<-ran
+
+	if pool.Submit(context.Background(), func() { t.Error("task ran after Close") }) {
+		t.Error("Submit() accepted a task after Close")
+	}
+}
+
+func TestFilePoolSubmitAfterAbandon(t *testing.T) {
+	pool := newFilePool(1)
+	stuck := make(chan struct{})
+	defer close(stuck)
+	pool.Submit(context.Background(), func() { <-stuck })
+
+	// The job times out while its copy is stuck and the queue fills up
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	submitted := make(chan bool)
+	go func() {
+		for {
+			if !pool.Submit(ctx, func() {}) {
+				submitted <- false
+				return
+			}
+		}
+	}()
+	select {
+	case accepted := <-submitted:
+		if accepted {
+			t.Error("Submit() accepted a task after the job timed out")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Submit() blocked after the job timed out")
+	}
+	pool.Abandon()
+
+	closed := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() waited for an abandoned worker")
+	}
+}
+
+func TestFileCopierStopsWhenContextDone(t *testing.T) {
+	pool := newFilePool(1)
+	defer pool.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dir := t.TempDir()
+	copier := newFileCopier(ctx, pool, false, DeployJob{Area: "frontend", Theme: "Vendor/Hyva", Locale: "en_US"})
+	copier.PlaceContent(dir+"/src.js", []byte("x"), dir+"/dst.js")
+	if err := copier.Wait(dir); !errors.Is(err, errInterrupted) {
+		t.Errorf("Wait() error = %v, want errInterrupted", err)
+	}
+}
@@ -0,0 +1,35 @@
+package staticdeploy
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// copyBufferSize is the size of the pooled buffers used for userspace copies and hashing
+const copyBufferSize = 128 * 1024
+
+// copyBufferPool reuses copy buffers, so copying and hashing many small files doesn't
+// allocate a fresh buffer for each one
+var copyBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	},
+}
+
+// copyBuffered copies src to dst using a pooled buffer
+func copyBuffered(dst io.Writer, src io.Reader) (int64, error) {
+	buf := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(buf)
+
+	// Hide ReaderFrom/WriterTo, whose generic implementations would allocate their own buffer
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
+
+// copyFileContents copies src to dst with os.File.ReadFrom, which copies in the kernel where it
+// can (copy_file_range on Linux) and falls back to read/write otherwise
+func copyFileContents(dst, src *os.File) error {
+	_, err := dst.ReadFrom(src)
+	return err
+}
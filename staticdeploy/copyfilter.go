@@ -0,0 +1,204 @@
+package staticdeploy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/elgentos/magento2-static-deploy/copyfilterpb"
+)
+
+// CopyFilterConfig configures a copy filter (the copy_filters section of the config file):
+// either a gRPC service or a Go plugin
+type CopyFilterConfig struct {
+	GRPC    string   `yaml:"grpc" json:"grpc"`       // address, e.g. unix:///run/deploy-filter.sock or localhost:50051
+	TLS     bool     `yaml:"tls" json:"tls"`         // connect to the gRPC service with TLS
+	Plugin  string   `yaml:"plugin" json:"plugin"`   // Go plugin (.so) exporting FilterCopy
+	Match   []string `yaml:"match" json:"match"`     // only filter files matching these patterns (exclude syntax), default all
+	Timeout string   `yaml:"timeout" json:"timeout"` // per file, e.g. 5s (default 10s)
+}
+
+// defaultCopyFilterTimeout limits a single filter call
+const defaultCopyFilterTimeout = 10 * time.Second
+
+// CopyFile is a file about to be deployed, as seen by copy filters
+type CopyFile struct {
+	Area   string
+	Theme  string
+	Locale string
+	Path   string // destination within the locale directory, slash-separated
+	Source string
+}
+
+// CopyDecision is what a copy filter decided for a file; the zero value deploys it unchanged
+type CopyDecision struct {
+	Skip    bool
+	Path    string // new destination within the locale directory, "" to keep it
+	Content []byte // replacement content, nil to copy the source
+}
+
+// CopyFilter decides per file whether and where it's deployed, and may replace its content,
+// for deployment policies that don't fit excludes
+type CopyFilter interface {
+	Filter(ctx context.Context, file CopyFile) (CopyDecision, error)
+	// String returns the filter for messages
+	String() string
+}
+
+// configuredCopyFilter is a copy filter with the files it applies to
+type configuredCopyFilter struct {
+	filter  CopyFilter
+	match   []string
+	timeout time.Duration
+}
+
+// copyFilters are applied in order to every deployed file, none by default
+var copyFilters []configuredCopyFilter
+
+// registeredCopyFilters are the filters of RegisterCopyFilter
+var registeredCopyFilters []configuredCopyFilter
+
+// RegisterCopyFilter adds an in-process copy filter to the deploys and watches of the program,
+// for the files matching one of the patterns (exclude syntax), all files without patterns.
+// Registered filters run in the order of registration, after those of the config file; the
+// context of a call has the default timeout of 10s. Register filters before calling Main
+func RegisterCopyFilter(filter CopyFilter, match ...string) {
+	registeredCopyFilters = append(registeredCopyFilters, configuredCopyFilter{filter: filter, match: match, timeout: defaultCopyFilterTimeout})
+}
+
+// openCopyFilters connects to or loads the configured copy filters, followed by the
+// registered ones
+func openCopyFilters(configs []CopyFilterConfig) ([]configuredCopyFilter, error) {
+	var filters []configuredCopyFilter
+	for i, cfg := range configs {
+		timeout := defaultCopyFilterTimeout
+		if cfg.Timeout != "" {
+			var err error
+			if timeout, err = time.ParseDuration(cfg.Timeout); err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("copy_filters[%d]: invalid timeout %q", i, cfg.Timeout)
+			}
+		}
+
+		var filter CopyFilter
+		var err error
+		switch {
+		case cfg.GRPC != "" && cfg.Plugin != "":
+			return nil, fmt.Errorf("copy_filters[%d]: grpc and plugin are mutually exclusive", i)
+		case cfg.GRPC != "":
+			filter, err = newGRPCCopyFilter(cfg.GRPC, cfg.TLS)
+		case cfg.Plugin != "":
+			filter, err = loadPluginCopyFilter(cfg.Plugin)
+		default:
+			return nil, fmt.Errorf("copy_filters[%d]: grpc or plugin is required", i)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("copy_filters[%d]: %w", i, err)
+		}
+		filters = append(filters, configuredCopyFilter{filter: filter, match: cfg.Match, timeout: timeout})
+	}
+	return append(filters, registeredCopyFilters...), nil
+}
+
+// closeCopyFilters closes the connections of the copy filters opened by openCopyFilters at the
+// end of a run; plugins and registered filters stay loaded
+func closeCopyFilters() {
+	for _, f := range copyFilters {
+		if filter, ok := f.filter.(*grpcCopyFilter); ok {
+			filter.conn.Close()
+		}
+	}
+	copyFilters = nil
+}
+
+// applyCopyFilters runs the copy filters on a file; each filter sees the path the previous one
+// returned, a skip ends the chain and the last replacement content wins
+func applyCopyFilters(ctx context.Context, file CopyFile) (CopyDecision, error) {
+	var decision CopyDecision
+	for _, f := range copyFilters {
+		if len(f.match) > 0 && !matchesAny(f.match, file.Path) {
+			continue
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, f.timeout)
+		result, err := f.filter.Filter(callCtx, file)
+		cancel()
+		if err != nil {
+			return CopyDecision{}, fmt.Errorf("copy filter %s on %s: %w", f.filter, file.Path, err)
+		}
+		if result.Skip {
+			return CopyDecision{Skip: true}, nil
+		}
+		if result.Path != "" {
+			clean := filepath.ToSlash(filepath.Clean(result.Path))
+			if filepath.IsAbs(result.Path) || clean == ".." || strings.HasPrefix(clean, "../") {
+				return CopyDecision{}, fmt.Errorf("copy filter %s renamed %s to %s, outside the locale directory", f.filter, file.Path, result.Path)
+			}
+			file.Path = clean
+			decision.Path = clean
+		}
+		if result.Content != nil {
+			decision.Content = result.Content
+		}
+	}
+	return decision, nil
+}
+
+// matchesAny reports whether a path matches any of the patterns (exclude syntax)
+func matchesAny(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if matchExcludePattern(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// grpcCopyFilter is an out-of-process copy filter implementing copyfilterpb.CopyFilter
+type grpcCopyFilter struct {
+	address string
+	conn    *grpc.ClientConn
+	client  copyfilterpb.CopyFilterClient
+}
+
+// newGRPCCopyFilter creates the client of a gRPC copy filter; it connects on first use
+func newGRPCCopyFilter(address string, useTLS bool) (*grpcCopyFilter, error) {
+	if !strings.HasPrefix(address, "unix:") {
+		if err := requireNetwork("gRPC copy filter " + address); err != nil {
+			return nil, err
+		}
+	}
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &grpcCopyFilter{address: address, conn: conn, client: copyfilterpb.NewCopyFilterClient(conn)}, nil
+}
+
+func (f *grpcCopyFilter) Filter(ctx context.Context, file CopyFile) (CopyDecision, error) {
+	resp, err := f.client.Filter(ctx, &copyfilterpb.FilterRequest{
+		Area:   file.Area,
+		Theme:  file.Theme,
+		Locale: file.Locale,
+		Path:   file.Path,
+		Source: file.Source,
+	})
+	if err != nil {
+		return CopyDecision{}, err
+	}
+	return CopyDecision{Skip: resp.GetSkip(), Path: resp.GetPath(), Content: resp.Content}, nil
+}
+
+func (f *grpcCopyFilter) String() string {
+	return "grpc " + f.address
+}
@@ -0,0 +1,11 @@
+//go:build !((linux || darwin) && cgo)
+
+package staticdeploy
+
+import "fmt"
+
+// loadPluginCopyFilter fails: Go plugins need cgo on Linux or macOS, use a gRPC or in-process
+// filter instead
+func loadPluginCopyFilter(path string) (CopyFilter, error) {
+	return nil, fmt.Errorf("Go plugins aren't supported by this build (needs cgo on Linux or macOS), use a gRPC copy filter or a build registering the filter in-process")
+}
@@ -0,0 +1,50 @@
+//go:build (linux || darwin) && cgo
+
+package staticdeploy
+
+import (
+	"context"
+	"fmt"
+	"plugin"
+)
+
+// pluginFilterFunc is the signature of the FilterCopy function a copy filter plugin exports:
+// the file (area, theme, locale, destination path, source path) in, the decision out, with
+// nil content to copy the source. Only builtin types, so plugins don't import this program
+type pluginFilterFunc = func(area, theme, locale, path, source string) (skip bool, newPath string, content []byte, err error)
+
+// pluginCopyFilter is a copy filter loaded from a Go plugin (go build -buildmode=plugin)
+type pluginCopyFilter struct {
+	path   string
+	filter pluginFilterFunc
+}
+
+// loadPluginCopyFilter loads a Go plugin exporting FilterCopy
+func loadPluginCopyFilter(path string) (CopyFilter, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := p.Lookup("FilterCopy")
+	if err != nil {
+		return nil, err
+	}
+	filter, ok := symbol.(pluginFilterFunc)
+	if !ok {
+		return nil, fmt.Errorf("FilterCopy of plugin %s has type %T, expected %T", path, symbol, pluginFilterFunc(nil))
+	}
+	return &pluginCopyFilter{path: path, filter: filter}, nil
+}
+
+// Filter calls the plugin; plugins run in-process, so the context's deadline isn't enforced
+func (f *pluginCopyFilter) Filter(ctx context.Context, file CopyFile) (CopyDecision, error) {
+	skip, newPath, content, err := f.filter(file.Area, file.Theme, file.Locale, file.Path, file.Source)
+	if err != nil {
+		return CopyDecision{}, err
+	}
+	return CopyDecision{Skip: skip, Path: newPath, Content: content}, nil
+}
+
+func (f *pluginCopyFilter) String() string {
+	return "plugin " + f.path
+}
@@ -0,0 +1,53 @@
+package staticdeploy
+
+import (
+	"context"
+	"testing"
+)
+
+// renameFilter moves files below a directory
+type renameFilter struct {
+	dir string
+}
+
+func (f *renameFilter) Filter(ctx context.Context, file CopyFile) (CopyDecision, error) {
+	return CopyDecision{Path: f.dir + "/" + file.Path}, nil
+}
+
+func (f *renameFilter) String() string {
+	return "rename " + f.dir
+}
+
+func TestRegisterCopyFilter(t *testing.T) {
+	saved, savedFilters := registeredCopyFilters, copyFilters
+	t.Cleanup(func() { registeredCopyFilters, copyFilters = saved, savedFilters })
+	registeredCopyFilters = nil
+
+	first, second := &renameFilter{dir: "a"}, &renameFilter{dir: "b"}
+	RegisterCopyFilter(first)
+	RegisterCopyFilter(second, "*.js")
+
+	var err error
+	if copyFilters, err = openCopyFilters(nil); err != nil {
+		t.Fatalf("openCopyFilters() error = %v", err)
+	}
+	if len(copyFilters) != 2 {
+		t.Fatalf("openCopyFilters() returned %d filters, want the 2 registered ones", len(copyFilters))
+	}
+
+	decision, err := applyCopyFilters(context.Background(), CopyFile{Path: "js/app.js"})
+	if err != nil {
+		t.Fatalf("applyCopyFilters() error = %v", err)
+	}
+	if decision.Path != "b/a/js/app.js" {
+		t.Errorf("applyCopyFilters() path = %q, want b/a/js/app.js", decision.Path)
+	}
+
+	decision, err = applyCopyFilters(context.Background(), CopyFile{Path: "css/styles.css"})
+	if err != nil {
+		t.Fatalf("applyCopyFilters() error = %v", err)
+	}
+	if decision.Path != "a/css/styles.css" {
+		t.Errorf("applyCopyFilters() path = %q, want a/css/styles.css (not matched by the second filter)", decision.Path)
+	}
+}
@@ -0,0 +1,135 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// CredentialSource defines where a secret comes from (the credentials section of the config file)
+// Secrets are never accepted as command line flags, as those end up in process lists and shell history
+type CredentialSource struct {
+	Env     string `yaml:"env" json:"env"`         // environment variable holding the secret
+	File    string `yaml:"file" json:"file"`       // file holding the secret, must not be accessible by group or others
+	Command string `yaml:"command" json:"command"` // helper printing the secret, e.g. 'pass show deploy/s3'
+}
+
+// Credentials resolves named secrets for remote integrations, caching them for the run
+type Credentials struct {
+	magentoRoot string
+	sources     map[string]CredentialSource
+	mu          sync.Mutex
+	cache       map[string]string
+}
+
+// NewCredentials creates the resolver for the credentials configured in cfg
+func NewCredentials(magentoRoot string, cfg *Config) *Credentials {
+	return &Credentials{
+		magentoRoot: magentoRoot,
+		sources:     cfg.Credentials,
+		cache:       make(map[string]string),
+	}
+}
+
+// credentialEnvName returns the default environment variable of a credential,
+// e.g. s3.secret-key -> STATIC_DEPLOY_S3_SECRET_KEY
+func credentialEnvName(name string) string {
+	return "STATIC_DEPLOY_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+}
+
+// Has reports whether a secret is configured or its STATIC_DEPLOY_<NAME> variable is set, for
+// integrations with other ways to authenticate
+func (c *Credentials) Has(name string) bool {
+	_, configured := c.sources[name]
+	return configured || os.Getenv(credentialEnvName(name)) != ""
+}
+
+// Get returns the secret for name from, in order: its configured source, or the
+// STATIC_DEPLOY_<NAME> environment variable
+func (c *Credentials) Get(name string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if value, ok := c.cache[name]; ok {
+		return value, nil
+	}
+
+	value, err := c.resolve(name)
+	if err != nil {
+		return "", fmt.Errorf("credential %s: %w", name, err)
+	}
+	c.cache[name] = value
+	return value, nil
+}
+
+// resolve reads a secret from its source
+func (c *Credentials) resolve(name string) (string, error) {
+	source, configured := c.sources[name]
+
+	switch {
+	case configured && source.Command != "":
+		return runCredentialHelper(c.magentoRoot, source.Command)
+	case configured && source.File != "":
+		return readCredentialFile(source.File)
+	case configured && source.Env != "":
+		if value := os.Getenv(source.Env); value != "" {
+			return value, nil
+		}
+		return "", fmt.Errorf("environment variable %s is not set", source.Env)
+	}
+
+	if value := os.Getenv(credentialEnvName(name)); value != "" {
+		return value, nil
+	}
+	return "", fmt.Errorf("not configured (set %s or configure credentials.%s)", credentialEnvName(name), name)
+}
+
+// readCredentialFile reads a secret from a file, refusing files readable by group or others
+func readCredentialFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("%s is accessible by group or others (mode %04o), run: chmod 600 %s", path, info.Mode().Perm(), path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return value, nil
+}
+
+// runCredentialHelper runs an external helper (e.g. 'pass show x', 'aws-vault exec p -- printenv KEY')
+// and returns its trimmed standard output; standard error is passed through for prompts
+func runCredentialHelper(dir string, command string) (string, error) {
+	args, err := splitCommandLine(command)
+	if err != nil || len(args) == 0 {
+		return "", fmt.Errorf("invalid helper command %q", command)
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = runStderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("helper %s failed: %w", args[0], err)
+	}
+
+	value := strings.TrimSpace(stdout.String())
+	if value == "" {
+		return "", fmt.Errorf("helper %s printed no secret", args[0])
+	}
+	return value, nil
+}
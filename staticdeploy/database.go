@@ -0,0 +1,209 @@
+package staticdeploy
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// storeDatabase reads the store views and their theme and locale configuration from the
+// Magento database (--database), for installations without a config.php dump
+var storeDatabase bool
+
+// databaseTimeout limits connecting to and querying the database
+const databaseTimeout = 10 * time.Second
+
+// DatabaseConfig is the default connection of app/etc/env.php
+type DatabaseConfig struct {
+	Net         string // tcp or unix
+	Addr        string // host:port or socket path
+	Name        string
+	User        string
+	Password    string
+	TablePrefix string
+}
+
+// loadDatabaseConfig reads the default database connection from app/etc/env.php
+func loadDatabaseConfig(magentoRoot string) (*DatabaseConfig, error) {
+	env, err := readPHPArrayFile(filepath.Join(magentoRoot, "app/etc/env.php"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database configuration: %w", err)
+	}
+	connection := phpArrayPath(env, "db", "connection", "default")
+	if connection == nil {
+		return nil, fmt.Errorf("app/etc/env.php has no db/connection/default")
+	}
+
+	cfg := &DatabaseConfig{
+		Name:        phpArrayPathString(connection, "dbname"),
+		User:        phpArrayPathString(connection, "username"),
+		Password:    phpArrayPathString(connection, "password"),
+		TablePrefix: phpArrayPathString(env, "db", "table_prefix"),
+	}
+
+	// Magento accepts a host, host:port or a socket path as host, and an optional port
+	host := phpArrayPathString(connection, "host")
+	port := phpArrayPathString(connection, "port")
+	switch {
+	case strings.HasPrefix(host, "/"):
+		cfg.Net, cfg.Addr = "unix", host
+	case strings.Contains(host, ":"):
+		cfg.Net, cfg.Addr = "tcp", host
+	default:
+		if host == "" {
+			host = "localhost"
+		}
+		if port == "" {
+			port = "3306"
+		}
+		cfg.Net, cfg.Addr = "tcp", net.JoinHostPort(host, port)
+	}
+	return cfg, nil
+}
+
+// openMagentoDatabase connects to the database of a Magento installation
+func openMagentoDatabase(cfg *DatabaseConfig) (*sql.DB, error) {
+	if cfg.Net == "tcp" {
+		if err := requireNetwork("--database"); err != nil {
+			return nil, err
+		}
+	}
+	dsn := mysql.NewConfig()
+	dsn.Net = cfg.Net
+	dsn.Addr = cfg.Addr
+	dsn.DBName = cfg.Name
+	dsn.User = cfg.User
+	dsn.Passwd = cfg.Password
+	dsn.Timeout = databaseTimeout
+	dsn.ReadTimeout = databaseTimeout
+
+	db, err := sql.Open("mysql", dsn.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot connect to database %s on %s: %w", cfg.Name, cfg.Addr, err)
+	}
+	return db, nil
+}
+
+// loadDatabaseStoreConfig reads the store views and their locale and theme configuration
+// from the Magento database. The configuration is returned in the shape of the system
+// section of app/etc/config.php, with theme IDs resolved to theme paths (frontend/Vendor/theme)
+func loadDatabaseStoreConfig(magentoRoot string) ([]StoreView, map[string]interface{}, error) {
+	cfg, err := loadDatabaseConfig(magentoRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := openMagentoDatabase(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+	table := func(name string) string { return "`" + cfg.TablePrefix + name + "`" }
+
+	websiteCodes := make(map[string]string)
+	rows, err := db.Query("SELECT website_id, code FROM " + table("store_website"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read websites: %w", err)
+	}
+	for rows.Next() {
+		var id, code string
+		if err := rows.Scan(&id, &code); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		websiteCodes[id] = code
+	}
+	rows.Close()
+
+	var stores []StoreView
+	storeCodes := make(map[string]string)
+	rows, err = db.Query("SELECT store_id, code, website_id, is_active FROM " + table("store") + " ORDER BY store_id")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read store views: %w", err)
+	}
+	for rows.Next() {
+		var id int
+		var code, websiteID string
+		var active bool
+		if err := rows.Scan(&id, &code, &websiteID, &active); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		storeCodes[strconv.Itoa(id)] = code
+		stores = append(stores, StoreView{Code: code, ID: id, Website: websiteCodes[websiteID], Active: active})
+	}
+	rows.Close()
+
+	themePaths := make(map[string]string)
+	rows, err = db.Query("SELECT theme_id, area, theme_path FROM " + table("theme"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read themes: %w", err)
+	}
+	for rows.Next() {
+		var id, area, path string
+		if err := rows.Scan(&id, &area, &path); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		themePaths[id] = area + "/" + path
+	}
+	rows.Close()
+
+	system := make(map[string]interface{})
+	rows, err = db.Query("SELECT scope, scope_id, path, value FROM "+table("core_config_data")+" WHERE path IN (?, ?)",
+		"general/locale/code", "design/theme/theme_id")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var scope, scopeID, path string
+		var value sql.NullString
+		if err := rows.Scan(&scope, &scopeID, &path, &value); err != nil {
+			return nil, nil, err
+		}
+		if !value.Valid {
+			continue
+		}
+		if path == "design/theme/theme_id" {
+			if themePath, ok := themePaths[value.String]; ok {
+				value.String = themePath
+			}
+		}
+
+		keys := []string{scope}
+		switch scope {
+		case "websites":
+			keys = append(keys, websiteCodes[scopeID])
+		case "stores":
+			keys = append(keys, storeCodes[scopeID])
+		}
+		if keys[len(keys)-1] == "" {
+			continue // the scope no longer exists
+		}
+		setNestedValue(system, value.String, append(keys, strings.Split(path, "/")...)...)
+	}
+	return stores, system, rows.Err()
+}
+
+// setNestedValue sets a value in nested maps by keys, creating the maps as needed
+func setNestedValue(m map[string]interface{}, value string, keys ...string) {
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[key] = next
+		}
+		m = next
+	}
+	m[keys[len(keys)-1]] = value
+}
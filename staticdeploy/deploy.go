@@ -0,0 +1,2334 @@
+package staticdeploy
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DeployJob represents a single deployment job (locale/theme/area combo)
+type DeployJob struct {
+	Locale string
+	Theme  string
+	Area   string
+}
+
+// DeployResult tracks the result of a deployment job
+type DeployResult struct {
+	Job           DeployJob
+	FilesCount    int64
+	Duration      time.Duration
+	Error         string
+	Symlinked     bool
+	SymlinkTarget string
+	Attempts      int // runs of the job, more than 1 when it was retried (--retries)
+}
+
+// ModuleConfig represents a Magento module.xml structure
+type ModuleConfig struct {
+	XMLName xml.Name `xml:"config"`
+	Module  struct {
+		Name string `xml:"name,attr"`
+	} `xml:"module"`
+}
+
+// ThemeConfig represents a Magento theme.xml structure
+type ThemeConfig struct {
+	XMLName xml.Name `xml:"theme"`
+	Parent  string   `xml:"parent"`
+}
+
+// CLI flags (Magento-compatible)
+var (
+	magentoRoot    string
+	areasFlag      []string
+	themesFlag     []string
+	allThemes      bool
+	excludeThemes  []string
+	languagesFlag  []string
+	jobsFlag       int
+	strategyFlag   string
+	forceFlag      bool
+	verboseFlag    bool
+	quietFlag      bool
+	noColorFlag    bool
+	contentVersion string
+	noLumaDispatch bool
+	phpBinary      string
+	phpExec        string
+	phpExecRoot    string
+	phpIni         []string
+	phpMemoryLimit string
+	symlinkMode    string
+	noAreaThemes   bool
+	noCache        bool
+	configFile     string
+	storesFlag     []string
+	standbyRoot    string
+	releaseNotes   string
+	writeManifest  bool
+	noBuild        bool
+	scanJobsFlag   int
+	excludeFlag    []string
+	deployMode     string
+	imagesMode     string
+	compareMode    string
+	sinceRef       string
+	reportFile     string
+	progressFile   string
+	presetName     string
+	watchFlag      bool
+	liveReloadFlag string
+	pruneFlag      bool
+	versionOn      string
+)
+
+// newDeployFlags creates the flag set of the deploy options, bound to their variables, which
+// are reset to the defaults
+func newDeployFlags(errorHandling flag.ErrorHandling) *flag.FlagSet {
+	flags := flag.NewFlagSet(os.Args[0], errorHandling)
+
+	// Magento-compatible flags
+	flags.StringVarP(&magentoRoot, "root", "r", ".", "Path to Magento root directory")
+	flags.StringVarP(&configFile, "config", "c", "", "Path to config file (default: static-deploy.yaml, .yml or .json in the Magento root)")
+	flags.StringVar(&configEnvironment, "env", os.Getenv("STATIC_DEPLOY_ENV"), "Environment whose section of the config file overrides its settings, e.g. production (env: STATIC_DEPLOY_ENV)")
+	flags.StringArrayVarP(&areasFlag, "area", "a", []string{}, "Generate files only for the specified areas (can be repeated)")
+	flags.StringArrayVarP(&themesFlag, "theme", "t", []string{}, "Generate static view files for only the specified themes (can be repeated, supports 'Vendor/*' and 'all')")
+	flags.BoolVar(&allThemes, "all-themes", false, "Deploy every installed theme (app/design and vendor theme packages) of the selected areas, like -t all")
+	flags.StringArrayVar(&excludeThemes, "exclude-theme", nil, "Don't deploy this theme, e.g. Magento/luma or 'Magento/*' (can be repeated)")
+	flags.StringSliceVar(&storesFlag, "store", []string{}, "Deploy the theme and locale configured for the specified store view codes (comma-separated or repeated)")
+	flags.BoolVar(&storeDatabase, "database", false, "Read store views, themes and locales from the Magento database (connection from app/etc/env.php) in addition to app/etc/config.php")
+	flags.StringArrayVarP(&languagesFlag, "language", "l", []string{}, "Generate files only for the specified languages (can be repeated, supports 'auto', 'all' and locale groups from the config file)")
+	flags.IntVarP(&jobsFlag, "jobs", "j", 0, "Enable parallel processing using the specified number of jobs (0 = auto-detect)")
+	flags.StringVarP(&strategyFlag, "strategy", "s", "quick", "Deploy files using specified strategy")
+	flags.BoolVarP(&forceFlag, "force", "f", false, "Deploy files in any mode, overwriting all deployed files instead of only changed ones")
+	flags.BoolVarP(&verboseFlag, "verbose", "v", false, "Verbose output")
+	flags.BoolVarP(&quietFlag, "quiet", "q", false, "Only print the final summary and errors")
+	flags.BoolVar(&noColorFlag, "no-color", false, "Plain ASCII status symbols and no colors, for dumb terminals and log collectors (env: NO_COLOR)")
+	flags.StringVar(&contentVersion, "content-version", "", "Custom version of static content")
+	flags.StringVar(&contentVersionFile, "content-version-file", "", "Read the content version from this file, e.g. one shared by all nodes of a rollout")
+	flags.StringVar(&contentVersionURL, "content-version-url", "", "Fetch the content version from this URL (plain text or JSON with a \"version\" field)")
+	flags.StringVar(&versionOn, "version-on", "all-success", "When to write deployed_version.txt: 'all-success' (every job succeeded) or 'any-success' (any files were deployed)")
+	flags.BoolVar(&versionedDirs, "versioned-dirs", false, "Deploy into pub/static/version{N}/ (the content version) for static signing without web server rewrites")
+	flags.BoolVar(&noLumaDispatch, "no-luma-dispatch", false, "Disable automatic dispatch of Luma themes to bin/magento")
+	flags.StringVar(&phpBinary, "php", "php", "Path to PHP binary for Luma theme dispatch and CSS compilation (env: PHP_BINARY)")
+	flags.StringArrayVar(&phpIni, "php-ini", []string{}, "PHP ini setting passed as -d name=value to every PHP invocation (can be repeated)")
+	flags.StringVar(&phpMemoryLimit, "php-memory-limit", "", "PHP memory_limit for every PHP invocation, e.g. 2G (env: PHP_MEMORY_LIMIT)")
+	flags.StringVar(&phpExec, "php-exec", "", "Command used to run PHP instead of --php, e.g. 'docker compose exec -T php php' ({args} marks where PHP arguments go)")
+	flags.StringVar(&phpExecRoot, "php-exec-root", "", "Magento root path as seen by --php-exec (e.g. /var/www/html inside the container)")
+	flags.StringVar(&presetName, "preset", "", "Apply a bundle of flags: 'dev' (symlinks, primary theme and locale only, watch, LiveReload) or 'production' (checksums, prune, versioned dirs, minify, precompress, manifest); explicit flags take precedence")
+	flags.StringVar(&deployMode, "mode", "copy", "Deployment mode: 'copy', or 'symlink' for development (an alias of --symlink=file)")
+	flags.StringVar(&symlinkMode, "symlink", "", "Use symlinks instead of copies: 'file' (per-file symlinks to source) or 'locale' (directory-level symlinks for identical locales)")
+	flags.StringVar(&imagesMode, "images", "copy", "How images are deployed: 'copy', 'symlink' (symlinks to the sources) or 'defer' (left out, deploy later with --images=copy)")
+	flags.StringVar(&backupMode, "backup", "", "Before deploying, back up pub/static to var/static-backups/<timestamp>: 'link' (hard links, the default) or 'tar'")
+	flags.Lookup("backup").NoOptDefVal = "link"
+	flags.BoolVar(&resumeRun, "resume", false, "Continue an interrupted or failed run: skip the jobs it completed and reuse its content version")
+	flags.BoolVar(&keepPrevious, "keep-previous", false, "Before deploying, keep a copy of pub/static in var/.static-deploy-previous for the rollback command")
+	flags.BoolVar(&pruneFlag, "prune", false, "After a successful deploy, delete deployed files of the deployed themes that no longer have a source")
+	flags.BoolVar(&minifyAssets, "minify", false, "Minify the deployed JavaScript and CSS, except *.min.js and *.min.css (comments and whitespace only, nothing is renamed)")
+	flags.BoolVar(&precompressAssets, "precompress", false, "After a successful deploy, write .gz and .br copies of the deployed text assets for web servers serving them as is")
+	flags.BoolVar(&watchFlag, "watch", false, "After the deploy, keep watching the sources of its jobs and bring their changes to pub/static like the watch command")
+	flags.StringVar(&liveReloadFlag, "livereload", "", "With --watch, serve LiveReload on this address, reloading the browsers after changes (default address "+defaultLiveReloadAddr+")")
+	flags.Lookup("livereload").NoOptDefVal = defaultLiveReloadAddr
+	flags.StringVar(&sinceRef, "since", "", "Only deploy the themes whose sources changed since this git ref (e.g. the last deployed commit)")
+	flags.StringVar(&compareMode, "compare", "mtime", "How deployed files are compared to their sources: 'mtime' (size and modification time) or 'checksum' (content hash)")
+	flags.StringArrayVar(&excludeFlag, "exclude", nil, "Exclude files matching this pattern from deployment, in addition to the defaults (e.g. '*.map', '/js/dev')")
+	flags.IntVar(&scanJobsFlag, "scan-jobs", 0, "Number of parallel workers scanning vendor packages (0 = number of CPUs)")
+	flags.BoolVar(&noBuild, "no-build", false, "Skip theme build hooks (theme_builds config, and with theme_build_hooks the composer.json extra or package.json 'static-deploy' script)")
+	flags.BoolVar(&noCache, "no-cache", false, "Disable reuse of previously compiled CSS and vendor scans (var/.static-deploy-cache)")
+	flags.BoolVar(&offlineMode, "offline", os.Getenv("STATIC_DEPLOY_OFFLINE") == "1", "Guarantee no network access: fail if a configured feature needs it (default: $STATIC_DEPLOY_OFFLINE=1)")
+	flags.DurationVar(&runTimeout, "timeout", 0, "Stop the deployment after this duration (e.g. 30m), failing the unfinished jobs (0 = no limit)")
+	flags.IntVar(&jobRetries, "retries", 0, "Retry a failed theme/locale job up to this many times, e.g. after transient NFS errors")
+	flags.IntVar(&fileRetries, "file-retries", 0, "Retry a failed file copy up to this many times before failing its job")
+	flags.DurationVar(&retryWait, "retry-wait", time.Second, "Wait before the first retry, doubled for every next one (max 1m)")
+	flags.DurationVar(&jobTimeout, "job-timeout", 0, "Fail a theme/locale job that takes longer than this (e.g. 5m), e.g. a copy stuck on NFS (0 = no limit)")
+	flags.StringVar(&logLevel, "log-level", "info", "Minimum level of log messages: 'debug' (same as --verbose), 'info', 'warn' or 'error'")
+	flags.StringVar(&logFile, "log-file", "", "Also write the full log, including verbose output, to this file (the console keeps --log-level)")
+	flags.StringVar(&logFormat, "log-format", "text", "Log format: 'text', or 'json' for one JSON object per line with the theme, area, locale and counts as fields (for Loki, ELK)")
+	flags.StringVar(&outputFormat, "output", "text", "Results output on stdout: 'text', 'json' for the report (see --report) with all other output on stderr, or 'github' for GitHub Actions annotations and a step summary")
+	flags.StringVar(&notifyURL, "notify-url", "", "POST a JSON summary of the run (success, counts, duration, version) to this URL when it finishes")
+	flags.BoolVar(&slackNotify, "slack", false, "Post the outcome of the run with the jobs per theme to Slack, using the slack.webhook credential")
+	flags.StringVar(&reportFile, "report", "", "Write a JSON report of the run (jobs, errors and resource usage) to this file ('-' for stdout)")
+	flags.StringVar(&progressMode, "progress", "auto", "Progress of the jobs on the console: 'auto' (a status line on terminals, a line every 10s otherwise), 'bar', 'lines' or 'off'")
+	flags.StringVar(&otlpEndpoint, "otlp-endpoint", "", "Export traces of the deploy over OTLP to this endpoint, e.g. http://localhost:4318 (default: OTEL_EXPORTER_OTLP_ENDPOINT)")
+	flags.StringVar(&otlpProtocol, "otlp-protocol", "", "OTLP protocol: 'grpc' or 'http/protobuf' (default: OTEL_EXPORTER_OTLP_PROTOCOL, else http/protobuf)")
+	flags.StringVar(&eventsPath, "events", "", "Write progress events (job started/finished, files copied, compile finished) as JSON lines to this file, e.g. a named pipe or /dev/fd/3, or to stdout for '-' with all other output on stderr")
+	flags.StringVar(&progressFile, "progress-file", "", "Continuously write the progress of the run (jobs done, percent, ETA) as JSON to this file")
+	flags.BoolVar(&writeManifest, "manifest", false, "After a successful deploy, write a manifest of pub/static with the size, hash and source of every file")
+	flags.BoolVar(&signManifest, "sign-manifest", false, "Sign the manifest of --manifest with the Ed25519 key of the manifest.signing-key credential (checked by verify --public-key)")
+	flags.StringVar(&releaseNotes, "release-notes", "", "Write a summary of the static content changes since the previous deploy to this file ('-' for stdout)")
+	flags.BoolVar(&flushCache, "flush-cache", false, "After a successful deploy, flush the cache tags holding static content URLs from the Redis caches of app/etc/env.php")
+	flags.BoolVar(&invalidateCDN, "invalidate-cdn", false, "After uploading to object storage with --target, invalidate the replaced and deleted files in CloudFront or Cloudflare")
+	flags.BoolVar(&purgeCache, "purge", false, "After a successful deploy, purge the HTML cached in Varnish (http_cache_hosts of app/etc/env.php) or Fastly")
+	flags.StringVar(&standbyRoot, "standby", "", "After a successful deploy, mirror pub/static to the pub/static of this standby Magento root")
+	flags.StringArrayVar(&targetsFlag, "target", nil, "After a successful deploy, push pub/static to this web server or bucket, e.g. ssh://deploy@web1/var/www/magento/pub/static or s3://bucket/static (can be repeated)")
+	flags.StringVar(&targetSSH, "target-ssh", "ssh", "SSH command for --target, e.g. 'ssh -i deploy_key'")
+	flags.StringArrayVar(&traceThemes, "trace-resolution", nil, "Print every candidate location of this theme (and its parents) per area with whether it exists (can be repeated)")
+	flags.StringArrayVar(&onlyJobs, "only-job", nil, "Only deploy this area/Vendor/theme/locale job of the job matrix (can be repeated, see retry-failed)")
+	flags.BoolVar(&noAreaThemes, "no-default-area-themes", false, "Disable adding the standard theme (e.g. Magento/backend) for areas none of the given themes belong to")
+	return flags
+}
+
+func init() {
+	flag.CommandLine = newDeployFlags(flag.ExitOnError)
+
+	registerCommand(Command{
+		Name:        "deploy",
+		Description: "Deploy static view files (the default without a command)",
+		Run: func(args []string) error {
+			runDeploy(args)
+			return nil
+		},
+	})
+
+	// Custom usage message
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [deploy] [options] [languages...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s <command> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Deploys static view files (Magento-compatible CLI)\n\n")
+		printCommands()
+		fmt.Fprintf(os.Stderr, "Run '%s <command> --help' for the options of a command\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Arguments:\n")
+		fmt.Fprintf(os.Stderr, "  languages    Space-separated list of ISO-639 language codes\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s nl_NL en_US\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -f --area=frontend --theme=Vendor/Hyva nl_NL\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -f -a frontend -a adminhtml -t Vendor/Hyva -j 4 nl_NL en_US\n", os.Args[0])
+	}
+}
+
+// Main runs the command line interface with the arguments of the process; the main package of
+// the deployer, or of a build of it with copy filters registered (see RegisterCopyFilter)
+func Main() {
+	// Never leave temporary files behind, also when interrupted
+	shutdownSignals = handleShutdownSignals()
+	// The command owns the process, so failing trace exports are its warnings
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logWarnf("tracing: %v", err)
+	}))
+
+	// Without a command, deploy (Magento-compatible CLI)
+	if !runCommand(os.Args[1:]) {
+		runDeploy(os.Args[1:])
+	}
+}
+
+// runDeploy implements the deploy command, the default: it parses the deploy options from
+// args and exits with 1 when the deploy fails
+func runDeploy(args []string) {
+	results, err := deploy(context.Background(), args, nil)
+	if err != nil {
+		// The failures of a run are logged as they happen
+		if !errors.Is(err, ErrDeployFailed) {
+			logErrorf("%v", err)
+		}
+		os.Exit(1)
+	}
+
+	// Keep the deployed jobs up to date until interrupted, e.g. with --preset=dev
+	if watchFlag && len(results) > 0 {
+		jobs := make([]DeployJob, len(results))
+		for i, result := range results {
+			jobs[i] = result.Job
+		}
+		if err := runWatch(deployWatchArgs(jobs)); err != nil {
+			logErrorf("%v", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// deploy runs a deploy with the deploy options in args, parsed into the deploy flags, and
+// returns the results of its jobs; progress, if not nil, gets the events of --events as well
+// The run is stopped gracefully when ctx ends, like by a signal
+func deploy(parent context.Context, args []string, progress func(ProgressEvent)) ([]DeployResult, error) {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return nil, err
+	}
+	resetRunState()
+
+	// Options of the config file apply unless given on the command line
+	cfg, err := loadConfig(magentoRoot, configFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyConfigOptions(cfg.Options); err != nil {
+		return nil, err
+	}
+
+	if noColorFlag {
+		plainSymbols()
+	}
+	if quietFlag && verboseFlag {
+		return nil, errors.New("--quiet and --verbose are mutually exclusive")
+	}
+	if err := setupLogging(logLevel, logFormat, verboseFlag, quietFlag, logFile); err != nil {
+		return nil, err
+	}
+	if logLevel == "debug" {
+		verboseFlag = true
+	}
+	// Verbose output is logged for --log-file also when the console doesn't show it
+	debugLogs := verboseFlag || logFile != ""
+
+	if !quietFlag {
+		var err error
+		if consoleProgress, err = newProgressDisplay(progressMode); err != nil {
+			return nil, err
+		}
+	}
+
+	var preset Preset
+	if presetName != "" {
+		var err error
+		if preset, err = applyPreset(presetName); err != nil {
+			return nil, err
+		}
+	}
+
+	if symlinkMode != "" && symlinkMode != "file" && symlinkMode != "locale" {
+		return nil, fmt.Errorf("--symlink must be 'file' or 'locale', got '%s'", symlinkMode)
+	}
+
+	switch deployMode {
+	case "copy":
+	case "symlink":
+		// Development mode is an alias of --symlink=file, unless --symlink=locale is given as well
+		if symlinkMode == "" {
+			symlinkMode = "file"
+		}
+	default:
+		return nil, fmt.Errorf("--mode must be 'copy' or 'symlink', got '%s'", deployMode)
+	}
+
+	if imagesMode != "copy" && imagesMode != "symlink" && imagesMode != "defer" {
+		return nil, fmt.Errorf("--images must be 'copy', 'symlink' or 'defer', got '%s'", imagesMode)
+	}
+
+	if compareMode != "mtime" && compareMode != "checksum" {
+		return nil, fmt.Errorf("--compare must be 'mtime' or 'checksum', got '%s'", compareMode)
+	}
+
+	if allThemes && len(themesFlag) > 0 {
+		return nil, errors.New("--all-themes cannot be combined with --theme, use --exclude-theme to leave themes out")
+	}
+	for _, pattern := range excludeThemes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid --exclude-theme pattern '%s': %w", pattern, err)
+		}
+	}
+
+	if versionOn != "all-success" && versionOn != "any-success" {
+		return nil, fmt.Errorf("--version-on must be 'all-success' or 'any-success', got '%s'", versionOn)
+	}
+
+	// With --output=json stdout only gets the report, everything else goes to stderr
+	var resultsOut io.Writer
+	switch outputFormat {
+	case "text", "github":
+	case "json":
+		if reportFile == "-" {
+			return nil, errors.New("--report=- can't be combined with --output=json, which writes the report to stdout")
+		}
+		resultsOut, runStdout = runStdout, runStderr
+		defer func() { runStdout = resultsOut }()
+	default:
+		return nil, fmt.Errorf("--output must be 'text', 'json' or 'github', got '%s'", outputFormat)
+	}
+
+	// With --events=- stdout only gets the events, everything else goes to stderr
+	var eventsOut io.Writer
+	if eventsPath == "-" {
+		if resultsOut != nil || reportFile == "-" {
+			return nil, errors.New("--events=- can't be combined with --output=json or --report=-, which write to stdout")
+		}
+		eventsOut, runStdout = runStdout, runStderr
+		defer func() { runStdout = eventsOut }()
+	}
+
+	if jobRetries < 0 || fileRetries < 0 || retryWait < 0 {
+		return nil, errors.New("--retries, --file-retries and --retry-wait must not be negative")
+	}
+
+	if backupMode != "" && backupMode != "link" && backupMode != "tar" {
+		return nil, fmt.Errorf("--backup must be 'link' or 'tar', got '%s'", backupMode)
+	}
+
+	// Extend the default exclusions with those from the config file and command line
+	excludes := runExcludePatterns(cfg, excludeFlag)
+
+	if err := setHashAlgorithm(cfg); err != nil {
+		return nil, err
+	}
+	localeAliases = cfg.LocaleAliases
+	deployPhases = cfg.Phases
+	if err := validateThemeSources(magentoRoot, cfg.ThemeSources); err != nil {
+		return nil, err
+	}
+	themeSources = cfg.ThemeSources
+	if err := validateMagentoCommands(cfg.MagentoCommands); err != nil {
+		return nil, err
+	}
+	if copyFilters, err = openCopyFilters(cfg.CopyFilters); err != nil {
+		return nil, err
+	}
+	defer closeCopyFilters()
+	if minifyAssets {
+		enableMinify()
+	}
+
+	// Continue an interrupted run with its content version
+	var resumed *RunState
+	if resumeRun {
+		if resumed, err = loadRunState(magentoRoot); err != nil {
+			return nil, err
+		}
+		switch {
+		case resumed == nil:
+			logInfof("No interrupted run to resume, deploying all jobs")
+		case resumed.Options != deployOptionsKey(excludes):
+			logWarnf("the interrupted run used other options (%s), deploying all jobs", resumed.Options)
+			resumed = nil
+		case contentVersion == "" && contentVersionFile == "" && contentVersionURL == "":
+			contentVersion = resumed.Version
+		}
+	}
+
+	// Resolved once, so all themes and nodes of a rollout deploy the same version
+	version, err := resolveContentVersion(contentVersion, contentVersionFile, contentVersionURL, cfg.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	if resumed != nil && version != resumed.Version {
+		return nil, fmt.Errorf("cannot resume the run of content version %s with version %s", resumed.Version, version)
+	}
+	// Version directories are ordered by number, for pruning and rollback
+	if versionedDirs {
+		if _, err := strconv.ParseUint(version, 10, 63); err != nil {
+			return nil, fmt.Errorf("--versioned-dirs needs a numeric content version, got '%s'", version)
+		}
+	}
+
+	php, err := newPHPRunnerFromFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	notifier, err := NewNotifier(notifyURL, cfg.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	slack, err := NewSlackNotifier(magentoRoot, cfg)
+	if err != nil {
+		return nil, err
+	}
+	cacheFlusher, err := NewCacheFlusher(magentoRoot, cfg)
+	if err != nil {
+		return nil, err
+	}
+	purger, err := NewPurger(magentoRoot, cfg)
+	if err != nil {
+		return nil, err
+	}
+	targets, stores, err := openTargets(targetsFlag, targetSSH, magentoRoot, cfg)
+	if err != nil {
+		return nil, err
+	}
+	invalidator, err := NewCDNInvalidator(magentoRoot, cfg, stores)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := NewManifestSigner(magentoRoot, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setupTracing(); err != nil {
+		return nil, err
+	}
+	// The root span of the run; its spans are exported on exit
+	traceCtx, rootSpan := startSpan(context.Background(), "static-deploy", attribute.String("magento.content_version", version))
+	_, discoverySpan := startSpan(traceCtx, "discovery")
+
+	// Collect languages from positional arguments and --language flags
+	languages, err := expandLocales(magentoRoot, collectLanguages(), cfg)
+	if err != nil {
+		return nil, failTraced(rootSpan, err)
+	}
+	if len(languages) == 0 {
+		languages = []string{"en_US"} // Default
+	}
+
+	// Collect areas (default to frontend if not specified)
+	areas := areasFlag
+	if len(areas) == 0 {
+		areas = []string{"frontend"}
+	}
+
+	// Create deployment jobs, either for the given store views or for the locale/theme/area matrix
+	var jobs []DeployJob
+	if len(storesFlag) > 0 {
+		if len(themesFlag) > 0 || allThemes || len(collectLanguages()) > 0 {
+			return nil, failTraced(rootSpan, errors.New("--store cannot be combined with --theme, --all-themes or languages"))
+		}
+		jobs, err = createStoreDeployJobs(magentoRoot, storesFlag, areas, !noAreaThemes, debugLogs)
+		if err != nil {
+			return nil, failTraced(rootSpan, err)
+		}
+		languages = jobLocales(jobs)
+	} else {
+		// Collect themes (default if not specified)
+		themes := themesFlag
+		if allThemes {
+			themes = []string{"all"}
+		} else if len(themes) == 0 {
+			themes = []string{"Vendor/Hyva"}
+		}
+
+		// Resolve which themes to deploy per area
+		areaThemes := resolveAreaThemes(magentoRoot, themes, areas, !noAreaThemes, debugLogs)
+		themeCount := 0
+		for _, list := range areaThemes {
+			themeCount += len(list)
+		}
+		if themeCount == 0 {
+			return nil, failTraced(rootSpan, fmt.Errorf("no themes to deploy in %s: none installed or all excluded with --exclude-theme", strings.Join(areas, ", ")))
+		}
+		jobs = createDeployJobs(languages, areaThemes, areas)
+	}
+
+	// Deduplicate the job matrix and warn about suspicious jobs before starting work
+	jobs, warnings, err := checkJobMatrix(magentoRoot, jobs)
+	if err != nil {
+		return nil, failTraced(rootSpan, err)
+	}
+	for _, warning := range warnings {
+		logWarnf("%s", warning)
+	}
+
+	if len(onlyJobs) > 0 {
+		if jobs, err = filterOnlyJobs(jobs, onlyJobs); err != nil {
+			return nil, failTraced(rootSpan, err)
+		}
+	}
+
+	// Presets like dev only deploy the primary theme and locale
+	if preset.PrimaryOnly {
+		jobs = primaryJobs(jobs)
+	}
+
+	// Limit the jobs to the themes whose sources changed since a git ref
+	if sinceRef != "" {
+		// The files changed since the ref only limit the copies of this run, not of --watch
+		defer func() { sinceFiles = nil }()
+		jobs = filterJobsSince(magentoRoot, jobs, sinceRef, debugLogs)
+		if len(jobs) == 0 {
+			logInfof("No static content changes since %s", sinceRef)
+			report := &Report{Started: time.Now(), Jobs: []ReportJob{}}
+			report.finish(version, true)
+			publishReport(report, resultsOut, notifier, slack)
+			discoverySpan.End()
+			rootSpan.End()
+			finishTracing()
+			return nil, nil
+		}
+	}
+	themes := jobThemes(jobs)
+	discoverySpan.SetAttributes(attribute.Int("jobs", len(jobs)), attribute.StringSlice("magento.themes", themes), attribute.StringSlice("magento.locales", languages))
+	discoverySpan.End()
+
+	for _, theme := range traceThemes {
+		for _, area := range areas {
+			traceThemeResolution(runStdout, magentoRoot, area, theme)
+		}
+	}
+
+	numJobs := jobsFlag
+	if numJobs <= 0 {
+		numJobs = runtime.NumCPU()
+	}
+
+	if debugLogs {
+		logDebugf("Magento Static Content Deployer (Go)")
+		logDebugf("Root: %s", magentoRoot)
+		logDebugf("Languages: %v", languages)
+		logDebugf("Themes: %v", themes)
+		logDebugf("Areas: %v", areas)
+		logDebugf("Parallel Jobs: %d", numJobs)
+		logDebugf("Strategy: %s", strategyFlag)
+		logDebugf("Content version: %s", version)
+		if symlinkMode != "" {
+			logDebugf("Symlink mode: %s", symlinkMode)
+		}
+		logDebugf("")
+	}
+
+	if eventsPath != "" {
+		write, err := eventFileWriter(eventsPath, eventsOut)
+		if err != nil {
+			return nil, failTraced(rootSpan, err)
+		}
+		if callback := progress; callback != nil {
+			progress = func(event ProgressEvent) {
+				write(event)
+				callback(event)
+			}
+		} else {
+			progress = write
+		}
+	}
+	if progress != nil {
+		progressEvents = newEventEmitter(version, progress)
+	}
+	if progressFile != "" {
+		runProgress = newProgressTracker(progressFile, version)
+	}
+	deployState = newRunStateTracker(magentoRoot, version, deployOptionsKey(excludes), resumed)
+
+	runReport := &Report{Started: time.Now(), Jobs: []ReportJob{}, Warnings: warnings}
+
+	// failRun ends a run that failed before its jobs ran, with the report, --output and the
+	// notifications of the failure; the causes of ErrDeployFailed errors are reported already
+	failRun := func(err error) ([]DeployResult, error) {
+		if !errors.Is(err, ErrDeployFailed) {
+			runReport.Errors = append(runReport.Errors, err.Error())
+		}
+		runReport.finish(version, false)
+		publishReport(runReport, resultsOut, notifier, slack)
+		runProgress.Finish(false)
+		progressEvents.Finish(false, 0)
+		return nil, failTraced(rootSpan, err)
+	}
+
+	// Run theme build hooks so their output is deployed
+	if !noBuild {
+		runProgress.Phase("building")
+		_, span := startSpan(traceCtx, "theme builds")
+		err := runThemeBuilds(magentoRoot, jobs, cfg, verboseFlag)
+		endSpan(span, err)
+		if err != nil {
+			return failRun(err)
+		}
+	}
+
+	// Record the source of every deployed file for the manifest
+	if writeManifest || releaseNotes != "" {
+		deploySources = newSourceRecorder()
+	}
+
+	// Keep the current deployment for rollback
+	if keepPrevious {
+		if err := snapshotPreviousTree(magentoRoot, debugLogs); err != nil {
+			return failRun(fmt.Errorf("keeping previous deployment: %w", err))
+		}
+	}
+
+	// Classify themes into Hyvä and Luma
+	var hyvaThemes, lumaThemes []string
+	if noLumaDispatch {
+		// Treat all themes as Hyvä (user explicitly disabled Luma dispatch)
+		hyvaThemes = themes
+		if debugLogs {
+			logDebugf("Luma dispatch disabled - treating all themes as Hyvä")
+		}
+	} else {
+		hyvaThemes, lumaThemes = classifyThemes(magentoRoot, themes, areas, debugLogs)
+	}
+	// bin/magento always writes to pub/static, so with version directories either the Luma or
+	// the Hyvä themes would be missing from the URLs of the deployed version
+	if versionedDirs && len(lumaThemes) > 0 {
+		return failRun(fmt.Errorf("--versioned-dirs can't be used for themes deployed by bin/magento (%s): deploy them in a run without it, or use --no-luma-dispatch", strings.Join(lumaThemes, ", ")))
+	}
+
+	// Back up the current static content; bin/magento writes into files, so Luma themes need copies
+	if backupMode != "" {
+		runProgress.Phase("backup")
+		_, span := startSpan(traceCtx, "backup", attribute.String("mode", backupMode))
+		dest, err := backupStaticTree(magentoRoot, backupMode, len(lumaThemes) > 0, cfg.Backup.Retention, debugLogs)
+		endSpan(span, err)
+		if err != nil {
+			return failRun(fmt.Errorf("backing up pub/static: %w", err))
+		}
+		if dest != "" {
+			logInfof("Backed up pub/static to %s", dest)
+		}
+	}
+
+	// From here on a signal stops the run gracefully, with a partial summary, as do --timeout
+	// and the end of parent
+	ctx, cancel := context.WithCancel(trace.ContextWithSpan(parent, rootSpan))
+	defer cancel()
+	if shutdownSignals != nil {
+		defer context.AfterFunc(shutdownSignals.Graceful(), cancel)()
+	}
+	if runTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, runTimeout)
+		defer cancel()
+	}
+
+	hasErrors := false
+	start := time.Now()
+
+	hookEnv := runHookEnv(version, areas, themes, languages)
+	if err := runHooks("pre_deploy", cfg.Hooks.PreDeploy, magentoRoot, hookEnv, verboseFlag); err != nil {
+		logErrorf("%v", err)
+		runReport.Errors = append(runReport.Errors, err.Error())
+		if err := runHooks("on_failure", cfg.Hooks.OnFailure, magentoRoot, outcomeHookEnv(hookEnv, runReport, false), verboseFlag); err != nil {
+			logWarnf("%v", err)
+		}
+		return failRun(fmt.Errorf("%w: %w", ErrDeployFailed, err))
+	}
+
+	// bin/magento commands before the deployment, e.g. maintenance:enable; when one fails,
+	// nothing is deployed and only the 'always' commands run
+	if len(cfg.MagentoCommands) > 0 {
+		commands, err := runMagentoCommands(ctx, magentoRoot, php, cfg.MagentoCommands, []string{"before"}, verboseFlag)
+		runReport.Commands = append(runReport.Commands, commands...)
+		if err != nil {
+			logErrorf("%v", err)
+			runReport.Errors = append(runReport.Errors, err.Error())
+			runMagentoCommands(context.Background(), magentoRoot, php, cfg.MagentoCommands, []string{"always"}, verboseFlag)
+			if err := runHooks("on_failure", cfg.Hooks.OnFailure, magentoRoot, outcomeHookEnv(hookEnv, runReport, false), verboseFlag); err != nil {
+				logWarnf("%v", err)
+			}
+			return failRun(fmt.Errorf("%w: %w", ErrDeployFailed, err))
+		}
+	}
+	var deployed []DeployResult
+	var deployedJobs []ManifestJob
+	monitor := startResourceMonitor()
+
+	// With phases, bin/magento deploys the Luma jobs of each phase after its other jobs
+	var luma *lumaDispatch
+	if len(deployPhases) > 0 && len(lumaThemes) > 0 {
+		luma = &lumaDispatch{
+			Jobs: filterJobsByTheme(jobs, lumaThemes),
+			Deploy: func(ctx context.Context, jobs []DeployJob) error {
+				lumaCtx, span := startSpan(ctx, "luma themes", attribute.StringSlice("magento.themes", lumaThemes))
+				err := deployLumaJobs(lumaCtx, magentoRoot, php, jobs, numJobs, forceFlag, debugLogs, version)
+				endSpan(span, err)
+				if err != nil {
+					logErrorf("deploying Luma themes: %v", err)
+					runReport.Errors = append(runReport.Errors, fmt.Sprintf("deploying Luma themes: %v", err))
+				}
+				return err
+			},
+		}
+	}
+
+	// Deploy Hyvä themes using Go binary
+	if len(hyvaThemes) > 0 || luma != nil {
+		if debugLogs && len(lumaThemes) > 0 {
+			logDebugf("\nDeploying Hyvä themes using Go binary...")
+		}
+		results := deployStatic(
+			ctx,
+			magentoRoot,
+			filterJobsByTheme(jobs, hyvaThemes),
+			numJobs,
+			debugLogs,
+			version,
+			symlinkMode,
+			php,
+			excludes,
+			luma,
+		)
+
+		printResults(results, time.Since(start))
+		vendorScanErrors.Report(debugLogs)
+		runReport.addResults(results)
+		deployed = results
+		deployedJobs = manifestJobs(results)
+
+		// A failing post_job hook doesn't fail the job, its files are deployed
+		if len(cfg.Hooks.PostJob) > 0 {
+			for _, result := range results {
+				if err := runHooks("post_job", cfg.Hooks.PostJob, magentoRoot, jobHookEnv(version, result), verboseFlag); err != nil {
+					logWarnf("%v", err)
+				}
+			}
+		}
+
+		// Check for actual errors (not skipped themes)
+		for _, result := range results {
+			if result.Error != "" && !strings.Contains(result.Error, "theme not found") {
+				hasErrors = true
+				break
+			}
+		}
+
+		// Delete the files of the deployed themes that no longer have a source
+		if pruneFlag && !hasErrors {
+			pruned, err := pruneResults(magentoRoot, results, excludes)
+			if err != nil {
+				logErrorf("pruning stale files: %v", err)
+				runReport.Errors = append(runReport.Errors, fmt.Sprintf("pruning stale files: %v", err))
+				hasErrors = true
+			} else if pruned > 0 {
+				logInfof("Pruned %d stale file(s)", pruned)
+			} else {
+				logDebugf("Pruned %d stale file(s)", pruned)
+			}
+		}
+
+		// Compressed copies for the web server; after pruning, so none are written for stale
+		// files, and before the manifest, which lists them
+		if precompressAssets && !hasErrors {
+			_, span := startSpan(ctx, "precompress")
+			written, err := precompressResults(magentoRoot, results)
+			endSpan(span, err)
+			if err != nil {
+				logErrorf("precompressing: %v", err)
+				runReport.Errors = append(runReport.Errors, fmt.Sprintf("precompressing: %v", err))
+				hasErrors = true
+			} else {
+				logDebugf("Precompressed %d file(s)", written)
+			}
+		}
+	}
+
+	// Deploy Luma themes using bin/magento; with phases they were deployed phase by phase
+	if luma != nil {
+		for _, result := range luma.Results {
+			if result.Error != "" {
+				hasErrors = true
+			} else {
+				deployedJobs = append(deployedJobs, ManifestJob{Area: result.Job.Area, Theme: result.Job.Theme, Locale: result.Job.Locale})
+			}
+			deployed = append(deployed, result)
+		}
+	} else if len(lumaThemes) > 0 && ctx.Err() == nil {
+		runProgress.Phase("luma")
+		lumaCtx, span := startSpan(ctx, "luma themes", attribute.StringSlice("magento.themes", lumaThemes))
+		err := deployLumaThemes(lumaCtx, magentoRoot, php, lumaThemes, areas, languages, numJobs, forceFlag, debugLogs, version)
+		endSpan(span, err)
+		if err != nil {
+			logErrorf("deploying Luma themes: %v", err)
+			runReport.Errors = append(runReport.Errors, fmt.Sprintf("deploying Luma themes: %v", err))
+			hasErrors = true
+		}
+		// bin/magento deploys all jobs at once, they share its outcome
+		for _, job := range filterJobsByTheme(jobs, lumaThemes) {
+			result := DeployResult{Job: job, Attempts: 1}
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				deployedJobs = append(deployedJobs, ManifestJob{Area: job.Area, Theme: job.Theme, Locale: job.Locale})
+			}
+			deployed = append(deployed, result)
+		}
+	}
+
+	runProgress.Phase("finishing")
+
+	// Nothing is published after an interruption or timeout; the state file allows --resume
+	if ctx.Err() != nil {
+		reason := stopReason(ctx)
+		logWarnf("stopped, %v: deployed_version.txt is unchanged, run again with --resume to continue", reason)
+		runReport.Errors = append(runReport.Errors, reason.Error())
+		hasErrors = true
+	}
+
+	// Write the manifest and summarize the changes against the previous deployment's manifest
+	if (writeManifest || releaseNotes != "") && !hasErrors {
+		_, span := startSpan(ctx, "manifest")
+		previous, current, err := updateManifest(magentoRoot, deployedJobs)
+		if err == nil {
+			err = signer.Sign(filepath.Join(magentoRoot, "pub/static"))
+		}
+		endSpan(span, err)
+		if err != nil {
+			logErrorf("writing manifest: %v", err)
+			runReport.Errors = append(runReport.Errors, fmt.Sprintf("writing manifest: %v", err))
+			hasErrors = true
+		} else if releaseNotes != "" {
+			if err := writeReleaseNotes(magentoRoot, releaseNotes, previous, current); err != nil {
+				logErrorf("writing release notes: %v", err)
+				runReport.Errors = append(runReport.Errors, fmt.Sprintf("writing release notes: %v", err))
+				hasErrors = true
+			}
+		}
+	}
+
+	// Mirror the deployed tree to the warm standby
+	if standbyRoot != "" && !hasErrors {
+		if debugLogs {
+			logDebugf("\nSyncing standby %s...", standbyRoot)
+		}
+		_, span := startSpan(ctx, "standby sync")
+		report, err := syncStandby(magentoRoot, standbyRoot, time.Now(), debugLogs)
+		endSpan(span, err)
+		if err != nil {
+			logErrorf("syncing standby: %v", err)
+			runReport.Errors = append(runReport.Errors, fmt.Sprintf("syncing standby: %v", err))
+			hasErrors = true
+		} else {
+			logInfof("Standby in sync (version %s): %d copied, %d removed, %.1f MB, lag %.1fs",
+				report.Version, report.Copied, report.Deleted, float64(report.Bytes)/1024/1024, report.Lag.Seconds())
+		}
+	}
+
+	// Push the deployed tree to the web servers without shared storage
+	if len(targets) > 0 && !hasErrors {
+		if debugLogs {
+			logDebugf("\nPushing to %d target(s)...", len(targets))
+		}
+		_, span := startSpan(ctx, "push targets")
+		reports, err := pushTargets(targets, filepath.Join(magentoRoot, "pub/static"), version, debugLogs)
+		endSpan(span, err)
+		for _, report := range reports {
+			logInfof("Pushed to %s (release %s) in %.1fs", report.Target, report.Release, report.Duration.Seconds())
+		}
+		if err != nil {
+			logErrorf("pushing to targets: %v", err)
+			runReport.Errors = append(runReport.Errors, fmt.Sprintf("pushing to targets: %v", err))
+			hasErrors = true
+		}
+	}
+
+	// Upload the deployed tree to object storage, e.g. the origin of a CDN
+	var changedObjects []string
+	for _, store := range stores {
+		if hasErrors {
+			break
+		}
+		if debugLogs {
+			logDebugf("\nUploading to %s...", store)
+		}
+		_, span := startSpan(ctx, "upload")
+		report, err := uploadToRemote(store, filepath.Join(magentoRoot, "pub/static"), cfg.Remote, debugLogs)
+		endSpan(span, err)
+		if err != nil {
+			logErrorf("uploading to %s: %v", store, err)
+			runReport.Errors = append(runReport.Errors, fmt.Sprintf("uploading to %s: %v", store, err))
+			hasErrors = true
+		} else {
+			logInfof("Uploaded to %s (version %s): %d uploaded, %d unchanged, %d removed, %.1f MB",
+				report.Target, report.Version, report.Uploaded, report.Unchanged, report.Deleted, float64(report.Bytes)/1024/1024)
+			changedObjects = append(changedObjects, report.Changed...)
+		}
+	}
+
+	// Invalidate the objects the CDN may serve stale copies of; new files, e.g. below a new
+	// version prefix, were never cached
+	if invalidator != nil && !hasErrors {
+		_, span := startSpan(ctx, "cdn invalidation")
+		invalidated, err := invalidator.Invalidate(slices.Compact(slices.Sorted(slices.Values(changedObjects))))
+		endSpan(span, err)
+		for _, target := range invalidated {
+			logInfof("Invalidated %s", target)
+		}
+		if err != nil {
+			logErrorf("invalidating CDN: %v", err)
+			runReport.Errors = append(runReport.Errors, fmt.Sprintf("invalidating CDN: %v", err))
+			hasErrors = true
+		} else if len(changedObjects) == 0 && debugLogs {
+			logDebugf("No changed objects to invalidate")
+		}
+	}
+
+	// Flush the cached HTML and config still referencing the previous static content version
+	if cacheFlusher != nil && !hasErrors {
+		_, span := startSpan(ctx, "cache flush")
+		removed, err := cacheFlusher.Flush()
+		endSpan(span, err)
+		if err != nil {
+			logErrorf("flushing cache: %v", err)
+			runReport.Errors = append(runReport.Errors, fmt.Sprintf("flushing cache: %v", err))
+			hasErrors = true
+		} else {
+			for _, frontend := range sortedKeys(removed) {
+				logInfof("Flushed %d cache entries of %s (%s)", removed[frontend], frontend, strings.Join(cacheFlusher.tags, ", "))
+			}
+		}
+	}
+
+	// Purge the HTML with the previous static content URLs; after the cache flush, so Varnish
+	// isn't refilled from stale blocks
+	if purger != nil && !hasErrors {
+		_, span := startSpan(ctx, "purge")
+		purged, err := purger.Purge()
+		endSpan(span, err)
+		for _, target := range purged {
+			logInfof("Purged %s", target)
+		}
+		if err != nil {
+			logErrorf("purging: %v", err)
+			runReport.Errors = append(runReport.Errors, fmt.Sprintf("purging: %v", err))
+			hasErrors = true
+		}
+	}
+
+	// bin/magento commands after the deployment, e.g. cache:flush; 'always' commands also run
+	// after a failed or interrupted one, e.g. maintenance:disable
+	if len(cfg.MagentoCommands) > 0 {
+		moments := []string{"always"}
+		if !hasErrors {
+			moments = []string{"after", "always"}
+		}
+		_, span := startSpan(ctx, "magento commands")
+		commands, err := runMagentoCommands(context.Background(), magentoRoot, php, cfg.MagentoCommands, moments, verboseFlag)
+		endSpan(span, err)
+		runReport.Commands = append(runReport.Commands, commands...)
+		if err != nil {
+			logErrorf("%v", err)
+			runReport.Errors = append(runReport.Errors, err.Error())
+			hasErrors = true
+		}
+	}
+
+	if !hasErrors {
+		if err := runHooks("post_deploy", cfg.Hooks.PostDeploy, magentoRoot, outcomeHookEnv(hookEnv, runReport, true), verboseFlag); err != nil {
+			logErrorf("%v", err)
+			runReport.Errors = append(runReport.Errors, err.Error())
+			hasErrors = true
+		}
+	}
+	if hasErrors {
+		if err := runHooks("on_failure", cfg.Hooks.OnFailure, magentoRoot, outcomeHookEnv(hookEnv, runReport, false), verboseFlag); err != nil {
+			logWarnf("%v", err)
+		}
+	}
+
+	if reportFile != "" || resultsOut != nil || outputFormat == "github" || notifier != nil || slack != nil {
+		usage := monitor.Stop()
+		runReport.Resources = &usage
+		runReport.finish(version, !hasErrors)
+		if err := publishReport(runReport, resultsOut, notifier, slack); err != nil {
+			hasErrors = true
+		}
+	}
+
+	runProgress.Finish(!hasErrors)
+	progressEvents.Finish(!hasErrors, runReport.Files)
+	deployState.Finish(!hasErrors)
+
+	if hasErrors {
+		err := ErrDeployFailed
+		if len(runReport.Errors) > 0 {
+			err = fmt.Errorf("%w: %s", ErrDeployFailed, strings.Join(runReport.Errors, "; "))
+		}
+		return deployed, failTraced(rootSpan, err)
+	}
+	rootSpan.End()
+	finishTracing()
+	return deployed, nil
+}
+
+// publishReport writes the report of a finished run (--report, --output) and sends the
+// notifications of its outcome; it returns the error of writing the --report file
+func publishReport(report *Report, resultsOut io.Writer, notifier *Notifier, slack *SlackNotifier) error {
+	var err error
+	if reportFile != "" {
+		if err = writeReport(reportFile, report); err != nil {
+			logErrorf("writing report: %v", err)
+		}
+	}
+	if resultsOut != nil {
+		runStdout = resultsOut
+		writeReport("-", report)
+	}
+	if outputFormat == "github" {
+		printGitHubAnnotations(runStdout, report)
+		if err := writeGitHubStepSummary(report); err != nil {
+			logWarnf("no step summary written: %v", err)
+		}
+	}
+	// A failed notification doesn't fail the deploy, which is done by now
+	if err := notifier.Notify(report); err != nil {
+		logWarnf("notifying %s: %v", notifyURL, err)
+	}
+	if err := slack.Notify(report); err != nil {
+		logWarnf("notifying Slack: %v", err)
+	}
+	return err
+}
+
+// resetRunState clears the state a previous deploy in this process left behind
+func resetRunState() {
+	consoleProgress = nil
+	progressEvents = nil
+	runProgress = nil
+	deploySources = nil
+	deployChecksums = nil
+	sinceFiles = nil
+	filesProcessed.Store(0)
+	vendorScanErrors = &scanErrorLog{paths: make(map[string]map[string]bool)}
+}
+
+// newPHPRunnerFromFlags creates the PHP runner from the --php* flags, falling back to the
+// PHP_BINARY and PHP_MEMORY_LIMIT environment variables when the flags aren't given
+func newPHPRunnerFromFlags() (*PHPRunner, error) {
+	binary := phpBinary
+	if env := os.Getenv("PHP_BINARY"); env != "" && !flag.CommandLine.Changed("php") {
+		binary = env
+	}
+
+	memoryLimit := phpMemoryLimit
+	if env := os.Getenv("PHP_MEMORY_LIMIT"); env != "" && memoryLimit == "" {
+		memoryLimit = env
+	}
+
+	iniSettings := phpIni
+	if memoryLimit != "" {
+		iniSettings = append([]string{"memory_limit=" + memoryLimit}, iniSettings...)
+	}
+
+	return NewPHPRunner(magentoRoot, binary, phpExec, phpExecRoot, iniSettings)
+}
+
+// collectLanguages gathers languages from both positional args and --language flags
+func collectLanguages() []string {
+	var languages []string
+
+	// Add languages from --language/-l flags
+	languages = append(languages, languagesFlag...)
+
+	// Add positional arguments (space-separated languages like Magento)
+	languages = append(languages, flag.Args()...)
+
+	// Remove duplicates while preserving order
+	seen := make(map[string]bool)
+	unique := []string{}
+	for _, lang := range languages {
+		if !seen[lang] {
+			seen[lang] = true
+			unique = append(unique, lang)
+		}
+	}
+
+	return unique
+}
+
+// expandLocales resolves 'auto' and 'all' to the locales of the configured store views and
+// locale group names from the config file to their locales, removing duplicates
+func expandLocales(magentoRoot string, languages []string, cfg *Config) ([]string, error) {
+	var expanded []string
+	seen := make(map[string]bool)
+	add := func(locale string) {
+		if !seen[locale] {
+			seen[locale] = true
+			expanded = append(expanded, locale)
+		}
+	}
+
+	for _, lang := range languages {
+		if group, ok := cfg.LocaleGroups[lang]; ok {
+			for _, locale := range group {
+				add(locale)
+			}
+			continue
+		}
+
+		if lang == "auto" {
+			locales, err := autoLocales(magentoRoot)
+			if err != nil {
+				return nil, fmt.Errorf("cannot resolve --language auto: %w", err)
+			}
+			for _, locale := range locales {
+				add(locale)
+			}
+			continue
+		}
+
+		if lang == "all" {
+			storeCfg, err := loadStoreConfig(magentoRoot)
+			if err != nil {
+				return nil, fmt.Errorf("cannot resolve --language all: %w", err)
+			}
+			for _, locale := range storeCfg.Locales() {
+				add(locale)
+			}
+			continue
+		}
+
+		add(lang)
+	}
+
+	return expanded, nil
+}
+
+// localeAliases maps custom locale codes to the locale they fall back to (locale_aliases in the config file)
+var localeAliases map[string]string
+
+// localeFallbacks returns locale followed by the locales it falls back to through localeAliases,
+// e.g. de_CH_x -> [de_CH_x de_CH de_DE]
+func localeFallbacks(locale string) []string {
+	fallbacks := []string{locale}
+	seen := map[string]bool{locale: true}
+	for {
+		base, ok := localeAliases[locale]
+		if !ok || seen[base] {
+			return fallbacks
+		}
+		seen[base] = true
+		fallbacks = append(fallbacks, base)
+		locale = base
+	}
+}
+
+// deployStatic orchestrates the parallel deployment
+func deployStatic(ctx context.Context, magentoRoot string, jobs []DeployJob, numJobs int, verbose bool, version string, symlinkMode string, php *PHPRunner, excludes []string, luma *lumaDispatch) []DeployResult {
+	useSymlink := (symlinkMode == "file" || symlinkMode == "locale")
+
+	// Locale-level symlink mode: only deploy the first locale per (theme, area)
+	// group and create directory symlinks for the rest
+	type themeAreaKey struct{ Theme, Area string }
+	var kept map[themeAreaKey]string
+	var deferred map[themeAreaKey][]string
+
+	if symlinkMode == "locale" {
+		kept = make(map[themeAreaKey]string)
+		deferred = make(map[themeAreaKey][]string)
+		var filteredJobs []DeployJob
+
+		for _, job := range jobs {
+			key := themeAreaKey{job.Theme, job.Area}
+			if _, exists := kept[key]; !exists {
+				kept[key] = job.Locale
+				filteredJobs = append(filteredJobs, job)
+			} else {
+				deferred[key] = append(deferred[key], job.Locale)
+			}
+		}
+		jobs = filteredJobs
+	}
+
+	// Jobs completed by the interrupted run being resumed aren't deployed again
+	var resumedResults []DeployResult
+	var pending []DeployJob
+	for _, job := range jobs {
+		if state, ok := deployState.Completed(job); ok {
+			deployState.Resumed(job, state)
+			resumedResults = append(resumedResults, DeployResult{Job: job, FilesCount: state.Files})
+			continue
+		}
+		pending = append(pending, job)
+	}
+	if len(resumedResults) > 0 {
+		logInfof("Resuming: %d of %d jobs were completed by the interrupted run", len(resumedResults), len(jobs))
+	}
+	jobs = pending
+
+	if verbose {
+		logDebugf("Created %d deployment jobs", len(jobs))
+		logDebugf("Deployment version: %s\n", version)
+	}
+
+	// Scan the vendor packages once for all jobs
+	_, indexSpan := startSpan(ctx, "vendor index")
+	index := loadVendorIndex(magentoRoot, scanJobsFlag, !noCache)
+	indexSpan.End()
+
+	// Compare deployed files by content hash, with the hashes of the previous run
+	if compareMode == "checksum" {
+		deployChecksums = loadChecksumStore(deployRoot(magentoRoot, version), hashAlgorithm)
+	}
+
+	// Process jobs in parallel, phase by phase when phases are configured
+	runProgress.Jobs(len(jobs))
+	consoleProgress.Start(len(jobs))
+	progressEvents.Start(len(jobs))
+	results := append(resumedResults, processPhases(ctx, magentoRoot, jobs, numJobs, verbose, version, useSymlink, index, excludes, luma)...)
+	consoleProgress.Stop()
+	progressEvents.Stop()
+
+	if deployChecksums != nil {
+		if err := deployChecksums.Save(); err != nil {
+			logWarnf("failed to save checksums: %v", err)
+		}
+	}
+
+	// Create directory symlinks for deferred locales (locale-level symlink mode)
+	var symlinkLocaleResults []DeployResult
+	if symlinkMode == "locale" && deferred != nil {
+		for key, otherLocales := range deferred {
+			firstLocale := kept[key]
+			firstDir := filepath.Join(deployRoot(magentoRoot, version), key.Area, key.Theme, firstLocale)
+
+			// Find the result for the first locale to get file count
+			var firstResult *DeployResult
+			for i := range results {
+				if results[i].Job.Theme == key.Theme && results[i].Job.Area == key.Area && results[i].Job.Locale == firstLocale {
+					firstResult = &results[i]
+					break
+				}
+			}
+
+			for _, otherLocale := range otherLocales {
+				otherDir := filepath.Join(deployRoot(magentoRoot, version), key.Area, key.Theme, otherLocale)
+
+				// Remove existing directory/symlink if present
+				os.RemoveAll(otherDir)
+
+				// Create relative symlink: otherLocale -> firstLocale
+				// Since both are siblings under the same parent, relative path is just the first locale name
+				relTarget, _ := filepath.Rel(filepath.Dir(otherDir), firstDir)
+				err := os.Symlink(relTarget, otherDir)
+
+				result := DeployResult{
+					Job:           DeployJob{Locale: otherLocale, Theme: key.Theme, Area: key.Area},
+					Symlinked:     true,
+					SymlinkTarget: firstLocale,
+				}
+				if err != nil {
+					result.Error = fmt.Sprintf("failed to create locale symlink: %v", err)
+				} else if firstResult != nil {
+					result.FilesCount = firstResult.FilesCount
+				}
+				symlinkLocaleResults = append(symlinkLocaleResults, result)
+			}
+		}
+		results = append(results, symlinkLocaleResults...)
+	}
+
+	// Compile LESS files (email CSS and layout CSS) after file copying is complete
+	runProgress.Phase("compiling")
+	compileLessForResults(ctx, magentoRoot, deployRoot(magentoRoot, version), php, results, numJobs, verbose)
+	if !noCache {
+		removed, err := pruneLessCache(magentoRoot, lessCacheMaxAge, time.Now())
+		if err != nil {
+			logWarnf("failed to prune the compiled CSS cache: %v", err)
+		} else if verbose && removed > 0 {
+			logDebugf("%s Removed %d unused compiled CSS cache entr(y/ies)", symOK, removed)
+		}
+	}
+
+	// Create deployment version file if any files were deployed
+	totalFiles := int64(0)
+	for _, result := range results {
+		totalFiles += result.FilesCount
+	}
+	// A version only stands for a complete matrix unless --version-on=any-success
+	failed := failedJobs(results)
+	if ctx.Err() != nil {
+		// Interrupted runs never publish their version
+	} else if totalFiles > 0 && failed > 0 && versionOn == "all-success" {
+		logWarnf("%d job(s) failed, deployed_version.txt is not updated to %s (--version-on=all-success)", failed, version)
+	} else if totalFiles > 0 {
+		previous, _ := os.ReadFile(filepath.Join(magentoRoot, "pub/static/deployed_version.txt"))
+		_, span := startSpan(ctx, "version file", attribute.String("magento.content_version", version))
+		endSpan(span, createDeploymentVersionFile(magentoRoot, version, verbose))
+
+		// Only the new and the previous version directory are needed from now on
+		if versionedDirs {
+			removed, err := removeOldVersionDirs(magentoRoot, version, strings.TrimSpace(string(previous)))
+			if err != nil {
+				logWarnf("failed to remove old version directories: %v", err)
+			}
+			if verbose && len(removed) > 0 {
+				logDebugf("%s Removed %d old version director(y/ies)", symOK, len(removed))
+			}
+		}
+	}
+
+	return results
+}
+
+// compileLessForResults compiles LESS files for all successful deployment results
+// Jobs are compiled in parallel (each uses its own staging directory); verbose logs
+// are buffered per job so they aren't interleaved
+func compileLessForResults(ctx context.Context, magentoRoot string, root string, php *PHPRunner, results []DeployResult, numJobs int, verbose bool) {
+	if verbose {
+		logDebugf("\nCompiling CSS...")
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, numJobs)
+
+	for _, result := range results {
+		if result.Error != "" || result.Symlinked {
+			continue // Skip failed deployments and symlinked locales
+		}
+		if ctx.Err() != nil {
+			break // Interrupted, don't start new compilations
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(job DeployJob) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			destDir := filepath.Join(root, job.Area, job.Theme, job.Locale)
+
+			lessCtx, span := startSpan(ctx, "less", jobSpanAttrs(job)...)
+			defer span.End()
+
+			var out logBuffer
+			log := out.Logger().With(jobAttrs(job)...)
+			if verbose {
+				log.Debug(fmt.Sprintf("  %s/%s (%s):", job.Theme, job.Area, job.Locale))
+			}
+
+			// Use preprocessor to handle Magento's complex LESS structure
+			preprocessor := NewLessPreprocessor(lessCtx, magentoRoot, php, verbose, !noCache, log)
+			err := preprocessor.PreprocessAndCompile(destDir, job.Area, job.Theme, job.Locale)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				if verbose {
+					log.Debug(fmt.Sprintf("    %s LESS preprocessing error: %v", symFail, err), "error", err)
+				}
+			}
+			progressEvents.CompileFinished(job, err)
+
+			out.Flush()
+		}(result.Job)
+	}
+
+	wg.Wait()
+
+	if verbose {
+		logDebugf("")
+	}
+}
+
+// createDeployJobs generates all combinations of locales/themes/areas to deploy
+func createDeployJobs(locales []string, areaThemes map[string][]string, areas []string) []DeployJob {
+	var jobs []DeployJob
+
+	for _, locale := range locales {
+		for _, area := range areas {
+			for _, theme := range areaThemes[area] {
+				jobs = append(jobs, DeployJob{
+					Locale: locale,
+					Theme:  theme,
+					Area:   area,
+				})
+			}
+		}
+	}
+
+	return jobs
+}
+
+// defaultAreaThemes lists the standard theme candidates per area, in order of preference
+// The first candidate that exists is used; otherwise the first candidate is used as-is
+// (bin/magento resolves it through the theme registration)
+var defaultAreaThemes = map[string][]string{
+	"adminhtml": {"Magento/backend", "MageOS/m137-admin-theme"},
+}
+
+// resolveAreaThemes determines which themes to deploy for each area
+// Theme patterns ('all', 'Vendor/*') are expanded to the themes discovered in each area
+// When expand is true, areas for which none of the given themes exist get the
+// standard theme for that area (e.g. Magento/backend for adminhtml) instead of
+// producing jobs that are guaranteed to be skipped as "theme not found"
+func resolveAreaThemes(magentoRoot string, themes, areas []string, expand bool, verbose bool) map[string][]string {
+	areaThemes := make(map[string][]string)
+
+	for _, area := range areas {
+		areaThemes[area] = excludeThemePatterns(expandThemePatterns(magentoRoot, area, themes), excludeThemes, verbose)
+		if !expand {
+			continue
+		}
+
+		candidates, ok := defaultAreaThemes[area]
+		if !ok {
+			continue
+		}
+
+		found := false
+		for _, theme := range areaThemes[area] {
+			if themeExists(magentoRoot, area, theme) {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		defaultTheme := candidates[0]
+		for _, candidate := range candidates {
+			if themeExists(magentoRoot, area, candidate) {
+				defaultTheme = candidate
+				break
+			}
+		}
+
+		areaThemes[area] = []string{defaultTheme}
+		if verbose {
+			logDebugf("No given theme exists in %s area - using %s", area, defaultTheme)
+		}
+	}
+
+	return areaThemes
+}
+
+// jobThemes returns the themes of the given jobs without duplicates, preserving order
+func jobThemes(jobs []DeployJob) []string {
+	seen := make(map[string]bool)
+	var themes []string
+
+	for _, job := range jobs {
+		if !seen[job.Theme] {
+			seen[job.Theme] = true
+			themes = append(themes, job.Theme)
+		}
+	}
+
+	return themes
+}
+
+// jobLocales returns the locales of the given jobs without duplicates, preserving order
+func jobLocales(jobs []DeployJob) []string {
+	seen := make(map[string]bool)
+	var locales []string
+
+	for _, job := range jobs {
+		if !seen[job.Locale] {
+			seen[job.Locale] = true
+			locales = append(locales, job.Locale)
+		}
+	}
+
+	return locales
+}
+
+// filterJobsByTheme returns the jobs deploying one of the given themes
+func filterJobsByTheme(jobs []DeployJob, themes []string) []DeployJob {
+	allowed := make(map[string]bool)
+	for _, theme := range themes {
+		allowed[theme] = true
+	}
+
+	var filtered []DeployJob
+	for _, job := range jobs {
+		if allowed[job.Theme] {
+			filtered = append(filtered, job)
+		}
+	}
+
+	return filtered
+}
+
+// themeExists checks if a theme can be found
+func themeExists(magentoRoot string, area string, themeName string) bool {
+	sourceDirs := []string{
+		filepath.Join(magentoRoot, "app/design", area, themeName),
+		filepath.Join(magentoRoot, getVendorThemePath(area, themeName)),
+	}
+
+	for _, dir := range sourceDirs {
+		if _, err := os.Stat(dir); err == nil {
+			return true
+		}
+	}
+
+	// Fall back to themes registered by vendor packages (registration.php)
+	return findRegisteredTheme(magentoRoot, area, themeName) != ""
+}
+
+// getThemePath returns the physical path of a theme
+func getThemePath(magentoRoot string, area string, themeName string) string {
+	// Check app/design first
+	appDesignPath := filepath.Join(magentoRoot, "app/design", area, themeName)
+	if _, err := os.Stat(appDesignPath); err == nil {
+		return appDesignPath
+	}
+
+	// Check vendor path
+	vendorPath := filepath.Join(magentoRoot, getVendorThemePath(area, themeName))
+	if _, err := os.Stat(vendorPath); err == nil {
+		return vendorPath
+	}
+
+	// Check themes registered by vendor packages under a non-standard package name
+	return findRegisteredTheme(magentoRoot, area, themeName)
+}
+
+// getThemeParent reads theme.xml and returns the parent theme name
+func getThemeParent(themePath string) string {
+	themeXmlPath := filepath.Join(themePath, "theme.xml")
+	data, err := os.ReadFile(themeXmlPath)
+	if err != nil {
+		return ""
+	}
+
+	var config ThemeConfig
+	if err := xml.Unmarshal(data, &config); err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(config.Parent)
+}
+
+// getThemeParentChain builds the complete parent theme chain for a theme
+// Returns themes in order from the theme itself to its most distant ancestor
+// e.g., for GHDE/default -> [GHDE/default, GHNL/default, Sudac/default, Hyva/reset]
+// This order ensures child theme files are copied first and not overwritten by parent files
+func getThemeParentChain(magentoRoot string, area string, themeName string) []string {
+	var chain []string
+	visited := make(map[string]bool)
+	current := themeName
+
+	for current != "" && !visited[current] {
+		visited[current] = true
+		chain = append(chain, current) // Append to get child-first order
+
+		themePath := getThemePath(magentoRoot, area, current)
+		if themePath == "" {
+			break
+		}
+
+		current = getThemeParent(themePath)
+	}
+
+	return chain
+}
+
+// isHyvaTheme checks if a theme is Hyvä-based by checking its parent chain
+func isHyvaTheme(magentoRoot string, area string, themeName string, visited map[string]bool) bool {
+	// Prevent infinite loops
+	if visited[themeName] {
+		return false
+	}
+	visited[themeName] = true
+
+	// Check if this theme is a known Hyvä theme
+	hyvaThemes := []string{
+		"Hyva/default",
+		"Hyva/reset",
+	}
+	for _, hyva := range hyvaThemes {
+		if themeName == hyva {
+			return true
+		}
+	}
+
+	// Check for Tailwind config file (strong indicator of Hyvä)
+	themePath := getThemePath(magentoRoot, area, themeName)
+	if themePath != "" {
+		tailwindPaths := []string{
+			filepath.Join(themePath, "web/tailwind/tailwind.config.js"),
+			filepath.Join(themePath, "web/tailwind/tailwind.config.cjs"),
+			filepath.Join(themePath, "web/tailwind/tailwind-source.css"),
+		}
+		for _, tailwindPath := range tailwindPaths {
+			if _, err := os.Stat(tailwindPath); err == nil {
+				return true
+			}
+		}
+
+	}
+
+	// Check parent theme
+	if themePath != "" {
+		parent := getThemeParent(themePath)
+		if parent != "" {
+			return isHyvaTheme(magentoRoot, area, parent, visited)
+		}
+	}
+
+	return false
+}
+
+// classifyThemes separates themes into Hyvä and Luma categories
+func classifyThemes(magentoRoot string, themes []string, areas []string, verbose bool) (hyvaThemes []string, lumaThemes []string) {
+	// Check each theme against each area (a theme might be Hyvä in frontend but not exist in adminhtml)
+	themeClassification := make(map[string]bool) // true = Hyvä, false = Luma
+
+	for _, theme := range themes {
+		isHyva := false
+		for _, area := range areas {
+			if themeExists(magentoRoot, area, theme) {
+				visited := make(map[string]bool)
+				if isHyvaTheme(magentoRoot, area, theme, visited) {
+					isHyva = true
+					break
+				}
+			}
+		}
+		themeClassification[theme] = isHyva
+	}
+
+	for theme, isHyva := range themeClassification {
+		if isHyva {
+			hyvaThemes = append(hyvaThemes, theme)
+			if verbose {
+				logDebugf("%s%s detected as Hyvä theme", symTheme, theme)
+			}
+		} else {
+			lumaThemes = append(lumaThemes, theme)
+			if verbose {
+				logDebugf("%s%s detected as Luma theme", symTheme, theme)
+			}
+		}
+	}
+
+	return hyvaThemes, lumaThemes
+}
+
+// deployLumaThemes dispatches Luma theme deployment to bin/magento; canceling ctx stops it
+func deployLumaThemes(ctx context.Context, magentoRoot string, php *PHPRunner, themes []string, areas []string, languages []string, numJobs int, force bool, verbose bool, contentVersion string) error {
+	if len(themes) == 0 {
+		return nil
+	}
+
+	logInfof("\nDispatching Luma themes to bin/magento...")
+
+	// Build the command arguments
+	args := []string{php.Path(filepath.Join(magentoRoot, "bin/magento")), "setup:static-content:deploy"}
+
+	if force {
+		args = append(args, "-f")
+	}
+
+	for _, area := range areas {
+		args = append(args, "--area="+area)
+	}
+
+	for _, theme := range themes {
+		args = append(args, "--theme="+theme)
+	}
+
+	if numJobs > 0 {
+		args = append(args, fmt.Sprintf("--jobs=%d", numJobs))
+	}
+
+	if contentVersion != "" {
+		args = append(args, "--content-version="+contentVersion)
+	}
+
+	// Add languages as positional arguments
+	args = append(args, languages...)
+
+	// Show the command being executed
+	cmdStr := php.String() + " " + strings.Join(args, " ")
+	logInfof("Executing: %s\n", cmdStr)
+
+	// Execute the command
+	cmd := php.CommandContext(ctx, args...)
+	cmd.Stdout = runStdout
+	cmd.Stderr = runStderr
+
+	return cmd.Run()
+}
+
+// deployLumaJobs dispatches jobs to bin/magento, which deploys every combination of the areas,
+// themes and locales it is given: one run per area and set of locales
+func deployLumaJobs(ctx context.Context, magentoRoot string, php *PHPRunner, jobs []DeployJob, numJobs int, force bool, verbose bool, contentVersion string) error {
+	type areaTheme struct{ Area, Theme string }
+	var keys []areaTheme
+	locales := make(map[areaTheme][]string)
+	for _, job := range jobs {
+		key := areaTheme{job.Area, job.Theme}
+		if _, ok := locales[key]; !ok {
+			keys = append(keys, key)
+		}
+		locales[key] = append(locales[key], job.Locale)
+	}
+
+	// Themes of an area with the same locales share a run
+	type magentoRun struct {
+		Area    string
+		Themes  []string
+		Locales []string
+	}
+	var runs []*magentoRun
+	for _, key := range keys {
+		i := slices.IndexFunc(runs, func(run *magentoRun) bool {
+			return run.Area == key.Area && slices.Equal(run.Locales, locales[key])
+		})
+		if i < 0 {
+			runs = append(runs, &magentoRun{Area: key.Area, Locales: locales[key]})
+			i = len(runs) - 1
+		}
+		runs[i].Themes = append(runs[i].Themes, key.Theme)
+	}
+
+	for _, run := range runs {
+		if err := deployLumaThemes(ctx, magentoRoot, php, run.Themes, []string{run.Area}, run.Locales, numJobs, force, verbose, contentVersion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deployTask wraps a job and result tracking
+type deployTask struct {
+	job       DeployJob
+	resultIdx int
+	results   []DeployResult
+}
+
+// worker processes deployment jobs
+func worker(ctx context.Context, wg *sync.WaitGroup, jobChan <-chan *deployTask, magentoRoot string, verbose bool, version string, useSymlink bool, pool *filePool, index *VendorIndex, excludes []string) {
+	defer wg.Done()
+
+	for task := range jobChan {
+		// After an interruption the remaining jobs are reported, not started
+		if ctx.Err() != nil {
+			task.results[task.resultIdx] = DeployResult{
+				Job:   task.job,
+				Error: fmt.Sprintf("%s/%s (%s): %v", task.job.Theme, task.job.Area, task.job.Locale, stopReason(ctx)),
+			}
+			continue
+		}
+
+		start := time.Now()
+		runProgress.JobStarted(task.resultIdx, task.job)
+		consoleProgress.JobStarted(task.job)
+		deployState.JobStarted(task.job)
+		progressEvents.JobStarted(task.job)
+		jobCtx, span := startSpan(ctx, "deploy job", jobSpanAttrs(task.job)...)
+		var fileCount int64
+		var err error
+		attempts := 0
+		for {
+			attempts++
+			fileCount, err = deployWithTimeout(jobCtx, pool, func(ctx context.Context) (int64, error) {
+				return deployTheme(ctx, magentoRoot, task.job, version, useSymlink, pool, index, excludes)
+			})
+			if err == nil || attempts > jobRetries || !retryableJobError(ctx, err) {
+				break
+			}
+			if verbose {
+				logger.Debug(fmt.Sprintf("%s %s/%s (%s) - attempt %d failed: %v, retrying in %s", symRetry, task.job.Theme, task.job.Area, task.job.Locale, attempts, err, retryBackoff(attempts)),
+					append(jobAttrs(task.job), "attempt", attempts, "error", err)...)
+			}
+			span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempts), attribute.String("error", err.Error())))
+			if !sleepRetry(ctx, attempts) {
+				break
+			}
+		}
+		span.SetAttributes(attribute.Int64("files", fileCount), attribute.Int("attempts", attempts))
+
+		result := DeployResult{
+			Job:        task.job,
+			FilesCount: fileCount,
+			Duration:   time.Since(start),
+			Attempts:   attempts,
+		}
+
+		if err != nil {
+			// Check if it's a "not found" error - if so, mark as skipped instead of error
+			if strings.Contains(err.Error(), "theme directory not found") {
+				result.Error = "" // Don't treat as error
+				if verbose {
+					logger.Debug(fmt.Sprintf("%s %s/%s (%s) - theme not found (skipped), see --trace-resolution=%s", symSkip, task.job.Theme, task.job.Area, task.job.Locale, task.job.Theme),
+						append(jobAttrs(task.job), "status", "skipped")...)
+				}
+			} else {
+				result.Error = fmt.Sprintf("%s/%s (%s): %v", task.job.Theme, task.job.Area, task.job.Locale, err)
+				if verbose {
+					logger.Debug(fmt.Sprintf("%s %s/%s (%s) - %v%s", symFail, task.job.Theme, task.job.Area, task.job.Locale, err, attemptsNote(attempts)),
+						append(jobAttrs(task.job), "status", "failed", "error", err, "attempts", attempts)...)
+				}
+			}
+		} else {
+			deployState.JobDone(task.job, fileCount)
+			if verbose {
+				logger.Debug(fmt.Sprintf("%s %s/%s (%s) - %d files - %.1fs%s", symOK, task.job.Theme, task.job.Area, task.job.Locale, fileCount, result.Duration.Seconds(), attemptsNote(attempts)),
+					append(jobAttrs(task.job), "status", "deployed", "files", fileCount, "duration", result.Duration.Seconds(), "attempts", attempts)...)
+			}
+		}
+
+		if result.Error != "" {
+			endSpan(span, err)
+		} else {
+			span.End()
+		}
+		task.results[task.resultIdx] = result
+		runProgress.JobDone(task.job)
+		consoleProgress.JobDone(task.job, result.Error != "")
+		progressEvents.JobFinished(result)
+	}
+}
+
+// processJobs executes deployment jobs with parallelization
+func processJobs(ctx context.Context, magentoRoot string, jobs []DeployJob, numJobs int, verbose bool, version string, useSymlink bool, index *VendorIndex, excludes []string) []DeployResult {
+	results := make([]DeployResult, len(jobs))
+	jobChan := make(chan *deployTask, numJobs)
+	var wg sync.WaitGroup
+
+	// File copies of all jobs share one pool, so a single job still uses all workers
+	pool := newFilePool(numJobs)
+	defer pool.Close()
+
+	// Start worker goroutines
+	for i := 0; i < numJobs; i++ {
+		wg.Add(1)
+		go worker(ctx, &wg, jobChan, magentoRoot, verbose, version, useSymlink, pool, index, excludes)
+	}
+
+	// Send jobs to channel
+	go func() {
+		for i := range jobs {
+			jobChan <- &deployTask{
+				job:       jobs[i],
+				resultIdx: i,
+				results:   results,
+			}
+		}
+		close(jobChan)
+	}()
+
+	wg.Wait()
+	return results
+}
+
+// deployTheme handles the actual deployment for a theme/locale/area
+// For Hyva-based themes, this copies from:
+// 1. Theme web directory: app/design/{area}/{vendor}/{theme}/web (including parent themes)
+// 2. Library files: vendor/mage-os/magento2-base/lib/web/
+// 3. Extension view files from multiple locations:
+//   - vendor/*/view/{area}/web/
+//   - vendor/*/src/view/{area}/web/
+//   - vendor/*/view/base/web/
+//   - vendor/*/src/view/base/web/
+//
+// The sources are walked in priority order while the file copies run on pool (nil to copy synchronously)
+// index is the shared vendor scan; nil scans the vendor packages for this job
+func deployTheme(ctx context.Context, magentoRoot string, job DeployJob, version string, useSymlink bool, pool *filePool, index *VendorIndex, excludes []string) (int64, error) {
+	// Get the theme vendor/name
+	parts := strings.Split(job.Theme, "/")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid theme name: %s", job.Theme)
+	}
+
+	// Destination directory - deploy to pub/static/ (nginx handles versioning via URL rewriting),
+	// or pub/static/version{N}/ with --versioned-dirs
+	destDir := filepath.Join(deployRoot(magentoRoot, version), job.Area, job.Theme, job.Locale)
+
+	// Create destination directory
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	copier := newFileCopier(ctx, pool, useSymlink, job)
+	// Files placed before an interruption are up to date, so they aren't forced again
+	copier.force = forceFlag && !deployState.Interrupted(job)
+	copier.since = sinceFiles
+	copier.excludes = excludes
+	fileCount, err := queueThemeFiles(magentoRoot, job, destDir, copier, index)
+	if err != nil {
+		copier.Wait(magentoRoot)
+		return 0, err
+	}
+
+	if err := copier.Wait(magentoRoot); err != nil {
+		return fileCount, err
+	}
+
+	if fileCount == 0 {
+		return 0, fmt.Errorf("theme directory not found for %s/%s", job.Area, job.Theme)
+	}
+
+	return fileCount, nil
+}
+
+// queueThemeFiles walks the sources of a job in priority order and queues their files on copier,
+// returning the number of files
+func queueThemeFiles(magentoRoot string, job DeployJob, destDir string, copier *fileCopier, index *VendorIndex) (int64, error) {
+	var fileCount int64
+
+	// 1. Build parent theme chain and copy from all themes (child-first so child files take priority)
+	// e.g., for GHDE/default: [GHDE/default, GHNL/default, Sudac/default, Hyva/reset]
+	// Since copyDirectory skips claimed files, child theme files won't be overwritten by parents
+	themeChain := getThemeParentChain(magentoRoot, job.Area, job.Theme)
+
+	// Theme sources from the config file are queued between the standard sources by priority
+	queueSources := func(low int, high int) error {
+		count, err := queueThemeSources(magentoRoot, themeSourcesBetween(job.Theme, low, high), destDir, copier)
+		fileCount += count
+		return err
+	}
+	if err := queueSources(themeSourcePriority, math.MaxInt); err != nil {
+		return 0, err
+	}
+
+	for _, chainTheme := range themeChain {
+		chainParts := strings.Split(chainTheme, "/")
+		if len(chainParts) != 2 {
+			continue
+		}
+		chainVendor := chainParts[0]
+		chainName := chainParts[1]
+
+		// Try app/design path first
+		themeWebDir := filepath.Join(magentoRoot, "app/design", job.Area, chainVendor, chainName, "web")
+		if _, err := os.Stat(themeWebDir); err == nil {
+			count, err := copyDirectory(themeWebDir, destDir, copier)
+			if err != nil {
+				// Log but continue with other themes in chain
+				continue
+			}
+			fileCount += count
+		}
+
+		// Also try vendor path for themes installed via composer
+		vendorThemePath := getThemePath(magentoRoot, job.Area, chainTheme)
+		if vendorThemePath != "" {
+			vendorWebDir := filepath.Join(vendorThemePath, "web")
+			if _, err := os.Stat(vendorWebDir); err == nil {
+				count, err := copyDirectory(vendorWebDir, destDir, copier)
+				if err != nil {
+					continue
+				}
+				fileCount += count
+			}
+		}
+
+		// 1b. Copy theme module overrides (app/design/{area}/{vendor}/{theme}/{ModuleName}/web/)
+		// These override module web assets in the theme
+		themeBaseDir := filepath.Join(magentoRoot, "app/design", job.Area, chainVendor, chainName)
+		if themeEntries, err := os.ReadDir(themeBaseDir); err == nil {
+			for _, entry := range themeEntries {
+				// Skip non-directories and the "web" directory itself
+				if !entry.IsDir() || entry.Name() == "web" {
+					continue
+				}
+				// Check if this is a module override (contains a web directory)
+				moduleWebDir := filepath.Join(themeBaseDir, entry.Name(), "web")
+				if _, err := os.Stat(moduleWebDir); err == nil {
+					// This is a module override - deploy to ModuleName/ prefix
+					moduleName := entry.Name()
+					count, err := copyDirectoryWithModulePrefix(moduleWebDir, destDir, moduleName, copier)
+					if err != nil {
+						continue
+					}
+					fileCount += count
+				}
+			}
+		}
+	}
+
+	if err := queueSources(libSourcePriority, themeSourcePriority); err != nil {
+		return 0, err
+	}
+
+	// 2. Copy lib files from multiple possible locations
+	// Priority: Magento root lib/web first, then vendor/mage-os/magento2-base/lib/web
+	libDirs := []string{
+		filepath.Join(magentoRoot, "lib/web"),
+		filepath.Join(magentoRoot, "vendor/mage-os/magento2-base/lib/web"),
+	}
+	for _, libDir := range libDirs {
+		if _, err := os.Stat(libDir); err == nil {
+			count, err := copyDirectory(libDir, destDir, copier)
+			if err != nil {
+				return 0, fmt.Errorf("failed to copy library files from %s: %w", libDir, err)
+			}
+			fileCount += count
+		}
+	}
+
+	if err := queueSources(moduleSourcePriority, libSourcePriority); err != nil {
+		return 0, err
+	}
+
+	// 3. Copy extension view files from all vendors (vendor/*/view/{area}/web/)
+	// Unreadable packages and files are skipped and recorded in vendorScanErrors
+	copyExtensionDir := func(vendorName, webDir, moduleName string) {
+		if _, err := os.Stat(webDir); err != nil {
+			vendorScanErrors.Record(vendorName, webDir, err)
+			return
+		}
+		count, err := copyDirectoryWithModulePrefix(webDir, destDir, moduleName, copier)
+		if err != nil && !vendorScanErrors.Record(vendorName, webDir, err) {
+			// Log but don't fail on extension file errors
+			return
+		}
+		fileCount += count
+	}
+
+	if index == nil {
+		index = buildVendorIndex(magentoRoot, scanJobsFlag)
+	}
+	for _, webDir := range index.WebDirs(job.Area) {
+		copyExtensionDir(webDir.Vendor, webDir.Path, webDir.Module)
+	}
+
+	if err := queueSources(math.MinInt, moduleSourcePriority); err != nil {
+		return 0, err
+	}
+
+	return fileCount, nil
+}
+
+// copyDirectoryWithModulePrefix queues copies of files with an optional module name prefix in the path
+// Locale specific files in i18n/{locale}/ of the job's locale (and the locales it falls back to)
+// take priority over the other files, like in Magento's fallback; i18n/ itself isn't deployed
+// Unreadable directories are skipped and returned as *unreadableError
+func copyDirectoryWithModulePrefix(src, dst string, modulePrefix string, copier *fileCopier) (int64, error) {
+	var fileCount int64
+	var unreadable []string
+
+	roots := make([]string, 0, len(copier.locales)+1)
+	for _, locale := range copier.locales {
+		roots = append(roots, filepath.Join(src, "i18n", locale))
+	}
+	roots = append(roots, src)
+
+	for _, root := range roots {
+		if root != src {
+			if _, err := os.Stat(root); err != nil {
+				continue
+			}
+		}
+
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			// Nothing more is copied once the run is interrupted or the job timed out
+			if copier.Stopped() {
+				return filepath.SkipAll
+			}
+			if err != nil {
+				if os.IsPermission(err) && path != root {
+					unreadable = append(unreadable, path)
+					if info != nil && info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				return err
+			}
+
+			if info.IsDir() {
+				// Locale specific files were handled before
+				if root == src && path == filepath.Join(src, "i18n") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			// Calculate relative path
+			relPath, _ := filepath.Rel(root, path)
+
+			// Skip exclusions
+			if excludedPath(copier.excludes, relPath) {
+				return nil
+			}
+
+			// Images are left out entirely with --images=defer
+			if imagesMode == "defer" && isImageFile(relPath) {
+				return nil
+			}
+
+			// Add module prefix to destination path if provided
+			destPath := filepath.Join(dst, modulePrefix, relPath)
+			// Skip if destination was claimed by a higher priority source
+			if !copier.Claim(destPath) {
+				return nil
+			}
+			// With --since, deployed files of unchanged sources are kept as they are
+			if copier.Unchanged(path, destPath) {
+				deploySources.Record(destPath, path)
+				atomic.AddInt64(&fileCount, 1)
+				return nil
+			}
+			// Copy filters may skip, move or rewrite the file
+			var content []byte
+			if len(copyFilters) > 0 {
+				var ok bool
+				if destPath, content, ok = copier.Filter(path, dst, filepath.Join(modulePrefix, relPath)); !ok {
+					return nil
+				}
+			}
+			// Copy or symlink file, unless it's up to date
+			if content != nil {
+				copier.PlaceContent(path, content, destPath)
+			} else {
+				copier.Place(path, info, destPath)
+			}
+
+			atomic.AddInt64(&fileCount, 1)
+			return nil
+		})
+		if err != nil {
+			return fileCount, err
+		}
+	}
+
+	if len(unreadable) > 0 {
+		return fileCount, &unreadableError{Paths: unreadable}
+	}
+	return fileCount, nil
+}
+
+// copyDirectory recursively queues copies of files from src to dst
+func copyDirectory(src, dst string, copier *fileCopier) (int64, error) {
+	return copyDirectoryWithModulePrefix(src, dst, "", copier)
+}
+
+// symlinkFile creates a relative symlink at dst pointing to src
+func symlinkFile(src, dst string) error {
+	relPath, err := filepath.Rel(filepath.Dir(dst), src)
+	if err != nil {
+		return fmt.Errorf("failed to compute relative path from %s to %s: %w", dst, src, err)
+	}
+	return os.Symlink(relPath, dst)
+}
+
+// placeFile either copies or symlinks src to dst depending on useSymlink
+func placeFile(src, dst string, useSymlink bool) error {
+	if useSymlink {
+		return symlinkFile(src, dst)
+	}
+	return copyFile(src, dst)
+}
+
+// copyFile copies a file from src to dst, as a copy-on-write clone when the filesystem supports it
+func copyFile(src, dst string) error {
+	if tryCloneFile(src, dst) {
+		return nil
+	}
+
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	return copyFileContents(destination, source)
+}
+
+// printResults logs the deployment results summary, a record per job and one with the totals;
+// the failed jobs and the totals are the summary --quiet keeps
+func printResults(results []DeployResult, totalDuration time.Duration) {
+	if textLogs() {
+		logInfof("\n%s", rule())
+		logInfof("Deployment Results")
+		logInfof("%s", rule())
+	}
+
+	successCount := 0
+	retried := 0
+	totalFiles := int64(0)
+
+	for _, result := range results {
+		if result.Attempts > 1 {
+			retried++
+		}
+		if result.Error != "" {
+			logger.Log(context.Background(), levelSummary, fmt.Sprintf("%s %s%s", symFail, result.Error, attemptsNote(result.Attempts)),
+				append(jobAttrs(result.Job), "status", "failed", "error", result.Error, "attempts", result.Attempts)...)
+		} else if result.Symlinked {
+			successCount++
+			totalFiles += result.FilesCount
+			logger.Info(fmt.Sprintf("%s %s/%s (%s) %s %s (symlinked)", symOK, result.Job.Theme, result.Job.Area, result.Job.Locale, symArrow, result.SymlinkTarget),
+				append(jobAttrs(result.Job), "status", "symlinked", "target", result.SymlinkTarget)...)
+		} else {
+			successCount++
+			totalFiles += result.FilesCount
+			logger.Info(fmt.Sprintf("%s %s/%s (%s): %d files in %.1fs%s",
+				symOK, result.Job.Theme, result.Job.Area, result.Job.Locale, result.FilesCount, result.Duration.Seconds(), attemptsNote(result.Attempts)),
+				append(jobAttrs(result.Job), "status", "deployed", "files", result.FilesCount, "duration", result.Duration.Seconds(), "attempts", result.Attempts)...)
+		}
+	}
+
+	if textLogs() {
+		logInfof("%s", rule())
+	}
+	logger.Log(context.Background(), levelSummary, fmt.Sprintf("Total: %d/%d successful | %d files | %.1fs total", successCount, len(results), totalFiles, totalDuration.Seconds()),
+		"jobs", len(results), "succeeded", successCount, "files", totalFiles, "duration", totalDuration.Seconds(), "retried", retried)
+	if retried > 0 {
+		logger.Log(context.Background(), levelSummary, fmt.Sprintf("Retried: %d job(s)", retried))
+	}
+	if totalDuration.Seconds() > 0 {
+		logger.Info(fmt.Sprintf("Average: %.1f files/sec", float64(totalFiles)/totalDuration.Seconds()), "files_per_second", float64(totalFiles)/totalDuration.Seconds())
+	}
+}
+
+// createDeploymentVersionFile creates the required Magento deployment version file
+func createDeploymentVersionFile(magentoRoot string, version string, verbose bool) error {
+	versionFile := filepath.Join(magentoRoot, "pub/static/deployed_version.txt")
+
+	// Create the file with the version, never leaving a partially written one
+	err := writeFileAtomic(versionFile, []byte(version), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment version file: %w", err)
+	}
+
+	if verbose {
+		logDebugf("%s Created deployment version file: %s", symOK, version)
+	}
+
+	return nil
+}
+
+// getVendorThemePath converts a theme name to its vendor package path
+// e.g., "Magento/backend" with adminhtml -> "vendor/magento/theme-adminhtml-backend"
+// e.g., "Hyva/reset" with frontend -> "vendor/hyva-themes/magento2-hyva-reset"
+// e.g., "MageOS/m137-admin-theme" with adminhtml -> "vendor/mage-os/theme-adminhtml-m137"
+func getVendorThemePath(area string, themeName string) string {
+	parts := strings.Split(themeName, "/")
+	if len(parts) != 2 {
+		return ""
+	}
+
+	vendor := strings.ToLower(parts[0])
+	theme := strings.ToLower(parts[1])
+
+	// Special case mappings for known vendor packages
+	switch vendor {
+	case "magento":
+		if area == "adminhtml" {
+			return filepath.Join("vendor", vendor, "theme-"+area+"-"+theme)
+		}
+		return filepath.Join("vendor", vendor, "theme-frontend-"+theme)
+	case "hyva":
+		return filepath.Join("vendor", "hyva-themes", "magento2-hyva-"+theme, "web")
+	case "mage-os", "mageos":
+		return filepath.Join("vendor", "mage-os", "theme-"+area+"-"+theme)
+	default:
+		// Generic fallback for custom vendors
+		if area == "adminhtml" {
+			return filepath.Join("vendor", vendor, "theme-adminhtml-"+theme)
+		}
+		return filepath.Join("vendor", vendor, "theme-frontend-"+theme)
+	}
+}
+
+// getModuleName extracts the module name from a package's module.xml file
+func getModuleName(packagePath string) string {
+	moduleXmlPath := filepath.Join(packagePath, "etc", "module.xml")
+	if _, err := os.Stat(moduleXmlPath); err != nil {
+		// Try src/etc/module.xml
+		moduleXmlPath = filepath.Join(packagePath, "src", "etc", "module.xml")
+		if _, err := os.Stat(moduleXmlPath); err != nil {
+			return ""
+		}
+	}
+
+	data, err := os.ReadFile(moduleXmlPath)
+	if err != nil {
+		return ""
+	}
+
+	var cfg ModuleConfig
+	if err := xml.Unmarshal(data, &cfg); err != nil {
+		return ""
+	}
+
+	return cfg.Module.Name
+}
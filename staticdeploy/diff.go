@@ -0,0 +1,185 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+func init() {
+	registerCommand(Command{
+		Name:        "diff",
+		Description: "Compare two deployments (manifests or static trees) grouped by theme and module",
+		Run:         runDiff,
+	})
+}
+
+// runDiff implements the diff subcommand
+func runDiff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	summary := flags.Bool("summary", false, "Only print the number of changed files per theme and module")
+	withLocales := flags.Bool("locales", false, "List the locales each file changed in")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s diff [options] <old> <new>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Compares two deployments, each given as a manifest written by --manifest or as a static\n")
+		fmt.Fprintf(os.Stderr, "content directory (hashed on the fly), and lists the added (+), removed (-) and\n")
+		fmt.Fprintf(os.Stderr, "changed (~) files grouped by theme and module\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("diff needs two manifests or static directories")
+	}
+
+	old, new, err := loadDiffSides(flags.Arg(0), flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	fmt.Print(formatDeploymentDiff(old, new, *summary, *withLocales))
+	return nil
+}
+
+// loadDiffSides loads both sides of a diff: manifest files as they are, directories hashed
+// with the algorithm of the manifest on the other side, so the hashes are comparable
+func loadDiffSides(oldPath string, newPath string) (*Manifest, *Manifest, error) {
+	old, err := localDeploymentSource(oldPath, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	new, err := localDeploymentSource(newPath, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resolveDeploymentSources(old, new)
+}
+
+// diffEntry is a file that differs between two deployments, with the locales it differs in
+type diffEntry struct {
+	mark    string // "+", "-" or "~"
+	path    string // path within the locale directory, or relative to pub/static
+	locales []string
+}
+
+// formatDeploymentDiff lists the differences between two manifests per theme and, within a
+// theme, per module; a file differing in several locales of a theme is listed once
+func formatDeploymentDiff(old, new *Manifest, summary bool, withLocales bool) string {
+	diff := diffManifests(old, new)
+
+	type groupKey struct{ Area, Theme, Module string }
+	groups := make(map[groupKey]map[string]*diffEntry)
+	var other []diffEntry
+
+	record := func(mark string, relPath string) {
+		p, ok := splitStaticPath(relPath)
+		if !ok || p.Rest == "" {
+			other = append(other, diffEntry{mark: mark, path: relPath})
+			return
+		}
+		key := groupKey{p.Area, p.Theme, p.Module()}
+		if groups[key] == nil {
+			groups[key] = make(map[string]*diffEntry)
+		}
+		rest := p.Rest
+		if key.Module != "" {
+			rest = strings.TrimPrefix(rest, key.Module+"/")
+		}
+		id := mark + rest
+		if groups[key][id] == nil {
+			groups[key][id] = &diffEntry{mark: mark, path: rest}
+		}
+		groups[key][id].locales = append(groups[key][id].locales, p.Locale)
+	}
+	for _, relPath := range diff.Added {
+		record("+", relPath)
+	}
+	for _, relPath := range diff.Removed {
+		record("-", relPath)
+	}
+	for _, relPath := range diff.Changed {
+		record("~", relPath)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Static content diff %s → %s\n", versionOrNone(old), versionOrNone(new))
+	if len(diff.Added)+len(diff.Changed)+len(diff.Removed) == 0 {
+		sb.WriteString("No differences\n")
+		return sb.String()
+	}
+
+	keys := make([]groupKey, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Theme != keys[j].Theme {
+			return keys[i].Theme < keys[j].Theme
+		}
+		if keys[i].Area != keys[j].Area {
+			return keys[i].Area < keys[j].Area
+		}
+		return keys[i].Module < keys[j].Module
+	})
+
+	printEntries := func(indent string, entries []diffEntry) {
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].path != entries[j].path {
+				return entries[i].path < entries[j].path
+			}
+			return entries[i].mark < entries[j].mark
+		})
+		for _, entry := range entries {
+			fmt.Fprintf(&sb, "%s%s %s", indent, entry.mark, entry.path)
+			if withLocales && len(entry.locales) > 0 {
+				sort.Strings(entry.locales)
+				fmt.Fprintf(&sb, " [%s]", strings.Join(entry.locales, ", "))
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	var lastTheme groupKey
+	for i, key := range keys {
+		if i == 0 || key.Theme != lastTheme.Theme || key.Area != lastTheme.Area {
+			fmt.Fprintf(&sb, "\n%s (%s)\n", key.Theme, key.Area)
+			lastTheme = key
+		}
+		module := key.Module
+		if module == "" {
+			module = "theme files"
+		}
+
+		entries := make([]diffEntry, 0, len(groups[key]))
+		counts := make(map[string]int)
+		for _, entry := range groups[key] {
+			entries = append(entries, *entry)
+			counts[entry.mark]++
+		}
+		fmt.Fprintf(&sb, "  %s: %d added, %d removed, %d changed\n", module, counts["+"], counts["-"], counts["~"])
+		if !summary {
+			printEntries("    ", entries)
+		}
+	}
+
+	if len(other) > 0 {
+		fmt.Fprintf(&sb, "\nOther files\n")
+		printEntries("  ", other)
+	}
+
+	fmt.Fprintf(&sb, "\nTotal: %d files added, %d removed, %d changed\n", len(diff.Added), len(diff.Removed), len(diff.Changed))
+	return sb.String()
+}
+
+// versionOrNone returns the version of a manifest for display
+func versionOrNone(manifest *Manifest) string {
+	if manifest.Version == "" {
+		return "(unknown)"
+	}
+	return manifest.Version
+}
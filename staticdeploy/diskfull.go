@@ -0,0 +1,110 @@
+package staticdeploy
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// filesystemStats is the capacity of the filesystem holding a path
+type filesystemStats struct {
+	TotalBytes  uint64
+	FreeBytes   uint64 // available to unprivileged users
+	TotalInodes uint64 // 0 when the filesystem has no fixed number of inodes (e.g. btrfs)
+	FreeInodes  uint64
+}
+
+// diskFullError is a write that failed because the destination filesystem or quota is full
+type diskFullError struct {
+	Path     string
+	Quota    bool   // EDQUOT instead of ENOSPC
+	Resource string // "inodes", "bytes", or "" when unknown
+	Stats    *filesystemStats
+	Err      error
+}
+
+func (e *diskFullError) Error() string {
+	what := "filesystem full"
+	if e.Quota {
+		what = "disk quota exceeded"
+	}
+	if e.Resource != "" {
+		what += " (out of " + e.Resource + ")"
+	}
+
+	msg := fmt.Sprintf("%s writing %s", what, e.Path)
+	if e.Stats != nil {
+		msg += fmt.Sprintf("; filesystem: %s of %s free", formatBytes(e.Stats.FreeBytes), formatBytes(e.Stats.TotalBytes))
+		if e.Stats.TotalInodes > 0 {
+			msg += fmt.Sprintf(", %d of %d inodes free", e.Stats.FreeInodes, e.Stats.TotalInodes)
+		}
+	}
+	if e.Quota {
+		msg += " (the quota limit may be lower than the free space, check with quota -s)"
+	}
+	if e.Resource == "inodes" {
+		// Every file and symlink takes an inode, only sharing locale directories saves them
+		return msg + "; deploy fewer files with --symlink=locale (identical locales share one copy)"
+	}
+	return msg + "; deploy fewer files with --symlink=locale (identical locales share one copy), " +
+		"or use less space with --symlink=file or --images=symlink (symlinks to the sources use no data blocks)"
+}
+
+func (e *diskFullError) Unwrap() error {
+	return e.Err
+}
+
+// checkDiskFull turns an ENOSPC or EDQUOT error writing path into a *diskFullError with the
+// filesystem stats and which resource ran out; other errors are returned as is
+func checkDiskFull(err error, path string) error {
+	quota, ok := isDiskFull(err)
+	if !ok {
+		return err
+	}
+
+	full := &diskFullError{Path: path, Quota: quota, Err: err}
+	// The path itself may not exist, use the closest existing parent
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if stats, err := statFilesystem(dir); err == nil {
+			full.Stats = stats
+			break
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	if full.Stats != nil && !quota {
+		if full.Stats.TotalInodes > 0 && full.Stats.FreeInodes == 0 {
+			full.Resource = "inodes"
+		} else {
+			full.Resource = "bytes"
+		}
+	}
+	return full
+}
+
+// firstDiskFull returns the first *diskFullError in errs, or nil
+func firstDiskFull(errs []error) *diskFullError {
+	for _, err := range errs {
+		var full *diskFullError
+		if errors.As(err, &full) {
+			return full
+		}
+	}
+	return nil
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. 1.5 GiB
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
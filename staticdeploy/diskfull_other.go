@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package staticdeploy
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isDiskFull reports whether err is ENOSPC; quotas aren't distinguished on this platform
+func isDiskFull(err error) (quota bool, full bool) {
+	return false, errors.Is(err, syscall.ENOSPC)
+}
+
+// statFilesystem is not supported on this platform
+func statFilesystem(path string) (*filesystemStats, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,30 @@
+//go:build linux || darwin
+
+package staticdeploy
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isDiskFull reports whether err is ENOSPC or EDQUOT, and whether it's the quota
+func isDiskFull(err error) (quota bool, full bool) {
+	if errors.Is(err, syscall.EDQUOT) {
+		return true, true
+	}
+	return false, errors.Is(err, syscall.ENOSPC)
+}
+
+// statFilesystem returns the capacity of the filesystem holding path
+func statFilesystem(path string) (*filesystemStats, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return nil, err
+	}
+	return &filesystemStats{
+		TotalBytes:  uint64(st.Blocks) * uint64(st.Bsize),
+		FreeBytes:   uint64(st.Bavail) * uint64(st.Bsize),
+		TotalInodes: uint64(st.Files),
+		FreeInodes:  uint64(st.Ffree),
+	}, nil
+}
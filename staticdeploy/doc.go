@@ -0,0 +1,9 @@
+// Package staticdeploy is the deployer of Magento 2 static view files behind the
+// magento2-static-deploy command, for programs embedding it: Deploy runs a deploy in-process,
+// and a build of the command can add in-process copy filters:
+//
+//	func main() {
+//		staticdeploy.RegisterCopyFilter(policyFilter{}, "js/*")
+//		staticdeploy.Main()
+//	}
+package staticdeploy
@@ -0,0 +1,276 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+func init() {
+	registerCommand(Command{
+		Name:        "doctor",
+		Description: "Check the Magento root, config, PHP and pub/static before deploying",
+		Run:         runDoctor,
+	})
+}
+
+// minDoctorFreeBytes is the free space of pub/static below which doctor warns
+const minDoctorFreeBytes = 1 << 30
+
+// doctorCheck is the outcome of one check of the doctor command
+type doctorCheck struct {
+	name   string
+	status string // ok, warn or fail
+	detail string
+}
+
+// runDoctor implements the doctor subcommand
+func runDoctor(args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory")
+	configPath := flags.StringP("config", "c", "", "Path to config file")
+	php := flags.String("php", "php", "Path to PHP binary (env: PHP_BINARY)")
+	phpExecFlag := flags.String("php-exec", "", "Command used to run PHP instead of --php, e.g. 'docker compose exec -T php php'")
+	phpExecRootFlag := flags.String("php-exec-root", "", "Magento root path as seen by --php-exec")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s doctor [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Checks what a deploy needs: the Magento root, the config file, the themes, PHP and LESS,\n")
+		fmt.Fprintf(os.Stderr, "and whether pub/static is writable with enough free space. Exits with 1 when a check fails\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if env := os.Getenv("PHP_BINARY"); env != "" && !flags.Changed("php") {
+		*php = env
+	}
+
+	checks := []doctorCheck{
+		checkMagentoRoot(*root),
+		checkDoctorConfig(*root, *configPath),
+		checkDoctorThemes(*root),
+		checkDoctorPHP(*root, *php, *phpExecFlag, *phpExecRootFlag),
+		checkDoctorLess(*root),
+		checkPubStatic(*root),
+		checkDiskSpace(*root),
+		checkDeployedVersion(*root),
+		checkLeftovers(*root),
+	}
+
+	failed := 0
+	color := useColor(os.Stdout)
+	for _, check := range checks {
+		symbol := symOK
+		switch check.status {
+		case "warn":
+			symbol = symWarn
+		case "fail":
+			symbol = symFail
+			failed++
+		}
+		line := fmt.Sprintf("%s %s: %s", symbol, check.name, check.detail)
+		if color {
+			line = colorize(line)
+		}
+		fmt.Println(line)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// checkMagentoRoot checks that root is a Magento installation
+func checkMagentoRoot(root string) doctorCheck {
+	check := doctorCheck{name: "Magento root"}
+	abs, _ := filepath.Abs(root)
+	if _, err := os.Stat(filepath.Join(root, "app/etc")); err != nil {
+		check.status, check.detail = "fail", fmt.Sprintf("%s has no app/etc, pass the Magento root with --root", abs)
+		return check
+	}
+	var missing []string
+	for _, path := range []string{"app/etc/env.php", "app/etc/config.php", "bin/magento"} {
+		if _, err := os.Stat(filepath.Join(root, path)); err != nil {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) > 0 {
+		check.status, check.detail = "warn", fmt.Sprintf("%s is missing %s", abs, strings.Join(missing, ", "))
+		return check
+	}
+	check.status, check.detail = "ok", abs
+	return check
+}
+
+// checkDoctorConfig loads and validates the config file like a deploy does
+func checkDoctorConfig(root string, path string) doctorCheck {
+	check := doctorCheck{name: "Config"}
+	cfg, err := loadConfig(root, path)
+	if err == nil {
+		err = setHashAlgorithm(cfg)
+	}
+	if err == nil {
+		err = validateThemeSources(root, cfg.ThemeSources)
+	}
+	if err == nil {
+		err = validateMagentoCommands(cfg.MagentoCommands)
+	}
+	if err == nil {
+		for name := range cfg.Options {
+			if flag.CommandLine.Lookup(name) == nil || configOnlyFlags[name] {
+				err = fmt.Errorf("unknown option '%s'", name)
+			}
+		}
+	}
+	if err != nil {
+		check.status, check.detail = "fail", err.Error()
+		return check
+	}
+
+	check.status, check.detail = "ok", path
+	if path == "" {
+		check.detail = "none, using the defaults"
+		for _, name := range configFileNames {
+			if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+				check.detail = name
+				break
+			}
+		}
+	}
+	if configEnvironment != "" {
+		check.detail += " (environment " + configEnvironment + ")"
+	}
+	return check
+}
+
+// checkDoctorThemes counts the installed themes, and how many of them are Hyvä themes the
+// deployer copies itself instead of dispatching to bin/magento
+func checkDoctorThemes(root string) doctorCheck {
+	check := doctorCheck{name: "Themes"}
+	themes := discoverThemes(root)
+	if len(themes) == 0 {
+		check.status, check.detail = "warn", "no themes found in app/design or vendor"
+		return check
+	}
+	hyva := 0
+	for _, theme := range themes {
+		if isHyvaTheme(root, theme.Area, theme.Name, make(map[string]bool)) {
+			hyva++
+		}
+	}
+	check.status, check.detail = "ok", fmt.Sprintf("%d installed, %d Hyvä", len(themes), hyva)
+	return check
+}
+
+// checkDoctorPHP checks that PHP runs; it's only needed for Luma themes and LESS compilation
+func checkDoctorPHP(root, binary, execCommand, containerRoot string) doctorCheck {
+	check := doctorCheck{name: "PHP"}
+	runner, err := NewPHPRunner(root, binary, execCommand, containerRoot, nil)
+	if err != nil {
+		check.status, check.detail = "fail", err.Error()
+		return check
+	}
+	if _, err := runner.LookPath(); err != nil {
+		check.status, check.detail = "warn", err.Error()+" (needed for Luma themes and LESS compilation)"
+		return check
+	}
+	output, err := runner.Command("-r", "echo PHP_VERSION;").Output()
+	if err != nil {
+		check.status, check.detail = "warn", fmt.Sprintf("%s doesn't run: %v", runner, err)
+		return check
+	}
+	check.status, check.detail = "ok", fmt.Sprintf("%s (%s)", strings.TrimSpace(string(output)), runner)
+	return check
+}
+
+// checkDoctorLess checks that the LESS compiler used for Hyvä themes with LESS is installed
+func checkDoctorLess(root string) doctorCheck {
+	check := doctorCheck{name: "LESS compiler"}
+	if _, err := os.Stat(filepath.Join(root, "vendor/wikimedia/less.php/lessc.inc.php")); err != nil {
+		check.status, check.detail = "warn", "wikimedia/less.php isn't installed, themes with LESS can't be compiled"
+		return check
+	}
+	check.status, check.detail = "ok", "wikimedia/less.php"
+	return check
+}
+
+// checkPubStatic checks that pub/static is writable and reports the copy method its
+// filesystem supports
+func checkPubStatic(root string) doctorCheck {
+	check := doctorCheck{name: "pub/static"}
+	// Before the first deploy, the directory it's created in must be writable
+	dir := filepath.Join(root, "pub/static")
+	missing := ""
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		dir, missing = filepath.Join(root, "pub"), " (pub/static is created by the first deploy)"
+	}
+	probe, err := os.CreateTemp(dir, tempArtifactPrefix+"doctor-")
+	if err != nil {
+		check.status, check.detail = "fail", fmt.Sprintf("not writable: %v", err)
+		return check
+	}
+	probe.WriteString("doctor")
+	probe.Close()
+	defer os.Remove(probe.Name())
+
+	method := "copies"
+	clone := probe.Name() + "-clone"
+	if err := cloneFile(probe.Name(), clone); err == nil {
+		method = "copy-on-write clones"
+	}
+	os.Remove(clone)
+	check.status, check.detail = "ok", "writable, files are deployed as "+method+missing
+	return check
+}
+
+// checkDiskSpace warns when the filesystem of pub/static is almost full
+func checkDiskSpace(root string) doctorCheck {
+	check := doctorCheck{name: "Disk space"}
+	stats, err := statFilesystem(filepath.Join(root, "pub"))
+	if err != nil {
+		check.status, check.detail = "warn", fmt.Sprintf("unknown: %v", err)
+		return check
+	}
+	check.status = "ok"
+	check.detail = fmt.Sprintf("%s of %s free", formatBytes(stats.FreeBytes), formatBytes(stats.TotalBytes))
+	if stats.TotalInodes > 0 {
+		check.detail += fmt.Sprintf(", %d of %d inodes free", stats.FreeInodes, stats.TotalInodes)
+	}
+	if stats.FreeBytes < minDoctorFreeBytes || (stats.TotalInodes > 0 && stats.FreeInodes < stats.TotalInodes/20) {
+		check.status = "warn"
+	}
+	return check
+}
+
+// checkDeployedVersion reports the content version of the current deployment
+func checkDeployedVersion(root string) doctorCheck {
+	check := doctorCheck{name: "Deployed version"}
+	data, err := os.ReadFile(filepath.Join(root, "pub/static/deployed_version.txt"))
+	if err != nil {
+		check.status, check.detail = "warn", "no deployed_version.txt, nothing deployed yet"
+		return check
+	}
+	check.status, check.detail = "ok", strings.TrimSpace(string(data))
+	return check
+}
+
+// checkLeftovers warns about temporary files of runs that didn't finish (see cleanup)
+func checkLeftovers(root string) doctorCheck {
+	check := doctorCheck{name: "Leftovers"}
+	leftovers, err := findTempLeftovers(root, time.Now().Add(-time.Hour))
+	if err != nil {
+		check.status, check.detail = "warn", err.Error()
+		return check
+	}
+	if len(leftovers) > 0 {
+		check.status, check.detail = "warn", fmt.Sprintf("%d temporary file(s) of interrupted runs, remove them with cleanup", len(leftovers))
+		return check
+	}
+	check.status, check.detail = "ok", "no temporary files of interrupted runs"
+	return check
+}
@@ -0,0 +1,166 @@
+package staticdeploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// eventsPath receives the progress events of the run as JSON lines (--events)
+var eventsPath string
+
+// eventFilesInterval is how often files_copied events report the files processed so far
+const eventFilesInterval = time.Second
+
+// ProgressEvent is a step of the run. Types:
+//   - deploy_started: the jobs are about to run (Jobs)
+//   - job_started, job_finished: a job (Area, Theme, Locale; when finished Files, Duration, Error)
+//   - files_copied: the files compared, copied or linked by all jobs so far (Files), every second
+//   - compile_finished: the LESS compilation of a job (Area, Theme, Locale, Error)
+//   - deploy_finished: the outcome of the run (Success, Files)
+type ProgressEvent struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Version  string    `json:"version"`
+	Area     string    `json:"area,omitempty"`
+	Theme    string    `json:"theme,omitempty"`
+	Locale   string    `json:"locale,omitempty"`
+	Jobs     int       `json:"jobs,omitempty"`
+	Files    int64     `json:"files,omitempty"`
+	Duration float64   `json:"duration_seconds,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Success  *bool     `json:"success,omitempty"`
+}
+
+// eventEmitter passes the events of the run to a callback, one at a time and in order
+// All methods are no-ops on a nil emitter
+type eventEmitter struct {
+	mu       sync.Mutex
+	version  string
+	callback func(ProgressEvent)
+	stop     chan struct{}
+	stopped  chan struct{}
+	finished bool
+}
+
+// progressEvents emits the events of the run when --events or a progress callback of Deploy
+// is given, nil otherwise
+var progressEvents *eventEmitter
+
+// newEventEmitter creates an emitter for a run deploying version
+func newEventEmitter(version string, callback func(ProgressEvent)) *eventEmitter {
+	return &eventEmitter{version: version, callback: callback}
+}
+
+// eventFileWriter returns a callback writing events as JSON lines to path, e.g. a named pipe
+// or /dev/fd/3, or to stdout for -; a failing write is ignored, events must not fail the
+// deployment
+func eventFileWriter(path string, stdout io.Writer) (func(ProgressEvent), error) {
+	out := stdout
+	if path != "-" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("--events: %w", err)
+		}
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+	return func(event ProgressEvent) { encoder.Encode(event) }, nil
+}
+
+// emit fills in the time and version of an event and passes it to the callback
+func (e *eventEmitter) emit(event ProgressEvent) {
+	if e == nil {
+		return
+	}
+	event.Time = time.Now()
+	event.Version = e.version
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.callback(event)
+}
+
+// Start emits deploy_started and files_copied every second until Stop
+func (e *eventEmitter) Start(jobs int) {
+	if e == nil {
+		return
+	}
+	e.emit(ProgressEvent{Type: "deploy_started", Jobs: jobs})
+	e.stop, e.stopped = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(e.stopped)
+		ticker := time.NewTicker(eventFilesInterval)
+		defer ticker.Stop()
+		var reported int64
+		for {
+			select {
+			case <-e.stop:
+				if files := filesProcessed.Load(); files != reported {
+					e.emit(ProgressEvent{Type: "files_copied", Files: files})
+				}
+				return
+			case <-ticker.C:
+				if files := filesProcessed.Load(); files != reported {
+					reported = files
+					e.emit(ProgressEvent{Type: "files_copied", Files: files})
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the files_copied events, reporting the final count
+func (e *eventEmitter) Stop() {
+	if e == nil || e.stop == nil {
+		return
+	}
+	close(e.stop)
+	<-e.stopped
+	e.stop = nil
+}
+
+// JobStarted emits job_started
+func (e *eventEmitter) JobStarted(job DeployJob) {
+	e.emit(ProgressEvent{Type: "job_started", Area: job.Area, Theme: job.Theme, Locale: job.Locale})
+}
+
+// JobFinished emits job_finished with the outcome of the job
+func (e *eventEmitter) JobFinished(result DeployResult) {
+	e.emit(ProgressEvent{
+		Type:     "job_finished",
+		Area:     result.Job.Area,
+		Theme:    result.Job.Theme,
+		Locale:   result.Job.Locale,
+		Files:    result.FilesCount,
+		Duration: result.Duration.Seconds(),
+		Error:    result.Error,
+	})
+}
+
+// CompileFinished emits compile_finished for the LESS compilation of a job
+func (e *eventEmitter) CompileFinished(job DeployJob, err error) {
+	event := ProgressEvent{Type: "compile_finished", Area: job.Area, Theme: job.Theme, Locale: job.Locale}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	e.emit(event)
+}
+
+// Finish emits deploy_finished, once: runs stopped early finish on exit
+func (e *eventEmitter) Finish(success bool, files int64) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	finished := e.finished
+	e.finished = true
+	e.mu.Unlock()
+	if finished {
+		return
+	}
+	e.Stop()
+	e.emit(ProgressEvent{Type: "deploy_finished", Success: &success, Files: files})
+}
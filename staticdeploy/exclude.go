@@ -0,0 +1,67 @@
+package staticdeploy
+
+import (
+	"path"
+	"strings"
+)
+
+// defaultExcludePatterns are the files and directories of web directories that are never
+// deployed: sources that are compiled or built instead, documentation and development files
+// Patterns without a leading '/' match at any depth
+var defaultExcludePatterns = []string{
+	".*",           // hidden files and directories
+	"*.less",       // LESS sources (Magento compiles these, we don't)
+	"css/source",   // LESS source directories
+	"/tailwind",    // Tailwind sources of Hyvä themes
+	"*.md",         // README, CHANGELOG, ...
+	"*/docs",       // documentation of libraries, a top-level docs directory is deployed
+	"node_modules", // build dependencies
+	"playwright",   // tests
+	"test-results",
+}
+
+// runExcludePatterns returns the patterns of files a run doesn't deploy: the defaults plus
+// those from the config file and extra, e.g. --exclude
+func runExcludePatterns(cfg *Config, extra []string) []string {
+	return append(append(append([]string{}, defaultExcludePatterns...), cfg.Exclude...), extra...)
+}
+
+// excludedPath reports whether a path relative to a web directory matches one of patterns
+func excludedPath(patterns []string, relPath string) bool {
+	// Normalize path separators for cross-platform compatibility
+	normalizedPath := strings.ReplaceAll(relPath, "\\", "/")
+
+	for _, pattern := range patterns {
+		if matchExcludePattern(pattern, normalizedPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchExcludePattern reports whether a path relative to a web directory matches a pattern
+// Patterns are slash-separated path.Match globs matched against consecutive path components,
+// so a directory pattern excludes everything below it; a leading '/' anchors the pattern
+// to the start of the path
+func matchExcludePattern(pattern string, relPath string) bool {
+	anchored := strings.HasPrefix(pattern, "/")
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	parts := strings.Split(relPath, "/")
+
+	for start := 0; start+len(patternParts) <= len(parts); start++ {
+		if anchored && start > 0 {
+			break
+		}
+		matched := true
+		for i, patternPart := range patternParts {
+			if ok, _ := path.Match(patternPart, parts[start+i]); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package staticdeploy
+
+import "testing"
+
+func TestExcludedPathDefaults(t *testing.T) {
+	tests := []struct {
+		path     string
+		excluded bool
+	}{
+		{".htaccess", true},
+		{"js/.git/config", true},
+		{"css/source/_theme.less", true},
+		{"css/styles.css", false},
+		{"tailwind/tailwind.config.js", true},
+		{"js/tailwind/plugin.js", false},
+		{"README.md", true},
+		{"docs/guide.html", false},
+		{"js/lib/docs/index.html", true},
+		{"js/node_modules/x/index.js", true},
+	}
+	for _, tt := range tests {
+		if got := excludedPath(defaultExcludePatterns, tt.path); got != tt.excluded {
+			t.Errorf("excludedPath(%q) = %v, want %v", tt.path, got, tt.excluded)
+		}
+	}
+}
+
+func TestRunExcludePatternsPerRun(t *testing.T) {
+	cfg := &Config{Exclude: []string{"*.map"}}
+	withFlag := runExcludePatterns(cfg, []string{"/js/dev"})
+	without := runExcludePatterns(cfg, nil)
+
+	if !excludedPath(withFlag, "js/dev/debug.js") || excludedPath(without, "js/dev/debug.js") {
+		t.Error("the extra patterns of one run apply to another")
+	}
+	if !excludedPath(without, "js/app.js.map") {
+		t.Error("the patterns of the config file don't apply")
+	}
+	if len(defaultExcludePatterns) != len(runExcludePatterns(&Config{}, nil)) {
+		t.Error("runExcludePatterns changed the defaults")
+	}
+}
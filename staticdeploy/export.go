@@ -0,0 +1,145 @@
+package staticdeploy
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	flag "github.com/spf13/pflag"
+)
+
+// InventoryRow is a single deployed asset in the inventory export
+type InventoryRow struct {
+	Path        string `parquet:"path"`
+	Area        string `parquet:"area"`
+	Theme       string `parquet:"theme"`
+	Locale      string `parquet:"locale"`
+	Module      string `parquet:"module"`
+	Size        int64  `parquet:"size"`
+	Hash        string `parquet:"hash"`
+	ContentType string `parquet:"content_type"`
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "export",
+		Description: "Export the deployed asset inventory to CSV or Parquet",
+		Run:         runExport,
+	})
+}
+
+// runExport implements the export subcommand
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory")
+	configPath := flags.StringP("config", "c", "", "Path to config file (for the hash algorithm)")
+	format := flags.String("format", "", "Output format: csv or parquet (default: from --output extension, else csv)")
+	output := flags.StringP("output", "o", "-", "Output file ('-' for stdout)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s export [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Exports path, area, theme, locale, module, size, hash and content type of every deployed file\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *format == "" {
+		*format = "csv"
+		if strings.HasSuffix(*output, ".parquet") {
+			*format = "parquet"
+		}
+	}
+	if *format != "csv" && *format != "parquet" {
+		return fmt.Errorf("--format must be 'csv' or 'parquet', got '%s'", *format)
+	}
+	if *format == "parquet" && *output == "-" {
+		return fmt.Errorf("parquet output requires --output")
+	}
+
+	cfg, err := loadConfig(*root, *configPath)
+	if err != nil {
+		return err
+	}
+	if err := setHashAlgorithm(cfg); err != nil {
+		return err
+	}
+
+	manifest, err := buildManifest(filepath.Join(*root, "pub/static"), hashAlgorithm)
+	if err != nil {
+		return err
+	}
+	rows := inventoryRows(manifest)
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if *format == "parquet" {
+		return writeInventoryParquet(out, rows)
+	}
+	return writeInventoryCSV(out, rows)
+}
+
+// inventoryRows converts a manifest into inventory rows, sorted by path
+// Symlinks are skipped, their targets are part of the inventory themselves
+func inventoryRows(manifest *Manifest) []InventoryRow {
+	var rows []InventoryRow
+	for relPath, file := range manifest.Files {
+		if file.Link != "" {
+			continue
+		}
+
+		row := InventoryRow{
+			Path:        relPath,
+			Size:        file.Size,
+			Hash:        file.Hash,
+			ContentType: mime.TypeByExtension(path.Ext(relPath)),
+		}
+		if p, ok := splitStaticPath(relPath); ok {
+			row.Area = p.Area
+			row.Theme = p.Theme
+			row.Locale = p.Locale
+			row.Module = p.Module()
+		}
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Path < rows[j].Path })
+	return rows
+}
+
+// writeInventoryCSV writes the inventory as CSV with a header row
+func writeInventoryCSV(out io.Writer, rows []InventoryRow) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"path", "area", "theme", "locale", "module", "size", "hash", "content_type"})
+	for _, row := range rows {
+		w.Write([]string{row.Path, row.Area, row.Theme, row.Locale, row.Module, strconv.FormatInt(row.Size, 10), row.Hash, row.ContentType})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeInventoryParquet writes the inventory as a Parquet file
+func writeInventoryParquet(out io.Writer, rows []InventoryRow) error {
+	w := parquet.NewGenericWriter[InventoryRow](out)
+	if _, err := w.Write(rows); err != nil {
+		return fmt.Errorf("failed to write parquet rows: %w", err)
+	}
+	return w.Close()
+}
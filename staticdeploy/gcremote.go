@@ -0,0 +1,150 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// defaultRetentionKeep is the number of versions kept when no retention is configured
+const defaultRetentionKeep = 5
+
+func init() {
+	registerCommand(Command{
+		Name:        "gc-remote",
+		Description: "Delete expired versions from the remote target according to the retention policy",
+		Run:         runGCRemote,
+	})
+}
+
+// runGCRemote implements the gc-remote subcommand
+func runGCRemote(args []string) error {
+	flags := flag.NewFlagSet("gc-remote", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory")
+	configPath := flags.StringP("config", "c", "", "Path to config file")
+	target := flags.String("target", "", "Remote target URL (default: remote.target from the config file)")
+	keep := flags.Int("keep", 0, "Keep the newest N versions (default: remote.retention.keep, else 5)")
+	maxAge := flags.String("max-age", "", "Also keep versions younger than this, e.g. 30d or 72h (default: remote.retention.max_age)")
+	dryRun := flags.Bool("dry-run", false, "Only list the versions that would be deleted")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s gc-remote [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Deletes expired version prefixes from the remote target; the current version is never deleted\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*root, *configPath)
+	if err != nil {
+		return err
+	}
+	if *target == "" {
+		*target = cfg.Remote.Target
+	}
+	if *target == "" {
+		return fmt.Errorf("no remote target, use --target or remote.target in the config file")
+	}
+	if *keep == 0 {
+		*keep = cfg.Remote.Retention.Keep
+	}
+	if *keep <= 0 {
+		*keep = defaultRetentionKeep
+	}
+	if *maxAge == "" {
+		*maxAge = cfg.Remote.Retention.MaxAge
+	}
+	age, err := parseAge(*maxAge)
+	if err != nil {
+		return fmt.Errorf("invalid max age: %w", err)
+	}
+
+	store, err := openRemoteStore(*target, *root, cfg)
+	if err != nil {
+		return err
+	}
+
+	versions, err := store.ListVersions()
+	if err != nil {
+		return fmt.Errorf("failed to list versions on %s: %w", store, err)
+	}
+	current, err := store.CurrentVersion()
+	if err != nil {
+		return fmt.Errorf("failed to read current version on %s: %w", store, err)
+	}
+
+	expired := expiredVersions(versions, current, *keep, age, time.Now())
+	if len(expired) == 0 {
+		fmt.Printf("No expired versions on %s (%d versions)\n", store, len(versions))
+		return nil
+	}
+
+	for _, version := range expired {
+		if *dryRun {
+			fmt.Printf("Would delete %s (%s)\n", version.Name, version.Modified.Format(time.RFC3339))
+			continue
+		}
+		if err := store.DeleteVersion(version.Name); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", version.Name, err)
+		}
+		fmt.Printf("Deleted %s (%s)\n", version.Name, version.Modified.Format(time.RFC3339))
+	}
+
+	fmt.Printf("%d of %d versions expired on %s\n", len(expired), len(versions), store)
+	return nil
+}
+
+// expiredVersions returns the versions outside the retention policy: not among the newest
+// keep versions, older than maxAge (when set), and not the current version
+func expiredVersions(versions []RemoteVersion, current string, keep int, maxAge time.Duration, now time.Time) []RemoteVersion {
+	sorted := append([]RemoteVersion{}, versions...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].Modified.Equal(sorted[j].Modified) {
+			return sorted[i].Modified.After(sorted[j].Modified)
+		}
+		return sorted[i].Name > sorted[j].Name
+	})
+
+	var expired []RemoteVersion
+	for i, version := range sorted {
+		if i < keep || strings.TrimPrefix(version.Name, "version") == strings.TrimPrefix(current, "version") {
+			continue
+		}
+		if maxAge > 0 && now.Sub(version.Modified) < maxAge {
+			continue
+		}
+		expired = append(expired, version)
+	}
+	return expired
+}
+
+// parseAge parses a duration that may be given in days (e.g. 30d); "" is 0
+func parseAge(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	var age time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		age = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if age, err = time.ParseDuration(value); err != nil {
+			return 0, err
+		}
+	}
+	// A negative age would silently turn the max-age retention off
+	if age < 0 {
+		return 0, fmt.Errorf("invalid age %q: must not be negative", value)
+	}
+	return age, nil
+}
@@ -0,0 +1,97 @@
+package staticdeploy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpiredVersions(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	versions := []RemoteVersion{
+		{Name: "version1000", Modified: now.Add(-40 * day)},
+		{Name: "version2000", Modified: now.Add(-20 * day)},
+		{Name: "version3000", Modified: now.Add(-10 * day)},
+		{Name: "version4000", Modified: now.Add(-2 * day)},
+		{Name: "version5000", Modified: now.Add(-1 * day)},
+	}
+
+	tests := []struct {
+		name    string
+		current string
+		keep    int
+		maxAge  time.Duration
+		want    []string
+	}{
+		{"keep newest", "version5000", 2, 0, []string{"version3000", "version2000", "version1000"}},
+		{"keep all", "version5000", 5, 0, nil},
+		{"keep more than there are", "version5000", 10, 0, nil},
+		{"keep none but the current", "version5000", 0, 0, []string{"version4000", "version3000", "version2000", "version1000"}},
+		{"max age only", "version5000", 0, 15 * day, []string{"version2000", "version1000"}},
+		{"keep or max age, keep wins", "version5000", 4, 15 * day, []string{"version1000"}},
+		{"keep or max age, max age wins", "version5000", 1, 15 * day, []string{"version2000", "version1000"}},
+		{"old current version", "version1000", 2, 0, []string{"version3000", "version2000"}},
+		{"current version without prefix", "1000", 2, 0, []string{"version3000", "version2000"}},
+		{"old current version beyond max age", "version2000", 0, 5 * day, []string{"version3000", "version1000"}},
+		{"no current version", "", 1, 0, []string{"version4000", "version3000", "version2000", "version1000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, version := range expiredVersions(versions, tt.current, tt.keep, tt.maxAge, now) {
+				got = append(got, version.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expiredVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiredVersionsPrefixlessNames(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	versions := []RemoteVersion{
+		{Name: "1000", Modified: now.Add(-3 * time.Hour)},
+		{Name: "2000", Modified: now.Add(-2 * time.Hour)},
+		{Name: "3000", Modified: now.Add(-1 * time.Hour)},
+	}
+	for _, current := range []string{"1000", "version1000"} {
+		expired := expiredVersions(versions, current, 1, 0, now)
+		if len(expired) != 1 || expired[0].Name != "2000" {
+			t.Errorf("current %s: expiredVersions() = %v, want [2000]", current, expired)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"72h", 72 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"30", 0, true},
+		{"thirty days", 0, true},
+		{"-1d", 0, true},
+		{"-24h", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseAge(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAge(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("parseAge(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Uploads of GCS objects: files above gcsChunkSize (a multiple of 256 KiB) are uploaded in
+// chunks of that size with a resumable upload
+const (
+	gcsChunkSize       = 8 * 1024 * 1024
+	gcsDefaultEndpoint = "https://storage.googleapis.com"
+	gcsScope           = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+// GCSConfig configures Google Cloud Storage (the remote.gcs section of the config file)
+// The access token is the gcs.token credential when configured, else it comes from the
+// credentials of the environment (see googleTokenSource)
+type GCSConfig struct {
+	Endpoint string `yaml:"endpoint" json:"endpoint"` // e.g. of an emulator (default https://storage.googleapis.com)
+}
+
+// gcsRemoteStore is a remote target in a GCS bucket, below an optional prefix, accessed
+// through the JSON API
+type gcsRemoteStore struct {
+	bucket   string
+	prefix   string // "" or ending in a slash
+	endpoint string
+	tokens   *tokenSource
+	client   *HTTPClient
+}
+
+// newGCSRemoteStore opens a gs://bucket/prefix target
+func newGCSRemoteStore(u *url.URL, magentoRoot string, cfg *Config) (*gcsRemoteStore, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid remote target %q, expected gs://bucket/prefix", u.Redacted())
+	}
+	s := &gcsRemoteStore{
+		bucket:   u.Host,
+		prefix:   strings.Trim(u.Path, "/"),
+		endpoint: strings.TrimSuffix(cfg.Remote.GCS.Endpoint, "/"),
+	}
+	if s.prefix != "" {
+		s.prefix += "/"
+	}
+	if s.endpoint == "" {
+		s.endpoint = gcsDefaultEndpoint
+	}
+
+	var err error
+	if s.client, err = NewHTTPClient(cfg.HTTP); err != nil {
+		return nil, err
+	}
+	credentials := NewCredentials(magentoRoot, cfg)
+	if credentials.Has("gcs.token") {
+		token, err := credentials.Get("gcs.token")
+		if err != nil {
+			return nil, err
+		}
+		s.tokens = staticTokenSource("gcs.token", token)
+	} else if s.tokens, err = googleTokenSource(s.client, gcsScope); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *gcsRemoteStore) String() string {
+	return "gs://" + s.bucket + "/" + s.prefix
+}
+
+// gcsObject is an object of a listing
+type gcsObject struct {
+	Name    string    `json:"name"`
+	MD5Hash string    `json:"md5Hash"`
+	Updated time.Time `json:"updated"`
+}
+
+// list returns the objects below the prefix of the target and the given prefix
+func (s *gcsRemoteStore) list(prefix string) ([]gcsObject, error) {
+	var objects []gcsObject
+	pageToken := ""
+	for {
+		query := url.Values{"prefix": {s.prefix + prefix}, "fields": {"items(name,md5Hash,updated),nextPageToken"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		resp, err := s.do(http.MethodGet, s.bucketURL()+"/o?"+query.Encode(), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Items         []gcsObject `json:"items"`
+			NextPageToken string      `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid listing: %w", err)
+		}
+		for _, object := range result.Items {
+			object.Name = strings.TrimPrefix(object.Name, s.prefix)
+			objects = append(objects, object)
+		}
+		if result.NextPageToken == "" {
+			return objects, nil
+		}
+		pageToken = result.NextPageToken
+	}
+}
+
+func (s *gcsRemoteStore) ListVersions() ([]RemoteVersion, error) {
+	objects, err := s.list("")
+	if err != nil {
+		return nil, err
+	}
+	modified := make(map[string]time.Time, len(objects))
+	for _, object := range objects {
+		modified[object.Name] = object.Updated
+	}
+	return remoteVersionsOf(modified), nil
+}
+
+func (s *gcsRemoteStore) CurrentVersion() (string, error) {
+	resp, err := s.do(http.MethodGet, s.objectURL("deployed_version.txt")+"?alt=media", nil, nil)
+	if err != nil {
+		if e, ok := err.(*gcsError); ok && e.Code == http.StatusNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return strings.TrimSpace(string(data)), err
+}
+
+// DeleteVersion deletes the objects of a version prefix, as GCS has no bulk delete
+func (s *gcsRemoteStore) DeleteVersion(name string) error {
+	if !remoteVersionPattern.MatchString(name) {
+		return fmt.Errorf("refusing to delete %q: not a version prefix", name)
+	}
+	objects, err := s.list(name + "/")
+	if err != nil {
+		return err
+	}
+	keys := make([]string, len(objects))
+	for i, object := range objects {
+		keys[i] = object.Name
+	}
+	return forEachKey(keys, defaultRemoteConcurrency, s.DeleteObject)
+}
+
+// ListObjects fingerprints objects by their MD5
+func (s *gcsRemoteStore) ListObjects() (map[string]string, error) {
+	objects, err := s.list("")
+	if err != nil {
+		return nil, err
+	}
+	fingerprints := make(map[string]string, len(objects))
+	for _, object := range objects {
+		fingerprints[object.Name] = base64ToHex(object.MD5Hash)
+	}
+	return fingerprints, nil
+}
+
+func (s *gcsRemoteStore) Fingerprint(path string) (string, error) {
+	return fileMD5(path)
+}
+
+// PutObject uploads small files with a multipart upload, metadata and content in one request,
+// and larger ones in chunks with a resumable upload; GCS verifies the MD5 of both
+func (s *gcsRemoteStore) PutObject(key string, path string, contentType string, cacheControl string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	sum, err := fileMD5(path)
+	if err != nil {
+		return err
+	}
+	md5Hash, _ := hex.DecodeString(sum)
+	metadata, err := json.Marshal(map[string]string{
+		"name":         s.prefix + key,
+		"contentType":  contentType,
+		"cacheControl": cacheControl,
+		"md5Hash":      base64.StdEncoding.EncodeToString(md5Hash),
+	})
+	if err != nil {
+		return err
+	}
+	if info.Size() > gcsChunkSize {
+		return s.putResumable(path, info.Size(), contentType, metadata)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+	part.Write(metadata)
+	part, _ = writer.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	part.Write(content)
+	writer.Close()
+
+	header := http.Header{"Content-Type": {"multipart/related; boundary=" + writer.Boundary()}}
+	resp, err := s.do(http.MethodPost, s.uploadURL("multipart"), body.Bytes(), header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// putResumable uploads a large file in chunks to a resumable upload session
+func (s *gcsRemoteStore) putResumable(path string, size int64, contentType string, metadata []byte) error {
+	header := http.Header{
+		"Content-Type":            {"application/json; charset=UTF-8"},
+		"X-Upload-Content-Type":   {contentType},
+		"X-Upload-Content-Length": {fmt.Sprint(size)},
+	}
+	resp, err := s.do(http.MethodPost, s.uploadURL("resumable"), metadata, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return fmt.Errorf("no resumable upload session for %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	chunk := make([]byte, gcsChunkSize)
+	for offset := int64(0); offset < size; {
+		n, err := io.ReadFull(f, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		header := http.Header{"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(n)-1, size)}}
+		resp, err := s.do(http.MethodPut, session, chunk[:n], header)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		offset += int64(n)
+	}
+	return nil
+}
+
+func (s *gcsRemoteStore) DeleteObject(key string) error {
+	resp, err := s.do(http.MethodDelete, s.objectURL(key), nil, nil)
+	if err != nil {
+		if e, ok := err.(*gcsError); ok && e.Code == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// bucketURL returns the JSON API URL of the bucket
+func (s *gcsRemoteStore) bucketURL() string {
+	return s.endpoint + "/storage/v1/b/" + url.PathEscape(s.bucket)
+}
+
+// objectURL returns the JSON API URL of an object, with the slashes of its name escaped
+func (s *gcsRemoteStore) objectURL(key string) string {
+	return s.bucketURL() + "/o/" + url.PathEscape(s.prefix+key)
+}
+
+// uploadURL returns the URL of an upload of the given type
+func (s *gcsRemoteStore) uploadURL(uploadType string) string {
+	return s.endpoint + "/upload/storage/v1/b/" + url.PathEscape(s.bucket) + "/o?uploadType=" + uploadType
+}
+
+// gcsError is an error response of the JSON API
+type gcsError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *gcsError) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+// do sends an authorized request and returns the response of a successful one (including
+// 308 for chunks of a resumable upload); error responses are returned as *gcsError
+func (s *gcsRemoteStore) do(method string, target string, body []byte, header http.Header) (*http.Response, error) {
+	token, err := s.tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body, req.GetBody = nil, nil
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	// Uploads (POST) replace the object or start a new session, so they may be repeated
+	resp, err := s.client.DoIdempotent(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusPermanentRedirect {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var response struct {
+			Error gcsError `json:"error"`
+		}
+		if json.Unmarshal(data, &response) != nil || response.Error.Message == "" {
+			response.Error.Message = strings.TrimSpace(string(data))
+		}
+		response.Error.Code = resp.StatusCode
+		return nil, &response.Error
+	}
+	return resp, nil
+}
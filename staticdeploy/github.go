@@ -0,0 +1,130 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// printGitHubAnnotations prints workflow commands annotating the failed jobs, the themes that
+// weren't found, the errors outside jobs and the job matrix warnings of a report, for
+// --output=github
+func printGitHubAnnotations(w io.Writer, report *Report) {
+	jobErrors := make(map[string]bool)
+	skipped := make(map[string][]string) // theme (area) -> locales
+	for _, job := range report.Jobs {
+		label := fmt.Sprintf("%s/%s (%s)", job.Theme, job.Area, job.Locale)
+		switch {
+		case job.Error != "":
+			jobErrors[job.Error] = true
+			fmt.Fprintf(w, "::error title=%s::%s\n", escapeGitHubProperty("Static deploy failed: "+label), escapeGitHubData(job.Error))
+		case job.Files == 0 && job.SymlinkTarget == "":
+			theme := fmt.Sprintf("%s (%s)", job.Theme, job.Area)
+			skipped[theme] = append(skipped[theme], job.Locale)
+		}
+	}
+
+	themes := make([]string, 0, len(skipped))
+	for theme := range skipped {
+		themes = append(themes, theme)
+	}
+	sort.Strings(themes)
+	for _, theme := range themes {
+		message := fmt.Sprintf("%s: theme not found, skipped for %s; see --trace-resolution", theme, strings.Join(skipped[theme], ", "))
+		fmt.Fprintf(w, "::warning title=%s::%s\n", escapeGitHubProperty("Static deploy skipped a theme"), escapeGitHubData(message))
+	}
+
+	for _, message := range report.Errors {
+		if !jobErrors[message] {
+			fmt.Fprintf(w, "::error title=%s::%s\n", escapeGitHubProperty("Static deploy failed"), escapeGitHubData(message))
+		}
+	}
+	for _, message := range report.Warnings {
+		fmt.Fprintf(w, "::warning title=%s::%s\n", escapeGitHubProperty("Static deploy job matrix"), escapeGitHubData(message))
+	}
+}
+
+// writeGitHubStepSummary appends a markdown table of the results of a report to the step
+// summary file of the workflow ($GITHUB_STEP_SUMMARY)
+func writeGitHubStepSummary(report *Report) error {
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return fmt.Errorf("GITHUB_STEP_SUMMARY is not set, not running in GitHub Actions?")
+	}
+
+	var sb strings.Builder
+	status := "✅ Succeeded"
+	if !report.Success {
+		status = "❌ Failed"
+	}
+	fmt.Fprintf(&sb, "### Static content deploy: %s\n\n", status)
+	fmt.Fprintf(&sb, "Version `%s` · %d of %d jobs succeeded", report.Version, report.Totals.Succeeded, report.Totals.Jobs)
+	if report.Totals.Failed > 0 {
+		fmt.Fprintf(&sb, " · %d failed", report.Totals.Failed)
+	}
+	if report.Totals.Skipped > 0 {
+		fmt.Fprintf(&sb, " · %d skipped", report.Totals.Skipped)
+	}
+	fmt.Fprintf(&sb, " · %d files in %.1fs\n\n", report.Files, report.Duration)
+
+	if len(report.Jobs) > 0 {
+		sb.WriteString("| Theme | Area | Locale | Result | Files | Duration |\n")
+		sb.WriteString("|-------|------|--------|--------|------:|---------:|\n")
+		for _, job := range report.Jobs {
+			result := "✅"
+			switch {
+			case job.Error != "":
+				result = "❌ " + escapeMarkdownCell(job.Error)
+			case job.SymlinkTarget != "":
+				result = "🔗 → " + job.SymlinkTarget
+			case job.Files == 0:
+				result = "⊘ theme not found"
+			}
+			if job.Attempts > 1 {
+				result += fmt.Sprintf(" (%d attempts)", job.Attempts)
+			}
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s | %d | %.1fs |\n", job.Theme, job.Area, job.Locale, result, job.Files, job.Duration)
+		}
+		sb.WriteString("\n")
+	}
+
+	jobErrors := make(map[string]bool)
+	for _, job := range report.Jobs {
+		jobErrors[job.Error] = true
+	}
+	for _, message := range report.Errors {
+		if !jobErrors[message] {
+			fmt.Fprintf(&sb, "- ❌ %s\n", message)
+		}
+	}
+	for _, message := range report.Warnings {
+		fmt.Fprintf(&sb, "- ⚠️ %s\n", message)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(sb.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// escapeGitHubData escapes the message of a workflow command
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeGitHubProperty escapes a property value of a workflow command
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// escapeMarkdownCell keeps text on one line and its pipes from ending a table cell
+func escapeMarkdownCell(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ", "\r", "").Replace(s)
+}
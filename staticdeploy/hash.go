@@ -0,0 +1,56 @@
+package staticdeploy
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+	"lukechampine.com/blake3"
+)
+
+// defaultHashAlgorithm is the hash used for manifests and change detection unless configured
+const defaultHashAlgorithm = "xxhash64"
+
+// hashAlgorithms are the supported content hashes; all digests are byte strings (xxhash64
+// big-endian), so they don't depend on the byte order of the machine
+var hashAlgorithms = map[string]func() hash.Hash{
+	"xxhash64": func() hash.Hash { return xxhash.New() },
+	"sha256":   sha256.New,
+	"blake3":   func() hash.Hash { return blake3.New(32, nil) },
+}
+
+// hashAlgorithm is the configured hash of new manifests (the hash key of the config file)
+var hashAlgorithm = defaultHashAlgorithm
+
+// newHasher returns a new hash.Hash for algorithm
+func newHasher(algorithm string) (hash.Hash, error) {
+	newHash, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash algorithm %q (supported: %v)", algorithm, hashAlgorithmNames())
+	}
+	return newHash(), nil
+}
+
+// hashAlgorithmNames returns the supported algorithms, sorted
+func hashAlgorithmNames() []string {
+	names := make([]string, 0, len(hashAlgorithms))
+	for name := range hashAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setHashAlgorithm sets hashAlgorithm from the config, validating it
+func setHashAlgorithm(cfg *Config) error {
+	if cfg.Hash == "" {
+		return nil
+	}
+	if _, err := newHasher(cfg.Hash); err != nil {
+		return fmt.Errorf("invalid hash in config: %w", err)
+	}
+	hashAlgorithm = cfg.Hash
+	return nil
+}
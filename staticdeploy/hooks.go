@@ -0,0 +1,98 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Hooks are shell commands run at points of the deployment (the hooks section of the config
+// file), with STATIC_DEPLOY_* environment variables describing the run or the job
+type Hooks struct {
+	PreDeploy  []string `yaml:"pre_deploy" json:"pre_deploy"`   // before anything is deployed; a failure stops the run
+	PostJob    []string `yaml:"post_job" json:"post_job"`       // after every job; a failure is a warning
+	PostDeploy []string `yaml:"post_deploy" json:"post_deploy"` // after a successful deploy; a failure fails the run
+	OnFailure  []string `yaml:"on_failure" json:"on_failure"`   // after a failed or interrupted deploy
+}
+
+// runHooks runs the commands of a hook in order with sh in the Magento root, stopping at the
+// first failure. Output is shown when verbose or when a command fails
+func runHooks(hook string, commands []string, magentoRoot string, env []string, verbose bool) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	root, _ := filepath.Abs(magentoRoot)
+	env = append(append(os.Environ(), "STATIC_DEPLOY_HOOK="+hook, "STATIC_DEPLOY_ROOT="+root), env...)
+
+	for _, command := range commands {
+		if verbose {
+			logDebugf("Running %s hook: %s", hook, command)
+		}
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Dir = magentoRoot
+		cmd.Env = env
+		var out bytes.Buffer
+		if verbose {
+			cmd.Stdout = runStdout
+			cmd.Stderr = runStderr
+		} else {
+			cmd.Stdout = &out
+			cmd.Stderr = &out
+		}
+		if err := cmd.Run(); err != nil {
+			runStderr.Write(out.Bytes())
+			return fmt.Errorf("%s hook '%s' failed: %w", hook, command, err)
+		}
+	}
+	return nil
+}
+
+// runHookEnv describes the run to the pre_deploy, post_deploy and on_failure hooks
+func runHookEnv(version string, areas, themes, languages []string) []string {
+	return []string{
+		"STATIC_DEPLOY_VERSION=" + version,
+		"STATIC_DEPLOY_AREAS=" + strings.Join(areas, " "),
+		"STATIC_DEPLOY_THEMES=" + strings.Join(themes, " "),
+		"STATIC_DEPLOY_LOCALES=" + strings.Join(languages, " "),
+	}
+}
+
+// outcomeHookEnv adds the outcome of the run for the post_deploy and on_failure hooks
+func outcomeHookEnv(env []string, report *Report, success bool) []string {
+	status := "0"
+	if success {
+		status = "1"
+	}
+	return append(append([]string{}, env...),
+		"STATIC_DEPLOY_SUCCESS="+status,
+		"STATIC_DEPLOY_FILES="+strconv.FormatInt(report.Files, 10),
+		"STATIC_DEPLOY_ERRORS="+strings.Join(report.Errors, "\n"),
+	)
+}
+
+// jobHookEnv describes a finished job to the post_job hooks
+func jobHookEnv(version string, result DeployResult) []string {
+	status := "deployed"
+	switch {
+	case result.Error != "":
+		status = "failed"
+	case result.Symlinked:
+		status = "symlinked"
+	case result.FilesCount == 0:
+		status = "skipped"
+	}
+	return []string{
+		"STATIC_DEPLOY_VERSION=" + version,
+		"STATIC_DEPLOY_AREA=" + result.Job.Area,
+		"STATIC_DEPLOY_THEME=" + result.Job.Theme,
+		"STATIC_DEPLOY_LOCALE=" + result.Job.Locale,
+		"STATIC_DEPLOY_STATUS=" + status,
+		"STATIC_DEPLOY_FILES=" + strconv.FormatInt(result.FilesCount, 10),
+		fmt.Sprintf("STATIC_DEPLOY_DURATION=%.3f", result.Duration.Seconds()),
+		"STATIC_DEPLOY_ERROR=" + result.Error,
+	}
+}
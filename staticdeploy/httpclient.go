@@ -0,0 +1,234 @@
+package staticdeploy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// HTTPConfig configures the outbound HTTP client shared by all remote integrations
+// (the http section of the config file)
+type HTTPConfig struct {
+	Timeout            string  `yaml:"timeout" json:"timeout"`       // per attempt, e.g. 30s (default 30s)
+	Retries            int     `yaml:"retries" json:"retries"`       // retries after the first attempt (default 3, -1 for none)
+	RetryWait          string  `yaml:"retry_wait" json:"retry_wait"` // initial backoff, doubled per retry (default 1s)
+	Proxy              string  `yaml:"proxy" json:"proxy"`           // proxy URL, except for NO_PROXY hosts; default from HTTPS_PROXY/HTTP_PROXY/NO_PROXY
+	CAFile             string  `yaml:"ca_file" json:"ca_file"`       // PEM bundle trusted in addition to the system roots
+	InsecureSkipVerify bool    `yaml:"insecure_skip_verify" json:"insecure_skip_verify"`
+	RateLimit          float64 `yaml:"rate_limit" json:"rate_limit"` // max requests per second, 0 for unlimited
+}
+
+// Defaults of the HTTP client
+const (
+	defaultHTTPTimeout   = 30 * time.Second
+	defaultHTTPRetries   = 3
+	defaultHTTPRetryWait = time.Second
+	maxHTTPRetryWait     = time.Minute
+)
+
+// HTTPClient is an http.Client with retries, backoff and rate limiting
+type HTTPClient struct {
+	client    *http.Client
+	retries   int
+	retryWait time.Duration
+	limiter   *rateLimiter
+}
+
+// NewHTTPClient creates the HTTP client from its configuration
+// In offline mode no client is created, so integrations fail before the deployment starts
+func NewHTTPClient(cfg HTTPConfig) (*HTTPClient, error) {
+	if err := requireNetwork("outbound HTTP"); err != nil {
+		return nil, err
+	}
+
+	timeout, err := parseDurationDefault(cfg.Timeout, defaultHTTPTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http timeout: %w", err)
+	}
+	retryWait, err := parseDurationDefault(cfg.RetryWait, defaultHTTPRetryWait)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http retry_wait: %w", err)
+	}
+	retries := cfg.Retries
+	if retries == 0 {
+		retries = defaultHTTPRetries
+	} else if retries < 0 {
+		retries = 0
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if offlineMode {
+		transport.DialContext = offlineDialContext
+	}
+
+	// The configured proxy replaces those of the environment, NO_PROXY still applies
+	if cfg.Proxy != "" {
+		if _, err := url.Parse(cfg.Proxy); err != nil {
+			return nil, fmt.Errorf("invalid http proxy: %w", err)
+		}
+		proxy := httpproxy.FromEnvironment()
+		proxy.HTTPProxy, proxy.HTTPSProxy = cfg.Proxy, cfg.Proxy
+		proxyFunc := proxy.ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	}
+
+	if cfg.CAFile != "" || cfg.InsecureSkipVerify {
+		tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+		if cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA file: %w", err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &HTTPClient{
+		client:    &http.Client{Timeout: timeout, Transport: transport},
+		retries:   retries,
+		retryWait: retryWait,
+		limiter:   newRateLimiter(cfg.RateLimit),
+	}, nil
+}
+
+// Do sends a request, retrying 429 responses, and network errors and 5xx responses of
+// idempotent methods (GET, HEAD, OPTIONS, TRACE, PUT, DELETE), with exponential backoff
+// (honoring Retry-After). Requests with a body must be replayable (GetBody set, as done by
+// http.NewRequest for bytes and strings readers)
+func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return c.do(req, idempotentMethods[req.Method])
+}
+
+// DoIdempotent is Do for requests that are safe to repeat whatever their method, like
+// purges: network errors and 5xx responses are retried too
+func (c *HTTPClient) DoIdempotent(req *http.Request) (*http.Response, error) {
+	return c.do(req, true)
+}
+
+// idempotentMethods are the methods whose requests Do retries after they may have been
+// processed; a 429 response means the request wasn't, so it's retried for all methods
+var idempotentMethods = map[string]bool{
+	"": true, http.MethodGet: true, http.MethodHead: true, http.MethodOptions: true,
+	http.MethodTrace: true, http.MethodPut: true, http.MethodDelete: true,
+}
+
+func (c *HTTPClient) do(req *http.Request, idempotent bool) (*http.Response, error) {
+	wait := c.retryWait
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("cannot retry %s %s: request body is not replayable", req.Method, req.URL.Redacted())
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		c.limiter.Wait()
+		resp, err := c.client.Do(req)
+
+		retryable := (err == nil && resp.StatusCode == http.StatusTooManyRequests) ||
+			(idempotent && (err != nil || resp.StatusCode >= 500))
+		if !retryable || attempt >= c.retries {
+			return resp, err
+		}
+
+		delay := wait
+		if resp != nil {
+			if after := retryAfter(resp); after > 0 {
+				delay = after
+			}
+			// Drain so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		// Jitter so parallel jobs don't retry in lockstep
+		delay += time.Duration(rand.Int63n(int64(delay)/4 + 1))
+		if delay > maxHTTPRetryWait {
+			delay = maxHTTPRetryWait
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		wait *= 2
+	}
+}
+
+// retryAfter returns the delay requested by a Retry-After header in seconds, or 0
+func retryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// parseDurationDefault parses a duration, returning def for an empty value
+func parseDurationDefault(value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// rateLimiter spaces requests evenly at a maximum rate per second
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newRateLimiter returns a limiter for perSecond requests per second, nil for unlimited
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait blocks until the next request may be sent
+func (l *rateLimiter) Wait() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	sendAt := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(time.Until(sendAt))
+}
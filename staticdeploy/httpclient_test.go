@@ -0,0 +1,72 @@
+package staticdeploy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPClientRetriesIdempotentRequests(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(HTTPConfig{Retries: 2, RetryWait: "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(method string, do func(*http.Request) (*http.Response, error)) int {
+		attempts = 0
+		req, _ := http.NewRequest(method, server.URL, strings.NewReader("{}"))
+		resp, err := do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return attempts
+	}
+
+	if n := send(http.MethodPut, client.Do); n != 3 {
+		t.Errorf("PUT sent %d times, want 3", n)
+	}
+	if n := send(http.MethodPost, client.Do); n != 1 {
+		t.Errorf("POST sent %d times, want 1 (not retried)", n)
+	}
+	if n := send(http.MethodPost, client.DoIdempotent); n != 3 {
+		t.Errorf("POST with DoIdempotent sent %d times, want 3", n)
+	}
+}
+
+func TestHTTPClientProxyRespectsNoProxy(t *testing.T) {
+	t.Setenv("NO_PROXY", "varnish.internal,.svc")
+	t.Setenv("no_proxy", "")
+	client, err := NewHTTPClient(HTTPConfig{Proxy: "http://proxy.example.com:3128"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := client.client.Transport.(*http.Transport).Proxy
+
+	for target, want := range map[string]string{
+		"https://api.cloudflare.com/client/v4": "http://proxy.example.com:3128",
+		"http://varnish.internal:6081/":        "",
+		"http://cache.default.svc/":            "",
+		"http://127.0.0.1:6081/":               "",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		proxyURL, err := proxy(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if proxyURL != nil {
+			got = proxyURL.String()
+		}
+		if got != want {
+			t.Errorf("proxy of %s = %q, want %q", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// magentoAreas are the areas Magento deploys for --area=all
+var magentoAreas = []string{"frontend", "adminhtml"}
+
+// magentoNoFileOptions maps the --no-* file type options of setup:static-content:deploy
+// to the exclude patterns leaving out the same files
+var magentoNoFileOptions = []struct {
+	Name     string
+	Patterns []string
+}{
+	{"no-javascript", []string{"*.js"}},
+	{"no-css", []string{"*.css"}},
+	{"no-html", []string{"*.html"}},
+	{"no-fonts", []string{"*.eot", "*.ttf", "*.woff", "*.woff2", "fonts"}},
+}
+
+// magentoIgnoredOptions are setup:static-content:deploy options without effect on the files
+// this tool deploys (bundling, minification and LESS are done by Magento or the theme build)
+var magentoIgnoredOptions = []string{"no-js-bundle", "no-less", "no-html-minify", "no-parent", "no-misc"}
+
+func init() {
+	registerCommand(Command{
+		Name:        "import-command",
+		Description: "Translate a bin/magento setup:static-content:deploy command line to static-deploy options",
+		Run:         runImportCommand,
+	})
+}
+
+// runImportCommand implements the import-command subcommand
+func runImportCommand(args []string) error {
+	flags := flag.NewFlagSet("import-command", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory (to resolve --exclude-theme and --exclude-language)")
+	format := flags.String("format", "config", "Output format: config (the options section of static-deploy.yaml) or command (a command line)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s import-command [options] \"<bin/magento arguments>\"\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Prints the static-deploy options equivalent to a setup:static-content:deploy invocation, e.g.\n")
+		fmt.Fprintf(os.Stderr, "  %s import-command \"bin/magento setup:static-content:deploy -f -t Vendor/Hyva nl_NL en_US\"\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("no bin/magento command given")
+	}
+	if *format != "config" && *format != "command" {
+		return fmt.Errorf("--format must be 'config' or 'command', got '%s'", *format)
+	}
+
+	words, err := splitCommandLine(strings.Join(flags.Args(), " "))
+	if err != nil {
+		return err
+	}
+	options, notes, err := importMagentoCommand(*root, words)
+	if err != nil {
+		return err
+	}
+
+	for _, note := range notes {
+		fmt.Fprintf(os.Stderr, "Note: %s\n", note)
+	}
+	if *format == "command" {
+		fmt.Println(importedCommandLine(options))
+		return nil
+	}
+	fmt.Println("# static-deploy.yaml")
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]any{"options": importedConfigOptions(options)}); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// importedCommandLine returns the deploy command line of imported options, with the short
+// names of the deploy flags where they have one
+func importedCommandLine(options []importedOption) string {
+	deployFlags := newDeployFlags(flag.ContinueOnError)
+	words := []string{os.Args[0]}
+	for _, option := range options {
+		name := "--" + option.Name
+		if shorthand := deployFlags.Lookup(option.Name).Shorthand; shorthand != "" {
+			name = "-" + shorthand
+		}
+		switch {
+		case option.Value == "":
+			words = append(words, name)
+		case strings.HasPrefix(name, "--"):
+			words = append(words, name+"="+shellQuote(option.Value))
+		default:
+			words = append(words, name, shellQuote(option.Value))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// importedConfigOptions returns imported options as the options section of the config file:
+// lists for repeatable flags, numbers and booleans as such
+func importedConfigOptions(options []importedOption) map[string]any {
+	deployFlags := newDeployFlags(flag.ContinueOnError)
+	config := make(map[string]any)
+	for _, option := range options {
+		switch deployFlags.Lookup(option.Name).Value.Type() {
+		case "stringArray":
+			list, _ := config[option.Name].([]string)
+			config[option.Name] = append(list, option.Value)
+		case "bool":
+			config[option.Name] = true
+		case "int":
+			n, _ := strconv.Atoi(option.Value)
+			config[option.Name] = n
+		default:
+			config[option.Name] = option.Value
+		}
+	}
+	return config
+}
+
+// importedOption is a deploy option of an imported command, by its flag name; Value is ""
+// for boolean options
+type importedOption struct {
+	Name  string
+	Value string
+}
+
+// importMagentoCommand translates the words of a setup:static-content:deploy invocation to
+// static-deploy options, with notes about options that have no equivalent
+// Leading words up to the command name (php, bin/magento, ...) are skipped
+func importMagentoCommand(magentoRoot string, words []string) ([]importedOption, []string, error) {
+	for i, word := range words {
+		if isStaticDeployCommandName(word) {
+			words = words[i+1:]
+			break
+		}
+	}
+
+	flags := flag.NewFlagSet("setup:static-content:deploy", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	areas := flags.StringArrayP("area", "a", nil, "")
+	excludeAreas := flags.StringArray("exclude-area", nil, "")
+	themes := flags.StringArrayP("theme", "t", nil, "")
+	excludeThemes := flags.StringArray("exclude-theme", nil, "")
+	languages := flags.StringArrayP("language", "l", nil, "")
+	excludeLanguages := flags.StringArray("exclude-language", nil, "")
+	jobs := flags.IntP("jobs", "j", 0, "")
+	strategy := flags.StringP("strategy", "s", "", "")
+	force := flags.BoolP("force", "f", false, "")
+	version := flags.String("content-version", "", "")
+	symlinkLocale := flags.Bool("symlink-locale", false, "")
+	noImages := flags.Bool("no-images", false, "")
+	refreshOnly := flags.Bool("refresh-content-version-only", false, "")
+	verbosity := flags.CountP("verbose", "v", "")
+	flags.Int("max-execution-time", 0, "")
+	for _, option := range magentoNoFileOptions {
+		flags.Bool(option.Name, false, "")
+	}
+	for _, name := range magentoIgnoredOptions {
+		flags.Bool(name, false, "")
+	}
+	// Symfony console options
+	flags.BoolP("quiet", "q", false, "")
+	flags.BoolP("no-interaction", "n", false, "")
+	flags.Bool("ansi", false, "")
+	flags.Bool("no-ansi", false, "")
+
+	if err := flags.Parse(words); err != nil {
+		return nil, nil, fmt.Errorf("unsupported setup:static-content:deploy arguments: %w", err)
+	}
+	if *refreshOnly {
+		return nil, nil, fmt.Errorf("--refresh-content-version-only has no equivalent, this tool writes pub/static/deployed_version.txt as part of a deploy")
+	}
+
+	var out []importedOption
+	var notes []string
+
+	// Magento deploys all areas, themes and used locales unless told otherwise
+	areaList := withoutNone(*areas)
+	if len(areaList) == 0 || slices.Contains(areaList, "all") {
+		areaList = magentoAreas
+	}
+	areaList = subtract(areaList, withoutNone(*excludeAreas))
+	if len(areaList) == 0 {
+		return nil, nil, fmt.Errorf("all areas are excluded")
+	}
+	for _, area := range areaList {
+		out = append(out, importedOption{"area", area})
+	}
+
+	themeList := withoutNone(*themes)
+	if len(themeList) == 0 {
+		themeList = []string{"all"}
+	}
+	if excluded := withoutNone(*excludeThemes); len(excluded) > 0 {
+		var resolved []string
+		for _, area := range areaList {
+			resolved = appendUnique(resolved, expandThemePatterns(magentoRoot, area, themeList)...)
+		}
+		themeList = subtract(resolved, excluded)
+		if len(themeList) == 0 {
+			return nil, nil, fmt.Errorf("no themes left after --exclude-theme (themes are discovered in %s)", magentoRoot)
+		}
+	}
+	for _, theme := range themeList {
+		out = append(out, importedOption{"theme", theme})
+	}
+
+	languageList := append(withoutNone(*languages), flags.Args()...)
+	if len(languageList) == 0 {
+		languageList = []string{"all"}
+	}
+	if excluded := withoutNone(*excludeLanguages); len(excluded) > 0 {
+		resolved, err := expandLocales(magentoRoot, languageList, &Config{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot resolve --exclude-language: %w", err)
+		}
+		languageList = subtract(resolved, excluded)
+		if len(languageList) == 0 {
+			return nil, nil, fmt.Errorf("no languages left after --exclude-language")
+		}
+	}
+	for _, language := range languageList {
+		out = append(out, importedOption{"language", language})
+	}
+
+	if *jobs > 0 {
+		out = append(out, importedOption{"jobs", strconv.Itoa(*jobs)})
+	}
+	if *strategy != "" {
+		out = append(out, importedOption{"strategy", *strategy})
+		if *strategy != "quick" {
+			notes = append(notes, fmt.Sprintf("strategy '%s' is informational only, files are always deployed per theme and locale", *strategy))
+		}
+	}
+	if *force {
+		out = append(out, importedOption{"force", ""})
+	}
+	if *version != "" {
+		out = append(out, importedOption{"content-version", *version})
+	}
+	if *symlinkLocale {
+		out = append(out, importedOption{"symlink", "locale"})
+	}
+	if *noImages {
+		out = append(out, importedOption{"images", "defer"})
+	}
+	for _, option := range magentoNoFileOptions {
+		if enabled, _ := flags.GetBool(option.Name); enabled {
+			for _, pattern := range option.Patterns {
+				out = append(out, importedOption{"exclude", pattern})
+			}
+		}
+	}
+	for _, name := range magentoIgnoredOptions {
+		if flags.Changed(name) {
+			notes = append(notes, fmt.Sprintf("--%s is ignored, it has no effect on the files this tool deploys", name))
+		}
+	}
+	if flags.Changed("max-execution-time") {
+		notes = append(notes, "--max-execution-time is ignored")
+	}
+	if *verbosity > 0 {
+		out = append(out, importedOption{"verbose", ""})
+	}
+
+	return out, notes, nil
+}
+
+// isStaticDeployCommandName reports whether word names setup:static-content:deploy, also
+// abbreviated as Symfony console allows (e.g. s:s:d)
+func isStaticDeployCommandName(word string) bool {
+	parts := strings.Split(word, ":")
+	full := []string{"setup", "static-content", "deploy"}
+	if len(parts) != len(full) {
+		return false
+	}
+	for i, part := range parts {
+		if part == "" || !strings.HasPrefix(full[i], part) {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutNone drops the 'none' placeholder Magento uses as default of its exclude options
+func withoutNone(values []string) []string {
+	var out []string
+	for _, value := range values {
+		if value != "none" {
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+// subtract returns values without those in remove, keeping the order
+func subtract(values []string, remove []string) []string {
+	var out []string
+	for _, value := range values {
+		if !slices.Contains(remove, value) {
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+// appendUnique appends the values not yet in list
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// shellQuote quotes arg for a POSIX shell when needed
+func shellQuote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=/.,:@") == "" {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
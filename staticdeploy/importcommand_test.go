@@ -0,0 +1,27 @@
+package staticdeploy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportMagentoCommandConfigOptions(t *testing.T) {
+	words := strings.Fields("bin/magento setup:static-content:deploy -f --area=frontend -t Vendor/Hyva -j 4 --no-css nl_NL en_US")
+	options, _, err := importMagentoCommand(t.TempDir(), words)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"area":     []string{"frontend"},
+		"theme":    []string{"Vendor/Hyva"},
+		"language": []string{"nl_NL", "en_US"},
+		"jobs":     4,
+		"force":    true,
+		"exclude":  []string{"*.css"},
+	}
+	if got := importedConfigOptions(options); !reflect.DeepEqual(got, want) {
+		t.Errorf("importedConfigOptions = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package staticdeploy
+
+import (
+	"encoding/xml"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// defaultCSSEntryPoints are compiled for every theme; email CSS is referenced from email
+// templates rather than layout XML
+var defaultCSSEntryPoints = []string{
+	"css/email.css",
+	"css/email-inline.css",
+	"css/email-fonts.css",
+}
+
+// LayoutPage represents the <head> assets of a Magento layout XML file
+type LayoutPage struct {
+	XMLName xml.Name `xml:"page"`
+	Head    struct {
+		CSS    []LayoutAsset `xml:"css"`
+		Remove []LayoutAsset `xml:"remove"`
+	} `xml:"head"`
+}
+
+// LayoutAsset is a <css src="..."/> or <remove src="..."/> head entry
+type LayoutAsset struct {
+	Src     string `xml:"src,attr"`
+	SrcType string `xml:"src_type,attr"`
+}
+
+// findCSSEntryPoints returns the LESS files to compile for a theme (relative to the staging
+// directory, e.g. css/styles-m.less): the email CSS plus the CSS declared with <css src>
+// in the layout XML of the theme chain, minus the entries removed by child themes
+func findCSSEntryPoints(magentoRoot string, area string, theme string) []string {
+	entries := append([]string{}, defaultCSSEntryPoints...)
+	removed := make(map[string]bool)
+
+	// Parents first, so child themes can remove their parents' CSS
+	chain := getThemeParentChain(magentoRoot, area, theme)
+	for i := len(chain) - 1; i >= 0; i-- {
+		themePath := getThemePath(magentoRoot, area, chain[i])
+		if themePath == "" {
+			continue
+		}
+		layoutFiles, _ := filepath.Glob(filepath.Join(themePath, "*", "layout", "*.xml"))
+
+		for _, layoutFile := range layoutFiles {
+			data, err := os.ReadFile(layoutFile)
+			if err != nil {
+				continue
+			}
+			var page LayoutPage
+			if err := xml.Unmarshal(data, &page); err != nil {
+				continue
+			}
+
+			for _, css := range page.Head.CSS {
+				if src := layoutAssetPath(css); src != "" {
+					entries = append(entries, src)
+					delete(removed, src)
+				}
+			}
+			for _, remove := range page.Head.Remove {
+				if src := layoutAssetPath(remove); src != "" {
+					removed[src] = true
+				}
+			}
+		}
+	}
+
+	var lessFiles []string
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if removed[entry] || seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		lessFiles = append(lessFiles, strings.TrimSuffix(entry, ".css")+".less")
+	}
+	return lessFiles
+}
+
+// layoutAssetPath converts a layout asset src (css/styles.css or Module_Name::css/file.css)
+// to its path relative to the locale directory; URLs and non-CSS assets yield ""
+func layoutAssetPath(asset LayoutAsset) string {
+	src := strings.TrimSpace(asset.Src)
+	if asset.SrcType == "url" || strings.Contains(src, "//") || !strings.HasSuffix(src, ".css") {
+		return ""
+	}
+	if module, rest, found := strings.Cut(src, "::"); found {
+		return path.Join(module, rest)
+	}
+	return path.Clean(src)
+}
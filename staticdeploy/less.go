@@ -1,9 +1,10 @@
-package main
+package staticdeploy
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
@@ -11,17 +12,18 @@ import (
 // LessCompiler handles LESS to CSS compilation using PHP (wikimedia/less.php)
 // This matches Magento's built-in LESS compilation behavior
 type LessCompiler struct {
+	ctx         context.Context // kills the PHP process when canceled
 	magentoRoot string
 	verbose     bool
-	phpPath     string
+	php         *PHPRunner
+	log         *slog.Logger
 }
 
-// NewLessCompiler creates a new LESS compiler instance
-func NewLessCompiler(magentoRoot string, verbose bool) (*LessCompiler, error) {
-	// Find PHP in PATH
-	phpPath, err := exec.LookPath("php")
-	if err != nil {
-		return nil, fmt.Errorf("php not found in PATH")
+// NewLessCompiler creates a new LESS compiler instance logging verbose output to log
+func NewLessCompiler(ctx context.Context, magentoRoot string, php *PHPRunner, verbose bool, log *slog.Logger) (*LessCompiler, error) {
+	// Find PHP (or the command wrapping it) in PATH
+	if _, err := php.LookPath(); err != nil {
+		return nil, err
 	}
 
 	// Verify wikimedia/less.php is installed
@@ -31,64 +33,72 @@ func NewLessCompiler(magentoRoot string, verbose bool) (*LessCompiler, error) {
 	}
 
 	return &LessCompiler{
+		ctx:         ctx,
 		magentoRoot: magentoRoot,
 		verbose:     verbose,
-		phpPath:     phpPath,
+		php:         php,
+		log:         log,
 	}, nil
 }
 
-// CompileEmailCSS compiles the email LESS files to CSS for a given theme/locale/area
-func (lc *LessCompiler) CompileEmailCSS(stagingDir, destDir, area, theme, locale string) error {
-	// Email LESS files to compile
-	emailFiles := []string{
-		"email.less",
-		"email-inline.less",
-		"email-fonts.less",
-	}
-
-	for _, lessFileName := range emailFiles {
-		sourcePath := filepath.Join(stagingDir, "css", lessFileName)
+// CompileCSS compiles the given LESS entry points (relative to the staging directory)
+// to CSS for a given theme/locale/area; entry points without a LESS source are skipped
+func (lc *LessCompiler) CompileCSS(stagingDir, destDir, area, theme, locale string, entryPoints []string) error {
+	failed := 0
+	for _, lessFile := range entryPoints {
+		sourcePath := filepath.Join(stagingDir, lessFile)
 
 		if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
 			if lc.verbose {
-				fmt.Printf("    ⊘ %s not found\n", lessFileName)
+				lc.log.Debug(fmt.Sprintf("    %s %s not found", symSkip, lessFile))
 			}
 			continue
 		}
 
 		// Output CSS file path
-		cssFileName := strings.TrimSuffix(lessFileName, ".less") + ".css"
-		cssPath := filepath.Join(destDir, "css", cssFileName)
+		cssFile := strings.TrimSuffix(lessFile, ".less") + ".css"
+		cssPath := filepath.Join(destDir, cssFile)
 
 		// Ensure css directory exists
-		os.MkdirAll(filepath.Join(destDir, "css"), 0755)
+		os.MkdirAll(filepath.Dir(cssPath), 0755)
 
 		// Compile LESS to CSS using PHP
 		if err := lc.compileLessFile(sourcePath, cssPath, stagingDir, area, theme, locale); err != nil {
 			if lc.verbose {
-				fmt.Printf("    ✗ Failed to compile %s: %v\n", lessFileName, err)
+				lc.log.Debug(fmt.Sprintf("    %s Failed to compile %s: %v", symFail, lessFile, err), "file", lessFile, "error", err)
 			}
+			failed++
 			continue
 		}
 
 		if lc.verbose {
-			fmt.Printf("    ✓ Compiled %s → css/%s\n", lessFileName, cssFileName)
+			lc.log.Debug(fmt.Sprintf("    %s Compiled %s %s %s", symOK, lessFile, symArrow, cssFile), "file", lessFile, "css", cssFile)
 		}
 	}
 
+	if failed > 0 {
+		return fmt.Errorf("%d LESS file(s) failed to compile", failed)
+	}
+
 	return nil
 }
 
 // compileLessFile compiles a single LESS file to CSS using PHP wikimedia/less.php
 func (lc *LessCompiler) compileLessFile(sourcePath, destPath, stagingDir, area, theme, locale string) error {
-	// Build include paths for @import resolution
+	// Build include paths for @import resolution (as seen by PHP)
 	includePaths := []string{
-		stagingDir,
-		filepath.Join(stagingDir, "css"),
-		filepath.Join(stagingDir, "css", "source"),
-		filepath.Join(stagingDir, "css", "source", "lib"),
+		lc.php.Path(stagingDir),
+		lc.php.Path(filepath.Join(stagingDir, "css")),
+		lc.php.Path(filepath.Join(stagingDir, "css", "source")),
+		lc.php.Path(filepath.Join(stagingDir, "css", "source", "lib")),
 	}
 
+	// Compile to a temporary file renamed over the destination, so the CSS is never partially
+	// written and files hard linked by --backup keep their content
+	outPath := filepath.Join(filepath.Dir(destPath), tempArtifactPrefix+filepath.Base(destPath))
+	tempArtifacts.Track(outPath)
+	defer tempArtifacts.Remove(outPath)
+
 	// Create a PHP script to compile the LESS file
 	// This uses the same Less.php library that Magento uses
 	phpScript := fmt.Sprintf(`<?php
@@ -128,9 +138,9 @@ try {
     exit(1);
 }
 `,
-		lc.magentoRoot,
-		sourcePath,
-		destPath,
+		lc.php.Path(lc.magentoRoot),
+		lc.php.Path(sourcePath),
+		lc.php.Path(outPath),
 		phpArrayString(includePaths),
 		area,
 		theme,
@@ -138,26 +148,30 @@ try {
 	)
 
 	// Write the PHP script to the Magento root (accessible from Docker-based PHP)
-	tmpFileName := filepath.Join(lc.magentoRoot, ".less-compile-tmp.php")
+	// Each compilation gets a unique file so parallel jobs don't overwrite each other's script
+	tmpFile, err := createTempFile(lc.magentoRoot, ".less-compile-*.php")
+	if err != nil {
+		return fmt.Errorf("failed to create PHP script in %s: %w", lc.magentoRoot, err)
+	}
+	tmpFileName := tmpFile.Name()
+	defer tempArtifacts.Remove(tmpFileName) // Clean up temp file after execution
 
-	if err := os.WriteFile(tmpFileName, []byte(phpScript), 0644); err != nil {
+	_, err = tmpFile.WriteString(phpScript)
+	tmpFile.Close()
+	if err != nil {
 		return fmt.Errorf("failed to write PHP script to %s: %w", tmpFileName, err)
 	}
 
 	// Execute the PHP script from the magento root directory
-	cmd := exec.Command(lc.phpPath, tmpFileName)
-	cmd.Dir = lc.magentoRoot
+	cmd := lc.php.CommandContext(lc.ctx, lc.php.Path(tmpFileName))
 	output, err := cmd.CombinedOutput()
 
-	// Clean up temp file after execution
-	os.Remove(tmpFileName)
-
 	if err != nil {
 		return fmt.Errorf("PHP compilation failed: %v\nOutput: %s", err, string(output))
 	}
 
 	// Verify output file was created and has content
-	info, err := os.Stat(destPath)
+	info, err := os.Stat(outPath)
 	if err != nil {
 		return fmt.Errorf("output file not created: %w", err)
 	}
@@ -165,7 +179,7 @@ try {
 		return fmt.Errorf("output file is empty")
 	}
 
-	return nil
+	return os.Rename(outPath, destPath)
 }
 
 // phpArrayString converts a Go string slice to PHP array syntax
@@ -0,0 +1,132 @@
+package staticdeploy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// lessCacheDir is where compiled CSS is cached, relative to the Magento root
+// Entries are keyed by the hash of the staged LESS source set
+const lessCacheDir = "var/.static-deploy-cache/less"
+
+// lessCacheMaxAge is how long an entry stays cached without being reused; reusing an entry
+// renews it
+const lessCacheMaxAge = 30 * 24 * time.Hour
+
+// lessCacheFormat is mixed into every cache key; bump it when the compile output changes
+const lessCacheFormat = "v1"
+
+// hashStagedSources computes a cache key from all staged files plus the values that
+// end up in the compiled output (area and theme, used for the email-fonts.css URL, and
+// the compiled entry points)
+func hashStagedSources(stagingDir, area, theme string, entryPoints []string) (string, error) {
+	var files []string
+	err := filepath.Walk(stagingDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", lessCacheFormat, area, theme)
+	for _, entryPoint := range entryPoints {
+		fmt.Fprintf(h, "%s\x00", entryPoint)
+	}
+
+	for _, path := range files {
+		relPath, _ := filepath.Rel(stagingDir, path)
+		fmt.Fprintf(h, "%s\x00", filepath.ToSlash(relPath))
+
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		_, err = copyBuffered(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// restoreCompiledCSS copies a cached compile result into destDir
+// Returns false if there is no cache entry for the key
+func restoreCompiledCSS(cacheDir, destDir string) (bool, error) {
+	if _, err := os.Stat(cacheDir); err != nil {
+		return false, nil
+	}
+
+	err := filepath.Walk(cacheDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, _ := filepath.Rel(cacheDir, path)
+		destPath := filepath.Join(destDir, relPath)
+		os.MkdirAll(filepath.Dir(destPath), 0755)
+		return copyFileLess(path, destPath)
+	})
+	return err == nil, err
+}
+
+// storeCompiledCSS moves a compile output directory into the cache
+// The entry is renamed into place so concurrent jobs never see a partial entry
+func storeCompiledCSS(outDir, cacheDir string) error {
+	if err := os.MkdirAll(filepath.Dir(cacheDir), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(outDir, cacheDir); err != nil && !os.IsExist(err) {
+		// Another job stored the same entry first
+		if _, statErr := os.Stat(cacheDir); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// touchCompiledCSS marks a cache entry as used now, so pruneLessCache keeps it
+func touchCompiledCSS(cacheDir string) {
+	now := time.Now()
+	os.Chtimes(cacheDir, now, now)
+}
+
+// pruneLessCache removes the cache entries not used for maxAge, so the cache doesn't grow
+// without bound on build hosts that are reused. It returns the number of removed entries
+func pruneLessCache(magentoRoot string, maxAge time.Duration, now time.Time) (int, error) {
+	root := filepath.Join(magentoRoot, lessCacheDir)
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !entry.IsDir() || now.Sub(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -1,62 +1,128 @@
-package main
+package staticdeploy
 
 import (
+	"context"
 	"fmt"
-	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // LessPreprocessor handles Magento-style LESS preprocessing
 type LessPreprocessor struct {
+	ctx         context.Context
 	magentoRoot string
+	php         *PHPRunner
 	stagingDir  string
 	verbose     bool
+	useCache    bool
+	log         *slog.Logger
 }
 
-// NewLessPreprocessor creates a new preprocessor
-func NewLessPreprocessor(magentoRoot string, verbose bool) *LessPreprocessor {
+// NewLessPreprocessor creates a new preprocessor logging verbose output to log; canceling ctx
+// stops the PHP compilation in progress
+// When useCache is set, compiled CSS is reused for identical staged sources
+func NewLessPreprocessor(ctx context.Context, magentoRoot string, php *PHPRunner, verbose bool, useCache bool, log *slog.Logger) *LessPreprocessor {
 	return &LessPreprocessor{
+		ctx:         ctx,
 		magentoRoot: magentoRoot,
+		php:         php,
 		verbose:     verbose,
+		useCache:    useCache,
+		log:         log,
 	}
 }
 
 // PreprocessAndCompile preprocesses LESS files and compiles them to CSS
 func (lp *LessPreprocessor) PreprocessAndCompile(destDir, area, theme, locale string) error {
-	// Create a temporary staging directory in the Magento root (accessible from Docker-based PHP)
-	stagingDir := filepath.Join(lp.magentoRoot, ".less-staging-tmp")
-	os.RemoveAll(stagingDir) // Clean up any previous staging directory
-	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+	// Create a unique staging directory per job in the Magento root (accessible from Docker-based PHP)
+	// so parallel jobs don't share (or remove) each other's staged files
+	stagingDir, err := makeTempDir(lp.magentoRoot, ".less-staging-")
+	if err != nil {
 		return fmt.Errorf("failed to create staging directory: %w", err)
 	}
-	defer os.RemoveAll(stagingDir) // Clean up after compilation
+	defer tempArtifacts.Remove(stagingDir) // Clean up after compilation
 	lp.stagingDir = stagingDir
 
 	if lp.verbose {
-		fmt.Printf("    Staging directory: %s\n", stagingDir)
+		lp.log.Debug(fmt.Sprintf("    Staging directory: %s", stagingDir))
 	}
 
 	// Stage all LESS source files
+	_, stagingSpan := startSpan(lp.ctx, "less staging")
 	if err := lp.stageSourceFiles(area, theme); err != nil {
+		endSpan(stagingSpan, err)
 		return fmt.Errorf("failed to stage source files: %w", err)
 	}
 
 	// Process @magento_import directives
 	if err := lp.processMagentoImports(); err != nil {
+		endSpan(stagingSpan, err)
 		return fmt.Errorf("failed to process @magento_import: %w", err)
 	}
+	stagingSpan.End()
+
+	// LESS files to compile: email CSS and the CSS declared in the theme's layout XML
+	entryPoints := findCSSEntryPoints(lp.magentoRoot, area, theme)
+
+	// Reuse previously compiled CSS when the staged sources are identical
+	outDir := destDir
+	cacheDir := ""
+	if lp.useCache {
+		key, err := hashStagedSources(lp.stagingDir, area, theme, entryPoints)
+		if err == nil {
+			cacheDir = filepath.Join(lp.magentoRoot, lessCacheDir, key)
+			if ok, err := restoreCompiledCSS(cacheDir, destDir); ok {
+				touchCompiledCSS(cacheDir)
+				if lp.verbose {
+					lp.log.Debug(fmt.Sprintf("    %s Reused cached CSS (%s)", symOK, key[:12]))
+				}
+				trace.SpanFromContext(lp.ctx).SetAttributes(attribute.Bool("less.cached", true))
+				return nil
+			} else if err != nil && lp.verbose {
+				lp.log.Warn(fmt.Sprintf("    failed to restore cached CSS: %v", err))
+			}
+
+			// Compile into a private directory first so it can be moved into the cache
+			outDir, err = makeTempDir(lp.magentoRoot, ".less-output-")
+			if err != nil {
+				return fmt.Errorf("failed to create output directory: %w", err)
+			}
+			defer tempArtifacts.Remove(outDir)
+		} else if lp.verbose {
+			lp.log.Warn(fmt.Sprintf("    failed to hash staged sources: %v", err))
+		}
+	}
 
-	// Compile the email LESS files using lessc
-	compiler, err := NewLessCompiler(lp.magentoRoot, lp.verbose)
+	// Compile the LESS entry points using lessc
+	compiler, err := NewLessCompiler(lp.ctx, lp.magentoRoot, lp.php, lp.verbose, lp.log)
 	if err != nil {
 		return fmt.Errorf("LESS compiler not available: %w", err)
 	}
 
-	if err := compiler.CompileEmailCSS(lp.stagingDir, destDir, area, theme, locale); err != nil {
-		return fmt.Errorf("failed to compile email CSS: %w", err)
+	_, compileSpan := startSpan(lp.ctx, "less compile", attribute.Int("less.entry_points", len(entryPoints)))
+	compileErr := compiler.CompileCSS(lp.stagingDir, outDir, area, theme, locale, entryPoints)
+	endSpan(compileSpan, compileErr)
+
+	if cacheDir != "" {
+		if _, err := restoreCompiledCSS(outDir, destDir); err != nil {
+			return fmt.Errorf("failed to copy compiled CSS: %w", err)
+		}
+		// Only complete, successful compilations are cached
+		if compileErr == nil {
+			if err := storeCompiledCSS(outDir, cacheDir); err != nil && lp.verbose {
+				lp.log.Warn(fmt.Sprintf("    failed to cache compiled CSS: %v", err))
+			}
+		}
+	}
+
+	if compileErr != nil {
+		return fmt.Errorf("failed to compile CSS: %w", compileErr)
 	}
 
 	return nil
@@ -101,7 +167,7 @@ func (lp *LessPreprocessor) stageSourceFiles(area, theme string) error {
 		destPrefix := filepath.Join(lp.stagingDir, source.prefix)
 		if err := lp.copyLessFiles(source.path, destPrefix); err != nil {
 			if lp.verbose {
-				fmt.Printf("    Warning: failed to copy from %s: %v\n", source.path, err)
+				lp.log.Warn(fmt.Sprintf("    failed to copy from %s: %v", source.path, err))
 			}
 		}
 	}
@@ -184,8 +250,8 @@ func (lp *LessPreprocessor) expandMagentoImports(content string, baseDir string)
 		pattern := submatches[1]
 		isReference := strings.Contains(match, "(reference)")
 
-		// Find all matching files from modules
-		imports := lp.findModuleImports(pattern)
+		// Find all matching files from modules (patterns may contain wildcards)
+		imports := lp.findModuleImports(pattern, baseDir)
 
 		if len(imports) == 0 {
 			return "// @magento_import: no matches for " + pattern
@@ -205,24 +271,65 @@ func (lp *LessPreprocessor) expandMagentoImports(content string, baseDir string)
 	})
 }
 
-// findModuleImports finds all module LESS files matching a pattern
-func (lp *LessPreprocessor) findModuleImports(pattern string) []string {
+// moduleDirPattern matches staged module directories like Magento_Email
+var moduleDirPattern = regexp.MustCompile(`^[A-Za-z0-9]+_[A-Za-z0-9]+$`)
+
+// findModuleImports finds all LESS files matching a (glob) pattern, like Magento's
+// MagentoImport preprocessor: matches from every module come first (sorted by module),
+// followed by matches from the theme/library itself
+// Import paths are returned relative to baseDir (the directory of the importing file)
+func (lp *LessPreprocessor) findModuleImports(pattern string, baseDir string) []string {
 	var imports []string
+	seen := make(map[string]bool)
 
 	// Pattern like 'source/_email.less' should find Vendor_Module/css/source/_email.less
-	// in the staging directory
+	// when imported from css/email.less; strip the module directory if the importing
+	// file itself lives inside a module
+	relDir, err := filepath.Rel(lp.stagingDir, baseDir)
+	if err != nil || strings.HasPrefix(relDir, "..") {
+		relDir = "css"
+	}
+	if parts := strings.SplitN(filepath.ToSlash(relDir), "/", 2); moduleDirPattern.MatchString(parts[0]) {
+		if len(parts) == 2 {
+			relDir = parts[1]
+		} else {
+			relDir = "."
+		}
+	}
+
+	addMatches := func(root string) {
+		matches, err := filepath.Glob(filepath.Join(root, relDir, pattern))
+		if err != nil {
+			return
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || info.IsDir() {
+				continue
+			}
+			relPath, err := filepath.Rel(baseDir, match)
+			if err != nil {
+				continue
+			}
+			relPath = filepath.ToSlash(relPath)
+			if !seen[relPath] {
+				seen[relPath] = true
+				imports = append(imports, relPath)
+			}
+		}
+	}
 
 	// Search in module directories within staging
 	moduleDirs, _ := filepath.Glob(filepath.Join(lp.stagingDir, "*_*"))
 	for _, moduleDir := range moduleDirs {
-		checkPath := filepath.Join(moduleDir, "css", pattern)
-		if _, err := os.Stat(checkPath); err == nil {
-			// Make path relative to staging dir's css folder
-			relPath, _ := filepath.Rel(filepath.Join(lp.stagingDir, "css"), checkPath)
-			imports = append(imports, relPath)
+		if !moduleDirPattern.MatchString(filepath.Base(moduleDir)) {
+			continue
 		}
+		addMatches(moduleDir)
 	}
 
+	// Then the theme/library level files
+	addMatches(lp.stagingDir)
+
 	return imports
 }
 
@@ -234,12 +341,13 @@ func copyFileLess(src, dst string) error {
 	}
 	defer source.Close()
 
+	// Replace rather than overwrite dst, files hard linked by --backup keep their content
+	os.Remove(dst)
 	destination, err := os.Create(dst)
 	if err != nil {
 		return err
 	}
 	defer destination.Close()
 
-	_, err = io.Copy(destination, source)
-	return err
+	return copyFileContents(destination, source)
 }
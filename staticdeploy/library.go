@@ -0,0 +1,109 @@
+package staticdeploy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	flag "github.com/spf13/pflag"
+)
+
+// ErrDeployFailed is the error of a deploy that ran but failed: jobs or steps after them, like
+// uploads or hooks, failed. The failed jobs have the Error of their DeployResult
+var ErrDeployFailed = errors.New("deploy failed")
+
+// deployMu runs one Deploy at a time
+var deployMu sync.Mutex
+
+// Options are the options of Deploy, those of the deploy command
+// The common ones are fields; Flags sets any other deploy option by its command line name,
+// e.g. {"compare": {"checksum"}, "target": {"s3://bucket/static"}}, each value once, like a
+// repeated flag. The options of the config file apply unless given here
+type Options struct {
+	Root      string   // Magento root directory, default the working directory
+	Config    string   // config file, default static-deploy.yaml, .yml or .json in Root
+	Areas     []string // default frontend
+	Themes    []string // supports 'Vendor/*' and 'all', default Vendor/Hyva
+	Languages []string // supports 'auto', 'all' and locale groups, default en_US
+	Jobs      int      // parallel jobs, 0 for the number of CPUs
+	Force     bool
+	Verbose   bool
+	Flags     map[string][]string
+
+	// Output of the run, default the process's stdout and stderr; --output=json and
+	// --events=- write all other output to Stderr
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// args returns the command line of the deploy command for the options
+func (o Options) args() []string {
+	var args []string
+	if o.Root != "" {
+		args = append(args, "--root="+o.Root)
+	}
+	if o.Config != "" {
+		args = append(args, "--config="+o.Config)
+	}
+	for _, area := range o.Areas {
+		args = append(args, "--area="+area)
+	}
+	for _, theme := range o.Themes {
+		args = append(args, "--theme="+theme)
+	}
+	if o.Jobs != 0 {
+		args = append(args, "--jobs="+strconv.Itoa(o.Jobs))
+	}
+	if o.Force {
+		args = append(args, "--force")
+	}
+	if o.Verbose {
+		args = append(args, "--verbose")
+	}
+	names := make([]string, 0, len(o.Flags))
+	for name := range o.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range o.Flags[name] {
+			args = append(args, "--"+name+"="+value)
+		}
+	}
+	return append(append(args, "--"), o.Languages...)
+}
+
+// Deploy deploys the static view files like the deploy command, for programs embedding the
+// deployer, and returns the results of its jobs. Jobs of Luma themes dispatched to bin/magento
+// share the outcome of that run. progress, if not nil, gets the events of the run as they
+// happen (see ProgressEvent); it must not block
+// The run stops gracefully when ctx ends: no new files are copied and the unfinished jobs fail.
+// --watch is up to the caller, Deploy returns after the deploy. Deploys share the state of the
+// package (the options, logging, copy filters), so only one runs at a time; the process's
+// streams and the global otel tracer provider are left alone, and the OTEL_EXPORTER_OTLP_*
+// variables of the process don't enable tracing, --otlp-endpoint does
+func Deploy(ctx context.Context, opts Options, progress func(ProgressEvent)) ([]DeployResult, error) {
+	deployMu.Lock()
+	defer deployMu.Unlock()
+
+	runStdout, runStderr = opts.Stdout, opts.Stderr
+	if runStdout == nil {
+		runStdout = os.Stdout
+	}
+	if runStderr == nil {
+		runStderr = os.Stderr
+	}
+	tracingFromEnv = false
+	defer func() {
+		runStdout, runStderr = os.Stdout, os.Stderr
+		tracingFromEnv = true
+		closeLogging()
+	}()
+
+	flag.CommandLine = newDeployFlags(flag.ContinueOnError)
+	return deploy(ctx, opts.args(), progress)
+}
@@ -0,0 +1,78 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"go.opentelemetry.io/otel"
+)
+
+func TestOptionsArgs(t *testing.T) {
+	opts := Options{
+		Root:      "/var/www/magento",
+		Themes:    []string{"Vendor/Hyva"},
+		Languages: []string{"nl_NL", "en_US"},
+		Jobs:      4,
+		Force:     true,
+		Flags:     map[string][]string{"target": {"s3://a", "s3://b"}, "compare": {"checksum"}},
+	}
+	want := []string{
+		"--root=/var/www/magento", "--theme=Vendor/Hyva", "--jobs=4", "--force",
+		"--compare=checksum", "--target=s3://a", "--target=s3://b",
+		"--", "nl_NL", "en_US",
+	}
+	if got := opts.args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("args() = %q, want %q", got, want)
+	}
+}
+
+func TestDeployInvalidOptions(t *testing.T) {
+	savedFlags, savedLogger := flag.CommandLine, logger
+	t.Cleanup(func() { flag.CommandLine, logger = savedFlags, savedLogger })
+
+	for _, flags := range []map[string][]string{
+		{"mode": {"rsync"}, "progress": {"off"}},
+		{"no-such-option": {"1"}},
+	} {
+		_, err := Deploy(context.Background(), Options{Root: t.TempDir(), Flags: flags}, nil)
+		if err == nil {
+			t.Errorf("Deploy(%v) succeeded, want an error", flags)
+		} else if strings.Contains(err.Error(), ErrDeployFailed.Error()) {
+			t.Errorf("Deploy(%v) error = %v, want an option error", flags, err)
+		}
+	}
+	// The options of a call don't stay for the next one
+	if deployMode != "copy" {
+		t.Errorf("--mode = %q after a Deploy with --mode=rsync, want it reset by the next Deploy", deployMode)
+	}
+}
+
+func TestDeployLeavesProcessAlone(t *testing.T) {
+	savedFlags, savedLogger := flag.CommandLine, logger
+	t.Cleanup(func() { flag.CommandLine, logger = savedFlags, savedLogger })
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:1")
+	stdout, provider := os.Stdout, otel.GetTracerProvider()
+
+	var out, errs bytes.Buffer
+	dir := t.TempDir()
+	flags := map[string][]string{"output": {"json"}, "log-file": {filepath.Join(dir, "deploy.log")}, "progress": {"off"}}
+	if _, err := Deploy(context.Background(), Options{Root: dir, Flags: flags, Stdout: &out, Stderr: &errs}, nil); err == nil {
+		t.Fatal("Deploy without a Magento installation succeeded, want an error")
+	}
+
+	if os.Stdout != stdout || otel.GetTracerProvider() != provider {
+		t.Error("Deploy replaced os.Stdout or the global tracer provider")
+	}
+	if tracerProvider != nil || logFileHandle != nil {
+		t.Error("Deploy left tracing enabled by the environment or the --log-file open")
+	}
+	if !strings.HasPrefix(out.String(), "{") || !strings.Contains(errs.String(), "Error: ") {
+		t.Errorf("Stdout = %q, Stderr = %q, want the report on Stdout and the errors on Stderr", out.String(), errs.String())
+	}
+}
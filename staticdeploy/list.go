@@ -0,0 +1,237 @@
+package staticdeploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	flag "github.com/spf13/pflag"
+)
+
+func init() {
+	registerCommand(Command{
+		Name:        "list",
+		Description: "List the themes, locales and modules with static content the deployer sees",
+		Run:         runList,
+	})
+}
+
+// listSections are what the list command can show
+var listSections = []string{"themes", "locales", "modules"}
+
+// Listing is what the list command found, also its JSON output
+type Listing struct {
+	Themes  []ListedTheme             `json:"themes,omitempty"`
+	Locales *ListedLocales            `json:"locales,omitempty"`
+	Modules map[string][]ListedModule `json:"modules,omitempty"` // per area
+}
+
+// ListedTheme is an installed theme with its resolved path and parents
+type ListedTheme struct {
+	Area    string   `json:"area"`
+	Name    string   `json:"name"`
+	Path    string   `json:"path"`
+	Parents []string `json:"parents,omitempty"` // nearest first
+	Hyva    bool     `json:"hyva"`
+}
+
+// ListedLocales are the locales configured for the store views and in the config file
+type ListedLocales struct {
+	Stores  []ListedStore       `json:"stores,omitempty"`
+	Groups  map[string][]string `json:"groups,omitempty"`
+	Aliases map[string]string   `json:"aliases,omitempty"`
+	Error   string              `json:"error,omitempty"` // the store configuration couldn't be read
+}
+
+// ListedStore is a store view and its locale
+type ListedStore struct {
+	Code   string `json:"code"`
+	Locale string `json:"locale"`
+	Active bool   `json:"active"`
+}
+
+// ListedModule is a module with view web directories for an area
+type ListedModule struct {
+	Module string   `json:"module"`
+	Paths  []string `json:"paths"` // in priority order: view/{area}/web before view/base/web
+}
+
+// runList implements the list subcommand
+func runList(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory")
+	configPath := flags.StringP("config", "c", "", "Path to config file (for locale groups and aliases)")
+	areas := flags.StringArrayP("area", "a", []string{"frontend", "adminhtml"}, "Areas of the themes and modules to list (can be repeated)")
+	jsonOutput := flags.Bool("json", false, "Print the listing as JSON")
+	flags.BoolVar(&storeDatabase, "database", false, "Read the store views and their locales from the Magento database as well")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s list [options] [themes|locales|modules...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Lists the installed themes with their paths and parents, the locales of the store views\n")
+		fmt.Fprintf(os.Stderr, "and the config file, and the modules with view/{area}/web content, so you can verify what\n")
+		fmt.Fprintf(os.Stderr, "the deployer sees before running it. Without arguments all of them are listed\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	sections := flags.Args()
+	if len(sections) == 0 {
+		sections = listSections
+	}
+	show := make(map[string]bool)
+	for _, section := range sections {
+		if !slices.Contains(listSections, section) {
+			return fmt.Errorf("unknown section '%s', expected %s", section, strings.Join(listSections, ", "))
+		}
+		show[section] = true
+	}
+
+	cfg, err := loadConfig(*root, *configPath)
+	if err != nil {
+		return err
+	}
+
+	var listing Listing
+	if show["themes"] {
+		listing.Themes = listThemes(*root, *areas)
+	}
+	if show["locales"] {
+		listing.Locales = listLocales(*root, cfg)
+	}
+	if show["modules"] {
+		index := loadVendorIndex(*root, runtime.NumCPU(), true)
+		listing.Modules = make(map[string][]ListedModule)
+		for _, area := range *areas {
+			listing.Modules[area] = listModules(*root, index, area)
+		}
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(listing)
+	}
+	printListing(os.Stdout, listing, *areas)
+	return nil
+}
+
+// listThemes returns the installed themes of areas
+func listThemes(magentoRoot string, areas []string) []ListedTheme {
+	var themes []ListedTheme
+	for _, theme := range discoverThemes(magentoRoot) {
+		if !slices.Contains(areas, theme.Area) {
+			continue
+		}
+		path, _ := filepath.Rel(magentoRoot, theme.Path)
+		themes = append(themes, ListedTheme{
+			Area:    theme.Area,
+			Name:    theme.Name,
+			Path:    path,
+			Parents: getThemeParentChain(magentoRoot, theme.Area, theme.Name)[1:],
+			Hyva:    isHyvaTheme(magentoRoot, theme.Area, theme.Name, make(map[string]bool)),
+		})
+	}
+	return themes
+}
+
+// listLocales returns the locales of the store views and the locale groups and aliases of the config
+func listLocales(magentoRoot string, cfg *Config) *ListedLocales {
+	locales := &ListedLocales{Groups: cfg.LocaleGroups, Aliases: cfg.LocaleAliases}
+	sc, err := loadStoreConfig(magentoRoot)
+	if err != nil {
+		locales.Error = err.Error()
+		return locales
+	}
+	for _, store := range sc.Stores {
+		if store.Code == "admin" {
+			continue
+		}
+		locales.Stores = append(locales.Stores, ListedStore{Code: store.Code, Locale: sc.StoreLocale(store), Active: store.Active})
+	}
+	return locales
+}
+
+// listModules returns the modules with web content of an area, by module name
+func listModules(magentoRoot string, index *VendorIndex, area string) []ListedModule {
+	var modules []ListedModule
+	byName := make(map[string]int)
+	for _, dir := range index.WebDirs(area) {
+		path, _ := filepath.Rel(magentoRoot, dir.Path)
+		name := dir.Module
+		if name == "" {
+			name = "(" + dir.Vendor + ", no module)"
+		}
+		i, ok := byName[name]
+		if !ok {
+			i = len(modules)
+			byName[name] = i
+			modules = append(modules, ListedModule{Module: name})
+		}
+		modules[i].Paths = append(modules[i].Paths, path)
+	}
+	sort.SliceStable(modules, func(i, j int) bool { return modules[i].Module < modules[j].Module })
+	return modules
+}
+
+// printListing prints the listing as text
+func printListing(w io.Writer, listing Listing, areas []string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	if listing.Themes != nil {
+		fmt.Fprintf(tw, "Themes (%d):\n", len(listing.Themes))
+		for _, theme := range listing.Themes {
+			kind := "Luma"
+			if theme.Hyva {
+				kind = "Hyvä"
+			}
+			parents := "-"
+			if len(theme.Parents) > 0 {
+				parents = strings.Join(theme.Parents, " "+symArrow+" ")
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", theme.Area, theme.Name, kind, theme.Path, parents)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	if locales := listing.Locales; locales != nil {
+		fmt.Fprintf(tw, "Locales:\n")
+		if locales.Error != "" {
+			fmt.Fprintf(tw, "  %s store views: %s\n", symSkip, locales.Error)
+		}
+		for _, store := range locales.Stores {
+			status := ""
+			if !store.Active {
+				status = "inactive"
+			}
+			fmt.Fprintf(tw, "  %s\tstore %s\t%s\n", store.Locale, store.Code, status)
+		}
+		for _, name := range sortedKeys(locales.Groups) {
+			fmt.Fprintf(tw, "  %s\tgroup\t%s\n", name, strings.Join(locales.Groups[name], ", "))
+		}
+		for _, alias := range sortedKeys(locales.Aliases) {
+			fmt.Fprintf(tw, "  %s\talias of %s\t\n", alias, locales.Aliases[alias])
+		}
+		fmt.Fprintln(tw)
+	}
+
+	if listing.Modules != nil {
+		for _, area := range areas {
+			modules := listing.Modules[area]
+			fmt.Fprintf(tw, "Modules with %s web content (%d):\n", area, len(modules))
+			for _, module := range modules {
+				fmt.Fprintf(tw, "  %s\t%s\n", module.Module, strings.Join(module.Paths, ", "))
+			}
+			fmt.Fprintln(tw)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package staticdeploy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLiveReloadAddr is the address of LiveReload servers, which the browser extensions
+// connect to by default
+const defaultLiveReloadAddr = "127.0.0.1:35729"
+
+// liveReloadProtocol is the version of the LiveReload protocol spoken to browsers
+const liveReloadProtocol = "http://livereload.com/protocols/official-7"
+
+// webSocketGUID is appended to the key of a WebSocket handshake (RFC 6455)
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWebSocketMessage is the largest message accepted from a browser; they only say hello
+const maxWebSocketMessage = 64 * 1024
+
+// WebSocket opcodes
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xA
+)
+
+// LiveReloadServer tells the browsers connected over the LiveReload protocol to reload, on
+// /livereload like the LiveReload extensions expect. /livereload.js is a client for pages
+// without the extension, which reloads stylesheets in place and the page for anything else
+// All methods are no-ops on a nil server
+type LiveReloadServer struct {
+	addr    string
+	server  *http.Server
+	mu      sync.Mutex
+	clients map[*liveReloadClient]bool
+}
+
+// liveReloadClient is a browser connected over WebSocket
+type liveReloadClient struct {
+	conn  net.Conn
+	mu    sync.Mutex // serializes frames
+	hello bool       // the browser said hello, it only gets reloads after that
+}
+
+// liveReloadMessage is a command of the LiveReload protocol
+type liveReloadMessage struct {
+	Command    string   `json:"command"`
+	Protocols  []string `json:"protocols,omitempty"`
+	ServerName string   `json:"serverName,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	LiveCSS    bool     `json:"liveCSS"`
+}
+
+// NewLiveReloadServer starts a LiveReload server listening on addr
+func NewLiveReloadServer(addr string) (*LiveReloadServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("--livereload: %w", err)
+	}
+	s := &LiveReloadServer{addr: listener.Addr().String(), clients: make(map[*liveReloadClient]bool)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livereload", s.handleWebSocket)
+	mux.HandleFunc("/livereload.js", s.handleScript)
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// Addr returns the address the server listens on
+func (s *LiveReloadServer) Addr() string {
+	if s == nil {
+		return ""
+	}
+	return s.addr
+}
+
+// Refresh reloads the browsers: the stylesheets of cssPaths in place (paths below pub/static,
+// matched by file name), or the whole page when full
+func (s *LiveReloadServer) Refresh(cssPaths []string, full bool) {
+	if s == nil || (len(cssPaths) == 0 && !full) {
+		return
+	}
+	if full {
+		s.broadcast(liveReloadMessage{Command: "reload", Path: "/", LiveCSS: false})
+		return
+	}
+	for _, cssPath := range cssPaths {
+		s.broadcast(liveReloadMessage{Command: "reload", Path: "/static/" + cssPath, LiveCSS: true})
+	}
+}
+
+// Close stops the server and disconnects the browsers
+func (s *LiveReloadServer) Close() {
+	if s == nil {
+		return
+	}
+	s.server.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client := range s.clients {
+		client.conn.Close()
+	}
+}
+
+// broadcast sends a message to the browsers that said hello, dropping those that are gone
+func (s *LiveReloadServer) broadcast(message liveReloadMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sent := 0
+	for client := range s.clients {
+		if !client.hello {
+			continue
+		}
+		if err := client.write(wsText, data); err != nil {
+			client.conn.Close()
+			delete(s.clients, client)
+			continue
+		}
+		sent++
+	}
+	if sent > 0 {
+		logDebugf("LiveReload: reloading %s in %d browser(s)", message.Path, sent)
+	}
+}
+
+// handleWebSocket accepts a browser connection and answers its messages until it's closed
+func (s *LiveReloadServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "expected a WebSocket handshake", http.StatusBadRequest)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	accept := sha1.Sum([]byte(key + webSocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(accept[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	client := &liveReloadClient{conn: conn}
+	s.mu.Lock()
+	s.clients[client] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	s.serveClient(client, rw.Reader)
+}
+
+// serveClient answers the hello, pings and close of a browser
+func (s *LiveReloadServer) serveClient(client *liveReloadClient, reader *bufio.Reader) {
+	for {
+		opcode, payload, err := readWebSocketFrame(reader)
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case wsText:
+			var message liveReloadMessage
+			if json.Unmarshal(payload, &message) != nil || message.Command != "hello" {
+				continue
+			}
+			reply, _ := json.Marshal(liveReloadMessage{Command: "hello", Protocols: []string{liveReloadProtocol}, ServerName: "magento2-static-deploy"})
+			s.mu.Lock()
+			client.hello = true
+			s.mu.Unlock()
+			if client.write(wsText, reply) != nil {
+				return
+			}
+		case wsPing:
+			if client.write(wsPong, payload) != nil {
+				return
+			}
+		case wsClose:
+			client.write(wsClose, nil)
+			return
+		}
+	}
+}
+
+// write sends an unmasked frame, as servers do
+func (c *liveReloadClient) write(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readWebSocketFrame reads a frame sent by a browser, which masks its frames, and returns its
+// opcode and unmasked payload
+func readWebSocketFrame(reader *bufio.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if !masked {
+		return 0, nil, errors.New("unmasked frame from a client")
+	}
+	if length > maxWebSocketMessage {
+		return 0, nil, fmt.Errorf("frame of %d bytes is too large", length)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(reader, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// handleScript serves the LiveReload client for pages, included with
+// <script src="http://127.0.0.1:35729/livereload.js"></script>
+func (s *LiveReloadServer) handleScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "no-store")
+	io.WriteString(w, liveReloadScript)
+}
+
+// liveReloadScript connects to the server the script was loaded from; a reload of a
+// stylesheet replaces the stylesheets with its file name, anything else reloads the page
+const liveReloadScript = `(function () {
+  var origin = new URL(document.currentScript.src);
+  var url = (origin.protocol === 'https:' ? 'wss://' : 'ws://') + origin.host + '/livereload';
+
+  function reloadStylesheets(path) {
+    var name = path.split('/').pop();
+    var found = false;
+    document.querySelectorAll('link[rel="stylesheet"]').forEach(function (link) {
+      var href = link.href.split('?')[0];
+      if (href.split('/').pop() === name) {
+        link.href = href + '?livereload=' + Date.now();
+        found = true;
+      }
+    });
+    return found;
+  }
+
+  function connect() {
+    var socket = new WebSocket(url);
+    socket.onopen = function () {
+      socket.send(JSON.stringify({command: 'hello', protocols: ['` + liveReloadProtocol + `']}));
+    };
+    socket.onmessage = function (event) {
+      var message = JSON.parse(event.data);
+      if (message.command !== 'reload') {
+        return;
+      }
+      if (message.liveCSS && /\.css$/.test(message.path) && reloadStylesheets(message.path)) {
+        return;
+      }
+      location.reload();
+    };
+    socket.onclose = function () {
+      setTimeout(connect, 1000);
+    };
+  }
+
+  connect();
+})();
+`
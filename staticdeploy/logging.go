@@ -0,0 +1,385 @@
+package staticdeploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Logging options
+var (
+	logLevel  string // --log-level: debug, info, warn or error
+	logFormat string // --log-format: text or json
+	logFile   string // --log-file: also write all records, including debug, to this file
+)
+
+// runStdout and runStderr are the output of a run: those of the process for the commands,
+// those of the Options for Deploy. --output=json and --events=- point runStdout at runStderr
+var (
+	runStdout io.Writer = os.Stdout
+	runStderr io.Writer = os.Stderr
+)
+
+// logFileHandle is the file of --log-file, closed by closeLogging
+var logFileHandle *os.File
+
+// logger is where deploys, LESS compilation and the watcher log to; informational records go to
+// stdout, warnings and errors to stderr. It logs text at info level until setupLogging
+var logger = slog.New(&textLogHandler{level: slog.LevelInfo})
+
+// levelSummary is the level of the final summary of a run, which --quiet keeps
+const levelSummary = slog.LevelInfo + 2
+
+// setupLogging replaces logger according to --log-level, --log-format and --log-file; --verbose
+// implies debug, --quiet leaves only the summary and errors on the console
+func setupLogging(level string, format string, verbose bool, quiet bool, file string) error {
+	var minLevel slog.Level
+	switch level {
+	case "debug":
+		minLevel = slog.LevelDebug
+	case "info":
+		minLevel = slog.LevelInfo
+	case "warn":
+		minLevel = slog.LevelWarn
+	case "error":
+		minLevel = slog.LevelError
+	default:
+		return fmt.Errorf("--log-level must be 'debug', 'info', 'warn' or 'error', got '%s'", level)
+	}
+	if verbose {
+		minLevel = slog.LevelDebug
+	}
+
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = &textLogHandler{level: minLevel}
+	case "json":
+		console := newJSONLogHandler(minLevel, stdoutWriter{}, stderrWriter{})
+		console.console = true
+		handler = console
+	default:
+		return fmt.Errorf("--log-format must be 'text' or 'json', got '%s'", format)
+	}
+	if quiet {
+		handler = quietLogHandler{handler}
+	}
+
+	closeLogging()
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return fmt.Errorf("--log-file: %w", err)
+		}
+		logFileHandle = f
+		// Records are written unbuffered, so the file is complete also when exiting early
+		fileHandler := slog.Handler(&textLogHandler{level: slog.LevelDebug, out: f})
+		if format == "json" {
+			fileHandler = newJSONLogHandler(slog.LevelDebug, f, f)
+		}
+		handler = teeLogHandler{handler, fileHandler}
+	}
+	logger = slog.New(handler)
+	return nil
+}
+
+// closeLogging closes the --log-file of setupLogging, logging to the console at info level again
+func closeLogging() {
+	if logFileHandle == nil {
+		return
+	}
+	logger = slog.New(&textLogHandler{level: slog.LevelInfo})
+	logFileHandle.Close()
+	logFileHandle = nil
+}
+
+// logDebugf logs a formatted message at debug level (shown with --verbose)
+func logDebugf(format string, args ...any) {
+	logf(slog.LevelDebug, format, args...)
+}
+
+// logInfof logs a formatted message at info level
+func logInfof(format string, args ...any) {
+	logf(slog.LevelInfo, format, args...)
+}
+
+// logWarnf logs a formatted message at warn level
+func logWarnf(format string, args ...any) {
+	logf(slog.LevelWarn, format, args...)
+}
+
+// logErrorf logs a formatted message at error level
+func logErrorf(format string, args ...any) {
+	logf(slog.LevelError, format, args...)
+}
+
+func logf(level slog.Level, format string, args ...any) {
+	if logger.Enabled(context.Background(), level) {
+		logger.Log(context.Background(), level, fmt.Sprintf(format, args...))
+	}
+}
+
+// jobAttrs returns the attributes identifying a job in log records
+func jobAttrs(job DeployJob) []any {
+	return []any{"area", job.Area, "theme", job.Theme, "locale", job.Locale}
+}
+
+// textLogs reports whether logs are human-readable text, for output that only makes sense there
+// (separators, blank lines)
+func textLogs() bool {
+	return logFormat != "json"
+}
+
+// logOutput serializes writes of log records to stdout and stderr
+var logOutput sync.Mutex
+
+// levelWriter returns where records of a level are written; runStdout is looked up on every
+// record because --output=json redirects it to stderr
+func levelWriter(level slog.Level) io.Writer {
+	if level >= slog.LevelWarn {
+		return runStderr
+	}
+	return runStdout
+}
+
+// textLogHandler writes the messages of records as they are, warnings and errors prefixed like
+// they always were; attributes are only part of the JSON format. Written to a file (out), lines
+// are prefixed with the time of the record
+type textLogHandler struct {
+	level slog.Level
+	out   io.Writer // nil for stdout and stderr
+}
+
+func (h *textLogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *textLogHandler) Handle(_ context.Context, r slog.Record) error {
+	message := r.Message
+	prefix := ""
+	switch {
+	case r.Level >= slog.LevelError:
+		prefix = "Error: "
+	case r.Level >= slog.LevelWarn:
+		prefix = "Warning: "
+	}
+	if prefix != "" {
+		// Keep leading blank lines and indentation before the prefix
+		trimmed := strings.TrimLeft(message, "\n ")
+		message = message[:len(message)-len(trimmed)] + prefix + trimmed
+	}
+
+	w := h.out
+	if w == nil {
+		w = levelWriter(r.Level)
+		if useColor(w) {
+			message = colorize(message)
+		}
+	} else {
+		stamp := r.Time.Format("2006-01-02 15:04:05.000 ")
+		lines := strings.Split(message, "\n")
+		for i, line := range lines {
+			if line != "" {
+				lines[i] = stamp + line
+			}
+		}
+		message = strings.Join(lines, "\n")
+	}
+
+	logOutput.Lock()
+	defer logOutput.Unlock()
+	if h.out == nil {
+		consoleProgress.clear()
+		defer consoleProgress.redraw()
+	}
+	_, err := io.WriteString(w, message+"\n")
+	return err
+}
+
+func (h *textLogHandler) WithAttrs(_ []slog.Attr) slog.Handler { return h }
+func (h *textLogHandler) WithGroup(_ string) slog.Handler      { return h }
+
+// jsonLogHandler writes records as JSON lines for log shippers (Loki, ELK); messages are trimmed
+// and records with blank messages, which only space out the text format, are dropped
+type jsonLogHandler struct {
+	stdout  slog.Handler
+	stderr  slog.Handler
+	console bool // writes to the console, where the progress display is
+}
+
+// newJSONLogHandler creates a JSON handler logging records of at least level, below warn level
+// to stdout and others to stderr
+func newJSONLogHandler(level slog.Level, stdout io.Writer, stderr io.Writer) *jsonLogHandler {
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.MessageKey {
+				return slog.String(slog.MessageKey, strings.TrimSpace(a.Value.String()))
+			}
+			if len(groups) == 0 && a.Key == slog.LevelKey && a.Value.Any() == levelSummary {
+				return slog.String(slog.LevelKey, slog.LevelInfo.String())
+			}
+			return a
+		},
+	}
+	return &jsonLogHandler{
+		stdout: slog.NewJSONHandler(stdout, opts),
+		stderr: slog.NewJSONHandler(stderr, opts),
+	}
+}
+
+func (h *jsonLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.stdout.Enabled(ctx, level)
+}
+
+func (h *jsonLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if strings.TrimSpace(r.Message) == "" {
+		return nil
+	}
+	logOutput.Lock()
+	defer logOutput.Unlock()
+	if h.console {
+		consoleProgress.clear()
+		defer consoleProgress.redraw()
+	}
+	if r.Level >= slog.LevelWarn {
+		return h.stderr.Handle(ctx, r)
+	}
+	return h.stdout.Handle(ctx, r)
+}
+
+func (h *jsonLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &jsonLogHandler{stdout: h.stdout.WithAttrs(attrs), stderr: h.stderr.WithAttrs(attrs), console: h.console}
+}
+
+func (h *jsonLogHandler) WithGroup(name string) slog.Handler {
+	return &jsonLogHandler{stdout: h.stdout.WithGroup(name), stderr: h.stderr.WithGroup(name), console: h.console}
+}
+
+// quietLogHandler passes only the summary and errors to its handler (--quiet)
+type quietLogHandler struct {
+	slog.Handler
+}
+
+func (h quietLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return (level == levelSummary || level >= slog.LevelError) && h.Handler.Enabled(ctx, level)
+}
+
+func (h quietLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h quietLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return quietLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h quietLogHandler) WithGroup(name string) slog.Handler {
+	return quietLogHandler{h.Handler.WithGroup(name)}
+}
+
+// teeLogHandler passes records to several handlers, e.g. the console and --log-file
+type teeLogHandler []slog.Handler
+
+func (h teeLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h teeLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, r.Level) {
+			errs = append(errs, handler.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h teeLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeLogHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h teeLogHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeLogHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
+
+// stdoutWriter and stderrWriter write to the current runStdout and runStderr
+type stdoutWriter struct{}
+type stderrWriter struct{}
+
+func (stdoutWriter) Write(p []byte) (int, error) { return levelWriter(slog.LevelInfo).Write(p) }
+func (stderrWriter) Write(p []byte) (int, error) { return levelWriter(slog.LevelError).Write(p) }
+
+// logBuffer collects the records of a parallel task, e.g. the LESS compilation of a job, so they
+// are logged together instead of interleaved with those of other tasks
+type logBuffer struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+// Logger returns a logger recording into the buffer
+func (b *logBuffer) Logger() *slog.Logger {
+	return slog.New(&bufferLogHandler{buffer: b, next: logger.Handler()})
+}
+
+// Flush logs the buffered records, in order and without records of other buffers in between
+func (b *logBuffer) Flush() {
+	b.mu.Lock()
+	records := b.records
+	b.records = nil
+	b.mu.Unlock()
+
+	logFlush.Lock()
+	defer logFlush.Unlock()
+	for _, r := range records {
+		logger.Handler().Handle(context.Background(), r)
+	}
+}
+
+// logFlush keeps flushed buffers together
+var logFlush sync.Mutex
+
+type bufferLogHandler struct {
+	buffer *logBuffer
+	next   slog.Handler
+	attrs  []slog.Attr
+}
+
+func (h *bufferLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *bufferLogHandler) Handle(_ context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(h.attrs...)
+	h.buffer.mu.Lock()
+	h.buffer.records = append(h.buffer.records, r)
+	h.buffer.mu.Unlock()
+	return nil
+}
+
+func (h *bufferLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &bufferLogHandler{buffer: h.buffer, next: h.next, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *bufferLogHandler) WithGroup(_ string) slog.Handler { return h }
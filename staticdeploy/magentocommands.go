@@ -0,0 +1,96 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MagentoCommand is a bin/magento call run around the deployment (the magento_commands
+// section of the config file)
+type MagentoCommand struct {
+	Command string `yaml:"command" json:"command"` // arguments of bin/magento, e.g. cache:flush full_page
+	When    string `yaml:"when" json:"when"`       // before, after (default, after a successful deploy) or always (also after a failed one)
+}
+
+// ReportCommand is the outcome of a bin/magento command in the report
+type ReportCommand struct {
+	Command  string  `json:"command"`
+	When     string  `json:"when"`
+	Success  bool    `json:"success"`
+	Duration float64 `json:"duration_seconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// validateMagentoCommands checks the magento_commands section before anything is deployed
+func validateMagentoCommands(commands []MagentoCommand) error {
+	for _, command := range commands {
+		if strings.TrimSpace(command.Command) == "" {
+			return fmt.Errorf("magento_commands: empty command")
+		}
+		if _, err := splitCommandLine(command.Command); err != nil {
+			return fmt.Errorf("magento_commands: %s: %w", command.Command, err)
+		}
+		switch command.When {
+		case "", "before", "after", "always":
+		default:
+			return fmt.Errorf("magento_commands: %s: when must be 'before', 'after' or 'always', got '%s'", command.Command, command.When)
+		}
+	}
+	return nil
+}
+
+// runMagentoCommands runs the commands of the given moments in order, stopping at the first
+// failure except for 'always' commands, which all run. Output is shown when verbose or when
+// a command fails
+func runMagentoCommands(ctx context.Context, magentoRoot string, php *PHPRunner, commands []MagentoCommand, moments []string, verbose bool) ([]ReportCommand, error) {
+	var results []ReportCommand
+	var firstErr error
+	for _, command := range commands {
+		when := command.When
+		if when == "" {
+			when = "after"
+		}
+		if !slices.Contains(moments, when) || (firstErr != nil && when != "always") {
+			continue
+		}
+
+		args, _ := splitCommandLine(command.Command)
+		args = append([]string{php.Path(filepath.Join(magentoRoot, "bin/magento"))}, args...)
+		if verbose {
+			logDebugf("Executing: %s %s", php, strings.Join(args, " "))
+		}
+
+		start := time.Now()
+		cmd := php.CommandContext(ctx, args...)
+		var out bytes.Buffer
+		if verbose {
+			cmd.Stdout = runStdout
+			cmd.Stderr = runStderr
+		} else {
+			cmd.Stdout = &out
+			cmd.Stderr = &out
+		}
+		err := cmd.Run()
+
+		result := ReportCommand{Command: command.Command, When: when, Success: err == nil, Duration: time.Since(start).Seconds()}
+		if err != nil {
+			runStderr.Write(out.Bytes())
+			result.Error = err.Error()
+			logger.Log(context.Background(), levelSummary, fmt.Sprintf("%s bin/magento %s: %v", symFail, command.Command, err),
+				"command", command.Command, "when", when, "status", "failed", "error", err.Error())
+			if firstErr == nil {
+				firstErr = fmt.Errorf("bin/magento %s failed: %w", command.Command, err)
+			}
+		} else {
+			logger.Info(fmt.Sprintf("%s bin/magento %s - %.1fs", symOK, command.Command, result.Duration),
+				"command", command.Command, "when", when, "status", "succeeded", "duration", result.Duration)
+		}
+		results = append(results, result)
+	}
+	return results, firstErr
+}
@@ -0,0 +1,366 @@
+package staticdeploy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Manifest files are kept in pub/static so they travel with the deployed tree
+const (
+	manifestFileName         = ".static-deploy-manifest.json"
+	previousManifestFileName = ".static-deploy-manifest.previous.json"
+)
+
+// manifestFormat is the version of the manifest format written by this build
+//
+// Compatibility rules:
+//   - the format number only changes for incompatible changes (renamed fields, a different
+//     hash input); adding optional fields keeps the number and older readers ignore them
+//   - manifests without a format number are format 1 (written before it was recorded)
+//   - manifests of a newer format are refused instead of misread
+//
+// The format is platform independent: paths use forward slashes, sizes are JSON numbers and
+// hashes are computed over the raw file bytes, so no byte order or line endings are involved
+// and a manifest written on amd64 validates on arm64 (see manifest.schema.json)
+const manifestFormat = 1
+
+// legacyManifestHashAlgorithm is the hash of manifests without hash_algorithm
+const legacyManifestHashAlgorithm = "sha256"
+
+// Manifest lists every file of a deployed pub/static tree
+type Manifest struct {
+	Format    int                     `json:"format"`
+	Algorithm string                  `json:"hash_algorithm"` // see hashAlgorithms, hashes are lowercase hex
+	Version   string                  `json:"version"`        // deployed_version.txt content
+	Generated time.Time               `json:"generated"`
+	Files     map[string]ManifestFile `json:"files"`          // keyed by path relative to pub/static
+	Jobs      []ManifestJob           `json:"jobs,omitempty"` // jobs that deployed this version
+}
+
+// ManifestJob is a theme/locale job that contributed to the version of a manifest
+type ManifestJob struct {
+	Area   string `json:"area"`
+	Theme  string `json:"theme"`
+	Locale string `json:"locale"`
+	Files  int64  `json:"files,omitempty"` // unknown for Luma themes deployed by bin/magento
+}
+
+// manifestJobs returns the jobs of the results that deployed files
+func manifestJobs(results []DeployResult) []ManifestJob {
+	var jobs []ManifestJob
+	for _, result := range results {
+		if result.Error != "" || (result.FilesCount == 0 && !result.Symlinked) {
+			continue
+		}
+		jobs = append(jobs, ManifestJob{Area: result.Job.Area, Theme: result.Job.Theme, Locale: result.Job.Locale, Files: result.FilesCount})
+	}
+	return jobs
+}
+
+// addJobs records the jobs of this run in the manifest, with those of earlier runs that
+// deployed the same version (split deployments)
+func (m *Manifest) addJobs(jobs []ManifestJob, previous *Manifest) {
+	key := func(job ManifestJob) string { return job.Area + "/" + job.Theme + "/" + job.Locale }
+	seen := make(map[string]bool)
+	for _, job := range jobs {
+		seen[key(job)] = true
+	}
+	m.Jobs = append([]ManifestJob{}, jobs...)
+	if previous != nil && previous.Version == m.Version {
+		for _, job := range previous.Jobs {
+			if !seen[key(job)] {
+				m.Jobs = append(m.Jobs, job)
+			}
+		}
+	}
+	sort.Slice(m.Jobs, func(i, j int) bool { return key(m.Jobs[i]) < key(m.Jobs[j]) })
+}
+
+// ManifestFile describes a single deployed file
+type ManifestFile struct {
+	Size   int64  `json:"size"`
+	Hash   string `json:"hash,omitempty"`
+	Link   string `json:"link,omitempty"`   // symlink target (with forward slashes) instead of content
+	Source string `json:"source,omitempty"` // file it was deployed from, relative to the Magento root
+}
+
+// SameContent reports whether two manifest entries have the same content, whatever their source
+func (f ManifestFile) SameContent(other ManifestFile) bool {
+	return f.Size == other.Size && f.Hash == other.Hash && f.Link == other.Link
+}
+
+// deploySources records the source of every file placed by this run, for the manifest
+// nil (recording nothing) unless a manifest is written
+var deploySources *sourceRecorder
+
+// sourceRecorder maps deployed paths to the files they were deployed from
+type sourceRecorder struct {
+	mu      sync.Mutex
+	sources map[string]string
+}
+
+// newSourceRecorder creates an empty recorder
+func newSourceRecorder() *sourceRecorder {
+	return &sourceRecorder{sources: make(map[string]string)}
+}
+
+// Record stores src as the source of the deployed file dst
+func (r *sourceRecorder) Record(dst string, src string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sources[dst] = src
+}
+
+// Source returns the source of the deployed file dst, or "" if it wasn't placed by this run
+func (r *sourceRecorder) Source(dst string) string {
+	if r == nil {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sources[dst]
+}
+
+// addSources fills in the source of the manifest entries: recorded by this run, or else taken
+// from the previous manifest when the file didn't change. Compiled CSS and files generated by
+// Magento have no source
+func (m *Manifest) addSources(magentoRoot string, staticRoot string, previous *Manifest) {
+	for relPath, file := range m.Files {
+		if src := deploySources.Source(filepath.Join(staticRoot, filepath.FromSlash(relPath))); src != "" {
+			if rel, err := filepath.Rel(magentoRoot, src); err == nil {
+				src = rel
+			}
+			file.Source = filepath.ToSlash(src)
+		} else if previous != nil && previous.Algorithm == m.Algorithm {
+			if old, ok := previous.Files[relPath]; ok && old.SameContent(file) {
+				file.Source = old.Source
+			}
+		}
+		m.Files[relPath] = file
+	}
+}
+
+// ManifestDiff lists the paths that differ between two manifests
+type ManifestDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// buildManifest hashes all files below staticRoot with algorithm
+func buildManifest(staticRoot string, algorithm string) (*Manifest, error) {
+	if _, err := newHasher(algorithm); err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Format:    manifestFormat,
+		Algorithm: algorithm,
+		Generated: time.Now().UTC(),
+		Files:     make(map[string]ManifestFile),
+	}
+
+	if data, err := os.ReadFile(filepath.Join(staticRoot, "deployed_version.txt")); err == nil {
+		manifest.Version = strings.TrimSpace(string(data))
+	}
+
+	err := filepath.Walk(staticRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(staticRoot, path)
+		relPath = filepath.ToSlash(relPath)
+		if isManifestMetaFile(relPath) {
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			manifest.Files[relPath] = ManifestFile{Link: filepath.ToSlash(target)}
+			return nil
+		}
+
+		hash, err := hashFile(path, algorithm)
+		if err != nil {
+			return err
+		}
+		manifest.Files[relPath] = ManifestFile{Size: info.Size(), Hash: hash}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build manifest of %s: %w", staticRoot, err)
+	}
+
+	return manifest, nil
+}
+
+// isManifestMetaFile reports whether a path relative to pub/static is bookkeeping of this tool
+// rather than deployed content, and therefore not in manifests
+func isManifestMetaFile(relPath string) bool {
+	return relPath == manifestFileName || relPath == manifestSignatureFileName || relPath == previousManifestFileName || relPath == checksumsFileName
+}
+
+// hashFile returns the hex encoded hash of a file's content
+func hashFile(path string, algorithm string) (string, error) {
+	h, err := newHasher(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := copyBuffered(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadManifest reads a manifest file
+func loadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := parseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// parseManifest decodes and validates a manifest, e.g. one read over SSH or HTTP
+func parseManifest(data []byte) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if err := validateManifest(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]ManifestFile)
+	}
+	return &manifest, nil
+}
+
+// validateManifest checks a manifest against the format rules, upgrading unversioned manifests
+func validateManifest(manifest *Manifest) error {
+	if manifest.Format == 0 {
+		manifest.Format = 1
+	}
+	if manifest.Format > manifestFormat {
+		return fmt.Errorf("format %d is newer than the supported format %d, upgrade static-deploy", manifest.Format, manifestFormat)
+	}
+	if manifest.Algorithm == "" {
+		manifest.Algorithm = legacyManifestHashAlgorithm
+	}
+	h, err := newHasher(manifest.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	for path, file := range manifest.Files {
+		if path == "" || strings.HasPrefix(path, "/") || strings.Contains(path, "\\") || pathHasDotDot(path) {
+			return fmt.Errorf("invalid path %q", path)
+		}
+		if file.Link == "" && !validHexHash(file.Hash, h.Size()) {
+			return fmt.Errorf("invalid hash for %s", path)
+		}
+	}
+	return nil
+}
+
+// pathHasDotDot reports whether a slash separated path contains a .. component
+func pathHasDotDot(path string) bool {
+	for _, part := range strings.Split(path, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// validHexHash reports whether hash is a lowercase hex digest of size bytes
+func validHexHash(hash string, size int) bool {
+	if len(hash) != size*2 {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// saveManifest writes the manifest to pub/static, keeping the current one as the previous manifest
+func saveManifest(staticRoot string, manifest *Manifest) error {
+	current := filepath.Join(staticRoot, manifestFileName)
+	if _, err := os.Stat(current); err == nil {
+		if err := os.Rename(current, filepath.Join(staticRoot, previousManifestFileName)); err != nil {
+			return fmt.Errorf("failed to keep previous manifest: %w", err)
+		}
+	}
+	// The signature of the previous manifest doesn't match the new one
+	if err := os.Remove(filepath.Join(staticRoot, manifestSignatureFileName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(current, data, 0644)
+}
+
+// diffManifests compares two manifests; a nil old manifest means everything was added
+func diffManifests(old, new *Manifest) ManifestDiff {
+	var diff ManifestDiff
+
+	for path, file := range new.Files {
+		if old == nil {
+			diff.Added = append(diff.Added, path)
+			continue
+		}
+		oldFile, ok := old.Files[path]
+		if !ok {
+			diff.Added = append(diff.Added, path)
+		} else if !oldFile.SameContent(file) {
+			diff.Changed = append(diff.Changed, path)
+		}
+	}
+	if old != nil {
+		for path := range old.Files {
+			if _, ok := new.Files[path]; !ok {
+				diff.Removed = append(diff.Removed, path)
+			}
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
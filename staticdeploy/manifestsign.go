@@ -0,0 +1,108 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// manifestSignatureFileName holds the base64 Ed25519 signature of the manifest, next to it
+const manifestSignatureFileName = manifestFileName + ".sig"
+
+// signManifest signs the manifest with the manifest.signing-key credential (--sign-manifest)
+var signManifest bool
+
+// ManifestSigner signs the manifest after a deploy with the Ed25519 private key of the
+// manifest.signing-key credential, PEM encoded PKCS #8 as written by
+// 'openssl genpkey -algorithm ed25519'
+type ManifestSigner struct {
+	key ed25519.PrivateKey
+}
+
+// NewManifestSigner loads the signing key for --sign-manifest; nil without the flag
+func NewManifestSigner(magentoRoot string, cfg *Config) (*ManifestSigner, error) {
+	if !signManifest {
+		return nil, nil
+	}
+	if !writeManifest {
+		return nil, fmt.Errorf("--sign-manifest requires --manifest")
+	}
+	credentials := NewCredentials(magentoRoot, cfg)
+	if !credentials.Has("manifest.signing-key") {
+		return nil, fmt.Errorf("--sign-manifest: no manifest.signing-key credential configured")
+	}
+	data, err := credentials.Get("manifest.signing-key")
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("--sign-manifest: manifest.signing-key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("--sign-manifest: invalid manifest.signing-key: %w", err)
+	}
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("--sign-manifest: manifest.signing-key is a %T, expected an Ed25519 key", key)
+	}
+	return &ManifestSigner{key: signingKey}, nil
+}
+
+// Sign writes the signature of the manifest in staticRoot
+func (s *ManifestSigner) Sign(staticRoot string) error {
+	if s == nil {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(staticRoot, manifestFileName))
+	if err != nil {
+		return err
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, data))
+	return writeFileAtomic(filepath.Join(staticRoot, manifestSignatureFileName), []byte(signature+"\n"), 0644)
+}
+
+// verifyManifestSignature checks the signature of the manifest at manifestPath, in the file of
+// the same name ending in .sig, with the PEM encoded (PKIX) Ed25519 public key at publicKeyPath
+func verifyManifestSignature(manifestPath, publicKeyPath string) error {
+	pemData, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return fmt.Errorf("%s is not PEM encoded", publicKeyPath)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid public key %s: %w", publicKeyPath, err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("%s is a %T, expected an Ed25519 key", publicKeyPath, key)
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return err
+	}
+	signaturePath := manifestPath + ".sig"
+	encoded, err := os.ReadFile(signaturePath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no signature at %s, deploy with --sign-manifest", signaturePath)
+	}
+	if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(encoded)))
+	if err != nil || !ed25519.Verify(publicKey, data, signature) {
+		return fmt.Errorf("the signature of %s doesn't match the manifest", signaturePath)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// localeCodePattern matches Magento locale codes like en_US, sr_Latn_RS or zh_Hans_CN
+var localeCodePattern = regexp.MustCompile(`^[a-z]{2,3}(_[A-Z][a-z]{3})?_[A-Z]{2}$`)
+
+// knownAreas are the areas Magento deploys static content for
+var knownAreas = map[string]bool{"frontend": true, "adminhtml": true, "base": true}
+
+// checkJobMatrix removes duplicate jobs and returns warnings about suspicious jobs
+// Jobs writing to the same destination under differently cased names (the same directory on
+// case-insensitive filesystems) would race, so they are an error, as are jobs whose area, theme
+// or locale isn't a plain directory name below pub/static
+func checkJobMatrix(magentoRoot string, jobs []DeployJob) ([]DeployJob, []string, error) {
+	var unique []DeployJob
+	var warnings []string
+	seen := make(map[DeployJob]bool)
+	destinations := make(map[string]DeployJob)
+	duplicates := 0
+
+	for _, job := range jobs {
+		if err := checkJobPath(job); err != nil {
+			return nil, nil, err
+		}
+		if seen[job] {
+			duplicates++
+			continue
+		}
+		seen[job] = true
+
+		dest := strings.ToLower(job.Area + "/" + job.Theme + "/" + job.Locale)
+		if other, ok := destinations[dest]; ok {
+			return nil, nil, fmt.Errorf("%s/%s (%s) and %s/%s (%s) deploy to the same directory on case-insensitive filesystems",
+				other.Theme, other.Area, other.Locale, job.Theme, job.Area, job.Locale)
+		}
+		destinations[dest] = job
+		unique = append(unique, job)
+	}
+	if duplicates > 0 {
+		warnings = append(warnings, fmt.Sprintf("removed %d duplicate job(s)", duplicates))
+	}
+
+	// Report every suspicious area, theme and locale once, not per job
+	reported := make(map[string]bool)
+	warn := func(key string, format string, args ...any) {
+		if !reported[key] {
+			reported[key] = true
+			warnings = append(warnings, fmt.Sprintf(format, args...))
+		}
+	}
+	for _, job := range unique {
+		if !knownAreas[job.Area] {
+			warn("area "+job.Area, "unknown area '%s' (expected frontend or adminhtml)", job.Area)
+		}
+		if !localeCodePattern.MatchString(job.Locale) && localeAliases[job.Locale] == "" {
+			warn("locale "+job.Locale, "'%s' doesn't look like a locale code (e.g. en_US) and is no locale alias", job.Locale)
+		}
+		if themeExists(magentoRoot, job.Area, job.Theme) {
+			continue
+		}
+		for _, info := range discoverThemes(magentoRoot) {
+			if info.Name == job.Theme && info.Area != job.Area {
+				warn("theme "+job.Area+"/"+job.Theme, "%s is a %s theme, its %s jobs will be skipped", job.Theme, info.Area, job.Area)
+				break
+			}
+		}
+	}
+
+	return unique, warnings, nil
+}
+
+// checkJobPath returns an error unless the destination of a job, area/Vendor/theme/locale,
+// stays below pub/static: every part must be a single directory name
+func checkJobPath(job DeployJob) error {
+	vendor, name, _ := strings.Cut(job.Theme, "/")
+	for _, part := range []string{job.Area, vendor, name, job.Locale} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+			return fmt.Errorf("invalid job %s/%s (%s): area, theme and locale must be names like frontend, Vendor/theme and en_US",
+				job.Theme, job.Area, job.Locale)
+		}
+	}
+	return nil
+}
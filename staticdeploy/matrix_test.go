@@ -0,0 +1,24 @@
+package staticdeploy
+
+import "testing"
+
+func TestCheckJobMatrixRejectsPaths(t *testing.T) {
+	root := t.TempDir()
+	for _, job := range []DeployJob{
+		{Area: "frontend", Theme: "../..", Locale: "en_US"},
+		{Area: "frontend", Theme: "Vendor/Hyva", Locale: ".."},
+		{Area: "..", Theme: "Vendor/Hyva", Locale: "en_US"},
+		{Area: "frontend", Theme: "Vendor/Hyva/x", Locale: "en_US"},
+		{Area: "frontend", Theme: "Vendor", Locale: "en_US"},
+		{Area: "frontend", Theme: "Vendor/Hyva", Locale: `a\b`},
+	} {
+		if _, _, err := checkJobMatrix(root, []DeployJob{job}); err == nil {
+			t.Errorf("checkJobMatrix(%+v) = nil error, want the job refused", job)
+		}
+	}
+
+	jobs := []DeployJob{{Area: "frontend", Theme: "Vendor/Hyva", Locale: "en_US"}}
+	if _, _, err := checkJobMatrix(root, jobs); err != nil {
+		t.Errorf("checkJobMatrix(%+v) = %v, want no error", jobs[0], err)
+	}
+}
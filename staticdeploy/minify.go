@@ -0,0 +1,387 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path"
+	"strings"
+)
+
+// minifyAssets minifies the deployed JavaScript and CSS (--minify)
+var minifyAssets bool
+
+// errMinifySyntax makes the minifiers give up on a file they can't tokenize reliably; it's
+// deployed as is
+var errMinifySyntax = errors.New("unexpected syntax")
+
+// minifyCopyFilter is the built-in copy filter of --minify. It's conservative: comments and
+// whitespace are removed, but line breaks that may end a JavaScript statement are kept and
+// nothing is renamed, so the code runs exactly as before. License comments (/*! ... */) stay
+type minifyCopyFilter struct{}
+
+// enableMinify adds the minify filter in front of the configured copy filters, so their
+// content replacements win
+func enableMinify() {
+	copyFilters = append([]configuredCopyFilter{{filter: minifyCopyFilter{}, timeout: defaultCopyFilterTimeout}}, copyFilters...)
+}
+
+func (minifyCopyFilter) String() string {
+	return "minify"
+}
+
+// Filter minifies .js and .css files, except those already minified
+func (minifyCopyFilter) Filter(ctx context.Context, file CopyFile) (CopyDecision, error) {
+	ext := path.Ext(file.Path)
+	if (ext != ".js" && ext != ".css") || strings.HasSuffix(file.Path, ".min"+ext) {
+		return CopyDecision{}, nil
+	}
+	content, err := os.ReadFile(file.Source)
+	if err != nil {
+		return CopyDecision{}, err
+	}
+	// The source map of built files would no longer match
+	if bytes.Contains(content, []byte("sourceMappingURL=")) {
+		return CopyDecision{}, nil
+	}
+	var minified []byte
+	if ext == ".js" {
+		minified, err = minifyJS(content)
+	} else {
+		minified, err = minifyCSS(content)
+	}
+	if err != nil || len(minified) >= len(content) {
+		return CopyDecision{}, nil
+	}
+	return CopyDecision{Content: minified}, nil
+}
+
+// jsRegexpPrecedingKeywords are the keywords after which a slash starts a regular expression
+var jsRegexpPrecedingKeywords = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true, "new": true,
+	"delete": true, "void": true, "throw": true, "case": true, "do": true, "else": true,
+	"yield": true, "await": true,
+}
+
+// jsControlKeywords are the keywords whose parenthesized condition may be followed by a
+// regular expression, e.g. if (x) /a/.test(s)
+var jsControlKeywords = map[string]bool{"if": true, "while": true, "for": true, "with": true}
+
+// jsMinifier removes the comments and whitespace of JavaScript
+type jsMinifier struct {
+	src     []byte
+	pos     int
+	out     bytes.Buffer
+	space   bool   // whitespace before the next token
+	newline bool   // a line break before the next token
+	parens  []bool // the open parentheses, true for those of a control keyword
+	control bool   // the last closed parenthesis was that of a control keyword
+}
+
+// minifyJS minifies JavaScript, returning errMinifySyntax for code it can't tokenize
+func minifyJS(src []byte) ([]byte, error) {
+	m := &jsMinifier{src: src}
+	if err := m.code(false); err != nil {
+		return nil, err
+	}
+	return m.out.Bytes(), nil
+}
+
+// isJSIdentByte reports whether c can be part of an identifier or number
+func isJSIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c == '\\' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// last returns the last written byte, 0 at the start
+func (m *jsMinifier) last() byte {
+	if m.out.Len() == 0 {
+		return 0
+	}
+	return m.out.Bytes()[m.out.Len()-1]
+}
+
+// lastWord returns the identifier or keyword the output ends with
+func (m *jsMinifier) lastWord() string {
+	out := m.out.Bytes()
+	i := len(out)
+	for i > 0 && isJSIdentByte(out[i-1]) {
+		i--
+	}
+	return string(out[i:])
+}
+
+// emit writes the whitespace pending before a token starting with c. A line break is kept
+// unless the tokens around it make it meaningless, as it may end a statement; a space only
+// where the tokens would merge otherwise
+func (m *jsMinifier) emit(c byte) {
+	last := m.last()
+	if m.newline && last != 0 && !strings.ContainsRune("{;,([", rune(last)) && !strings.ContainsRune(")]};,", rune(c)) {
+		m.out.WriteByte('\n')
+	} else if (m.space || m.newline) && last != 0 && !strings.ContainsRune("{}()[];,", rune(last)) && !strings.ContainsRune("{}()[];,", rune(c)) {
+		m.out.WriteByte(' ')
+	}
+	m.space, m.newline = false, false
+}
+
+// code minifies code up to the end, or the closing brace of a template literal substitution
+func (m *jsMinifier) code(substitution bool) error {
+	depth := 0
+	for m.pos < len(m.src) {
+		c := m.src[m.pos]
+		switch {
+		case c == '\n' || c == '\r' || c == 0xe2 && m.isLineSeparator():
+			m.newline = true
+			m.pos++
+			if c == 0xe2 {
+				m.pos += 2
+			}
+		case c == ' ' || c == '\t' || c == '\f' || c == '\v':
+			m.space = true
+			m.pos++
+		case c == '/' && m.peek(1) == '/':
+			end := bytes.IndexAny(m.src[m.pos:], "\r\n")
+			if end < 0 {
+				m.pos = len(m.src)
+			} else {
+				m.pos += end
+			}
+		case c == '/' && m.peek(1) == '*':
+			end := bytes.Index(m.src[m.pos+2:], []byte("*/"))
+			if end < 0 {
+				return errMinifySyntax
+			}
+			comment := m.src[m.pos : m.pos+2+end+2]
+			m.pos += len(comment)
+			if bytes.HasPrefix(comment, []byte("/*!")) {
+				m.emit('/')
+				m.out.Write(comment)
+				m.newline = true
+			} else if bytes.ContainsAny(comment, "\r\n") {
+				m.newline = true
+			} else {
+				m.space = true
+			}
+		case c == '\'' || c == '"':
+			m.emit(c)
+			if err := m.copyQuoted(c); err != nil {
+				return err
+			}
+		case c == '`':
+			m.emit(c)
+			if err := m.template(); err != nil {
+				return err
+			}
+		case c == '/' && m.last() == '}':
+			// A regular expression after a block, a division after an object literal
+			return errMinifySyntax
+		case c == '/' && m.regexpAllowed():
+			m.emit(c)
+			if err := m.copyRegexp(); err != nil {
+				return err
+			}
+		default:
+			switch c {
+			case '(':
+				word := m.lastWord()
+				property := bytes.HasSuffix(m.out.Bytes()[:m.out.Len()-len(word)], []byte("."))
+				m.parens = append(m.parens, jsControlKeywords[word] && !property)
+			case ')':
+				if len(m.parens) == 0 {
+					return errMinifySyntax
+				}
+				m.control = m.parens[len(m.parens)-1]
+				m.parens = m.parens[:len(m.parens)-1]
+			case '{':
+				depth++
+			case '}':
+				if depth == 0 && substitution {
+					m.emit(c)
+					m.out.WriteByte(c)
+					m.pos++
+					return nil
+				}
+				depth--
+			}
+			m.emit(c)
+			m.out.WriteByte(c)
+			m.pos++
+		}
+	}
+	if substitution {
+		return errMinifySyntax
+	}
+	return nil
+}
+
+// peek returns the byte at offset from the position, 0 past the end
+func (m *jsMinifier) peek(offset int) byte {
+	if m.pos+offset < len(m.src) {
+		return m.src[m.pos+offset]
+	}
+	return 0
+}
+
+// isLineSeparator reports whether the position is at U+2028 or U+2029
+func (m *jsMinifier) isLineSeparator() bool {
+	return m.peek(1) == 0x80 && (m.peek(2) == 0xa8 || m.peek(2) == 0xa9)
+}
+
+// regexpAllowed reports whether a slash at the position starts a regular expression rather
+// than a division, by the token before it
+func (m *jsMinifier) regexpAllowed() bool {
+	out := m.out.Bytes()
+	if len(out) == 0 {
+		return true
+	}
+	// a++ / b and a-- / b are divisions
+	last := out[len(out)-1]
+	if strings.ContainsRune("(,=:[!&|?{};+-*%<>~^", rune(last)) {
+		return !(len(out) > 1 && (last == '+' || last == '-') && out[len(out)-2] == last)
+	}
+	// (a + b) / 2 is a division, if (a) /b/.test(s) a regular expression
+	if last == ')' {
+		return m.control
+	}
+	return jsRegexpPrecedingKeywords[m.lastWord()]
+}
+
+// copyQuoted copies a string literal
+func (m *jsMinifier) copyQuoted(quote byte) error {
+	start := m.pos
+	for m.pos++; m.pos < len(m.src); m.pos++ {
+		switch m.src[m.pos] {
+		case '\\':
+			m.pos++
+		case '\n', '\r':
+			return errMinifySyntax
+		case quote:
+			m.pos++
+			m.out.Write(m.src[start:m.pos])
+			return nil
+		}
+	}
+	return errMinifySyntax
+}
+
+// copyRegexp copies a regular expression literal and its flags
+func (m *jsMinifier) copyRegexp() error {
+	start := m.pos
+	class := false
+	for m.pos++; m.pos < len(m.src); m.pos++ {
+		switch m.src[m.pos] {
+		case '\\':
+			m.pos++
+		case '\n', '\r':
+			return errMinifySyntax
+		case '[':
+			class = true
+		case ']':
+			class = false
+		case '/':
+			if class {
+				continue
+			}
+			for m.pos++; m.pos < len(m.src) && isJSIdentByte(m.src[m.pos]); m.pos++ {
+			}
+			m.out.Write(m.src[start:m.pos])
+			return nil
+		}
+	}
+	return errMinifySyntax
+}
+
+// template copies a template literal, minifying the code of its substitutions
+func (m *jsMinifier) template() error {
+	start := m.pos
+	for m.pos++; m.pos < len(m.src); m.pos++ {
+		switch m.src[m.pos] {
+		case '\\':
+			m.pos++
+		case '`':
+			m.pos++
+			m.out.Write(m.src[start:m.pos])
+			return nil
+		case '$':
+			if m.peek(1) != '{' {
+				continue
+			}
+			m.pos += 2
+			m.out.Write(m.src[start:m.pos])
+			if err := m.code(true); err != nil {
+				return err
+			}
+			start = m.pos
+			m.pos--
+		}
+	}
+	return errMinifySyntax
+}
+
+// minifyCSS removes the comments and whitespace of CSS, except license comments (/*! ... */)
+// and the whitespace inside strings
+func minifyCSS(src []byte) ([]byte, error) {
+	var out bytes.Buffer
+	space := false
+	// Whitespace next to these is never significant; around others, like the descendant
+	// combinator or the operators of calc(), it is
+	const tight = "{};,>"
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, errMinifySyntax
+			}
+			if i+2 < len(src) && src[i+2] == '!' {
+				out.Write(src[i : i+2+end+2])
+				out.WriteByte('\n')
+			} else {
+				space = true
+			}
+			i += 2 + end + 2
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			space = true
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for ; end < len(src) && src[end] != c; end++ {
+				if src[end] == '\\' {
+					end++
+				} else if src[end] == '\n' {
+					return nil, errMinifySyntax
+				}
+			}
+			if end >= len(src) {
+				return nil, errMinifySyntax
+			}
+			if space && out.Len() > 0 && !strings.ContainsRune(tight, rune(out.Bytes()[out.Len()-1])) {
+				out.WriteByte(' ')
+			}
+			out.Write(src[i : end+1])
+			space = false
+			i = end + 1
+		default:
+			last := byte(0)
+			if out.Len() > 0 {
+				last = out.Bytes()[out.Len()-1]
+			}
+			// The last declaration of a block needs no semicolon
+			if c == '}' && last == ';' {
+				out.Truncate(out.Len() - 1)
+				last = 0
+				if out.Len() > 0 {
+					last = out.Bytes()[out.Len()-1]
+				}
+			}
+			if space && last != 0 && last != '\n' && !strings.ContainsRune(tight, rune(last)) && !strings.ContainsRune(tight, rune(c)) {
+				out.WriteByte(' ')
+			}
+			out.WriteByte(c)
+			space = false
+			i++
+		}
+	}
+	return out.Bytes(), nil
+}
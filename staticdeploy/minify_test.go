@@ -0,0 +1,99 @@
+package staticdeploy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMinifyJS(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"indentation", "function f(a, b) {\n    if (a) {\n        return b;\n    }\n}\n", "function f(a,b){if(a){return b;}}"},
+		{"comments", "var a = 1; // one\n/* two */ var b = 2;", "var a = 1;var b = 2;"},
+		{"license comment", "/*! (c) Vendor */\nvar a = 1;", "/*! (c) Vendor */\nvar a = 1;"},
+		{"line break ending a statement", "var a = 1\nvar b = 2", "var a = 1\nvar b = 2"},
+		{"return with line break", "return\nvalue", "return\nvalue"},
+		{"strings", "x = 'a  // b' + \"c /* d */\";", "x = 'a  // b' + \"c /* d */\";"},
+		{"regexp", "x = /a b\\/ [/]/g.test(y)", "x = /a b\\/ [/]/g.test(y)"},
+		{"regexp after keyword", "return /a  b/.test(y)", "return /a  b/.test(y)"},
+		{"division", "x = a  /  b / c", "x = a / b / c"},
+		{"increment before division", "x = a++ / 2", "x = a++ / 2"},
+		{"division after parentheses", "x = (a + b)  /  2", "x =(a + b)/ 2"},
+		{"regexp after a condition", "if (x) /  +/.test(s)", "if(x)/  +/.test(s)"},
+		{"regexp after a nested condition", "while (f(x)) /a  b/.exec(s)", "while(f(x))/a  b/.exec(s)"},
+		{"division after a method named like a keyword", "x = a.if(b)  /  2", "x = a.if(b)/ 2"},
+		{"unary operators stay apart", "x = a + +b; y = a - -b", "x = a + +b;y = a - -b"},
+		{"template literal", "x = `a  ${ f( 1 ) }  b ${ {a: 1}.a }`", "x = `a  ${f(1)}  b ${{a: 1}.a}`"},
+		{"nested template literal", "x = `a ${ `b ${ c }` }`", "x = `a ${`b ${c}`}`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := minifyJS([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("minifyJS() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("minifyJS() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinifyJSUnexpectedSyntax(t *testing.T) {
+	for _, src := range []string{"x = 'open", "/* open", "x = `a ${ b", "x = /open\n", "f())", "{} /a  b/.test(s)", "x = {} / 2"} {
+		if _, err := minifyJS([]byte(src)); !errors.Is(err, errMinifySyntax) {
+			t.Errorf("minifyJS(%q) error = %v, want errMinifySyntax", src, err)
+		}
+	}
+}
+
+func TestMinifyCopyFilterSourceMaps(t *testing.T) {
+	for name, src := range map[string]string{
+		"app.js":     "var a  =  1;\n//# sourceMappingURL=app.js.map\n",
+		"styles.css": ".a {  x: 1 }\n/*# sourceMappingURL=styles.css.map */\n",
+	} {
+		source := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(source, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		decision, err := minifyCopyFilter{}.Filter(context.Background(), CopyFile{Path: name, Source: source})
+		if err != nil {
+			t.Fatalf("Filter(%s) error = %v", name, err)
+		}
+		if decision.Content != nil {
+			t.Errorf("Filter(%s) minified a file with a source map: %q", name, decision.Content)
+		}
+	}
+}
+
+func TestMinifyCSS(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"whitespace and last semicolon", ".a {\n  color: red;\n  margin: 0;\n}\n", ".a{color: red;margin: 0}"},
+		{"descendant combinator", ".a .b > .c { x: 1 }", ".a .b>.c{x: 1}"},
+		{"comments", "/* x */ .a { /* y */ x: 1 }", ".a{x: 1}"},
+		{"license comment", "/*! (c) Vendor */\n.a { x: 1 }", "/*! (c) Vendor */\n.a{x: 1}"},
+		{"strings", ".a::before { content: \"  ;  }  \"; }", ".a::before{content: \"  ;  }  \"}"},
+		{"calc", ".a { width: calc(100% - 2px); }", ".a{width: calc(100% - 2px)}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := minifyCSS([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("minifyCSS() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("minifyCSS() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
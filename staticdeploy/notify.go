@@ -0,0 +1,86 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// notifyURL receives the summary of the run as a JSON POST when it finishes (--notify-url)
+var notifyURL string
+
+// Notification is the summary of a run posted to --notify-url
+type Notification struct {
+	Event    string       `json:"event"` // always "deploy.finished"
+	Success  bool         `json:"success"`
+	Version  string       `json:"version"`
+	Host     string       `json:"host"`
+	Started  time.Time    `json:"started"`
+	Duration float64      `json:"duration_seconds"`
+	Files    int64        `json:"files"`
+	Totals   ReportTotals `json:"totals"`
+	Errors   []string     `json:"errors,omitempty"`
+}
+
+// Notifier posts the summary of a run to a webhook
+type Notifier struct {
+	url    string
+	client *HTTPClient
+}
+
+// NewNotifier creates the notifier for url, nil when url is empty
+// The HTTP client is created up front, so --offline fails before the deployment starts
+func NewNotifier(url string, httpCfg HTTPConfig) (*Notifier, error) {
+	if url == "" {
+		return nil, nil
+	}
+	client, err := NewHTTPClient(httpCfg)
+	if err != nil {
+		return nil, fmt.Errorf("--notify-url: %w", err)
+	}
+	return &Notifier{url: url, client: client}, nil
+}
+
+// Notify posts the summary of a finished report; a nil notifier does nothing
+func (n *Notifier) Notify(report *Report) error {
+	if n == nil {
+		return nil
+	}
+	host, _ := os.Hostname()
+	body, err := json.Marshal(Notification{
+		Event:    "deploy.finished",
+		Success:  report.Success,
+		Version:  report.Version,
+		Host:     host,
+		Started:  report.Started,
+		Duration: report.Duration,
+		Files:    report.Files,
+		Totals:   report.Totals,
+		Errors:   report.Errors,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "magento2-static-deploy")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package staticdeploy
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// offlineMode guarantees no network connections are made (--offline)
+// Integrations needing the network must call requireNetwork before the deployment starts,
+// so a run fails fast instead of halfway
+var offlineMode bool
+
+// requireNetwork returns an error when a feature needing network access is used in offline mode
+func requireNetwork(feature string) error {
+	if offlineMode {
+		return fmt.Errorf("%s requires network access, which is disabled by --offline", feature)
+	}
+	return nil
+}
+
+// offlineDialContext refuses all connections; it's installed in every HTTP transport so
+// nothing slips through in offline mode
+func offlineDialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return nil, fmt.Errorf("connection to %s refused: network access is disabled by --offline", address)
+}
@@ -0,0 +1,177 @@
+package staticdeploy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// PhaseConfig is a deployment phase: its jobs only start after all jobs of the phases before
+// it finished. A job belongs to the first phase it matches; empty lists match every job
+type PhaseConfig struct {
+	Name    string   `yaml:"name" json:"name"`
+	Areas   []string `yaml:"areas" json:"areas"`
+	Themes  []string `yaml:"themes" json:"themes"` // theme names or globs like Vendor/*
+	Locales []string `yaml:"locales" json:"locales"`
+
+	// AbortOnFailure skips the later phases when a job of this phase failed
+	AbortOnFailure bool `yaml:"abort_on_failure" json:"abort_on_failure"`
+}
+
+// deployPhases are the phases from the config file; without phases all jobs run at once
+var deployPhases []PhaseConfig
+
+// jobPhase is a phase with the jobs assigned to it
+type jobPhase struct {
+	PhaseConfig
+	Jobs []DeployJob
+}
+
+// Matches reports whether a job belongs to the phase
+func (p PhaseConfig) Matches(job DeployJob) bool {
+	if len(p.Areas) > 0 && !slices.Contains(p.Areas, job.Area) {
+		return false
+	}
+	if len(p.Locales) > 0 && !slices.Contains(p.Locales, job.Locale) {
+		return false
+	}
+	if len(p.Themes) == 0 {
+		return true
+	}
+	for _, pattern := range p.Themes {
+		if matched, _ := path.Match(pattern, job.Theme); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPhases assigns the jobs to the configured phases, in phase order; jobs matching no
+// phase run in a final phase. Phases without jobs are left out
+func splitPhases(jobs []DeployJob, phases []PhaseConfig) []jobPhase {
+	split := make([]jobPhase, len(phases)+1)
+	for i, phase := range phases {
+		split[i].PhaseConfig = phase
+		if split[i].Name == "" {
+			split[i].Name = fmt.Sprintf("phase %d", i+1)
+		}
+	}
+	split[len(phases)].Name = "remaining"
+
+	for _, job := range jobs {
+		i := slices.IndexFunc(phases, func(phase PhaseConfig) bool { return phase.Matches(job) })
+		if i < 0 {
+			i = len(phases)
+		}
+		split[i].Jobs = append(split[i].Jobs, job)
+	}
+
+	return slices.DeleteFunc(split, func(phase jobPhase) bool { return len(phase.Jobs) == 0 })
+}
+
+// lumaDispatch deploys the jobs of the themes bin/magento deploys (Luma themes) phase by
+// phase, after the other jobs of each phase
+type lumaDispatch struct {
+	Jobs []DeployJob
+
+	// Deploy runs bin/magento for the jobs of a phase
+	Deploy func(ctx context.Context, jobs []DeployJob) error
+
+	// Results are those of Jobs, in phase order
+	Results []DeployResult
+}
+
+// processPhases runs the jobs phase by phase, with a barrier between phases; luma, if not nil,
+// adds the jobs dispatched to bin/magento to the phases, its results go to luma.Results
+// When a job of a phase with abort_on_failure fails, the jobs of the later phases are
+// reported as skipped instead of deployed
+func processPhases(ctx context.Context, magentoRoot string, jobs []DeployJob, numJobs int, verbose bool, version string, useSymlink bool, index *VendorIndex, excludes []string, luma *lumaDispatch) []DeployResult {
+	if luma == nil && len(splitPhases(jobs, deployPhases)) <= 1 {
+		return processJobs(ctx, magentoRoot, jobs, numJobs, verbose, version, useSymlink, index, excludes)
+	}
+
+	dispatched := make(map[DeployJob]bool)
+	all := jobs
+	if luma != nil {
+		for _, job := range luma.Jobs {
+			dispatched[job] = true
+		}
+		all = append(slices.Clip(jobs), luma.Jobs...)
+	}
+	phases := splitPhases(all, deployPhases)
+
+	var results []DeployResult
+	abortedBy := ""
+	for i, phase := range phases {
+		var own, magento []DeployJob
+		for _, job := range phase.Jobs {
+			if dispatched[job] {
+				magento = append(magento, job)
+			} else {
+				own = append(own, job)
+			}
+		}
+
+		if abortedBy != "" {
+			for _, job := range phase.Jobs {
+				result := DeployResult{
+					Job:   job,
+					Error: fmt.Sprintf("%s/%s (%s): skipped, phase %s failed", job.Theme, job.Area, job.Locale, abortedBy),
+				}
+				if dispatched[job] {
+					luma.Results = append(luma.Results, result)
+				} else {
+					results = append(results, result)
+				}
+			}
+			continue
+		}
+
+		if len(phases) > 1 {
+			logger.Info(fmt.Sprintf("Phase %d/%d: %s (%d jobs)", i+1, len(phases), phase.Name, len(phase.Jobs)), "phase", phase.Name, "jobs", len(phase.Jobs))
+		}
+		var phaseResults []DeployResult
+		if len(own) > 0 {
+			phaseResults = processJobs(ctx, magentoRoot, own, numJobs, verbose, version, useSymlink, index, excludes)
+		}
+		results = append(results, phaseResults...)
+		failed := failedJobs(phaseResults) > 0
+
+		// bin/magento deploys the Luma jobs of the phase at once, they share its outcome
+		if len(magento) > 0 {
+			err := ctx.Err()
+			if err != nil {
+				err = stopReason(ctx)
+			} else {
+				err = luma.Deploy(ctx, magento)
+			}
+			for _, job := range magento {
+				result := DeployResult{Job: job, Attempts: 1}
+				if err != nil {
+					result.Error = err.Error()
+				}
+				luma.Results = append(luma.Results, result)
+			}
+			failed = failed || err != nil
+		}
+
+		if phase.AbortOnFailure && failed {
+			abortedBy = phase.Name
+			logErrorf("phase %s failed, skipping the remaining phases", phase.Name)
+		}
+	}
+	return results
+}
+
+// failedJobs returns the number of failed jobs; themes that don't exist aren't failures
+func failedJobs(results []DeployResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" && !strings.Contains(result.Error, "theme not found") {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,38 @@
+package staticdeploy
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestProcessPhasesDispatchesLumaPerPhase(t *testing.T) {
+	defer func(phases []PhaseConfig) { deployPhases = phases }(deployPhases)
+	deployPhases = []PhaseConfig{
+		{Name: "storefront", Areas: []string{"frontend"}, AbortOnFailure: true},
+		{Name: "admin", Areas: []string{"adminhtml"}},
+	}
+
+	var dispatched [][]DeployJob
+	luma := &lumaDispatch{
+		Jobs: []DeployJob{
+			{Area: "adminhtml", Theme: "Magento/backend", Locale: "en_US"},
+			{Area: "frontend", Theme: "Magento/luma", Locale: "en_US"},
+		},
+		Deploy: func(ctx context.Context, jobs []DeployJob) error {
+			dispatched = append(dispatched, jobs)
+			return errors.New("bin/magento failed")
+		},
+	}
+	processPhases(context.Background(), t.TempDir(), nil, 1, false, "1", false, nil, nil, luma)
+
+	if len(dispatched) != 1 || len(dispatched[0]) != 1 || dispatched[0][0].Area != "frontend" {
+		t.Fatalf("dispatched %v, want only the frontend job of the first phase", dispatched)
+	}
+	if len(luma.Results) != 2 {
+		t.Fatalf("got %d Luma results, want 2", len(luma.Results))
+	}
+	if want := "Magento/backend/adminhtml (en_US): skipped, phase storefront failed"; luma.Results[1].Error != want {
+		t.Errorf("adminhtml result error = %q, want %q", luma.Results[1].Error, want)
+	}
+}
@@ -0,0 +1,155 @@
+package staticdeploy
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// PHPRunner runs PHP commands, either with a local PHP binary or through a command
+// prefix like "docker compose exec -T php php" when PHP only exists inside a container
+// Host paths under the Magento root are mapped to the container's Magento root
+type PHPRunner struct {
+	command       []string
+	iniArgs       []string
+	hostRoot      string
+	containerRoot string
+}
+
+// NewPHPRunner creates a PHP runner
+// execCommand is an optional command prefix (e.g. "docker compose exec -T php php"); when
+// it contains {args} the PHP arguments are inserted there instead of appended
+// containerRoot is the Magento root inside the container (defaults to the host root)
+// iniSettings are passed as -d options (e.g. memory_limit=2G) to every PHP invocation
+func NewPHPRunner(magentoRoot string, binary string, execCommand string, containerRoot string, iniSettings []string) (*PHPRunner, error) {
+	hostRoot, err := filepath.Abs(magentoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve Magento root: %w", err)
+	}
+
+	runner := &PHPRunner{
+		command:       []string{binary},
+		hostRoot:      hostRoot,
+		containerRoot: containerRoot,
+	}
+
+	if execCommand != "" {
+		command, err := splitCommandLine(execCommand)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --php-exec command: %w", err)
+		}
+		if len(command) == 0 {
+			return nil, fmt.Errorf("invalid --php-exec command: empty")
+		}
+		runner.command = command
+	}
+
+	for _, setting := range iniSettings {
+		if !strings.Contains(setting, "=") {
+			return nil, fmt.Errorf("invalid PHP ini setting %q, expected name=value", setting)
+		}
+		runner.iniArgs = append(runner.iniArgs, "-d", setting)
+	}
+
+	return runner, nil
+}
+
+// LookPath checks that the PHP binary (or the wrapper command) is available
+func (r *PHPRunner) LookPath() (string, error) {
+	path, err := exec.LookPath(r.command[0])
+	if err != nil {
+		return "", fmt.Errorf("%s not found in PATH", r.command[0])
+	}
+	return path, nil
+}
+
+// Path maps a host path to the path PHP sees; paths outside the Magento root are kept
+func (r *PHPRunner) Path(hostPath string) string {
+	absPath, err := filepath.Abs(hostPath)
+	if err != nil {
+		return hostPath
+	}
+	if r.containerRoot == "" {
+		return absPath
+	}
+
+	relPath, err := filepath.Rel(r.hostRoot, absPath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return absPath
+	}
+	return strings.TrimSuffix(r.containerRoot, "/") + "/" + filepath.ToSlash(relPath)
+}
+
+// Command builds the command running PHP with the given arguments from the Magento root
+func (r *PHPRunner) Command(args ...string) *exec.Cmd {
+	return r.CommandContext(context.Background(), args...)
+}
+
+// CommandContext is Command with a context that kills PHP when it's canceled
+func (r *PHPRunner) CommandContext(ctx context.Context, args ...string) *exec.Cmd {
+	args = append(append([]string{}, r.iniArgs...), args...)
+
+	var argv []string
+	inserted := false
+	for _, part := range r.command {
+		if part == "{args}" {
+			argv = append(argv, args...)
+			inserted = true
+			continue
+		}
+		argv = append(argv, part)
+	}
+	if !inserted {
+		argv = append(argv, args...)
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = r.hostRoot
+	return cmd
+}
+
+// String returns the command prefix (including ini options) for display
+func (r *PHPRunner) String() string {
+	return strings.Join(append(append([]string{}, r.command...), r.iniArgs...), " ")
+}
+
+// splitCommandLine splits a command line into arguments, honoring single and double quotes
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	for _, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,277 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readPHPArrayFile parses a PHP file returning an array literal, like app/etc/config.php
+// and app/etc/env.php. Only literals are supported (arrays, strings, numbers, booleans
+// and null), which is what Magento writes to these files; PHP itself is not needed
+// Arrays become map[string]interface{}, or []interface{} for lists without explicit keys
+func readPHPArrayFile(path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &phpArrayParser{src: string(data)}
+	value, err := p.parseFile()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return value, nil
+}
+
+// phpArrayParser is a minimal recursive descent parser for PHP array literals
+type phpArrayParser struct {
+	src string
+	pos int
+}
+
+func (p *phpArrayParser) parseFile() (interface{}, error) {
+	idx := strings.Index(p.src, "return")
+	if idx < 0 {
+		return nil, fmt.Errorf("no return statement found")
+	}
+	p.pos = idx + len("return")
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] != ';' {
+		return nil, p.errorf("expected ';'")
+	}
+	return value, nil
+}
+
+func (p *phpArrayParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips whitespace and comments
+func (p *phpArrayParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch {
+		case strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])):
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "//") || p.src[p.pos] == '#':
+			end := strings.IndexByte(p.src[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end + 1
+			}
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end + 4
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *phpArrayParser) parseValue() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end of file")
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case c == '[':
+		p.pos++
+		return p.parseArray("]")
+	case len(p.src)-p.pos >= 5 && strings.EqualFold(p.src[p.pos:p.pos+5], "array"):
+		p.pos += len("array")
+		p.skipSpace()
+		if p.pos >= len(p.src) || p.src[p.pos] != '(' {
+			return nil, p.errorf("expected '(' after array")
+		}
+		p.pos++
+		return p.parseArray(")")
+	case c == '\'' || c == '"':
+		return p.parseString()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	default:
+		word := p.parseWord()
+		switch strings.ToLower(word) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return nil, p.errorf("unsupported expression %q", word)
+	}
+}
+
+func (p *phpArrayParser) parseArray(closing string) (interface{}, error) {
+	assoc := make(map[string]interface{})
+	var list []interface{}
+	isList := true
+	nextIndex := int64(0)
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unterminated array")
+		}
+		if strings.HasPrefix(p.src[p.pos:], closing) {
+			p.pos += len(closing)
+			break
+		}
+
+		first, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		// Entries are either "key => value" or a value with the next integer key
+		key := strconv.FormatInt(nextIndex, 10)
+		value := first
+		p.skipSpace()
+		if strings.HasPrefix(p.src[p.pos:], "=>") {
+			p.pos += 2
+			if value, err = p.parseValue(); err != nil {
+				return nil, err
+			}
+			key = fmt.Sprint(first)
+		}
+
+		if n, err := strconv.ParseInt(key, 10, 64); err == nil && n >= nextIndex {
+			nextIndex = n + 1
+		}
+		if isList && key == strconv.Itoa(len(list)) {
+			list = append(list, value)
+		} else {
+			isList = false
+		}
+		assoc[key] = value
+
+		p.skipSpace()
+		if p.pos < len(p.src) && p.src[p.pos] == ',' {
+			p.pos++
+		}
+	}
+
+	if isList {
+		if list == nil {
+			return []interface{}{}, nil
+		}
+		return list, nil
+	}
+	return assoc, nil
+}
+
+func (p *phpArrayParser) parseString() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == quote {
+			p.pos++
+			return sb.String(), nil
+		}
+		if c == '\\' && p.pos+1 < len(p.src) {
+			next := p.src[p.pos+1]
+			if quote == '\'' {
+				if next == '\'' || next == '\\' {
+					sb.WriteByte(next)
+					p.pos += 2
+					continue
+				}
+			} else {
+				replacements := map[byte]string{'n': "\n", 't': "\t", 'r': "\r", '"': "\"", '\\': "\\", '$': "$"}
+				if r, ok := replacements[next]; ok {
+					sb.WriteString(r)
+					p.pos += 2
+					continue
+				}
+			}
+		}
+		sb.WriteByte(c)
+		p.pos++
+	}
+
+	return "", p.errorf("unterminated string")
+}
+
+func (p *phpArrayParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) && strings.ContainsRune("0123456789.eE_", rune(p.src[p.pos])) {
+		p.pos++
+	}
+
+	text := strings.ReplaceAll(p.src[start:p.pos], "_", "")
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, p.errorf("invalid number %q", text)
+	}
+	return f, nil
+}
+
+func (p *phpArrayParser) parseWord() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if !(c == '_' || c == '\\' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start && p.pos < len(p.src) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// phpArrayPath looks up a nested value by keys, e.g. phpArrayPath(cfg, "system", "default")
+func phpArrayPath(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			value = v[i]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// phpArrayPathString returns a nested string value, or "" if missing or not scalar
+func phpArrayPathString(value interface{}, keys ...string) string {
+	switch v := phpArrayPath(value, keys...).(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return ""
+}
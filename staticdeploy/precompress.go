@@ -0,0 +1,119 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// precompressAssets writes gzip and Brotli copies of the deployed text assets (--precompress)
+var precompressAssets bool
+
+// precompressMinSize is the size below which compression gains less than its overhead
+const precompressMinSize = 1024
+
+// precompressExtensions are the deployed files that compress well; images and fonts are
+// compressed already
+var precompressExtensions = map[string]bool{
+	".js": true, ".mjs": true, ".css": true, ".svg": true, ".json": true, ".html": true,
+	".txt": true, ".xml": true, ".map": true,
+}
+
+// precompressEncodings are the compressed copies written next to a file, by suffix, for web
+// servers serving them as is (nginx gzip_static and brotli_static, Apache MultiViews)
+var precompressEncodings = []struct {
+	suffix   string
+	compress func(w io.Writer) io.WriteCloser
+}{
+	{".gz", func(w io.Writer) io.WriteCloser {
+		zw, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+		return zw
+	}},
+	{".br", func(w io.Writer) io.WriteCloser {
+		return brotli.NewWriterLevel(w, brotli.BestCompression)
+	}},
+}
+
+// isPrecompressedCopy reports whether path is the compressed copy of a file for which
+// deployed returns true
+func isPrecompressedCopy(path string, deployed func(string) bool) bool {
+	for _, encoding := range precompressEncodings {
+		if source, ok := strings.CutSuffix(path, encoding.suffix); ok && deployed(source) {
+			return true
+		}
+	}
+	return false
+}
+
+// precompressDir writes the compressed copies of the files below dir that are missing or
+// older than their file, returning how many were written. A copy gets the modification
+// time of its file, which makes it up to date; copies that aren't smaller are removed
+func precompressDir(dir string) (int, error) {
+	var written int
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		if !precompressExtensions[strings.ToLower(filepath.Ext(path))] || info.Size() < precompressMinSize {
+			return nil
+		}
+
+		var content []byte
+		for _, encoding := range precompressEncodings {
+			target := path + encoding.suffix
+			if existing, err := os.Stat(target); err == nil && existing.ModTime().Equal(info.ModTime()) {
+				continue
+			}
+			if content == nil {
+				if content, err = os.ReadFile(path); err != nil {
+					return err
+				}
+			}
+
+			var compressed bytes.Buffer
+			w := encoding.compress(&compressed)
+			w.Write(content)
+			if err := w.Close(); err != nil {
+				return err
+			}
+			if compressed.Len() >= len(content) {
+				if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				continue
+			}
+			if err := writeFileAtomic(target, compressed.Bytes(), 0644); err != nil {
+				return err
+			}
+			if err := os.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+				return err
+			}
+			written++
+		}
+		return nil
+	})
+	return written, err
+}
+
+// precompressResults precompresses the locale directories of the successful jobs; symlinked
+// ones point to the sources, which are left alone
+func precompressResults(magentoRoot string, results []DeployResult) (int, error) {
+	var written int
+	for _, result := range results {
+		if result.Error != "" || result.Symlinked || result.FilesCount == 0 {
+			continue
+		}
+		job := result.Job
+		n, err := precompressDir(filepath.Join(currentDeployRoot(magentoRoot), job.Area, job.Theme, job.Locale))
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,80 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"sort"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Preset is a named bundle of flag values for a common use case
+type Preset struct {
+	Flags       map[string]string
+	PrimaryOnly bool // deploy only the first theme and locale
+}
+
+// presets are the supported --preset values
+var presets = map[string]Preset{
+	// Quick local frontend development: symlinks to the sources, primary theme and locale
+	// only, unminified, then watching the sources with LiveReload
+	"dev": {
+		Flags: map[string]string{
+			"mode":       "symlink",
+			"minify":     "false",
+			"watch":      "true",
+			"livereload": defaultLiveReloadAddr,
+		},
+		PrimaryOnly: true,
+	},
+	// Production builds: content hash change detection, removal of stale files, an atomic
+	// switch to a new version directory, minified and precompressed assets and a manifest;
+	// signing it needs a key, so --sign-manifest is up to the user
+	"production": {
+		Flags: map[string]string{
+			"mode":           "copy",
+			"compare":        "checksum",
+			"prune":          "true",
+			"versioned-dirs": "true",
+			"minify":         "true",
+			"precompress":    "true",
+			"manifest":       "true",
+		},
+	},
+}
+
+// applyPreset sets the flags of a preset that weren't given explicitly on the command line
+func applyPreset(name string) (Preset, error) {
+	preset, ok := presets[name]
+	if !ok {
+		names := make([]string, 0, len(presets))
+		for n := range presets {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Preset{}, fmt.Errorf("unknown preset '%s' (available: %v)", name, names)
+	}
+
+	for name, value := range preset.Flags {
+		if flag.CommandLine.Changed(name) {
+			continue
+		}
+		if err := flag.CommandLine.Set(name, value); err != nil {
+			return Preset{}, fmt.Errorf("preset flag --%s: %w", name, err)
+		}
+	}
+	return preset, nil
+}
+
+// primaryJobs limits jobs to the theme and locale of the first job (in all its areas)
+func primaryJobs(jobs []DeployJob) []DeployJob {
+	if len(jobs) == 0 {
+		return jobs
+	}
+	var primary []DeployJob
+	for _, job := range jobs {
+		if job.Theme == jobs[0].Theme && job.Locale == jobs[0].Locale {
+			primary = append(primary, job)
+		}
+	}
+	return primary
+}
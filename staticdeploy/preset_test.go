@@ -0,0 +1,122 @@
+package staticdeploy
+
+import (
+	"reflect"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+)
+
+// presetTestFlags replaces the deploy flags with string flags of the same names for the
+// duration of a test, so presets don't change the real options
+func presetTestFlags(t *testing.T) *flag.FlagSet {
+	saved := flag.CommandLine
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, preset := range presets {
+		for name := range preset.Flags {
+			if flags.Lookup(name) == nil {
+				flags.String(name, "", "")
+			}
+		}
+	}
+	flag.CommandLine = flags
+	t.Cleanup(func() { flag.CommandLine = saved })
+	return flags
+}
+
+func TestPresetFlagsExist(t *testing.T) {
+	for presetName, preset := range presets {
+		for name := range preset.Flags {
+			if flag.CommandLine.Lookup(name) == nil {
+				t.Errorf("preset %s sets unknown flag --%s", presetName, name)
+			}
+		}
+	}
+}
+
+func TestApplyPreset(t *testing.T) {
+	flags := presetTestFlags(t)
+	if err := flags.Parse([]string{"--compare=mtime", "--precompress=false"}); err != nil {
+		t.Fatal(err)
+	}
+
+	preset, err := applyPreset("production")
+	if err != nil {
+		t.Fatalf("applyPreset() error = %v", err)
+	}
+	if preset.PrimaryOnly {
+		t.Errorf("production preset is PrimaryOnly")
+	}
+	want := map[string]string{
+		"mode":           "copy",
+		"compare":        "mtime", // given explicitly
+		"prune":          "true",
+		"versioned-dirs": "true",
+		"minify":         "true",
+		"precompress":    "false", // given explicitly
+		"manifest":       "true",
+	}
+	for name, value := range want {
+		if got := flags.Lookup(name).Value.String(); got != value {
+			t.Errorf("--%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestApplyPresetDev(t *testing.T) {
+	flags := presetTestFlags(t)
+
+	preset, err := applyPreset("dev")
+	if err != nil {
+		t.Fatalf("applyPreset() error = %v", err)
+	}
+	if !preset.PrimaryOnly {
+		t.Errorf("dev preset isn't PrimaryOnly")
+	}
+	want := map[string]string{
+		"mode":       "symlink",
+		"minify":     "false",
+		"watch":      "true",
+		"livereload": defaultLiveReloadAddr,
+	}
+	for name, value := range want {
+		if got := flags.Lookup(name).Value.String(); got != value {
+			t.Errorf("--%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestApplyPresetUnknown(t *testing.T) {
+	presetTestFlags(t)
+	if _, err := applyPreset("staging"); err == nil {
+		t.Error("applyPreset(staging) succeeded, want an error")
+	}
+}
+
+func TestPrimaryJobs(t *testing.T) {
+	jobs := []DeployJob{
+		{Area: "frontend", Theme: "Vendor/Hyva", Locale: "nl_NL"},
+		{Area: "frontend", Theme: "Vendor/Hyva", Locale: "de_DE"},
+		{Area: "frontend", Theme: "Vendor/Other", Locale: "nl_NL"},
+		{Area: "adminhtml", Theme: "Vendor/Hyva", Locale: "nl_NL"},
+		{Area: "adminhtml", Theme: "Magento/backend", Locale: "nl_NL"},
+	}
+
+	tests := []struct {
+		name string
+		jobs []DeployJob
+		want []DeployJob
+	}{
+		{"no jobs", nil, nil},
+		{"first theme and locale in all areas", jobs, []DeployJob{jobs[0], jobs[3]}},
+		{"single job", jobs[1:2], jobs[1:2]},
+		{"other theme first", jobs[2:], []DeployJob{jobs[2]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := primaryJobs(tt.jobs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("primaryJobs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
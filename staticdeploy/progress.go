@@ -0,0 +1,142 @@
+package staticdeploy
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Progress is the content of the --progress-file, rewritten as the run advances
+type Progress struct {
+	Phase      string    `json:"phase"`   // building, backup, deploying, compiling, luma, finishing, done
+	Version    string    `json:"version"` // content version being deployed
+	JobsTotal  int       `json:"jobs_total"`
+	JobsDone   int       `json:"jobs_done"`
+	CurrentJob int       `json:"current_job"` // 1-based index of the most recently started job
+	Running    []string  `json:"running"`     // theme/area (locale) of the jobs in progress
+	Percent    float64   `json:"percent"`
+	ETASeconds *float64  `json:"eta_seconds,omitempty"` // estimate for the remaining jobs, once one is done
+	Started    time.Time `json:"started"`
+	Updated    time.Time `json:"updated"`
+	Success    *bool     `json:"success,omitempty"` // set when done
+}
+
+// progressTracker writes the Progress of the run to a file for external orchestration
+// All methods are no-ops on a nil tracker
+type progressTracker struct {
+	path     string
+	mu       sync.Mutex
+	progress Progress
+	running  map[string]bool
+	jobStart time.Time // start of the deploying phase, for the ETA
+}
+
+// runProgress tracks the run when --progress-file is given, nil otherwise
+var runProgress *progressTracker
+
+// newProgressTracker creates a tracker writing to path for a run deploying version
+func newProgressTracker(path string, version string) *progressTracker {
+	now := time.Now()
+	return &progressTracker{
+		path:     path,
+		progress: Progress{Phase: "starting", Version: version, Running: []string{}, Started: now, Updated: now},
+		running:  make(map[string]bool),
+	}
+}
+
+// Phase sets the phase of the run
+func (t *progressTracker) Phase(phase string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress.Phase = phase
+	t.write()
+}
+
+// Jobs sets the number of jobs and starts the deploying phase
+func (t *progressTracker) Jobs(total int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress.Phase = "deploying"
+	t.progress.JobsTotal = total
+	t.jobStart = time.Now()
+	t.write()
+}
+
+// JobStarted records the start of job index (0-based)
+func (t *progressTracker) JobStarted(index int, job DeployJob) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if index+1 > t.progress.CurrentJob {
+		t.progress.CurrentJob = index + 1
+	}
+	t.running[jobLabel(job)] = true
+	t.write()
+}
+
+// JobDone records the end of a job
+func (t *progressTracker) JobDone(job DeployJob) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.running, jobLabel(job))
+	t.progress.JobsDone++
+
+	if remaining := t.progress.JobsTotal - t.progress.JobsDone; remaining >= 0 {
+		perJob := time.Since(t.jobStart).Seconds() / float64(t.progress.JobsDone)
+		eta := perJob * float64(remaining)
+		t.progress.ETASeconds = &eta
+	}
+	t.write()
+}
+
+// Finish marks the run as done
+func (t *progressTracker) Finish(success bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress.Phase = "done"
+	t.progress.Success = &success
+	t.progress.Percent = 100
+	zero := 0.0
+	t.progress.ETASeconds = &zero
+	t.write()
+}
+
+// write replaces the progress file, renaming a temporary file so readers never see a
+// partial one. Failures are ignored, progress reporting must not fail the deployment
+func (t *progressTracker) write() {
+	t.progress.Updated = time.Now()
+	t.progress.Running = t.progress.Running[:0]
+	for label := range t.running {
+		t.progress.Running = append(t.progress.Running, label)
+	}
+	sort.Strings(t.progress.Running)
+	if t.progress.JobsTotal > 0 && t.progress.Phase != "done" {
+		t.progress.Percent = float64(t.progress.JobsDone) * 100 / float64(t.progress.JobsTotal)
+	}
+
+	data, err := json.MarshalIndent(t.progress, "", "  ")
+	if err != nil {
+		return
+	}
+	writeFileAtomic(t.path, data, 0644)
+}
+
+// jobLabel returns the theme/area (locale) label of a job
+func jobLabel(job DeployJob) string {
+	return job.Theme + "/" + job.Area + " (" + job.Locale + ")"
+}
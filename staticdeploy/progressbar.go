@@ -0,0 +1,230 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressMode is --progress: auto (a status line on terminals, lines otherwise), bar, lines
+// or off
+var progressMode string
+
+// Intervals of the progress display: the status line is redrawn every progressBarInterval,
+// lines are logged every progressLineInterval (the first one only after that long, so short
+// runs stay quiet)
+const (
+	progressBarInterval  = 200 * time.Millisecond
+	progressLineInterval = 10 * time.Second
+)
+
+// progressDisplay shows the progress of the deploying phase on the console: the jobs done, the
+// jobs running and the files per second. All methods are no-ops on a nil display
+type progressDisplay struct {
+	bar     bool      // redraw a status line on w instead of logging lines
+	w       io.Writer // terminal of the status line
+	mu      sync.Mutex
+	total   int
+	done    int
+	failed  int
+	running map[string]time.Time // job label -> start
+	start   time.Time
+	drawn   bool        // the status line is on the screen
+	active  atomic.Bool // between Start and Stop
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// consoleProgress is the display of the run, nil when --progress=off or --quiet
+var consoleProgress *progressDisplay
+
+// filesProcessed counts the files compared, copied or linked by all jobs, for the rate
+var filesProcessed atomic.Int64
+
+// newProgressDisplay creates the display for mode; auto draws a status line when stderr is a
+// terminal and logs are text, and logs lines otherwise
+func newProgressDisplay(mode string) (*progressDisplay, error) {
+	d := &progressDisplay{w: runStderr, running: make(map[string]time.Time)}
+	switch mode {
+	case "auto":
+		f, ok := runStderr.(*os.File)
+		d.bar = textLogs() && ok && isTerminal(f)
+	case "bar":
+		d.bar = true
+	case "lines":
+	case "off":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("--progress must be 'auto', 'bar', 'lines' or 'off', got '%s'", mode)
+	}
+	return d, nil
+}
+
+// Start shows the progress of total jobs until Stop
+func (d *progressDisplay) Start(total int) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.total = total
+	d.start = time.Now()
+	d.stop = make(chan struct{})
+	d.stopped = make(chan struct{})
+	d.mu.Unlock()
+	d.active.Store(true)
+
+	interval := progressLineInterval
+	if d.bar {
+		interval = progressBarInterval
+	}
+	go func() {
+		defer close(d.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if d.bar {
+					logOutput.Lock()
+					d.draw()
+					logOutput.Unlock()
+				} else {
+					d.logLine()
+				}
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// JobStarted records the start of a job
+func (d *progressDisplay) JobStarted(job DeployJob) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.running[jobLabel(job)] = time.Now()
+}
+
+// JobDone records the end of a job
+func (d *progressDisplay) JobDone(job DeployJob, failed bool) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.running, jobLabel(job))
+	d.done++
+	if failed {
+		d.failed++
+	}
+}
+
+// Stop ends the display, removing the status line
+func (d *progressDisplay) Stop() {
+	if d == nil || !d.active.Swap(false) {
+		return
+	}
+	close(d.stop)
+	<-d.stopped
+
+	logOutput.Lock()
+	defer logOutput.Unlock()
+	d.clear()
+}
+
+// status returns the progress as text and as log attributes
+func (d *progressDisplay) status() (string, []any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	running := make([]string, 0, len(d.running))
+	for label := range d.running {
+		running = append(running, label)
+	}
+	// Longest running first, those are the ones to worry about
+	sort.Slice(running, func(i, j int) bool {
+		return d.running[running[i]].Before(d.running[running[j]])
+	})
+
+	rate := 0.0
+	if elapsed := time.Since(d.start).Seconds(); elapsed > 0 {
+		rate = float64(filesProcessed.Load()) / elapsed
+	}
+
+	text := fmt.Sprintf("%d/%d jobs", d.done, d.total)
+	if d.failed > 0 {
+		text += fmt.Sprintf(" (%d failed)", d.failed)
+	}
+	text += fmt.Sprintf(" | %.0f files/sec", rate)
+	if len(running) > 0 {
+		text += " | " + strings.Join(running, ", ")
+	}
+	attrs := []any{"jobs_done", d.done, "jobs_total", d.total, "jobs_failed", d.failed, "files_per_second", rate, "running", running}
+	return text, attrs
+}
+
+// logLine logs the progress, for consoles that aren't terminals and log collectors
+func (d *progressDisplay) logLine() {
+	text, attrs := d.status()
+	logger.Info("Progress: "+text, attrs...)
+}
+
+// draw redraws the status line; the caller holds logOutput
+func (d *progressDisplay) draw() {
+	text, _ := d.status()
+
+	d.mu.Lock()
+	done, total := d.done, d.total
+	d.mu.Unlock()
+
+	const barWidth = 20
+	filled := barWidth
+	if total > 0 {
+		filled = done * barWidth / total
+	}
+	line := "[" + strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled) + "] " + text
+
+	width := 0
+	if f, ok := d.w.(*os.File); ok {
+		width = terminalWidth(f)
+	}
+	if width <= 0 {
+		width = 80
+	}
+	if runes := []rune(line); len(runes) > width-1 {
+		line = string(runes[:width-4]) + "..."
+	}
+	io.WriteString(d.w, "\r\033[K"+line)
+	d.drawn = true
+}
+
+// clear removes the status line so a log record can be written; the caller holds logOutput
+func (d *progressDisplay) clear() {
+	if d == nil || !d.drawn {
+		return
+	}
+	io.WriteString(d.w, "\r\033[K")
+	d.drawn = false
+}
+
+// redraw draws the status line again after a log record; the caller holds logOutput
+func (d *progressDisplay) redraw() {
+	if d == nil || !d.bar || !d.active.Load() {
+		return
+	}
+	d.draw()
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,204 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// purgeCache purges the HTML cached in Varnish or Fastly with the previous static content URLs
+// after a successful deploy (--purge)
+var purgeCache bool
+
+// fastlyAPI is the base URL of the Fastly API
+const fastlyAPI = "https://api.fastly.com"
+
+// maxFastlyKeys is the number of surrogate keys Fastly accepts per purge request
+const maxFastlyKeys = 256
+
+// PurgeConfig configures --purge (the purge section of the config file)
+type PurgeConfig struct {
+	Varnish *VarnishPurgeConfig `yaml:"varnish" json:"varnish"`
+	Fastly  *FastlyPurgeConfig  `yaml:"fastly" json:"fastly"`
+}
+
+// VarnishPurgeConfig configures the PURGE requests sent to Varnish with Magento's VCL
+type VarnishPurgeConfig struct {
+	Hosts       []string `yaml:"hosts" json:"hosts"`               // host:port, default: http_cache_hosts of env.php
+	TagsPattern string   `yaml:"tags_pattern" json:"tags_pattern"` // X-Magento-Tags-Pattern, default .* (everything)
+}
+
+// FastlyPurgeConfig configures the purge through the Fastly API; the API token is the
+// fastly.token credential
+type FastlyPurgeConfig struct {
+	ServiceID     string   `yaml:"service_id" json:"service_id"`
+	SurrogateKeys []string `yaml:"surrogate_keys" json:"surrogate_keys"` // purge all when empty
+	Soft          bool     `yaml:"soft" json:"soft"`                     // mark the keys stale instead of removing them
+}
+
+// Purger purges cached HTML from Varnish and Fastly
+type Purger struct {
+	client       *HTTPClient
+	varnishHosts []string
+	tagsPattern  string
+	fastly       *FastlyPurgeConfig
+	fastlyToken  string
+}
+
+// NewPurger creates the purger when --purge is given, nil otherwise. Hosts, credentials and
+// the HTTP client are resolved up front, so a misconfiguration fails before deploying
+func NewPurger(magentoRoot string, cfg *Config) (*Purger, error) {
+	if !purgeCache {
+		return nil, nil
+	}
+	client, err := NewHTTPClient(cfg.HTTP)
+	if err != nil {
+		return nil, fmt.Errorf("--purge: %w", err)
+	}
+	p := &Purger{client: client}
+
+	varnish := cfg.Purge.Varnish
+	if varnish != nil || cfg.Purge.Fastly == nil {
+		if varnish == nil {
+			varnish = &VarnishPurgeConfig{}
+		}
+		p.varnishHosts = varnish.Hosts
+		if len(p.varnishHosts) == 0 {
+			if p.varnishHosts, err = httpCacheHosts(magentoRoot); err != nil {
+				return nil, fmt.Errorf("--purge: %w", err)
+			}
+		}
+		p.tagsPattern = varnish.TagsPattern
+		if p.tagsPattern == "" {
+			p.tagsPattern = ".*"
+		}
+	}
+
+	if fastly := cfg.Purge.Fastly; fastly != nil {
+		if fastly.ServiceID == "" {
+			return nil, fmt.Errorf("--purge: purge.fastly.service_id is required")
+		}
+		if fastly.Soft && len(fastly.SurrogateKeys) == 0 {
+			return nil, fmt.Errorf("--purge: soft purges need purge.fastly.surrogate_keys, Fastly can't soft purge everything")
+		}
+		if p.fastlyToken, err = NewCredentials(magentoRoot, cfg).Get("fastly.token"); err != nil {
+			return nil, fmt.Errorf("--purge: %w", err)
+		}
+		p.fastly = fastly
+	}
+	return p, nil
+}
+
+// httpCacheHosts returns the Varnish hosts Magento purges, from http_cache_hosts in env.php
+func httpCacheHosts(magentoRoot string) ([]string, error) {
+	env, err := readPHPArrayFile(filepath.Join(magentoRoot, "app/etc/env.php"))
+	if err != nil {
+		return nil, err
+	}
+	entries, _ := phpArrayPath(env, "http_cache_hosts").([]interface{})
+	var hosts []string
+	for _, entry := range entries {
+		host := phpArrayPathString(entry, "host")
+		if host == "" {
+			continue
+		}
+		port := phpArrayPathString(entry, "port")
+		if port == "" {
+			port = "80"
+		}
+		hosts = append(hosts, net.JoinHostPort(host, port))
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no http_cache_hosts in app/etc/env.php; configure purge.varnish.hosts")
+	}
+	return hosts, nil
+}
+
+// Purge purges every configured Varnish host and the Fastly service, returning a line per
+// target for the summary; a nil purger does nothing
+func (p *Purger) Purge() ([]string, error) {
+	if p == nil {
+		return nil, nil
+	}
+	var purged []string
+	for _, host := range p.varnishHosts {
+		if err := p.purgeVarnish(host); err != nil {
+			return purged, fmt.Errorf("Varnish %s: %w", host, err)
+		}
+		purged = append(purged, fmt.Sprintf("Varnish %s (%s)", host, p.tagsPattern))
+	}
+	if p.fastly != nil {
+		description, err := p.purgeFastly()
+		if err != nil {
+			return purged, fmt.Errorf("Fastly service %s: %w", p.fastly.ServiceID, err)
+		}
+		purged = append(purged, description)
+	}
+	return purged, nil
+}
+
+// purgeVarnish sends a PURGE request handled by Magento's VCL, which bans the pages with a
+// tag matching the pattern
+func (p *Purger) purgeVarnish(host string) error {
+	req, err := http.NewRequest("PURGE", "http://"+host+"/", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Magento-Tags-Pattern", p.tagsPattern)
+	return p.send(req)
+}
+
+// purgeFastly purges the surrogate keys, or the whole service when there are none
+func (p *Purger) purgeFastly() (string, error) {
+	service := url.PathEscape(p.fastly.ServiceID)
+	keys := p.fastly.SurrogateKeys
+	if len(keys) == 0 {
+		req, err := http.NewRequest(http.MethodPost, fastlyAPI+"/service/"+service+"/purge_all", nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Fastly-Key", p.fastlyToken)
+		return fmt.Sprintf("Fastly service %s (everything)", p.fastly.ServiceID), p.send(req)
+	}
+
+	for start := 0; start < len(keys); start += maxFastlyKeys {
+		end := min(start+maxFastlyKeys, len(keys))
+		req, err := http.NewRequest(http.MethodPost, fastlyAPI+"/service/"+service+"/purge", nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Fastly-Key", p.fastlyToken)
+		req.Header.Set("Surrogate-Key", strings.Join(keys[start:end], " "))
+		if p.fastly.Soft {
+			req.Header.Set("Fastly-Soft-Purge", "1")
+		}
+		if err := p.send(req); err != nil {
+			return "", err
+		}
+	}
+	kind := "purged"
+	if p.fastly.Soft {
+		kind = "soft purged"
+	}
+	return fmt.Sprintf("Fastly service %s (%d surrogate key(s) %s)", p.fastly.ServiceID, len(keys), kind), nil
+}
+
+// send sends a purge request and checks its status
+func (p *Purger) send(req *http.Request) error {
+	req.Header.Set("User-Agent", "magento2-static-deploy")
+	// Purging twice does no harm, so POSTs and PURGEs are retried too
+	resp, err := p.client.DoIdempotent(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package staticdeploy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// errCloneUnsupported is returned by cloneFile when the platform or filesystem can't clone
+var errCloneUnsupported = errors.New("file cloning not supported")
+
+// cloneDisabled holds the source and destination device pairs a clone failed for, so
+// unsupported filesystems only pay for a single attempt while others keep cloning
+var cloneDisabled sync.Map // [2]uint64 -> true
+
+// tryCloneFile creates dst as a copy-on-write clone (reflink) of src when supported
+// (FICLONE on btrfs/XFS, clonefile on APFS); returns false when a regular copy is needed
+func tryCloneFile(src, dst string) bool {
+	devices := [2]uint64{fileDevice(src), fileDevice(filepath.Dir(dst))}
+	if _, disabled := cloneDisabled.Load(devices); disabled {
+		return false
+	}
+	if err := cloneFile(src, dst); err != nil {
+		if errors.Is(err, errCloneUnsupported) {
+			cloneDisabled.Store(devices, true)
+		}
+		return false
+	}
+	return true
+}
+
+// fileDevice returns the device of the filesystem a path is on, 0 when unknown
+func fileDevice(path string) uint64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return statDevice(info)
+}
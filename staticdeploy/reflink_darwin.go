@@ -0,0 +1,26 @@
+package staticdeploy
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile clones src to dst with clonefile(2) (APFS); dst must not exist
+func cloneFile(src, dst string) error {
+	err := unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW)
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EXDEV) {
+		return errCloneUnsupported
+	}
+	return err
+}
+
+// statDevice returns the device of a file's filesystem
+func statDevice(info fs.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev)
+	}
+	return 0
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package staticdeploy
+
+import "io/fs"
+
+// cloneFile is not supported on this platform
+func cloneFile(src, dst string) error {
+	return errCloneUnsupported
+}
+
+// statDevice is unknown on this platform, clones are never attempted anyway
+func statDevice(info fs.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,263 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// assetCategories maps file extensions to the names used in release notes (singular, plural)
+var assetCategories = map[string][2]string{
+	".css":   {"CSS", "CSS"},
+	".js":    {"JS", "JS"},
+	".html":  {"template", "templates"},
+	".json":  {"JSON", "JSON"},
+	".png":   {"image", "images"},
+	".jpg":   {"image", "images"},
+	".jpeg":  {"image", "images"},
+	".gif":   {"image", "images"},
+	".svg":   {"image", "images"},
+	".webp":  {"image", "images"},
+	".ico":   {"image", "images"},
+	".woff":  {"font", "fonts"},
+	".woff2": {"font", "fonts"},
+	".ttf":   {"font", "fonts"},
+	".eot":   {"font", "fonts"},
+	".otf":   {"font", "fonts"},
+}
+
+// staticPath is a path below pub/static split into its deployment parts
+type staticPath struct {
+	Area   string
+	Theme  string
+	Locale string
+	Rest   string // path within the locale directory
+}
+
+// splitStaticPath splits area/Vendor/theme/locale/rest; ok is false for top-level files
+// Rest is empty for locale directory symlinks
+func splitStaticPath(relPath string) (staticPath, bool) {
+	parts := strings.SplitN(relPath, "/", 5)
+	if len(parts) < 4 {
+		return staticPath{}, false
+	}
+	p := staticPath{
+		Area:   parts[0],
+		Theme:  parts[1] + "/" + parts[2],
+		Locale: parts[3],
+	}
+	if len(parts) == 5 {
+		p.Rest = parts[4]
+	}
+	return p, true
+}
+
+// Module returns the module prefix of the path (e.g. Magento_Catalog), or ""
+func (p staticPath) Module() string {
+	first := strings.SplitN(p.Rest, "/", 2)[0]
+	if strings.Contains(p.Rest, "/") && moduleDirPattern.MatchString(first) {
+		return first
+	}
+	return ""
+}
+
+// category returns the singular and plural release note name of a file's type
+func category(relPath string) [2]string {
+	if names, ok := assetCategories[strings.ToLower(path.Ext(relPath))]; ok {
+		return names
+	}
+	return [2]string{"other file", "other files"}
+}
+
+// updateManifest writes the manifest of the deployed tree, with the sources of its files and
+// the jobs that deployed it, returning the previous manifest (nil for the first one) and the new one
+func updateManifest(magentoRoot string, jobs []ManifestJob) (*Manifest, *Manifest, error) {
+	staticRoot := filepath.Join(magentoRoot, "pub/static")
+
+	previous, err := loadManifest(filepath.Join(staticRoot, manifestFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	current, err := buildManifest(staticRoot, hashAlgorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	current.addSources(magentoRoot, staticRoot, previous)
+	current.addJobs(jobs, previous)
+	if err := saveManifest(staticRoot, current); err != nil {
+		return nil, nil, err
+	}
+	return previous, current, nil
+}
+
+// writeReleaseNotes writes the release notes of the changes between the previous and the
+// current manifest (see updateManifest) to dest ('-' for stdout)
+func writeReleaseNotes(magentoRoot string, dest string, previous, current *Manifest) error {
+	staticRoot := filepath.Join(magentoRoot, "pub/static")
+
+	// Hashes of different algorithms can't be compared, so after changing the configured
+	// algorithm the tree is hashed once more with the previous one for the notes
+	compared := current
+	if previous != nil && previous.Algorithm != current.Algorithm {
+		var err error
+		if compared, err = buildManifest(staticRoot, previous.Algorithm); err != nil {
+			return err
+		}
+	}
+
+	notes := generateReleaseNotes(previous, compared)
+	if dest == "-" {
+		fmt.Print("\n" + notes)
+		return nil
+	}
+	return os.WriteFile(dest, []byte(notes), 0644)
+}
+
+// generateReleaseNotes summarizes the changes between two manifests for humans
+// Files are counted once per theme, regardless of how many locales contain them
+func generateReleaseNotes(old, new *Manifest) string {
+	diff := diffManifests(old, new)
+
+	type themeKey struct{ Area, Theme string }
+	type change struct {
+		action   string
+		category [2]string
+	}
+	themeChanges := make(map[themeKey]map[change]map[string]bool)
+	var otherChanges []string
+	totals := make(map[string]int) // action -> files, those of themes once for all locales
+
+	record := func(action string, relPath string) {
+		if relPath == "deployed_version.txt" {
+			return // Reported in the header
+		}
+		p, ok := splitStaticPath(relPath)
+		if !ok {
+			otherChanges = append(otherChanges, fmt.Sprintf("%s %s", relPath, action))
+			totals[action]++
+			return
+		}
+		if p.Rest == "" {
+			otherChanges = append(otherChanges, fmt.Sprintf("%s (%s): locale %s %s", p.Theme, p.Area, p.Locale, action))
+			totals[action]++
+			return
+		}
+		key := themeKey{p.Area, p.Theme}
+		if themeChanges[key] == nil {
+			themeChanges[key] = make(map[change]map[string]bool)
+		}
+		c := change{action, category(relPath)}
+		if themeChanges[key][c] == nil {
+			themeChanges[key][c] = make(map[string]bool)
+		}
+		if !themeChanges[key][c][p.Rest] {
+			themeChanges[key][c][p.Rest] = true
+			totals[action]++
+		}
+	}
+
+	for _, relPath := range diff.Added {
+		record("added", relPath)
+	}
+	for _, relPath := range diff.Changed {
+		record("changed", relPath)
+	}
+	for _, relPath := range diff.Removed {
+		record("removed", relPath)
+	}
+
+	var sb strings.Builder
+	oldVersion := "(none)"
+	if old != nil && old.Version != "" {
+		oldVersion = old.Version
+	}
+	fmt.Fprintf(&sb, "Static content changes %s → %s\n", oldVersion, new.Version)
+
+	if len(diff.Added)+len(diff.Changed)+len(diff.Removed) == 0 {
+		sb.WriteString("No static content changes\n")
+		return sb.String()
+	}
+
+	// Per theme: "Vendor/Hyva (frontend): 3 CSS changed, 1 image added"
+	keys := make([]themeKey, 0, len(themeChanges))
+	for key := range themeChanges {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Theme != keys[j].Theme {
+			return keys[i].Theme < keys[j].Theme
+		}
+		return keys[i].Area < keys[j].Area
+	})
+
+	for _, key := range keys {
+		var parts []string
+		for _, action := range []string{"changed", "added", "removed"} {
+			var changes []change
+			for c := range themeChanges[key] {
+				if c.action == action {
+					changes = append(changes, c)
+				}
+			}
+			sort.Slice(changes, func(i, j int) bool { return changes[i].category[0] < changes[j].category[0] })
+			for _, c := range changes {
+				count := len(themeChanges[key][c])
+				name := c.category[1]
+				if count == 1 {
+					name = c.category[0]
+				}
+				parts = append(parts, fmt.Sprintf("%d %s %s", count, name, action))
+			}
+		}
+		fmt.Fprintf(&sb, "- %s (%s): %s\n", key.Theme, key.Area, strings.Join(parts, ", "))
+	}
+
+	// Modules whose assets appeared or disappeared entirely
+	oldModules := manifestModules(old)
+	newModules := manifestModules(new)
+	for _, module := range sortedKeys(newModules) {
+		if !oldModules[module] {
+			fmt.Fprintf(&sb, "- New module assets from %s\n", module)
+		}
+	}
+	for _, module := range sortedKeys(oldModules) {
+		if !newModules[module] {
+			fmt.Fprintf(&sb, "- Module assets of %s removed\n", module)
+		}
+	}
+
+	for _, line := range otherChanges {
+		fmt.Fprintf(&sb, "- %s\n", line)
+	}
+
+	fmt.Fprintf(&sb, "Total: %d files added, %d changed, %d removed\n", totals["added"], totals["changed"], totals["removed"])
+	return sb.String()
+}
+
+// manifestModules returns the set of modules with files in the manifest
+func manifestModules(manifest *Manifest) map[string]bool {
+	modules := make(map[string]bool)
+	if manifest == nil {
+		return modules
+	}
+	for relPath := range manifest.Files {
+		if p, ok := splitStaticPath(relPath); ok && p.Module() != "" {
+			modules[p.Module()] = true
+		}
+	}
+	return modules
+}
+
+// sortedKeys returns the keys of a set (or any map) in sorted order
+func sortedKeys[V any](set map[string]V) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
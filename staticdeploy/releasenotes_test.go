@@ -0,0 +1,24 @@
+package staticdeploy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReleaseNotesTotalCountsFilesPerTheme(t *testing.T) {
+	old := &Manifest{Version: "1", Files: map[string]ManifestFile{
+		"frontend/Vendor/Hyva/en_US/css/styles.css": {Size: 1, Hash: "a"},
+		"frontend/Vendor/Hyva/nl_NL/css/styles.css": {Size: 1, Hash: "a"},
+	}}
+	new := &Manifest{Version: "2", Files: map[string]ManifestFile{
+		"frontend/Vendor/Hyva/en_US/css/styles.css": {Size: 1, Hash: "b"},
+		"frontend/Vendor/Hyva/nl_NL/css/styles.css": {Size: 1, Hash: "b"},
+		"frontend/Vendor/Hyva/en_US/js/app.js":      {Size: 1, Hash: "c"},
+		"frontend/Vendor/Hyva/nl_NL/js/app.js":      {Size: 1, Hash: "c"},
+	}}
+
+	notes := generateReleaseNotes(old, new)
+	if !strings.Contains(notes, "Total: 1 files added, 1 changed, 0 removed") {
+		t.Errorf("release notes don't count files once per theme:\n%s", notes)
+	}
+}
@@ -0,0 +1,220 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RemoteConfig configures the remote (object storage) target (the remote section of the config file)
+type RemoteConfig struct {
+	Target       string             `yaml:"target" json:"target"` // e.g. file:///mnt/cdn-origin/static, s3://bucket/static, gs://bucket/static or azure://account/container/static
+	Retention    RetentionConfig    `yaml:"retention" json:"retention"`
+	Concurrency  int                `yaml:"concurrency" json:"concurrency"` // parallel uploads (default 16)
+	CacheControl CacheControlConfig `yaml:"cache_control" json:"cache_control"`
+	S3           S3Config           `yaml:"s3" json:"s3"`
+	GCS          GCSConfig          `yaml:"gcs" json:"gcs"`
+	Azure        AzureConfig        `yaml:"azure" json:"azure"`
+}
+
+// CacheControlConfig sets the Cache-Control header of uploaded objects
+type CacheControlConfig struct {
+	Versioned string `yaml:"versioned" json:"versioned"` // below version prefixes (default: a year, immutable)
+	Default   string `yaml:"default" json:"default"`     // other objects (default: 5 minutes)
+}
+
+// RetentionConfig defines which deployed versions are kept on the remote target
+type RetentionConfig struct {
+	Keep   int    `yaml:"keep" json:"keep"`       // always keep the newest N versions
+	MaxAge string `yaml:"max_age" json:"max_age"` // also keep versions younger than this, e.g. 30d
+}
+
+// RemoteVersion is a versioned prefix on a remote target
+type RemoteVersion struct {
+	Name     string
+	Modified time.Time
+}
+
+// RemoteStore is a remote target holding one prefix per deployed content version,
+// next to a deployed_version.txt with the current version
+type RemoteStore interface {
+	// ListVersions returns the version prefixes; other prefixes are never listed
+	ListVersions() ([]RemoteVersion, error)
+	// CurrentVersion returns the content of deployed_version.txt, or "" if there is none
+	CurrentVersion() (string, error)
+	// DeleteVersion removes a version prefix and everything below it
+	DeleteVersion(name string) error
+	// ListObjects returns the fingerprint of every object, keyed by its slash separated path
+	// below the target
+	ListObjects() (map[string]string, error)
+	// Fingerprint returns the fingerprint of a local file as ListObjects returns it once uploaded
+	Fingerprint(path string) (string, error)
+	// PutObject uploads a local file with the given Content-Type and Cache-Control
+	PutObject(key string, path string, contentType string, cacheControl string) error
+	// DeleteObject removes an object
+	DeleteObject(key string) error
+	// String returns the target URL for messages
+	String() string
+}
+
+// remoteVersionPattern matches version prefixes: content versions (timestamps) with
+// an optional "version" prefix, as used in static URLs
+var remoteVersionPattern = regexp.MustCompile(`^(version)?[0-9]+$`)
+
+// openRemoteStore opens the remote target at a URL, resolving the credentials and HTTP client
+// of object storage
+func openRemoteStore(target string, magentoRoot string, cfg *Config) (RemoteStore, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote target %q: %w", target, err)
+	}
+
+	switch u.Scheme {
+	case "file", "":
+		root := u.Path
+		if u.Scheme == "" {
+			root = target
+		}
+		return &fileRemoteStore{root: root}, nil
+	case "s3":
+		return newS3RemoteStore(u, magentoRoot, cfg)
+	case "gs":
+		return newGCSRemoteStore(u, magentoRoot, cfg)
+	case "azure":
+		return newAzureRemoteStore(u, magentoRoot, cfg)
+	default:
+		return nil, fmt.Errorf("unsupported remote target scheme %q", u.Scheme)
+	}
+}
+
+// fileRemoteStore is a remote target on a (mounted) filesystem
+type fileRemoteStore struct {
+	root string
+}
+
+// remoteVersionsOf returns the version prefixes of the objects of a bucket, given by key and
+// modification time; a version was modified when its newest object was
+func remoteVersionsOf(objects map[string]time.Time) []RemoteVersion {
+	modified := make(map[string]time.Time)
+	for key, objectModified := range objects {
+		top, _, ok := strings.Cut(key, "/")
+		if !ok || !remoteVersionPattern.MatchString(top) {
+			continue
+		}
+		if objectModified.After(modified[top]) {
+			modified[top] = objectModified
+		}
+	}
+
+	versions := make([]RemoteVersion, 0, len(modified))
+	for _, name := range sortedKeys(modified) {
+		versions = append(versions, RemoteVersion{Name: name, Modified: modified[name]})
+	}
+	return versions
+}
+
+func (s *fileRemoteStore) ListVersions() ([]RemoteVersion, error) {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []RemoteVersion
+	for _, entry := range entries {
+		if !entry.IsDir() || !remoteVersionPattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, RemoteVersion{Name: entry.Name(), Modified: info.ModTime()})
+	}
+	return versions, nil
+}
+
+func (s *fileRemoteStore) CurrentVersion() (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.root, "deployed_version.txt"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+func (s *fileRemoteStore) DeleteVersion(name string) error {
+	if !remoteVersionPattern.MatchString(name) {
+		return fmt.Errorf("refusing to delete %q: not a version prefix", name)
+	}
+	return os.RemoveAll(filepath.Join(s.root, name))
+}
+
+// ListObjects fingerprints files by size and modification time, which PutObject keeps
+func (s *fileRemoteStore) ListObjects() (map[string]string, error) {
+	objects := make(map[string]string)
+	err := filepath.WalkDir(s.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == s.root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(s.root, path)
+		objects[filepath.ToSlash(relPath)] = fileFingerprint(info)
+		return nil
+	})
+	return objects, err
+}
+
+func (s *fileRemoteStore) Fingerprint(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fileFingerprint(info), nil
+}
+
+// PutObject copies the file; a filesystem has no headers
+func (s *fileRemoteStore) PutObject(key string, path string, contentType string, cacheControl string) error {
+	dst := filepath.Join(s.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	os.Remove(dst)
+	if err := copyFile(path, dst); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+func (s *fileRemoteStore) DeleteObject(key string) error {
+	err := os.Remove(filepath.Join(s.root, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// fileFingerprint identifies a file by its size and modification time
+func fileFingerprint(info os.FileInfo) string {
+	return fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano())
+}
+
+func (s *fileRemoteStore) String() string {
+	return "file://" + s.root
+}
@@ -0,0 +1,340 @@
+package staticdeploy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// remoteLiveHashAlgorithm is the hash of live trees read over SSH, computed by sha256sum on
+// the server so nothing needs to be installed there
+const remoteLiveHashAlgorithm = "sha256"
+
+func init() {
+	registerCommand(Command{
+		Name:        "remote-diff",
+		Description: "Compare the static content of two environments (local, SSH or HTTP)",
+		Run:         runRemoteDiff,
+	})
+}
+
+// runRemoteDiff implements the remote-diff subcommand
+func runRemoteDiff(args []string) error {
+	flags := flag.NewFlagSet("remote-diff", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory (for the config file)")
+	configPath := flags.StringP("config", "c", "", "Path to config file")
+	left := flags.String("left", "", "First environment: a path, file://, ssh://[user@]host[:port]/path or http(s):// manifest URL")
+	right := flags.String("right", "pub/static", "Second environment, in the same forms as --left")
+	live := flags.Bool("live", false, "Hash the live trees instead of reading their manifests")
+	sshCommand := flags.String("ssh", "ssh", "SSH command for ssh:// environments, e.g. 'ssh -i deploy_key'")
+	summary := flags.Bool("summary", false, "Only print the number of differing files per theme and module")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s remote-diff --left <location> [--right <location>] [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Compares the static content of two environments, by their manifests (written by --manifest)\n")
+		fmt.Fprintf(os.Stderr, "or, with --live, by hashing the trees; exits with status 1 when they diverge\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *left == "" {
+		flags.Usage()
+		return fmt.Errorf("--left is required")
+	}
+
+	cfg, err := loadConfig(*root, *configPath)
+	if err != nil {
+		return err
+	}
+	ssh, err := splitCommandLine(*sshCommand)
+	if err != nil || len(ssh) == 0 {
+		return fmt.Errorf("invalid --ssh command %q", *sshCommand)
+	}
+
+	leftSource, err := openDeploymentSource(*left, *live, ssh, cfg.HTTP)
+	if err != nil {
+		return err
+	}
+	rightSource, err := openDeploymentSource(*right, *live, ssh, cfg.HTTP)
+	if err != nil {
+		return err
+	}
+	leftManifest, rightManifest, err := resolveDeploymentSources(leftSource, rightSource)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Left:  %s (version %s)\n", *left, versionOrNone(leftManifest))
+	fmt.Printf("Right: %s (version %s)\n", *right, versionOrNone(rightManifest))
+	diff := diffManifests(leftManifest, rightManifest)
+	differing := len(diff.Added) + len(diff.Removed) + len(diff.Changed)
+	if differing == 0 {
+		fmt.Printf("%s Identical: %d files\n", symOK, len(rightManifest.Files))
+		return nil
+	}
+	fmt.Print(formatDeploymentDiff(leftManifest, rightManifest, *summary, true))
+	return fmt.Errorf("the environments diverge: %d of %d files differ", differing, len(rightManifest.Files)+len(diff.Removed))
+}
+
+// deploymentSource is one side of a comparison: a manifest, or a tree hashed on demand
+type deploymentSource struct {
+	name       string
+	manifest   *Manifest
+	hash       func(algorithm string) (*Manifest, error)
+	algorithms []string // algorithms hash supports, nil for all
+}
+
+// openDeploymentSource opens a location given to remote-diff; without live, directories are
+// represented by their manifest
+func openDeploymentSource(location string, live bool, ssh []string, httpCfg HTTPConfig) (*deploymentSource, error) {
+	u, err := url.Parse(location)
+	if err != nil || !strings.Contains(location, "://") {
+		return localDeploymentSource(location, !live)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return localDeploymentSource(u.Path, !live)
+	case "ssh":
+		if u.Host == "" || u.Path == "" {
+			return nil, fmt.Errorf("invalid SSH location %q, expected ssh://[user@]host[:port]/path", location)
+		}
+		if strings.HasPrefix(u.Hostname(), "-") || (u.User != nil && strings.HasPrefix(u.User.Username(), "-")) {
+			return nil, fmt.Errorf("invalid SSH location %q: host and user must not start with '-'", location)
+		}
+		return sshDeploymentSource(u, live, ssh)
+	case "http", "https":
+		if live {
+			return nil, fmt.Errorf("%s: --live needs a filesystem or SSH location, HTTP only serves manifests", location)
+		}
+		manifest, err := fetchManifest(location, httpCfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", u.Redacted(), err)
+		}
+		return &deploymentSource{name: u.Redacted(), manifest: manifest}, nil
+	default:
+		return nil, fmt.Errorf("unsupported location scheme %q (use a path, file://, ssh:// or https://)", u.Scheme)
+	}
+}
+
+// localDeploymentSource opens a manifest file or a static content directory; with
+// readManifest a directory is represented by the manifest in it
+func localDeploymentSource(location string, readManifest bool) (*deploymentSource, error) {
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestPath := location
+	if info.IsDir() {
+		if !readManifest {
+			return &deploymentSource{
+				name: location,
+				hash: func(algorithm string) (*Manifest, error) { return buildManifest(location, algorithm) },
+			}, nil
+		}
+		manifestPath = filepath.Join(location, manifestFileName)
+	}
+
+	manifest, err := loadManifest(manifestPath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no manifest at %s, deploy with --manifest or compare with --live", manifestPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &deploymentSource{name: location, manifest: manifest}, nil
+}
+
+// sshDeploymentSource reads the manifest of a remote directory (or a remote manifest file)
+// over SSH or, with live, lists and hashes the remote tree with find and sha256sum
+func sshDeploymentSource(u *url.URL, live bool, ssh []string) (*deploymentSource, error) {
+	name := u.Redacted()
+	dir := u.Path
+
+	if !live {
+		script := fmt.Sprintf("if [ -d %[1]s ]; then cat %[1]s/%[2]s; else cat %[1]s; fi", shellQuote(dir), manifestFileName)
+		output, err := runSSH(u, ssh, script)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w (deploy with --manifest or compare with --live)", name, err)
+		}
+		manifest, err := parseManifest(output)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return &deploymentSource{name: name, manifest: manifest}, nil
+	}
+
+	return &deploymentSource{
+		name:       name,
+		algorithms: []string{remoteLiveHashAlgorithm},
+		hash: func(algorithm string) (*Manifest, error) {
+			// GNU find lists links and sizes, sha256sum hashes the regular files
+			script := fmt.Sprintf("cd %s && printf 'V\\t%%s\\n' \"$(cat deployed_version.txt 2>/dev/null)\" && "+
+				"find . \\( -type l -printf 'L\\t%%P\\t%%l\\n' \\) -o \\( -type f -printf 'F\\t%%P\\t%%s\\n' \\) && "+
+				"find . -type f -exec sha256sum {} +", shellQuote(dir))
+			output, err := runSSH(u, ssh, script)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			return parseRemoteListing(output)
+		},
+	}, nil
+}
+
+// runSSH runs a shell script on the host of an ssh:// URL and returns its output
+func runSSH(u *url.URL, ssh []string, script string) ([]byte, error) {
+	if err := requireNetwork("SSH"); err != nil {
+		return nil, err
+	}
+
+	args := append([]string{}, ssh[1:]...)
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	host := u.Hostname()
+	if u.User != nil {
+		host = u.User.Username() + "@" + host
+	}
+	// The host is never read as an option of ssh
+	args = append(args, "--", host, script)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(ssh[0], args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+	return output, nil
+}
+
+// parseRemoteListing builds a manifest from the output of the live SSH listing script
+func parseRemoteListing(output []byte) (*Manifest, error) {
+	manifest := &Manifest{
+		Format:    manifestFormat,
+		Algorithm: remoteLiveHashAlgorithm,
+		Generated: time.Now().UTC(),
+		Files:     make(map[string]ManifestFile),
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.SplitN(line, "\t", 3)
+		switch {
+		case fields[0] == "V" && len(fields) == 2:
+			manifest.Version = strings.TrimSpace(fields[1])
+		case fields[0] == "L" && len(fields) == 3:
+			if !isManifestMetaFile(fields[1]) {
+				manifest.Files[fields[1]] = ManifestFile{Link: fields[2]}
+			}
+		case fields[0] == "F" && len(fields) == 3:
+			var size int64
+			if _, err := fmt.Sscan(fields[2], &size); err != nil {
+				return nil, fmt.Errorf("unexpected listing line %q", line)
+			}
+			if !isManifestMetaFile(fields[1]) {
+				file := manifest.Files[fields[1]]
+				file.Size = size
+				manifest.Files[fields[1]] = file
+			}
+		default:
+			// sha256sum: "<hash>  ./<path>"
+			hash, relPath, ok := strings.Cut(line, "  ")
+			if !ok || !validHexHash(hash, 32) {
+				return nil, fmt.Errorf("unexpected listing line %q", line)
+			}
+			relPath = strings.TrimPrefix(relPath, "./")
+			if file, ok := manifest.Files[relPath]; ok {
+				file.Hash = hash
+				manifest.Files[relPath] = file
+			}
+		}
+	}
+	return manifest, scanner.Err()
+}
+
+// fetchManifest downloads a manifest, e.g. the one served from a CDN origin
+func fetchManifest(location string, httpCfg HTTPConfig) (*Manifest, error) {
+	client, err := NewHTTPClient(httpCfg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseManifest(data)
+}
+
+// resolveDeploymentSources returns the manifests of both sides, hashing trees with the
+// algorithm of the manifest on the other side (or one both trees support), so the hashes
+// are comparable
+func resolveDeploymentSources(left, right *deploymentSource) (*Manifest, *Manifest, error) {
+	algorithm := ""
+	for _, source := range []*deploymentSource{left, right} {
+		if source.manifest == nil {
+			continue
+		}
+		if algorithm != "" && algorithm != source.manifest.Algorithm {
+			return nil, nil, fmt.Errorf("the manifests use different hash algorithms (%s and %s), compare the trees instead",
+				algorithm, source.manifest.Algorithm)
+		}
+		algorithm = source.manifest.Algorithm
+	}
+	if algorithm == "" {
+		algorithm = hashAlgorithm
+		for _, source := range []*deploymentSource{left, right} {
+			if source.algorithms != nil {
+				algorithm = source.algorithms[0]
+			}
+		}
+	}
+
+	manifests := make([]*Manifest, 2)
+	for i, source := range []*deploymentSource{left, right} {
+		if source.manifest != nil {
+			manifests[i] = source.manifest
+			continue
+		}
+		if source.algorithms != nil && !slices.Contains(source.algorithms, algorithm) {
+			return nil, nil, fmt.Errorf("%s can only be hashed with %s, but the other side uses %s",
+				source.name, strings.Join(source.algorithms, ", "), algorithm)
+		}
+		manifest, err := source.hash(algorithm)
+		if err != nil {
+			return nil, nil, err
+		}
+		manifests[i] = manifest
+	}
+	return manifests[0], manifests[1], nil
+}
@@ -0,0 +1,249 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Defaults of uploads to remote targets
+const (
+	defaultRemoteConcurrency     = 16
+	defaultVersionedCacheControl = "public, max-age=31536000, immutable"
+	defaultRemoteCacheControl    = "public, max-age=300"
+)
+
+// remoteContentTypes are the types of static files mime.TypeByExtension doesn't know on
+// every system (it reads /etc/mime.types)
+var remoteContentTypes = map[string]string{
+	".css":   "text/css; charset=utf-8",
+	".js":    "application/javascript; charset=utf-8",
+	".mjs":   "application/javascript; charset=utf-8",
+	".json":  "application/json",
+	".map":   "application/json",
+	".html":  "text/html; charset=utf-8",
+	".txt":   "text/plain; charset=utf-8",
+	".svg":   "image/svg+xml",
+	".png":   "image/png",
+	".jpg":   "image/jpeg",
+	".jpeg":  "image/jpeg",
+	".gif":   "image/gif",
+	".webp":  "image/webp",
+	".avif":  "image/avif",
+	".ico":   "image/x-icon",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".eot":   "application/vnd.ms-fontobject",
+	".xml":   "application/xml",
+	".gz":    "application/gzip",
+	".br":    "application/x-brotli",
+}
+
+// RemoteUploadReport summarizes an upload to a remote target
+type RemoteUploadReport struct {
+	Target    string
+	Uploaded  int
+	Unchanged int
+	Deleted   int
+	Bytes     int64
+	Version   string
+	Changed   []string // keys of the replaced and deleted objects, which CDNs may have cached
+}
+
+// uploadToRemote makes the remote target hold the deployed static tree, uploading only the
+// files whose fingerprint differs. Like the standby mirror, deployed_version.txt is uploaded
+// after all other files and stale objects are deleted last; version prefixes the tree doesn't
+// have any more are left to gc-remote and its retention
+func uploadToRemote(store RemoteStore, staticRoot string, cfg RemoteConfig, verbose bool) (RemoteUploadReport, error) {
+	report := RemoteUploadReport{Target: store.String()}
+
+	files, err := listUploadFiles(staticRoot)
+	if err != nil {
+		return report, fmt.Errorf("failed to scan %s: %w", staticRoot, err)
+	}
+	objects, err := store.ListObjects()
+	if err != nil {
+		return report, fmt.Errorf("failed to list %s: %w", store, err)
+	}
+
+	const versionFile = "deployed_version.txt"
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		if key != versionFile {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var uploaded, unchanged int64
+	var bytes int64
+	var changedMu sync.Mutex
+	upload := func(key string) error {
+		local := files[key]
+		fingerprint, err := store.Fingerprint(local)
+		if err != nil {
+			return err
+		}
+		if objects[key] == fingerprint {
+			atomic.AddInt64(&unchanged, 1)
+			return nil
+		}
+		info, err := os.Stat(local)
+		if err != nil {
+			return err
+		}
+		if err := store.PutObject(key, local, remoteContentType(key), remoteCacheControl(key, cfg.CacheControl)); err != nil {
+			return err
+		}
+		atomic.AddInt64(&uploaded, 1)
+		atomic.AddInt64(&bytes, info.Size())
+		if _, ok := objects[key]; ok {
+			changedMu.Lock()
+			report.Changed = append(report.Changed, key)
+			changedMu.Unlock()
+		}
+		if verbose {
+			logDebugf("  %s %s", symArrow, key)
+		}
+		return nil
+	}
+
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultRemoteConcurrency
+	}
+	firstErr := forEachKey(keys, concurrency, func(key string) error {
+		if err := upload(key); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+		return nil
+	})
+
+	report.Uploaded, report.Unchanged, report.Bytes = int(uploaded), int(unchanged), bytes
+	if firstErr != nil {
+		return report, firstErr
+	}
+
+	// Switch the target to the new version once all of its files are present
+	if _, ok := files[versionFile]; ok {
+		if err := upload(versionFile); err != nil {
+			return report, fmt.Errorf("failed to upload %s: %w", versionFile, err)
+		}
+		report.Uploaded, report.Unchanged, report.Bytes = int(uploaded), int(unchanged), bytes
+		if data, err := os.ReadFile(files[versionFile]); err == nil {
+			report.Version = strings.TrimSpace(string(data))
+		}
+	}
+
+	for _, key := range sortedKeys(objects) {
+		top, _, _ := strings.Cut(key, "/")
+		if _, ok := files[key]; ok || (top != key && remoteVersionPattern.MatchString(top)) {
+			continue
+		}
+		if err := store.DeleteObject(key); err != nil {
+			return report, fmt.Errorf("failed to delete stale %s: %w", key, err)
+		}
+		report.Deleted++
+		report.Changed = append(report.Changed, key)
+	}
+	sort.Strings(report.Changed)
+	return report, nil
+}
+
+// forEachKey calls fn for every key with up to concurrency calls at a time and returns the
+// first error
+func forEachKey(keys []string, concurrency int, fn func(key string) error) error {
+	keyChan := make(chan string)
+	var firstErr error
+	var errOnce sync.Once
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keyChan {
+				if err := fn(key); err != nil {
+					errOnce.Do(func() { firstErr = err })
+				}
+			}
+		}()
+	}
+	for _, key := range keys {
+		keyChan <- key
+	}
+	close(keyChan)
+	wg.Wait()
+	return firstErr
+}
+
+// listUploadFiles lists the files below root by their slash separated key, following the
+// symlinks of --symlink and --mode=symlink deploys, as objects can't be links
+func listUploadFiles(root string) (map[string]string, error) {
+	files := make(map[string]string)
+	var walk func(dir string, prefix string) error
+	walk = func(dir string, prefix string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			fullPath := filepath.Join(dir, entry.Name())
+			key := path.Join(prefix, entry.Name())
+			info, err := os.Stat(fullPath)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if err := walk(fullPath, key); err != nil {
+					return err
+				}
+				continue
+			}
+			// The previous manifest and the checksums are bookkeeping of the local tree
+			if key != manifestFileName && key != manifestSignatureFileName && isManifestMetaFile(key) {
+				continue
+			}
+			files[key] = fullPath
+		}
+		return nil
+	}
+	return files, walk(root, "")
+}
+
+// remoteContentType returns the Content-Type of an object by its extension
+func remoteContentType(key string) string {
+	ext := strings.ToLower(path.Ext(key))
+	if contentType, ok := remoteContentTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// remoteCacheControl returns the Cache-Control of an object: files below a version prefix
+// never change, deployed_version.txt and the manifest and its signature must be revalidated
+func remoteCacheControl(key string, cfg CacheControlConfig) string {
+	if key == "deployed_version.txt" || key == manifestFileName || key == manifestSignatureFileName {
+		return "no-cache"
+	}
+	if top, _, ok := strings.Cut(key, "/"); ok && remoteVersionPattern.MatchString(top) {
+		if cfg.Versioned != "" {
+			return cfg.Versioned
+		}
+		return defaultVersionedCacheControl
+	}
+	if cfg.Default != "" {
+		return cfg.Default
+	}
+	return defaultRemoteCacheControl
+}
@@ -0,0 +1,108 @@
+package staticdeploy
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// outputFormat is the format of the results on stdout: text, or json for the report
+// (--output); with json all other output goes to stderr
+var outputFormat string
+
+// Report is the machine-readable summary of a deployment run
+type Report struct {
+	Version   string          `json:"version"`
+	Started   time.Time       `json:"started"`
+	Duration  float64         `json:"duration_seconds"`
+	Success   bool            `json:"success"`
+	Files     int64           `json:"files"`
+	Totals    ReportTotals    `json:"totals"`
+	Jobs      []ReportJob     `json:"jobs"`
+	Commands  []ReportCommand `json:"commands,omitempty"` // bin/magento commands of magento_commands
+	Errors    []string        `json:"errors,omitempty"`
+	Warnings  []string        `json:"warnings,omitempty"` // about the job matrix, see checkJobMatrix
+	Resources *ResourceUsage  `json:"resources,omitempty"`
+}
+
+// ReportJob is the result of a single deployment job in the report
+type ReportJob struct {
+	Area          string  `json:"area"`
+	Theme         string  `json:"theme"`
+	Locale        string  `json:"locale"`
+	Files         int64   `json:"files"`
+	Duration      float64 `json:"duration_seconds"`
+	SymlinkTarget string  `json:"symlink_target,omitempty"`
+	Error         string  `json:"error,omitempty"`
+	Attempts      int     `json:"attempts,omitempty"` // more than 1 when the job was retried
+}
+
+// ReportTotals counts the jobs of the report by outcome
+type ReportTotals struct {
+	Jobs           int     `json:"jobs"`
+	Succeeded      int     `json:"succeeded"`
+	Failed         int     `json:"failed"`
+	Skipped        int     `json:"skipped"` // theme not found
+	Retried        int     `json:"retried"`
+	FilesPerSecond float64 `json:"files_per_second"`
+}
+
+// addResults adds deployment results to the report
+func (r *Report) addResults(results []DeployResult) {
+	for _, result := range results {
+		r.Jobs = append(r.Jobs, ReportJob{
+			Area:          result.Job.Area,
+			Theme:         result.Job.Theme,
+			Locale:        result.Job.Locale,
+			Files:         result.FilesCount,
+			Duration:      result.Duration.Seconds(),
+			SymlinkTarget: result.SymlinkTarget,
+			Error:         result.Error,
+			Attempts:      result.Attempts,
+		})
+		r.Files += result.FilesCount
+		if result.Error != "" {
+			r.Errors = append(r.Errors, result.Error)
+		}
+	}
+}
+
+// finish completes the report at the end of the run: duration, outcome and totals
+func (r *Report) finish(version string, success bool) {
+	r.Version = version
+	r.Duration = time.Since(r.Started).Seconds()
+	r.Success = success
+
+	r.Totals = ReportTotals{Jobs: len(r.Jobs)}
+	for _, job := range r.Jobs {
+		switch {
+		case job.Error != "":
+			r.Totals.Failed++
+		case job.Files == 0 && job.SymlinkTarget == "":
+			r.Totals.Skipped++
+		default:
+			r.Totals.Succeeded++
+		}
+		if job.Attempts > 1 {
+			r.Totals.Retried++
+		}
+	}
+	if r.Duration > 0 {
+		r.Totals.FilesPerSecond = float64(r.Files) / r.Duration
+	}
+}
+
+// writeReport writes the report as JSON to path ('-' for stdout)
+func writeReport(path string, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if path == "-" {
+		_, err = runStdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
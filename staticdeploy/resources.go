@@ -0,0 +1,85 @@
+package staticdeploy
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// resourceSampleInterval is how often goroutines and open file descriptors are sampled
+const resourceSampleInterval = 50 * time.Millisecond
+
+// ResourceUsage is the resource consumption of a run, for sizing CI runners and containers
+type ResourceUsage struct {
+	PeakRSSBytes         int64   `json:"peak_rss_bytes"`       // of the deployer itself
+	ChildPeakRSSBytes    int64   `json:"child_peak_rss_bytes"` // largest child process (PHP, build hooks)
+	CPUSeconds           float64 `json:"cpu_seconds"`          // user + system time of the deployer
+	ChildCPUSeconds      float64 `json:"child_cpu_seconds"`    // user + system time of all child processes
+	PeakGoroutines       int     `json:"peak_goroutines"`      // sampled
+	PeakOpenFiles        int     `json:"peak_open_files"`      // sampled, -1 when unsupported
+	SampleIntervalMillis int64   `json:"sample_interval_millis"`
+}
+
+// resourceMonitor samples goroutine and file descriptor counts in the background
+type resourceMonitor struct {
+	mu             sync.Mutex
+	peakGoroutines int
+	peakOpenFiles  int
+	stop           chan struct{}
+	done           chan struct{}
+}
+
+// startResourceMonitor starts sampling until Stop is called
+func startResourceMonitor() *resourceMonitor {
+	m := &resourceMonitor{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	m.sample()
+
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(resourceSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.sample()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+
+	return m
+}
+
+// sample records the current goroutine and open file counts if they're new highs
+func (m *resourceMonitor) sample() {
+	goroutines := runtime.NumGoroutine()
+	openFiles := countOpenFiles()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if goroutines > m.peakGoroutines {
+		m.peakGoroutines = goroutines
+	}
+	if openFiles > m.peakOpenFiles || openFiles < 0 {
+		m.peakOpenFiles = openFiles
+	}
+}
+
+// Stop ends sampling and returns the resource usage of the run so far
+func (m *resourceMonitor) Stop() ResourceUsage {
+	close(m.stop)
+	<-m.done
+	m.sample()
+
+	usage := processUsage()
+	m.mu.Lock()
+	usage.PeakGoroutines = m.peakGoroutines
+	usage.PeakOpenFiles = m.peakOpenFiles
+	m.mu.Unlock()
+	usage.SampleIntervalMillis = resourceSampleInterval.Milliseconds()
+	return usage
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package staticdeploy
+
+// processUsage is not supported on this platform; only the sampled values are reported
+func processUsage() ResourceUsage {
+	return ResourceUsage{}
+}
+
+// countOpenFiles is not supported on this platform
+func countOpenFiles() int {
+	return -1
+}
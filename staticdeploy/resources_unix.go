@@ -0,0 +1,56 @@
+//go:build unix
+
+package staticdeploy
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// processUsage returns the RSS and CPU usage of the process and its children
+func processUsage() ResourceUsage {
+	var usage ResourceUsage
+
+	var self, children syscall.Rusage
+	if syscall.Getrusage(syscall.RUSAGE_SELF, &self) == nil {
+		usage.PeakRSSBytes = maxRSSBytes(self.Maxrss)
+		usage.CPUSeconds = cpuSeconds(self)
+	}
+	if syscall.Getrusage(syscall.RUSAGE_CHILDREN, &children) == nil {
+		usage.ChildPeakRSSBytes = maxRSSBytes(children.Maxrss)
+		usage.ChildCPUSeconds = cpuSeconds(children)
+	}
+
+	return usage
+}
+
+// maxRSSBytes converts ru_maxrss to bytes; it's reported in bytes on macOS, kilobytes elsewhere
+func maxRSSBytes(maxrss int64) int64 {
+	if runtime.GOOS == "darwin" {
+		return maxrss
+	}
+	return maxrss * 1024
+}
+
+// cpuSeconds returns the user + system time of a rusage
+func cpuSeconds(ru syscall.Rusage) float64 {
+	return (time.Duration(ru.Utime.Nano()) + time.Duration(ru.Stime.Nano())).Seconds()
+}
+
+// countOpenFiles returns the number of open file descriptors, or -1 if unknown
+func countOpenFiles() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		f, err := os.Open(dir)
+		if err != nil {
+			continue
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err == nil {
+			return len(names) - 1 // minus the descriptor used for reading the directory
+		}
+	}
+	return -1
+}
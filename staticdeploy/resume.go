@@ -0,0 +1,151 @@
+package staticdeploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runStateFile records the progress of the current run per job, so an interrupted run can be
+// continued with --resume; it's removed when a run succeeds
+const runStateFile = "var/.static-deploy-state.json"
+
+// resumeRun continues an interrupted run (--resume)
+var resumeRun bool
+
+// RunState is the content of the run state file
+type RunState struct {
+	Version string              `json:"version"`
+	Options string              `json:"options"` // options affecting the deployed files, see deployOptionsKey
+	Started time.Time           `json:"started"`
+	Jobs    map[string]JobState `json:"jobs"` // by jobLabel
+}
+
+// JobState is the progress of a single job; jobs are recorded when they start, so a job
+// that isn't done was interrupted or failed
+type JobState struct {
+	Done  bool  `json:"done"`
+	Files int64 `json:"files"`
+}
+
+// runStateTracker persists the RunState as jobs start and finish
+// All methods are no-ops on a nil tracker
+type runStateTracker struct {
+	path     string
+	mu       sync.Mutex
+	state    RunState
+	previous *RunState // state of the interrupted run being resumed, nil otherwise
+}
+
+// deployState tracks the jobs of the run, nil until the deployment starts
+var deployState *runStateTracker
+
+// newRunStateTracker starts tracking a run; previous is the state of the run it resumes
+func newRunStateTracker(magentoRoot string, version string, options string, previous *RunState) *runStateTracker {
+	return &runStateTracker{
+		path:     filepath.Join(magentoRoot, runStateFile),
+		state:    RunState{Version: version, Options: options, Started: time.Now(), Jobs: make(map[string]JobState)},
+		previous: previous,
+	}
+}
+
+// loadRunState reads the state of an interrupted run, nil when there is none
+func loadRunState(magentoRoot string) (*RunState, error) {
+	path := filepath.Join(magentoRoot, runStateFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state RunState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid run state %s: %w", path, err)
+	}
+	if state.Jobs == nil {
+		state.Jobs = make(map[string]JobState)
+	}
+	return &state, nil
+}
+
+// deployOptionsKey describes the options that change what a job writes; a run can only be
+// resumed with the same options
+func deployOptionsKey(excludes []string) string {
+	return strings.Join([]string{
+		"mode=" + deployMode,
+		"symlink=" + symlinkMode,
+		"images=" + imagesMode,
+		fmt.Sprintf("versioned-dirs=%t", versionedDirs),
+		fmt.Sprintf("minify=%t", minifyAssets),
+		"exclude=" + strings.Join(excludes, ","),
+	}, " ")
+}
+
+// Completed returns the state of a job the resumed run completed
+func (t *runStateTracker) Completed(job DeployJob) (JobState, bool) {
+	if t == nil || t.previous == nil {
+		return JobState{}, false
+	}
+	state, ok := t.previous.Jobs[jobLabel(job)]
+	return state, ok && state.Done
+}
+
+// Interrupted reports whether the resumed run started a job without completing it; its
+// files are then compared instead of forced, so those already placed aren't copied again
+func (t *runStateTracker) Interrupted(job DeployJob) bool {
+	if t == nil || t.previous == nil {
+		return false
+	}
+	state, ok := t.previous.Jobs[jobLabel(job)]
+	return ok && !state.Done
+}
+
+// Resumed records a job completed by the resumed run as completed by this run
+func (t *runStateTracker) Resumed(job DeployJob, state JobState) {
+	t.record(job, state)
+}
+
+// JobStarted records the start of a job
+func (t *runStateTracker) JobStarted(job DeployJob) {
+	t.record(job, JobState{})
+}
+
+// JobDone records a successfully deployed job with its number of files
+func (t *runStateTracker) JobDone(job DeployJob, files int64) {
+	t.record(job, JobState{Done: true, Files: files})
+}
+
+// record updates the state of a job and writes the state file; failures are ignored, the
+// state must not fail the deployment
+func (t *runStateTracker) record(job DeployJob, state JobState) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.state.Jobs[jobLabel(job)] = state
+
+	data, err := json.MarshalIndent(t.state, "", "  ")
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(t.path), 0755) == nil {
+		writeFileAtomic(t.path, data, 0644)
+	}
+}
+
+// Finish removes the state file after a successful run; after a failed one it's kept, so
+// --resume only repeats the failed and remaining jobs
+func (t *runStateTracker) Finish(success bool) {
+	if t == nil || !success {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	os.Remove(t.path)
+}
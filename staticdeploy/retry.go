@@ -0,0 +1,63 @@
+package staticdeploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Retries of failed jobs (--retries) and of failed copies of single files (--file-retries),
+// waiting retryWait before the first retry and twice as long before every next one
+var (
+	jobRetries  int
+	fileRetries int
+	retryWait   time.Duration
+)
+
+// maxRetryWait caps the backoff between retries
+const maxRetryWait = time.Minute
+
+// retryableJobError reports whether a failed job may succeed when run again, e.g. after a
+// transient NFS error. Missing themes, full disks, timeouts and stopped runs fail again
+func retryableJobError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, errInterrupted) {
+		return false
+	}
+	var full *diskFullError
+	var timeout *timeoutError
+	if errors.As(err, &full) || errors.As(err, &timeout) {
+		return false
+	}
+	return !strings.Contains(err.Error(), "theme directory not found") && !strings.Contains(err.Error(), "invalid theme name")
+}
+
+// retryBackoff returns the wait before the given retry (1 for the first)
+func retryBackoff(retry int) time.Duration {
+	wait := retryWait
+	for i := 1; i < retry && wait < maxRetryWait; i++ {
+		wait *= 2
+	}
+	return min(wait, maxRetryWait)
+}
+
+// sleepRetry waits for the backoff of a retry; false when ctx stopped the run meanwhile
+func sleepRetry(ctx context.Context, retry int) bool {
+	timer := time.NewTimer(retryBackoff(retry))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// attemptsNote describes the attempts of a job for output, empty when it ran once
+func attemptsNote(attempts int) string {
+	if attempts <= 1 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d attempts)", attempts)
+}
@@ -0,0 +1,186 @@
+package staticdeploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// onlyJobs limits the deployment to these area/Vendor/theme/locale jobs (--only-job)
+var onlyJobs []string
+
+func init() {
+	registerCommand(Command{
+		Name:        "retry-failed",
+		Description: "Redeploy only the jobs that failed in the run of a report, with its content version",
+		Run:         runRetryFailed,
+	})
+}
+
+// runRetryFailed implements the retry-failed subcommand
+func runRetryFailed(args []string) error {
+	flags := flag.NewFlagSet("retry-failed", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory")
+	reportPath := flags.String("report", "", "Report of the failed run, written with --report (required)")
+	dryRun := flags.Bool("dry-run", false, "Only print the deploy command")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s retry-failed --report <file> [options] [-- deploy options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Redeploys the jobs that failed in the run of the report with the same content version, so\n")
+		fmt.Fprintf(os.Stderr, "the version becomes complete without a full rerun. Deploy options after -- are passed on\n")
+		fmt.Fprintf(os.Stderr, "(e.g. -- --symlink=locale -j 4); the report is replaced by that of the retry\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *reportPath == "" {
+		flags.Usage()
+		return fmt.Errorf("--report is required")
+	}
+
+	report, err := loadReport(*reportPath)
+	if err != nil {
+		return err
+	}
+	failed := failedReportJobs(report)
+	for _, message := range report.Errors {
+		if strings.HasPrefix(message, "deploying Luma themes") {
+			fmt.Fprintf(os.Stderr, "Note: Luma themes failed in bin/magento and aren't retried, redeploy them with -t\n")
+		}
+	}
+	if len(failed) == 0 {
+		fmt.Printf("No failed jobs in %s\n", *reportPath)
+		return nil
+	}
+	if err := checkVersionStillValid(*root, report); err != nil {
+		return err
+	}
+
+	deployArgs := retryDeployArgs(*root, *reportPath, report.Version, failed, flags.Args())
+	fmt.Printf("Retrying %d failed job(s) of version %s:\n", len(failed), report.Version)
+	for _, job := range failed {
+		fmt.Printf("  %s\n", jobLabel(job))
+	}
+	quoted := make([]string, len(deployArgs))
+	for i, arg := range deployArgs {
+		quoted[i] = shellQuote(arg)
+	}
+	fmt.Printf("%s %s\n\n", os.Args[0], strings.Join(quoted, " "))
+	if *dryRun {
+		return nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(self, deployArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("retry failed: %w", err)
+	}
+	return nil
+}
+
+// loadReport reads a report written with --report
+func loadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid report %s: %w", path, err)
+	}
+	if report.Version == "" {
+		return nil, fmt.Errorf("report %s has no content version", path)
+	}
+	return &report, nil
+}
+
+// failedReportJobs returns the jobs of a report that failed; skipped themes have no error
+func failedReportJobs(report *Report) []DeployJob {
+	var jobs []DeployJob
+	for _, job := range report.Jobs {
+		if job.Error != "" {
+			jobs = append(jobs, DeployJob{Area: job.Area, Theme: job.Theme, Locale: job.Locale})
+		}
+	}
+	return jobs
+}
+
+// checkVersionStillValid refuses to retry when another version was deployed after the run of
+// the report, as its jobs would then mix two versions
+func checkVersionStillValid(magentoRoot string, report *Report) error {
+	versionFile := filepath.Join(magentoRoot, "pub/static/deployed_version.txt")
+	info, err := os.Stat(versionFile)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(versionFile)
+	if err != nil {
+		return err
+	}
+	deployed := strings.TrimSpace(string(data))
+
+	end := report.Started.Add(time.Duration(report.Duration * float64(time.Second)))
+	if deployed != report.Version && info.ModTime().After(end) {
+		return fmt.Errorf("version %s was deployed after the run of the report (version %s), deploy all jobs instead", deployed, report.Version)
+	}
+	return nil
+}
+
+// retryDeployArgs builds the deploy arguments redeploying the failed jobs: their areas,
+// themes and locales limited to the failed combinations with --only-job
+func retryDeployArgs(magentoRoot string, reportPath string, version string, failed []DeployJob, extra []string) []string {
+	args := []string{"-r", magentoRoot, "--content-version=" + version, "--report=" + reportPath, "--no-default-area-themes"}
+
+	var areas, themes, locales []string
+	for _, job := range failed {
+		areas = appendUnique(areas, job.Area)
+		themes = appendUnique(themes, job.Theme)
+		locales = appendUnique(locales, job.Locale)
+		args = append(args, "--only-job="+job.Area+"/"+job.Theme+"/"+job.Locale)
+	}
+	for _, area := range areas {
+		args = append(args, "-a", area)
+	}
+	for _, theme := range themes {
+		args = append(args, "-t", theme)
+	}
+	args = append(args, extra...)
+	return append(args, locales...)
+}
+
+// filterOnlyJobs keeps the jobs named by --only-job (area/Vendor/theme/locale)
+func filterOnlyJobs(jobs []DeployJob, specs []string) ([]DeployJob, error) {
+	wanted := make(map[DeployJob]bool)
+	for _, spec := range specs {
+		parts := strings.Split(spec, "/")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid --only-job %q, expected area/Vendor/theme/locale", spec)
+		}
+		wanted[DeployJob{Area: parts[0], Theme: parts[1] + "/" + parts[2], Locale: parts[3]}] = true
+	}
+
+	var filtered []DeployJob
+	for _, job := range jobs {
+		if wanted[job] {
+			filtered = append(filtered, job)
+			delete(wanted, job)
+		}
+	}
+	for job := range wanted {
+		logWarnf("--only-job %s/%s/%s is not in the job matrix", job.Area, job.Theme, job.Locale)
+	}
+	return filtered, nil
+}
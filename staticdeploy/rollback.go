@@ -0,0 +1,126 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// previousTreeDir holds the copy of pub/static from before the last deploy (--keep-previous)
+// It's at the same depth as pub/static, so relative symlinks to the sources stay valid
+const previousTreeDir = "var/.static-deploy-previous"
+
+// keepPrevious copies pub/static to previousTreeDir before deploying (--keep-previous)
+var keepPrevious bool
+
+// snapshotPreviousTree updates the copy of the deployed tree that rollback restores
+// Nothing is kept when nothing was deployed yet; versioned directories keep the previous
+// version by themselves
+func snapshotPreviousTree(magentoRoot string, verbose bool) error {
+	staticRoot := filepath.Join(magentoRoot, "pub/static")
+	if _, err := os.Stat(filepath.Join(staticRoot, "deployed_version.txt")); err != nil {
+		return nil
+	}
+	if currentDeployRoot(magentoRoot) != staticRoot {
+		return nil
+	}
+
+	report, err := mirrorStaticTree(staticRoot, filepath.Join(magentoRoot, previousTreeDir), false)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		logDebugf("%s Kept previous deployment %s (%d copied, %d removed)", symOK, report.Version, report.Copied, report.Deleted)
+	}
+	return nil
+}
+
+func init() {
+	registerCommand(Command{
+		Name:        "rollback",
+		Description: "Restore the deployment from before the last deploy",
+		Run:         runRollback,
+	})
+}
+
+// runRollback implements the rollback subcommand
+func runRollback(args []string) error {
+	flags := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory")
+	to := flags.String("to", "", "With versioned directories, the version to switch to (default: the one before the current)")
+	verbose := flags.BoolP("verbose", "v", false, "List every restored file")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s rollback [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Restores the copy of pub/static kept by --keep-previous, or switches deployed_version.txt\n")
+		fmt.Fprintf(os.Stderr, "to the previous pub/static/version{N} directory when deploying with --versioned-dirs\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	staticRoot := filepath.Join(*root, "pub/static")
+	current := ""
+	if data, err := os.ReadFile(filepath.Join(staticRoot, "deployed_version.txt")); err == nil {
+		current = strings.TrimSpace(string(data))
+	}
+
+	if currentDeployRoot(*root) != staticRoot || *to != "" {
+		version := *to
+		if version == "" {
+			var err error
+			if version, err = previousVersionDir(staticRoot, current); err != nil {
+				return err
+			}
+		}
+		if info, err := os.Stat(filepath.Join(staticRoot, "version"+version)); err != nil || !info.IsDir() {
+			return fmt.Errorf("version directory version%s not found in %s", version, staticRoot)
+		}
+		if err := writeFileAtomic(filepath.Join(staticRoot, "deployed_version.txt"), []byte(version), 0644); err != nil {
+			return fmt.Errorf("failed to switch deployed_version.txt: %w", err)
+		}
+		fmt.Printf("Rolled back from version %s to %s\n", current, version)
+		return nil
+	}
+
+	previousRoot := filepath.Join(*root, previousTreeDir)
+	data, err := os.ReadFile(filepath.Join(previousRoot, "deployed_version.txt"))
+	if err != nil {
+		return fmt.Errorf("no previous deployment kept in %s, deploy with --keep-previous to enable rollback", previousRoot)
+	}
+	previous := strings.TrimSpace(string(data))
+	if previous == current {
+		return fmt.Errorf("version %s is deployed already", current)
+	}
+
+	report, err := mirrorStaticTree(previousRoot, staticRoot, *verbose)
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", previousRoot, err)
+	}
+	fmt.Printf("Rolled back from version %s to %s: %d restored, %d removed\n", current, previous, report.Copied, report.Deleted)
+	return nil
+}
+
+// previousVersionDir returns the newest version{N} directory in staticRoot older than current
+func previousVersionDir(staticRoot string, current string) (string, error) {
+	entries, err := os.ReadDir(staticRoot)
+	if err != nil {
+		return "", err
+	}
+	currentNumber, _ := strconv.ParseInt(current, 10, 64)
+	found := int64(-1)
+	for _, entry := range entries {
+		if n, ok := versionDirNumber(entry); ok && n < currentNumber && n > found {
+			found = n
+		}
+	}
+	if found < 0 {
+		return "", fmt.Errorf("no version directory older than version%s in %s", current, staticRoot)
+	}
+	return strconv.FormatInt(found, 10), nil
+}
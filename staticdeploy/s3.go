@@ -0,0 +1,589 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Multipart uploads of S3 objects: files above s3PartSize are uploaded in parts of that size,
+// s3PartConcurrency at a time
+const (
+	s3PartSize        = 8 * 1024 * 1024
+	s3PartConcurrency = 4
+	s3DefaultRegion   = "us-east-1"
+)
+
+// S3Config configures S3 and S3-compatible storage (the remote.s3 section of the config file)
+// The keys are the s3.access-key and s3.secret-key credentials, else those of the default AWS
+// credential chain (see awsKeyChain)
+type S3Config struct {
+	Region    string `yaml:"region" json:"region"`         // default: AWS_REGION, else us-east-1
+	Endpoint  string `yaml:"endpoint" json:"endpoint"`     // S3-compatible storage, e.g. https://minio.example.com:9000
+	PathStyle bool   `yaml:"path_style" json:"path_style"` // bucket in the path instead of the host name, as MinIO needs
+}
+
+// s3RemoteStore is a remote target in an S3 bucket, below an optional prefix
+// Requests are signed with AWS Signature Version 4 and sent by the shared HTTP client
+type s3RemoteStore struct {
+	bucket    string
+	prefix    string // "" or ending in a slash
+	region    string
+	endpoint  *url.URL
+	pathStyle bool
+	keys      *awsKeySource
+	client    *HTTPClient
+}
+
+// newS3RemoteStore opens an s3://bucket/prefix target
+func newS3RemoteStore(u *url.URL, magentoRoot string, cfg *Config) (*s3RemoteStore, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid remote target %q, expected s3://bucket/prefix", u.Redacted())
+	}
+	s := &s3RemoteStore{
+		bucket:    u.Host,
+		prefix:    strings.Trim(u.Path, "/"),
+		region:    cfg.Remote.S3.Region,
+		pathStyle: cfg.Remote.S3.PathStyle,
+	}
+	if s.prefix != "" {
+		s.prefix += "/"
+	}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_REGION")
+	}
+	if s.region == "" {
+		s.region = s3DefaultRegion
+	}
+
+	endpoint := cfg.Remote.S3.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + s.region + ".amazonaws.com"
+	}
+	var err error
+	if s.endpoint, err = url.Parse(endpoint); err != nil || s.endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid remote.s3.endpoint %q", endpoint)
+	}
+
+	if s.client, err = NewHTTPClient(cfg.HTTP); err != nil {
+		return nil, err
+	}
+	if s.keys, err = awsKeyChain(s.client, NewCredentials(magentoRoot, cfg)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// s3Credential returns a credential, falling back to the variable of the AWS tools
+func s3Credential(credentials *Credentials, name string, awsEnv string) (string, error) {
+	value, err := credentials.Get(name)
+	if err == nil {
+		return value, nil
+	}
+	if value := os.Getenv(awsEnv); value != "" {
+		return value, nil
+	}
+	return "", fmt.Errorf("%w, or %s", err, awsEnv)
+}
+
+func (s *s3RemoteStore) String() string {
+	return "s3://" + s.bucket + "/" + s.prefix
+}
+
+// s3Object is an object of a ListObjectsV2 response
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+}
+
+// list returns the objects below the prefix of the target and the given prefix
+func (s *s3RemoteStore) list(prefix string) ([]s3Object, error) {
+	var objects []s3Object
+	token := ""
+	for {
+		query := map[string]string{"list-type": "2", "prefix": s.prefix + prefix}
+		if token != "" {
+			query["continuation-token"] = token
+		}
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents              []s3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid listing: %w", err)
+		}
+		for _, object := range result.Contents {
+			object.Key = strings.TrimPrefix(object.Key, s.prefix)
+			objects = append(objects, object)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// ListVersions lists all objects to find the version prefixes
+func (s *s3RemoteStore) ListVersions() ([]RemoteVersion, error) {
+	objects, err := s.list("")
+	if err != nil {
+		return nil, err
+	}
+	modified := make(map[string]time.Time, len(objects))
+	for _, object := range objects {
+		modified[object.Key] = object.LastModified
+	}
+	return remoteVersionsOf(modified), nil
+}
+
+func (s *s3RemoteStore) CurrentVersion() (string, error) {
+	resp, err := s.do(http.MethodGet, "deployed_version.txt", nil, nil, nil)
+	if err != nil {
+		if isS3NotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return strings.TrimSpace(string(data)), err
+}
+
+// DeleteVersion deletes the objects of a version prefix in batches of 1000
+func (s *s3RemoteStore) DeleteVersion(name string) error {
+	if !remoteVersionPattern.MatchString(name) {
+		return fmt.Errorf("refusing to delete %q: not a version prefix", name)
+	}
+	objects, err := s.list(name + "/")
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(objects); start += 1000 {
+		end := min(start+1000, len(objects))
+		if err := s.deleteBatch(objects[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteBatch deletes up to 1000 objects with one DeleteObjects request
+func (s *s3RemoteStore) deleteBatch(objects []s3Object) error {
+	type objectID struct {
+		Key string `xml:"Key"`
+	}
+	request := struct {
+		XMLName xml.Name   `xml:"Delete"`
+		Quiet   bool       `xml:"Quiet"`
+		Objects []objectID `xml:"Object"`
+	}{Quiet: true}
+	for _, object := range objects {
+		request.Objects = append(request.Objects, objectID{Key: s.prefix + object.Key})
+	}
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(body)
+	header := http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(sum[:])}, "Content-Type": {"application/xml"}}
+	resp, err := s.do(http.MethodPost, "", map[string]string{"delete": ""}, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Errors []struct {
+			Key     string `xml:"Key"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid delete response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("failed to delete %d object(s), e.g. %s: %s", len(result.Errors), result.Errors[0].Key, result.Errors[0].Message)
+	}
+	return nil
+}
+
+// ListObjects fingerprints objects by their ETag
+func (s *s3RemoteStore) ListObjects() (map[string]string, error) {
+	objects, err := s.list("")
+	if err != nil {
+		return nil, err
+	}
+	fingerprints := make(map[string]string, len(objects))
+	for _, object := range objects {
+		fingerprints[object.Key] = strings.Trim(object.ETag, `"`)
+	}
+	return fingerprints, nil
+}
+
+// Fingerprint returns the ETag S3 gives the file: its MD5, or for multipart uploads the MD5
+// of the MD5s of the parts followed by the number of parts
+func (s *s3RemoteStore) Fingerprint(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var partSums []byte
+	parts := 0
+	for {
+		h := md5.New()
+		n, err := io.CopyN(h, f, s3PartSize)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if n > 0 || parts == 0 {
+			partSums = h.Sum(partSums)
+			parts++
+		}
+		if n < s3PartSize {
+			break
+		}
+	}
+	if parts == 1 {
+		return hex.EncodeToString(partSums), nil
+	}
+	sum := md5.Sum(partSums)
+	return hex.EncodeToString(sum[:]) + "-" + strconv.Itoa(parts), nil
+}
+
+func (s *s3RemoteStore) PutObject(key string, path string, contentType string, cacheControl string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {contentType}, "Cache-Control": {cacheControl}}
+	if info.Size() > s3PartSize {
+		return s.putMultipart(key, path, info.Size(), header)
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPut, key, nil, body, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// putMultipart uploads a large file in parts, aborting the upload when a part fails so no
+// parts are left behind to be billed
+func (s *s3RemoteStore) putMultipart(key string, path string, size int64, header http.Header) error {
+	resp, err := s.do(http.MethodPost, key, map[string]string{"uploads": ""}, nil, header)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("invalid multipart upload response: %v", err)
+	}
+
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	parts := make([]completedPart, (size+s3PartSize-1)/s3PartSize)
+	errs := make([]error, len(parts))
+	sem := make(chan struct{}, s3PartConcurrency)
+	var wg sync.WaitGroup
+	for i := range parts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			parts[i].PartNumber = i + 1
+			parts[i].ETag, errs[i] = s.putPart(key, path, initiated.UploadID, i, size)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			s.abortMultipart(key, initiated.UploadID)
+			return fmt.Errorf("part %d: %w", i+1, err)
+		}
+	}
+
+	complete := struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	resp, err = s.do(http.MethodPost, key, map[string]string{"uploadId": initiated.UploadID}, body, http.Header{"Content-Type": {"application/xml"}})
+	if err != nil {
+		s.abortMultipart(key, initiated.UploadID)
+		return err
+	}
+	defer resp.Body.Close()
+	// CompleteMultipartUpload can fail after a 200 response, with the error in the body
+	data, _ := io.ReadAll(resp.Body)
+	if bytes.Contains(data, []byte("<Error>")) {
+		s.abortMultipart(key, initiated.UploadID)
+		return parseS3Error(resp.Status, data)
+	}
+	return nil
+}
+
+// putPart uploads part i of a file and returns its ETag
+func (s *s3RemoteStore) putPart(key string, path string, uploadID string, i int, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	offset := int64(i) * s3PartSize
+	body := make([]byte, min(s3PartSize, size-offset))
+	if _, err := f.ReadAt(body, offset); err != nil {
+		return "", err
+	}
+
+	query := map[string]string{"partNumber": strconv.Itoa(i + 1), "uploadId": uploadID}
+	resp, err := s.do(http.MethodPut, key, query, body, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// abortMultipart removes the parts of a failed upload
+func (s *s3RemoteStore) abortMultipart(key string, uploadID string) {
+	resp, err := s.do(http.MethodDelete, key, map[string]string{"uploadId": uploadID}, nil, nil)
+	if err != nil {
+		logWarnf("aborting the upload of %s: %v", key, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func (s *s3RemoteStore) DeleteObject(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3Error is an error response of S3
+type s3Error struct {
+	Status  string
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return e.Status
+	}
+	return fmt.Sprintf("%s: %s (%s)", e.Status, e.Message, e.Code)
+}
+
+// parseS3Error builds the error of a response from its XML body
+func parseS3Error(status string, body []byte) error {
+	e := &s3Error{Status: status}
+	xml.Unmarshal(body, e)
+	return e
+}
+
+// isS3NotFound reports whether an error is a 404 response
+func isS3NotFound(err error) bool {
+	e, ok := err.(*s3Error)
+	return ok && strings.HasPrefix(e.Status, "404")
+}
+
+// do sends a signed request for an object key (or the bucket for "") and returns the response
+// of a successful request; error responses are returned as *s3Error
+func (s *s3RemoteStore) do(method string, key string, query map[string]string, body []byte, header http.Header) (*http.Response, error) {
+	u := *s.endpoint
+	objectPath := ""
+	if key != "" {
+		objectPath = "/" + awsURIEncode(s.prefix+key, false)
+	}
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + s.prefix + key
+		u.RawPath = "/" + awsURIEncode(s.bucket, true) + objectPath
+		if key == "" {
+			u.Path, u.RawPath = "/"+s.bucket, "/"+awsURIEncode(s.bucket, true)
+		}
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + s.prefix + key
+		u.RawPath = objectPath
+		if key == "" {
+			u.Path, u.RawPath = "/", "/"
+		}
+	}
+	u.RawQuery = awsCanonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body, req.GetBody = nil, nil
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+	if err := s.sign(req, u.EscapedPath(), body, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	// Deleting objects and completing an upload may be repeated, starting an upload may not:
+	// a retry would leave an unfinished upload behind
+	send := s.client.DoIdempotent
+	if _, initiate := query["uploads"]; initiate {
+		send = s.client.Do
+	}
+	resp, err := send(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return nil, parseS3Error(resp.Status, data)
+	}
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 authorization of a request
+func (s *s3RemoteStore) sign(req *http.Request, canonicalURI string, body []byte, now time.Time) error {
+	keys, err := s.keys.Keys()
+	if err != nil {
+		return err
+	}
+	signAWSRequest(req, canonicalURI, body, keys, s.region, "s3", now)
+	return nil
+}
+
+// awsKeys are the access keys requests to AWS are signed with
+type awsKeys struct {
+	accessKey string
+	secretKey string
+	token     string // of temporary credentials, else ""
+}
+
+// signAWSRequest adds the AWS Signature Version 4 authorization of a request to a service
+func signAWSRequest(req *http.Request, canonicalURI string, body []byte, keys awsKeys, region string, service string, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if keys.token != "" {
+		req.Header.Set("X-Amz-Security-Token", keys.token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") || lower == "content-md5" || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := sortedKeys(headers)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+keys.secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		keys.accessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsURIEncode percent-encodes everything but the unreserved characters, and slashes unless
+// encodeSlash, as Signature Version 4 requires
+func awsURIEncode(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// awsCanonicalQuery returns the query string sorted by name, as signed and sent
+func awsCanonicalQuery(query map[string]string) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = awsURIEncode(name, true) + "=" + awsURIEncode(query[name], true)
+	}
+	return strings.Join(pairs, "&")
+}
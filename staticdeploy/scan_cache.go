@@ -0,0 +1,99 @@
+package staticdeploy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// scanCacheDir is where vendor scan results are cached, relative to the Magento root
+// Entries are keyed by the hash of composer.lock, which changes whenever packages do
+const scanCacheDir = "var/.static-deploy-cache/scan"
+
+// scanCacheFormat is mixed into every cache key; bump it when VendorIndex changes
+const scanCacheFormat = "v1"
+
+// loadVendorIndex returns the vendor index from the scan cache, or scans vendor/ and stores
+// the result when useCache is set
+func loadVendorIndex(magentoRoot string, concurrency int, useCache bool) *VendorIndex {
+	if !useCache {
+		return buildVendorIndex(magentoRoot, concurrency)
+	}
+
+	cacheFile, err := scanCacheFile(magentoRoot)
+	if err != nil {
+		// No composer.lock, nothing to key the cache on
+		return buildVendorIndex(magentoRoot, concurrency)
+	}
+
+	if index, err := readScanCache(magentoRoot, cacheFile); err == nil {
+		return index
+	}
+
+	index := buildVendorIndex(magentoRoot, concurrency)
+	// Don't cache incomplete scans, unreadable packages may be fixed before the next run
+	if vendorScanErrors.Empty() {
+		writeScanCache(magentoRoot, cacheFile, index)
+	}
+	return index
+}
+
+// scanCacheFile returns the cache entry path for the current composer.lock
+func scanCacheFile(magentoRoot string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(magentoRoot, "composer.lock"))
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", scanCacheFormat)
+	h.Write(data)
+	return filepath.Join(magentoRoot, scanCacheDir, hex.EncodeToString(h.Sum(nil))+".json"), nil
+}
+
+// readScanCache reads a cached index, whose paths are stored relative to the Magento root
+func readScanCache(magentoRoot string, cacheFile string) (*VendorIndex, error) {
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		return nil, err
+	}
+	var packages []VendorPackage
+	if err := json.Unmarshal(data, &packages); err != nil {
+		return nil, err
+	}
+
+	for i := range packages {
+		packages[i].Path = filepath.Join(magentoRoot, packages[i].Path)
+		for j := range packages[i].SubModules {
+			packages[i].SubModules[j].Path = filepath.Join(magentoRoot, packages[i].SubModules[j].Path)
+		}
+	}
+	return &VendorIndex{Packages: packages}, nil
+}
+
+// writeScanCache stores an index; the entry is renamed into place so concurrent runs never
+// read a partial entry. Failures are ignored, the cache is an optimization only
+func writeScanCache(magentoRoot string, cacheFile string, index *VendorIndex) {
+	packages := make([]VendorPackage, len(index.Packages))
+	for i, pkg := range index.Packages {
+		pkg.Path, _ = filepath.Rel(magentoRoot, pkg.Path)
+		subModules := make([]VendorModule, len(pkg.SubModules))
+		for j, module := range pkg.SubModules {
+			module.Path, _ = filepath.Rel(magentoRoot, module.Path)
+			subModules[j] = module
+		}
+		pkg.SubModules = subModules
+		packages[i] = pkg
+	}
+
+	data, err := json.Marshal(packages)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+		return
+	}
+	writeFileAtomic(cacheFile, data, 0644)
+}
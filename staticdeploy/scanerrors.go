@@ -0,0 +1,111 @@
+package staticdeploy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// unreadableError is returned by the copy functions when files or directories below the
+// source couldn't be read; everything readable was still copied
+type unreadableError struct {
+	Paths []string
+}
+
+func (e *unreadableError) Error() string {
+	return fmt.Sprintf("%d unreadable path(s), first: %s", len(e.Paths), e.Paths[0])
+}
+
+// isUnreadableSource reports whether err is a permission error opening the source file src
+// (as opposed to writing the destination)
+func isUnreadableSource(err error, src string) bool {
+	var pathErr *os.PathError
+	return errors.As(err, &pathErr) && pathErr.Path == src && os.IsPermission(err)
+}
+
+// scanErrorLog collects the unreadable paths found while scanning vendor packages, per vendor
+// Jobs scan the same packages, so paths are deduplicated
+type scanErrorLog struct {
+	mu    sync.Mutex
+	paths map[string]map[string]bool // vendor -> unreadable paths
+}
+
+// vendorScanErrors collects the unreadable vendor paths of all deployment jobs
+var vendorScanErrors = &scanErrorLog{paths: make(map[string]map[string]bool)}
+
+// Record adds the unreadable paths of err for a vendor; other errors are ignored
+// Returns true when err was a permission or unreadable path error
+func (l *scanErrorLog) Record(vendor string, path string, err error) bool {
+	var paths []string
+	if ue, ok := err.(*unreadableError); ok {
+		paths = ue.Paths
+	} else if os.IsPermission(err) {
+		paths = []string{path}
+	} else {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.paths[vendor] == nil {
+		l.paths[vendor] = make(map[string]bool)
+	}
+	for _, p := range paths {
+		l.paths[vendor][p] = true
+	}
+	return true
+}
+
+// Empty reports whether no unreadable paths were recorded
+func (l *scanErrorLog) Empty() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.paths) == 0
+}
+
+// Count returns the number of recorded unreadable paths
+func (l *scanErrorLog) Count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	total := 0
+	for _, paths := range l.paths {
+		total += len(paths)
+	}
+	return total
+}
+
+// Report writes a warning with the number of unreadable paths per vendor to stderr
+// Returns false when there's nothing to report
+func (l *scanErrorLog) Report(verbose bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.paths) == 0 {
+		return false
+	}
+
+	vendors := make([]string, 0, len(l.paths))
+	total := 0
+	for vendor, paths := range l.paths {
+		vendors = append(vendors, vendor)
+		total += len(paths)
+	}
+	sort.Strings(vendors)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n%d unreadable path(s) in vendor were skipped, the deployment may be incomplete (check file ownership):", total)
+	for _, vendor := range vendors {
+		fmt.Fprintf(&sb, "\n  %s: %d", vendor, len(l.paths[vendor]))
+	}
+	logger.Warn(sb.String(), "paths", total, "vendors", vendors)
+	if verbose {
+		for _, vendor := range vendors {
+			paths := sortedKeys(l.paths[vendor])
+			logger.Debug(fmt.Sprintf("  %s:\n    %s", vendor, strings.Join(paths, "\n    ")), "vendor", vendor, "paths", paths)
+		}
+	}
+	return true
+}
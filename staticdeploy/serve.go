@@ -0,0 +1,427 @@
+package staticdeploy
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"google.golang.org/grpc"
+)
+
+func init() {
+	registerCommand(Command{
+		Name:        "serve",
+		Description: "Run a daemon deploying on HTTP requests (POST /deploy, GET /status, GET /last-result) or gRPC",
+		Run:         runServe,
+	})
+}
+
+// defaultServeAddr only accepts local connections, which need no token
+const defaultServeAddr = "127.0.0.1:8765"
+
+// The areas, themes, stores and locale aliases a deploy request may pass; other locales are
+// Magento locale codes. None can hold a path outside pub/static
+var (
+	deployRequestArea  = regexp.MustCompile(`^(frontend|adminhtml)$`)
+	deployRequestTheme = regexp.MustCompile(`^[A-Za-z0-9_]+/[A-Za-z0-9_*-]+$`)
+	deployRequestName  = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// DeployRequest is the body of POST /deploy; empty fields use the deploy options of the daemon
+type DeployRequest struct {
+	Themes  []string `json:"themes,omitempty"`
+	Locales []string `json:"locales,omitempty"`
+	Areas   []string `json:"areas,omitempty"`
+	Stores  []string `json:"stores,omitempty"`
+}
+
+// ServeRun is a deploy started by the daemon, as returned by its endpoints
+type ServeRun struct {
+	ID       int             `json:"id"`
+	Request  DeployRequest   `json:"request"`
+	Started  time.Time       `json:"started"`
+	Finished *time.Time      `json:"finished,omitempty"`
+	Running  bool            `json:"running"`
+	ExitCode int             `json:"exit_code"`
+	Jobs     int             `json:"jobs"`
+	JobsDone int             `json:"jobs_done"`
+	Files    int64           `json:"files"`
+	Report   json.RawMessage `json:"report,omitempty"` // the JSON report of the finished run
+
+	events  []ProgressEvent // so far, for gRPC watchers
+	updated chan struct{}   // closed when events are added or the run finished
+}
+
+// deployDaemon runs one deploy at a time, each in a child process of this binary so a run
+// can't leave state behind; the vendor index cache on disk stays warm between runs
+type deployDaemon struct {
+	root          string
+	configPath    string
+	deployArgs    []string
+	localeAliases map[string]string
+	token         string
+	ctx           context.Context
+
+	mu        sync.Mutex
+	nextID    int
+	current   *ServeRun
+	last      *ServeRun
+	verifying int // Verify calls hashing the deployed files
+	wg        sync.WaitGroup
+}
+
+// runServe implements the serve subcommand
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory")
+	configPath := flags.StringP("config", "c", "", "Path to config file")
+	listen := flags.String("listen", defaultServeAddr, "Address to listen on; other than loopback addresses need the serve.token credential")
+	grpcListen := flags.String("grpc-listen", "", "Address to serve the gRPC service on (deploypb/deploy.proto), e.g. 127.0.0.1:8766")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s serve [options] [-- deploy options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Runs a daemon deploying on HTTP or gRPC requests, one at a time. The deploy options after --\n")
+		fmt.Fprintf(os.Stderr, "apply to every deploy, e.g. -- -f --jobs 8; a request chooses themes, locales, areas or stores\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.ArgsLenAtDash() > 0 {
+		flags.Usage()
+		return fmt.Errorf("deploy options must follow --")
+	}
+
+	cfg, err := loadConfig(*root, *configPath)
+	if err != nil {
+		return err
+	}
+	absRoot, err := filepath.Abs(*root)
+	if err != nil {
+		return err
+	}
+	daemon := &deployDaemon{root: absRoot, configPath: *configPath, deployArgs: flags.Args(), localeAliases: cfg.LocaleAliases, ctx: shutdownSignals.Graceful()}
+	if daemon.token, err = NewCredentials(*root, cfg).Get("serve.token"); err != nil {
+		for _, addr := range []string{*listen, *grpcListen} {
+			if addr != "" && !isLoopbackAddr(addr) {
+				return fmt.Errorf("listening on %s needs a token: %w", addr, err)
+			}
+		}
+		daemon.token = ""
+	}
+
+	// The first deploy shouldn't pay for scanning the vendor packages
+	start := time.Now()
+	index := loadVendorIndex(*root, runtime.NumCPU(), true)
+	logInfof("Vendor index ready: %d packages in %.1fs", len(index.Packages), time.Since(start).Seconds())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/deploy", daemon.authorized(daemon.handleDeploy))
+	mux.HandleFunc("/status", daemon.authorized(daemon.handleStatus))
+	mux.HandleFunc("/last-result", daemon.authorized(daemon.handleLastResult))
+	server := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	errs := make(chan error, 2)
+	go func() { errs <- server.ListenAndServe() }()
+	logInfof("Listening on %s for %s", *listen, *root)
+
+	var grpcServer *grpc.Server
+	if *grpcListen != "" {
+		listener, err := net.Listen("tcp", *grpcListen)
+		if err != nil {
+			server.Close()
+			return err
+		}
+		grpcServer = daemon.newGRPCServer()
+		go func() { errs <- grpcServer.Serve(listener) }()
+		logInfof("Serving gRPC on %s", *grpcListen)
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	case <-daemon.ctx.Done():
+	}
+	// The running deploy gets the signal as well and stops gracefully
+	logInfof("Shutting down, waiting for the running deploy")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	daemon.wg.Wait()
+	if grpcServer != nil {
+		// Watch streams end with the deploy
+		grpcServer.GracefulStop()
+	}
+	return nil
+}
+
+// isLoopbackAddr reports whether a listen address only accepts local connections
+func isLoopbackAddr(addr string) bool {
+	host, _, _ := net.SplitHostPort(addr)
+	ip := net.ParseIP(host)
+	return host == "localhost" || (ip != nil && ip.IsLoopback())
+}
+
+// authorized requires the bearer token, when the daemon has one
+func (d *deployDaemon) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if d.token != "" {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(d.token)) != 1 {
+				writeServeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid bearer token"})
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// handleDeploy starts a deploy: 202 with the run, 409 while another one runs
+func (d *deployDaemon) handleDeploy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeServeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	// Browsers can't send JSON to another origin without a preflight, so forms and text/plain
+	// requests of other pages can't start deploys
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeServeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "use Content-Type: application/json"})
+		return
+	}
+	var req DeployRequest
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			writeServeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request: " + err.Error()})
+			return
+		}
+	}
+	if err := req.validate(d.localeAliases); err != nil {
+		writeServeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	run, err := d.start(req)
+	if err != nil {
+		writeServeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "run": run})
+		return
+	}
+	writeServeJSON(w, http.StatusAccepted, run)
+}
+
+// handleStatus returns the running deploy, if any
+func (d *deployDaemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := map[string]any{"state": "idle"}
+	if d.current != nil {
+		status = map[string]any{"state": "running", "run": d.current}
+	}
+	writeServeJSON(w, http.StatusOK, status)
+}
+
+// handleLastResult returns the last finished deploy with its report
+func (d *deployDaemon) handleLastResult(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.last == nil {
+		writeServeJSON(w, http.StatusNotFound, map[string]string{"error": "no deploy finished yet"})
+		return
+	}
+	writeServeJSON(w, http.StatusOK, d.last)
+}
+
+// validate checks the values of a request; they're passed as --flag=value, so they can't
+// become other options, and they become paths below pub/static, so they must be names
+func (req DeployRequest) validate(localeAliases map[string]string) error {
+	valid := map[string]func(string) bool{
+		"themes": deployRequestTheme.MatchString,
+		"areas":  deployRequestArea.MatchString,
+		"stores": deployRequestName.MatchString,
+		"locales": func(locale string) bool {
+			return localeCodePattern.MatchString(locale) || (localeAliases[locale] != "" && deployRequestName.MatchString(locale))
+		},
+	}
+	for field, values := range map[string][]string{"themes": req.Themes, "locales": req.Locales, "areas": req.Areas, "stores": req.Stores} {
+		for _, value := range values {
+			if !valid[field](value) {
+				return fmt.Errorf("invalid value in %s: '%s'", field, value)
+			}
+		}
+	}
+	if len(req.Stores) > 0 && (len(req.Themes) > 0 || len(req.Locales) > 0) {
+		return fmt.Errorf("stores cannot be combined with themes or locales")
+	}
+	return nil
+}
+
+// start starts a deploy in a child process unless one is running, returning a copy of the
+// started or the running deploy
+func (d *deployDaemon) start(req DeployRequest) (*ServeRun, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.current != nil {
+		running := *d.current
+		return &running, fmt.Errorf("deploy %d is running", running.ID)
+	}
+	if d.verifying > 0 {
+		return nil, fmt.Errorf("the deployed files are being verified")
+	}
+	if d.ctx.Err() != nil {
+		return nil, fmt.Errorf("shutting down")
+	}
+
+	d.nextID++
+	run := &ServeRun{ID: d.nextID, Request: req, Started: time.Now(), Running: true, updated: make(chan struct{})}
+	d.current = run
+	started := *run
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.deploy(run)
+	}()
+	return &started, nil
+}
+
+// deploy runs the deploy of a request, following its progress events
+func (d *deployDaemon) deploy(run *ServeRun) {
+	exitCode, report, err := d.runChild(run)
+	if err != nil {
+		logErrorf("deploy %d: %v", run.ID, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	finished := time.Now()
+	run.Finished = &finished
+	run.Running = false
+	run.ExitCode = exitCode
+	run.Report = report
+	if n := len(run.events); n == 0 || run.events[n-1].Type != "deploy_finished" {
+		// The child failed before it could report, watchers still get the outcome
+		success := exitCode == 0
+		run.events = append(run.events, ProgressEvent{Type: "deploy_finished", Time: finished, Success: &success, Files: run.Files})
+	}
+	close(run.updated)
+	d.current = nil
+	d.last = run
+	logInfof("Deploy %d finished with exit code %d in %.1fs", run.ID, exitCode, finished.Sub(run.Started).Seconds())
+}
+
+// runChild runs this binary's deploy for a request and returns its exit code and JSON report
+func (d *deployDaemon) runChild(run *ServeRun) (int, json.RawMessage, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 1, nil, err
+	}
+	reportFile, err := os.CreateTemp("", tempArtifactPrefix+"serve-report-")
+	if err != nil {
+		return 1, nil, err
+	}
+	reportFile.Close()
+	defer os.Remove(reportFile.Name())
+
+	args := []string{"deploy", "--root=" + d.root, "--report=" + reportFile.Name(), "--events=-"}
+	if d.configPath != "" {
+		args = append(args, "--config="+d.configPath)
+	}
+	args = append(args, d.deployArgs...)
+	for _, area := range run.Request.Areas {
+		args = append(args, "--area="+area)
+	}
+	for _, theme := range run.Request.Themes {
+		args = append(args, "--theme="+theme)
+	}
+	for _, store := range run.Request.Stores {
+		args = append(args, "--store="+store)
+	}
+	for _, locale := range run.Request.Locales {
+		args = append(args, "--language="+locale)
+	}
+	logInfof("Deploy %d started: %s", run.ID, strings.Join(args[4:], " "))
+
+	// The events come on the child's stdout, which works on every platform; its output goes
+	// to stderr
+	cmd := exec.CommandContext(d.ctx, executable, args...)
+	cmd.Stderr = os.Stderr
+	events, err := cmd.StdoutPipe()
+	if err != nil {
+		return 1, nil, err
+	}
+	// On shutdown the deploy stops gracefully, like on Ctrl+C; Windows has no SIGTERM
+	cmd.Cancel = func() error {
+		if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	if err := cmd.Start(); err != nil {
+		return 1, nil, err
+	}
+	d.followEvents(run, events)
+
+	exitCode := 0
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return 1, nil, err
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	report, err := os.ReadFile(reportFile.Name())
+	if err != nil || len(report) == 0 || !json.Valid(report) {
+		return exitCode, nil, nil // the run failed before writing its report
+	}
+	return exitCode, json.RawMessage(report), nil
+}
+
+// followEvents updates the progress of a run from its events until the child closes them
+func (d *deployDaemon) followEvents(run *ServeRun, events io.Reader) {
+	scanner := bufio.NewScanner(events)
+	for scanner.Scan() {
+		var event ProgressEvent
+		if json.Unmarshal(scanner.Bytes(), &event) != nil || event.Type == "" {
+			continue // not an event, e.g. printed before the child moved its output to stderr
+		}
+		d.mu.Lock()
+		switch event.Type {
+		case "deploy_started":
+			run.Jobs = event.Jobs
+		case "job_finished":
+			run.JobsDone++
+		case "files_copied", "deploy_finished":
+			run.Files = event.Files
+		}
+		run.events = append(run.events, event)
+		close(run.updated)
+		run.updated = make(chan struct{})
+		d.mu.Unlock()
+	}
+}
+
+// writeServeJSON writes a JSON response
+func writeServeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
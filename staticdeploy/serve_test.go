@@ -0,0 +1,94 @@
+package staticdeploy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeployRequestValidate(t *testing.T) {
+	aliases := map[string]string{"en_KIDS": "en_US"}
+	valid := []DeployRequest{
+		{},
+		{Themes: []string{"Vendor/Hyva", "Vendor/*"}, Locales: []string{"nl_NL", "sr_Latn_RS", "en_KIDS"}, Areas: []string{"frontend", "adminhtml"}},
+		{Stores: []string{"default", "nl_store"}},
+	}
+	for _, req := range valid {
+		if err := req.validate(aliases); err != nil {
+			t.Errorf("validate(%+v) error = %v", req, err)
+		}
+	}
+
+	invalid := []DeployRequest{
+		{Locales: []string{"en_US/../../../../../home/x"}},
+		{Locales: []string{".."}},
+		{Locales: []string{"en_OTHER"}}, // not an alias
+		{Themes: []string{"../.."}},
+		{Themes: []string{"Vendor/../x"}},
+		{Themes: []string{"Hyva"}},
+		{Areas: []string{"base"}},
+		{Areas: []string{"frontend/.."}},
+		{Stores: []string{"../default"}},
+		{Stores: []string{"default"}, Themes: []string{"Vendor/Hyva"}},
+	}
+	for _, req := range invalid {
+		if err := req.validate(aliases); err == nil {
+			t.Errorf("validate(%+v) succeeded, want an error", req)
+		}
+	}
+}
+
+func TestHandleDeployRequiresJSON(t *testing.T) {
+	daemon := &deployDaemon{}
+	for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded"} {
+		r := httptest.NewRequest(http.MethodPost, "/deploy", strings.NewReader(`{"locales":["nl_NL"]}`))
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		daemon.handleDeploy(w, r)
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("POST /deploy with Content-Type %q: status %d, want %d", contentType, w.Code, http.StatusUnsupportedMediaType)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/deploy", strings.NewReader(`{"locales":["en_US/../../x"]}`))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	w := httptest.NewRecorder()
+	daemon.handleDeploy(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST /deploy with a path as locale: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDaemonRootPath(t *testing.T) {
+	d := &deployDaemon{root: "/var/www/magento"}
+	tests := []struct {
+		requested, def, want string
+	}{
+		{"", "pub/static", "/var/www/magento/pub/static"},
+		{"", "", ""},
+		{"pub/static", "", "/var/www/magento/pub/static"},
+		{"/var/www/magento/var/manifest.json", "", "/var/www/magento/var/manifest.json"},
+	}
+	for _, tt := range tests {
+		got, err := d.rootPath(tt.requested, tt.def)
+		if err != nil || got != tt.want {
+			t.Errorf("rootPath(%q, %q) = %q, %v, want %q", tt.requested, tt.def, got, err, tt.want)
+		}
+	}
+	for _, requested := range []string{"/etc", "../other", "pub/../../other", "/var/www/magento2"} {
+		if got, err := d.rootPath(requested, ""); err == nil {
+			t.Errorf("rootPath(%q) = %q, want an error for a path outside the root", requested, got)
+		}
+	}
+}
+
+func TestDaemonStartWhileVerifying(t *testing.T) {
+	d := &deployDaemon{ctx: context.Background(), verifying: 1}
+	if _, err := d.start(DeployRequest{}); err == nil {
+		t.Errorf("start() succeeded while verifying")
+	}
+}
@@ -0,0 +1,211 @@
+package staticdeploy
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elgentos/magento2-static-deploy/deploypb"
+)
+
+// grpcDeployServer implements deploypb.StaticDeploy on the daemon, sharing its deploys with
+// the HTTP endpoints
+type grpcDeployServer struct {
+	deploypb.UnimplementedStaticDeployServer
+	daemon *deployDaemon
+}
+
+// newGRPCServer creates the gRPC server of the daemon, requiring its token on every call
+func (d *deployDaemon) newGRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := d.authorizedGRPC(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := d.authorizedGRPC(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	deploypb.RegisterStaticDeployServer(server, &grpcDeployServer{daemon: d})
+	return server
+}
+
+// authorizedGRPC requires the bearer token in the authorization metadata, when the daemon has one
+func (d *deployDaemon) authorizedGRPC(ctx context.Context) error {
+	if d.token == "" {
+		return nil
+	}
+	var given string
+	if values := metadata.ValueFromIncomingContext(ctx, "authorization"); len(values) > 0 {
+		given = strings.TrimPrefix(values[0], "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(given), []byte(d.token)) != 1 {
+		return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+	}
+	return nil
+}
+
+func (s *grpcDeployServer) Deploy(ctx context.Context, in *deploypb.DeployRequest) (*deploypb.Run, error) {
+	req := DeployRequest{Themes: in.GetThemes(), Locales: in.GetLocales(), Areas: in.GetAreas(), Stores: in.GetStores()}
+	if err := req.validate(s.daemon.localeAliases); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	run, err := s.daemon.start(req)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return run.proto(), nil
+}
+
+func (s *grpcDeployServer) Watch(in *deploypb.WatchRequest, stream deploypb.StaticDeploy_WatchServer) error {
+	d := s.daemon
+	matches := func(run *ServeRun) bool {
+		return run != nil && (in.GetRunId() == 0 || int64(run.ID) == in.GetRunId())
+	}
+	d.mu.Lock()
+	run := d.current
+	if !matches(run) {
+		run = d.last
+	}
+	d.mu.Unlock()
+	if !matches(run) {
+		if in.GetRunId() == 0 {
+			return status.Error(codes.NotFound, "no deploy ran yet")
+		}
+		return status.Errorf(codes.NotFound, "deploy %d is neither running nor the last one", in.GetRunId())
+	}
+
+	sent := 0
+	for {
+		// Events are only appended, so the slice taken under the lock stays valid
+		d.mu.Lock()
+		events, running, updated := run.events[sent:], run.Running, run.updated
+		d.mu.Unlock()
+		for _, event := range events {
+			if err := stream.Send(event.proto()); err != nil {
+				return err
+			}
+		}
+		sent += len(events)
+		if !running {
+			return nil
+		}
+		select {
+		case <-updated:
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+	}
+}
+
+func (s *grpcDeployServer) Verify(ctx context.Context, in *deploypb.VerifyRequest) (*deploypb.VerifyResponse, error) {
+	d := s.daemon
+	staticDir, err := d.rootPath(in.GetStaticDir(), "pub/static")
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "static_dir: %v", err)
+	}
+	manifest, err := d.rootPath(in.GetManifest(), "")
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "manifest: %v", err)
+	}
+
+	// No deploy may change the files while they're hashed
+	d.mu.Lock()
+	if d.current != nil {
+		defer d.mu.Unlock()
+		return nil, status.Errorf(codes.FailedPrecondition, "deploy %d is running", d.current.ID)
+	}
+	d.verifying++
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.verifying--
+		d.mu.Unlock()
+	}()
+
+	expected, diff, err := verifyStaticContent(staticDir, manifest)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &deploypb.VerifyResponse{
+		Version:  expected.Version,
+		Files:    int64(len(expected.Files)),
+		Missing:  diff.Removed,
+		Modified: diff.Changed,
+		Extra:    diff.Added,
+		Match:    len(diff.Removed)+len(diff.Changed)+len(diff.Added) == 0,
+	}, nil
+}
+
+// rootPath resolves a path of a request relative to the Magento root, def when empty, and
+// refuses paths outside the root; the daemon doesn't read other files for its clients
+func (d *deployDaemon) rootPath(requested string, def string) (string, error) {
+	if requested == "" {
+		if def == "" {
+			return "", nil
+		}
+		requested = def
+	}
+	if !filepath.IsAbs(requested) {
+		requested = filepath.Join(d.root, requested)
+	}
+	rel, err := filepath.Rel(d.root, requested)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s is outside the Magento root %s", requested, d.root)
+	}
+	return filepath.Clean(requested), nil
+}
+
+// proto converts a run for the gRPC service
+func (run *ServeRun) proto() *deploypb.Run {
+	p := &deploypb.Run{
+		Id: int64(run.ID),
+		Request: &deploypb.DeployRequest{
+			Themes:  run.Request.Themes,
+			Locales: run.Request.Locales,
+			Areas:   run.Request.Areas,
+			Stores:  run.Request.Stores,
+		},
+		Started:    timestamppb.New(run.Started),
+		Running:    run.Running,
+		ExitCode:   int32(run.ExitCode),
+		Jobs:       int32(run.Jobs),
+		JobsDone:   int32(run.JobsDone),
+		Files:      run.Files,
+		ReportJson: string(run.Report),
+	}
+	if run.Finished != nil {
+		p.Finished = timestamppb.New(*run.Finished)
+	}
+	return p
+}
+
+// proto converts a progress event for the gRPC service
+func (event ProgressEvent) proto() *deploypb.ProgressEvent {
+	return &deploypb.ProgressEvent{
+		Type:            event.Type,
+		Time:            timestamppb.New(event.Time),
+		Version:         event.Version,
+		Area:            event.Area,
+		Theme:           event.Theme,
+		Locale:          event.Locale,
+		Jobs:            int32(event.Jobs),
+		Files:           event.Files,
+		DurationSeconds: event.Duration,
+		Error:           event.Error,
+		Success:         event.Success != nil && *event.Success,
+	}
+}
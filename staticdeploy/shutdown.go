@@ -0,0 +1,65 @@
+package staticdeploy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// errInterrupted is the error of jobs and files not deployed because the run was interrupted
+var errInterrupted = errors.New("interrupted")
+
+// shutdownHandler handles SIGINT and SIGTERM
+// Until Graceful is called (e.g. while a subcommand runs), a signal removes the temporary
+// artifacts and exits. A graceful run is canceled instead: no new work is started, the copies
+// in progress finish and the run ends with a partial summary. A second signal exits at once
+type shutdownHandler struct {
+	mu       sync.Mutex
+	graceful bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// shutdownSignals handles the signals of the process, for all commands; started by main
+var shutdownSignals *shutdownHandler
+
+// handleShutdownSignals starts handling SIGINT and SIGTERM
+func handleShutdownSignals() *shutdownHandler {
+	h := &shutdownHandler{}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			h.mu.Lock()
+			graceful := h.graceful && h.ctx.Err() == nil
+			if graceful {
+				h.cancel()
+			}
+			h.mu.Unlock()
+
+			if graceful {
+				logWarnf("\nreceived %s, finishing the copies in progress (repeat to abort immediately)", sig)
+				continue
+			}
+			removed := tempArtifacts.RemoveAll()
+			logWarnf("\nreceived %s, removed %d temporary file(s)", sig, removed)
+			runProgress.Finish(false)
+			progressEvents.Finish(false, filesProcessed.Load())
+			os.Exit(1)
+		}
+	}()
+	return h
+}
+
+// Graceful switches to graceful shutdown, returning the context canceled by a signal
+func (h *shutdownHandler) Graceful() context.Context {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.graceful = true
+	return h.ctx
+}
@@ -0,0 +1,203 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// sinceFiles are the absolute paths of the files changed since the --since ref; files of the
+// deployed jobs whose source isn't one of them are only placed when they aren't deployed yet.
+// nil places every file, e.g. after deletions, whose fallbacks need to be placed
+var sinceFiles map[string]bool
+
+// ignoredChangeDirs are the directories of the Magento root without deployed sources
+var ignoredChangeDirs = []string{"bin/", "dev/", "generated/", "pub/media/", "pub/static/", "setup/", "var/"}
+
+// changedSources is the static content impact of the files changed since a git ref
+type changedSources struct {
+	themes map[string]bool // area/Vendor/theme
+	owners map[string]bool // Vendor/theme whose theme sources (theme_sources config) changed
+	areas  map[string]bool // areas where module view files changed
+	full   string          // first path that can't be mapped, requiring a full deploy
+}
+
+// gitChangedFiles returns the paths (relative to the Magento root) changed between ref and
+// the working tree, including uncommitted and untracked files
+func gitChangedFiles(magentoRoot string, ref string) ([]string, error) {
+	commit, err := gitResolveCommit(magentoRoot, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, args := range [][]string{
+		{"diff", "--name-only", "--no-renames", "--relative", commit, "--"},
+		{"ls-files", "--others", "--exclude-standard"},
+	} {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("git", args...)
+		cmd.Dir = magentoRoot
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		for _, line := range strings.Split(stdout.String(), "\n") {
+			if line != "" {
+				files = append(files, line)
+			}
+		}
+	}
+	return files, nil
+}
+
+// gitResolveCommit resolves a ref to its commit. The ref comes after --end-of-options, so a
+// ref like --output=file can't be taken for an option of git
+func gitResolveCommit(magentoRoot string, ref string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{commit}")
+	cmd.Dir = magentoRoot
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("invalid git ref %q: %s", ref, msg)
+		}
+		return "", fmt.Errorf("invalid git ref %q: not a commit", ref)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// mapChangedFiles maps changed paths to the themes and areas whose static content they affect:
+//   - app/design/{area}/{Vendor}/{theme}/... affects that theme (and its child themes)
+//   - app/code/{Vendor}/{Module}/view/{area}/... affects all themes of the area (base: all areas)
+//   - files in a theme source from the config file affect the themes declaring it
+//   - other app/code files (except registration.php, etc/module.xml and i18n/), hidden and
+//     Markdown files at the top and the directories of ignoredChangeDirs don't affect static content
+//   - anything else (vendor, lib/web, app/etc/config.php, unknown paths) can't be mapped to
+//     themes, so it requires a full deploy
+func mapChangedFiles(magentoRoot string, files []string) changedSources {
+	changed := changedSources{themes: make(map[string]bool), owners: make(map[string]bool), areas: make(map[string]bool)}
+
+	for _, file := range files {
+		if owners := themeSourceOf(magentoRoot, file); len(owners) > 0 {
+			for _, theme := range owners {
+				changed.owners[theme] = true
+			}
+			continue
+		}
+		parts := strings.Split(file, "/")
+		switch {
+		case len(parts) >= 6 && parts[0] == "app" && parts[1] == "design":
+			changed.themes[strings.Join(parts[2:5], "/")] = true
+		case len(parts) >= 7 && parts[0] == "app" && parts[1] == "code" && parts[4] == "view":
+			changed.areas[parts[5]] = true
+		case ignoredChange(parts):
+		default:
+			if changed.full == "" {
+				changed.full = file
+			}
+		}
+	}
+	return changed
+}
+
+// ignoredChange reports whether a changed path, split at slashes, is known not to affect
+// static content
+func ignoredChange(parts []string) bool {
+	file := strings.Join(parts, "/")
+	if len(parts) >= 5 && parts[0] == "app" && parts[1] == "code" {
+		module := strings.Join(parts[4:], "/")
+		return module != "registration.php" && module != "etc/module.xml" && parts[4] != "i18n"
+	}
+	if strings.HasPrefix(parts[0], ".") || len(parts) == 1 && strings.HasSuffix(file, ".md") {
+		return true
+	}
+	for _, dir := range ignoredChangeDirs {
+		if strings.HasPrefix(file, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// affects reports whether a job has to be redeployed for the changes
+func (c changedSources) affects(magentoRoot string, job DeployJob) bool {
+	if c.areas[job.Area] || c.areas["base"] || c.owners[job.Theme] {
+		return true
+	}
+	for _, theme := range getThemeParentChain(magentoRoot, job.Area, job.Theme) {
+		if c.themes[job.Area+"/"+theme] {
+			return true
+		}
+	}
+	return false
+}
+
+// filterJobsSince limits jobs to those affected by the changes since a git ref, keeping all
+// jobs when the changes can't be determined or mapped
+func filterJobsSince(magentoRoot string, jobs []DeployJob, ref string, verbose bool) []DeployJob {
+	files, err := gitChangedFiles(magentoRoot, ref)
+	if err != nil {
+		logWarnf("--since %s: %v, deploying everything", ref, err)
+		return jobs
+	}
+
+	changed := mapChangedFiles(magentoRoot, files)
+	if changed.full != "" {
+		logInfof("--since %s: %s can't be mapped to themes, deploying everything", ref, changed.full)
+		return jobs
+	}
+
+	var filtered []DeployJob
+	for _, job := range jobs {
+		if changed.affects(magentoRoot, job) {
+			filtered = append(filtered, job)
+		}
+	}
+	if verbose {
+		logDebugf("--since %s: %d changed file(s), %d of %d job(s) affected", ref, len(files), len(filtered), len(jobs))
+	}
+
+	// Only the changed files need to be placed, unless the files deployed before may be
+	// outdated: a new version directory or --force places every file, and a deleted source
+	// uncovers the file it overrode
+	if !versionedDirs && !forceFlag {
+		sinceFiles = changedFilePaths(magentoRoot, files)
+	}
+	return filtered
+}
+
+// changedFilePaths returns the absolute paths of the changed files, or nil when one of them
+// was deleted
+func changedFilePaths(magentoRoot string, files []string) map[string]bool {
+	paths := make(map[string]bool, len(files))
+	for _, file := range files {
+		path, err := filepath.Abs(filepath.Join(magentoRoot, filepath.FromSlash(file)))
+		if err != nil {
+			return nil
+		}
+		if _, err := os.Lstat(path); err != nil {
+			return nil
+		}
+		paths[path] = true
+	}
+	return paths
+}
+
+// Unchanged reports whether src didn't change since the --since ref and its copy at dst is
+// deployed, so it needn't be placed again; dry runs plan every file
+func (c *fileCopier) Unchanged(src string, dst string) bool {
+	if c.since == nil || c.dryRun {
+		return false
+	}
+	if path, err := filepath.Abs(src); err != nil || c.since[path] {
+		return false
+	}
+	_, err := os.Lstat(dst)
+	return err == nil
+}
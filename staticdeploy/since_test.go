@@ -0,0 +1,24 @@
+package staticdeploy
+
+import "testing"
+
+func TestMapChangedFilesUnknownPaths(t *testing.T) {
+	root := t.TempDir()
+	for file, full := range map[string]bool{
+		"app/etc/config.php":                                 true,
+		"app/code/Vendor/Module/registration.php":            true,
+		"app/code/Vendor/Module/i18n/nl_NL.csv":              true,
+		"packages/vendor/module/view/frontend/web/js/a.js":   true,
+		"vendor/magento/module-theme/view/base/web/js/x.js":  true,
+		"app/code/Vendor/Module/Model/Thing.php":             false,
+		"app/code/Vendor/Module/view/frontend/web/js/a.js":   false,
+		"app/design/frontend/Vendor/Hyva/web/css/styles.css": false,
+		".github/workflows/deploy.yml":                       false,
+		"README.md":                                          false,
+		"dev/tests/unit/phpunit.xml":                         false,
+	} {
+		if got := mapChangedFiles(root, []string{file}).full != ""; got != full {
+			t.Errorf("%s requires a full deploy: %v, want %v", file, got, full)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// slackNotify posts the outcome of the run to Slack when it finishes (--slack); the webhook URL
+// is the slack.webhook credential
+var slackNotify bool
+
+// maxSlackErrors limits the errors listed in a Slack message; the rest is counted
+const maxSlackErrors = 5
+
+// SlackConfig configures the Slack message (the slack section of the config file)
+type SlackConfig struct {
+	Channel  string `yaml:"channel" json:"channel"`   // overrides the channel of the webhook, if allowed
+	Username string `yaml:"username" json:"username"` // overrides the name of the webhook
+	On       string `yaml:"on" json:"on"`             // always (default) or failure
+}
+
+// SlackNotifier posts the outcome of a run to a Slack incoming webhook
+type SlackNotifier struct {
+	webhook string
+	client  *HTTPClient
+	cfg     SlackConfig
+}
+
+// NewSlackNotifier creates the notifier when --slack is given, nil otherwise. The webhook and
+// the HTTP client are resolved up front, so a missing credential fails before deploying
+func NewSlackNotifier(magentoRoot string, cfg *Config) (*SlackNotifier, error) {
+	if !slackNotify {
+		return nil, nil
+	}
+	if cfg.Slack.On != "" && cfg.Slack.On != "always" && cfg.Slack.On != "failure" {
+		return nil, fmt.Errorf("slack.on must be 'always' or 'failure', got '%s'", cfg.Slack.On)
+	}
+	webhook, err := NewCredentials(magentoRoot, cfg).Get("slack.webhook")
+	if err != nil {
+		return nil, fmt.Errorf("--slack: %w", err)
+	}
+	client, err := NewHTTPClient(cfg.HTTP)
+	if err != nil {
+		return nil, fmt.Errorf("--slack: %w", err)
+	}
+	return &SlackNotifier{webhook: webhook, client: client, cfg: cfg.Slack}, nil
+}
+
+// slackMessage is the payload of an incoming webhook; the attachment colors the message
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color    string   `json:"color"`
+	Text     string   `json:"text"`
+	Footer   string   `json:"footer,omitempty"`
+	MrkdwnIn []string `json:"mrkdwn_in"`
+}
+
+// Notify posts the outcome of a finished report; a nil notifier does nothing
+func (s *SlackNotifier) Notify(report *Report) error {
+	if s == nil || (s.cfg.On == "failure" && report.Success) {
+		return nil
+	}
+	host, _ := os.Hostname()
+	body, err := json.Marshal(formatSlackMessage(report, host, s.cfg))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// The webhook URL is the secret, keep it out of the logs
+		return fmt.Errorf("posting to the Slack webhook failed")
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Slack webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// formatSlackMessage summarizes a report: the outcome, a line per theme and area with its
+// locales, the totals and the first errors
+func formatSlackMessage(report *Report, host string, cfg SlackConfig) slackMessage {
+	duration := time.Duration(report.Duration * float64(time.Second)).Round(100 * time.Millisecond)
+	title := fmt.Sprintf(":white_check_mark: Static content %s deployed on %s in %s", report.Version, host, duration)
+	color := "good"
+	if !report.Success {
+		title = fmt.Sprintf(":x: Static content deploy %s failed on %s after %s", report.Version, host, duration)
+		color = "danger"
+	}
+
+	// Jobs grouped by theme and area, in order of appearance
+	type themeLine struct {
+		label   string
+		locales []string
+		files   int64
+	}
+	var lines []*themeLine
+	byTheme := make(map[string]*themeLine)
+	for _, job := range report.Jobs {
+		key := job.Theme + " (" + job.Area + ")"
+		line, ok := byTheme[key]
+		if !ok {
+			line = &themeLine{label: key}
+			byTheme[key] = line
+			lines = append(lines, line)
+		}
+		locale := job.Locale
+		switch {
+		case job.Error != "":
+			locale = ":x: " + locale
+		case job.Files == 0 && job.SymlinkTarget == "":
+			locale += " (skipped)"
+		}
+		line.locales = append(line.locales, locale)
+		line.files += job.Files
+	}
+
+	var text strings.Builder
+	for _, line := range lines {
+		sort.Strings(line.locales)
+		fmt.Fprintf(&text, "• *%s*: %s (%d files)\n", line.label, strings.Join(line.locales, ", "), line.files)
+	}
+	if len(lines) == 0 {
+		text.WriteString("No jobs deployed\n")
+	}
+	fmt.Fprintf(&text, "\n%d/%d jobs successful | %d files | %.0f files/sec",
+		report.Totals.Succeeded, report.Totals.Jobs, report.Files, report.Totals.FilesPerSecond)
+	if report.Totals.Retried > 0 {
+		fmt.Fprintf(&text, " | %d retried", report.Totals.Retried)
+	}
+
+	if len(report.Errors) > 0 {
+		errors := report.Errors
+		if len(errors) > maxSlackErrors {
+			errors = errors[:maxSlackErrors]
+		}
+		text.WriteString("\n```\n" + strings.Join(errors, "\n") + "\n```")
+		if more := len(report.Errors) - len(errors); more > 0 {
+			fmt.Fprintf(&text, "\nand %d more error(s)", more)
+		}
+	}
+
+	return slackMessage{
+		Channel:  cfg.Channel,
+		Username: cfg.Username,
+		Text:     title,
+		Attachments: []slackAttachment{{
+			Color:    color,
+			Text:     text.String(),
+			Footer:   "magento2-static-deploy",
+			MrkdwnIn: []string{"text"},
+		}},
+	}
+}
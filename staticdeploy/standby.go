@@ -0,0 +1,174 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// fileState describes a file in a static tree, used to compute the delta between trees
+type fileState struct {
+	Size    int64
+	ModTime time.Time
+	Link    string // symlink target, for symlinked files and locale directories
+}
+
+// StandbyReport summarizes a standby synchronization
+type StandbyReport struct {
+	Copied  int
+	Deleted int
+	Bytes   int64
+	Lag     time.Duration // time between the end of the deployment and the standby being in sync
+	Version string
+}
+
+// scanStaticTree lists all files and symlinks below root, keyed by relative path
+func scanStaticTree(root string) (map[string]fileState, error) {
+	states := make(map[string]fileState)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if path == root || info.IsDir() {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(root, path)
+		state := fileState{Size: info.Size(), ModTime: info.ModTime()}
+		if info.Mode()&os.ModeSymlink != 0 {
+			state.Link, _ = os.Readlink(path)
+			state.Size = 0
+			state.ModTime = time.Time{}
+		}
+		states[relPath] = state
+		return nil
+	})
+
+	return states, err
+}
+
+// syncStandby mirrors pub/static of the Magento root to the pub/static of a standby root
+func syncStandby(magentoRoot, standbyRoot string, deployFinished time.Time, verbose bool) (StandbyReport, error) {
+	report, err := mirrorStaticTree(filepath.Join(magentoRoot, "pub/static"), filepath.Join(standbyRoot, "pub/static"), verbose)
+	report.Lag = time.Since(deployFinished)
+	return report, err
+}
+
+// mirrorStaticTree makes the static tree dstRoot identical to srcRoot
+// Only new and changed files are copied; deployed_version.txt is written after all files
+// and stale files are removed last, so the mirror never references assets it lacks
+func mirrorStaticTree(srcRoot, dstRoot string, verbose bool) (StandbyReport, error) {
+	var report StandbyReport
+
+	srcStates, err := scanStaticTree(srcRoot)
+	if err != nil {
+		return report, fmt.Errorf("failed to scan %s: %w", srcRoot, err)
+	}
+	dstStates, err := scanStaticTree(dstRoot)
+	if err != nil {
+		return report, fmt.Errorf("failed to scan %s: %w", dstRoot, err)
+	}
+
+	const versionFile = "deployed_version.txt"
+
+	// Remove standby symlinks that are regular files or directories in the deployed tree first,
+	// otherwise files would be written through them into the link target
+	for relPath, dst := range dstStates {
+		if src, ok := srcStates[relPath]; dst.Link != "" && (!ok || src.Link == "") {
+			if err := os.Remove(filepath.Join(dstRoot, relPath)); err != nil && !os.IsNotExist(err) {
+				return report, fmt.Errorf("failed to remove stale %s: %w", relPath, err)
+			}
+			delete(dstStates, relPath)
+			if !ok {
+				report.Deleted++
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(srcStates))
+	for relPath := range srcStates {
+		if relPath != versionFile {
+			paths = append(paths, relPath)
+		}
+	}
+	sort.Strings(paths)
+
+	syncFile := func(relPath string) error {
+		src := srcStates[relPath]
+		if dst, ok := dstStates[relPath]; ok && dst.Size == src.Size && dst.ModTime.Equal(src.ModTime) && dst.Link == src.Link {
+			return nil
+		}
+
+		srcPath := filepath.Join(srcRoot, relPath)
+		dstPath := filepath.Join(dstRoot, relPath)
+		if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+			return err
+		}
+		os.RemoveAll(dstPath)
+
+		if src.Link != "" {
+			if err := os.Symlink(src.Link, dstPath); err != nil {
+				return err
+			}
+		} else {
+			if err := copyFile(srcPath, dstPath); err != nil {
+				return err
+			}
+			// Keep the modification time so the next sync sees the file as unchanged
+			os.Chtimes(dstPath, src.ModTime, src.ModTime)
+			report.Bytes += src.Size
+		}
+
+		report.Copied++
+		if verbose {
+			logDebugf("  %s %s", symArrow, relPath)
+		}
+		return nil
+	}
+
+	for _, relPath := range paths {
+		if err := syncFile(relPath); err != nil {
+			return report, fmt.Errorf("failed to sync %s: %w", relPath, err)
+		}
+	}
+
+	// Switch the standby to the new version once all of its files are present
+	if _, ok := srcStates[versionFile]; ok {
+		if err := syncFile(versionFile); err != nil {
+			return report, fmt.Errorf("failed to sync %s: %w", versionFile, err)
+		}
+		if data, err := os.ReadFile(filepath.Join(dstRoot, versionFile)); err == nil {
+			report.Version = string(data)
+		}
+	}
+
+	// Remove files that no longer exist in the deployed tree
+	// Files below a directory that became a symlink were already removed with the directory
+	for relPath := range dstStates {
+		if _, ok := srcStates[relPath]; ok || hasSymlinkParent(relPath, srcStates) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dstRoot, relPath)); err != nil && !os.IsNotExist(err) {
+			return report, fmt.Errorf("failed to remove stale %s: %w", relPath, err)
+		}
+		report.Deleted++
+	}
+
+	return report, nil
+}
+
+// hasSymlinkParent reports whether one of the parent directories of relPath is a symlink
+func hasSymlinkParent(relPath string, states map[string]fileState) bool {
+	for dir := filepath.Dir(relPath); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if state, ok := states[dir]; ok && state.Link != "" {
+			return true
+		}
+	}
+	return false
+}
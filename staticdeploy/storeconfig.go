@@ -0,0 +1,273 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLocale is Magento's locale when general/locale/code isn't configured
+const defaultLocale = "en_US"
+
+// StoreView describes a store view from the scopes section of app/etc/config.php
+type StoreView struct {
+	Code    string
+	ID      int
+	Website string
+	Active  bool
+}
+
+// StoreConfig holds the store scopes and system configuration from app/etc/config.php
+// and app/etc/env.php (as written by bin/magento app:config:dump), and with --database
+// from the Magento database
+type StoreConfig struct {
+	Stores  []StoreView
+	systems []interface{} // system sections, highest priority (env.php) first
+}
+
+// loadStoreConfig reads the store configuration of a Magento installation
+func loadStoreConfig(magentoRoot string) (*StoreConfig, error) {
+	configPath := filepath.Join(magentoRoot, "app/etc/config.php")
+	config, err := readPHPArrayFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store configuration: %w", err)
+	}
+
+	sc := &StoreConfig{}
+
+	// env.php overrides config.php
+	if env, err := readPHPArrayFile(filepath.Join(magentoRoot, "app/etc/env.php")); err == nil {
+		if system := phpArrayPath(env, "system"); system != nil {
+			sc.systems = append(sc.systems, system)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read store configuration: %w", err)
+	}
+	if system := phpArrayPath(config, "system"); system != nil {
+		sc.systems = append(sc.systems, system)
+	}
+
+	// Map website IDs to codes so store views can be resolved to their website scope
+	websiteCodes := make(map[string]string)
+	if websites, ok := phpArrayPath(config, "scopes", "websites").(map[string]interface{}); ok {
+		for code, website := range websites {
+			websiteCodes[phpArrayPathString(website, "website_id")] = code
+		}
+	}
+
+	if stores, ok := phpArrayPath(config, "scopes", "stores").(map[string]interface{}); ok {
+		for code, store := range stores {
+			id, _ := strconv.Atoi(phpArrayPathString(store, "store_id"))
+			sc.Stores = append(sc.Stores, StoreView{
+				Code:    code,
+				ID:      id,
+				Website: websiteCodes[phpArrayPathString(store, "website_id")],
+				Active:  phpArrayPathString(store, "is_active") != "0",
+			})
+		}
+	}
+	sort.Slice(sc.Stores, func(i, j int) bool { return sc.Stores[i].ID < sc.Stores[j].ID })
+
+	// The database has the lowest priority, like in Magento; its store views are used
+	// when config.php has none
+	if storeDatabase {
+		stores, system, err := loadDatabaseStoreConfig(magentoRoot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read store configuration from the database: %w", err)
+		}
+		sc.systems = append(sc.systems, system)
+		if len(sc.Stores) == 0 {
+			sc.Stores = stores
+		}
+	}
+
+	return sc, nil
+}
+
+// findStore returns the store view with the given code
+func (sc *StoreConfig) findStore(code string) (StoreView, bool) {
+	for _, store := range sc.Stores {
+		if store.Code == code {
+			return store, true
+		}
+	}
+	return StoreView{}, false
+}
+
+// value resolves a configuration path for a store view with Magento's scope fallback:
+// store view, then website, then default
+func (sc *StoreConfig) value(store StoreView, path string) string {
+	keys := strings.Split(path, "/")
+
+	var scopes [][]string
+	if store.Code != "" {
+		scopes = append(scopes, []string{"stores", store.Code})
+	}
+	if store.Website != "" {
+		scopes = append(scopes, []string{"websites", store.Website})
+	}
+	scopes = append(scopes, []string{"default"})
+
+	for _, scope := range scopes {
+		for _, system := range sc.systems {
+			if v := phpArrayPathString(system, append(scope, keys...)...); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// StoreLocale returns the locale configured for a store view
+func (sc *StoreConfig) StoreLocale(store StoreView) string {
+	if locale := sc.value(store, "general/locale/code"); locale != "" {
+		return locale
+	}
+	return defaultLocale
+}
+
+// StoreTheme returns the frontend theme (Vendor/theme) assigned to a store view
+func (sc *StoreConfig) StoreTheme(store StoreView) (string, error) {
+	value := sc.value(store, "design/theme/theme_id")
+	if value == "" {
+		return "", fmt.Errorf("no theme configured for store view %s", store.Code)
+	}
+
+	// app:config:dump writes the theme path (frontend/Vendor/theme) instead of the theme ID
+	if _, err := strconv.Atoi(value); err == nil {
+		return "", fmt.Errorf("theme ID %s of store view %s can't be resolved from app/etc/config.php; dump the configuration with bin/magento app:config:dump or use --database", value, store.Code)
+	}
+	return strings.TrimPrefix(value, "frontend/"), nil
+}
+
+// Locales returns the distinct locales used by the active storefront store views
+// Without scopes in config.php, all locales configured in any scope are returned
+func (sc *StoreConfig) Locales() []string {
+	var locales []string
+	seen := make(map[string]bool)
+	add := func(locale string) {
+		if locale != "" && !seen[locale] {
+			seen[locale] = true
+			locales = append(locales, locale)
+		}
+	}
+
+	storefront := 0
+	for _, store := range sc.Stores {
+		if store.Code == "admin" || !store.Active {
+			continue
+		}
+		storefront++
+		add(sc.StoreLocale(store))
+	}
+	if storefront > 0 {
+		return locales
+	}
+
+	add(sc.StoreLocale(StoreView{}))
+	for _, system := range sc.systems {
+		for _, scopeType := range []string{"websites", "stores"} {
+			scopes, _ := phpArrayPath(system, scopeType).(map[string]interface{})
+			codes := make([]string, 0, len(scopes))
+			for code := range scopes {
+				codes = append(codes, code)
+			}
+			sort.Strings(codes)
+			for _, code := range codes {
+				add(phpArrayPathString(scopes[code], "general", "locale", "code"))
+			}
+		}
+	}
+	return locales
+}
+
+// autoLocales returns the distinct locales of the active storefront store views for
+// --language auto. Unlike 'all' it doesn't fall back to the locales of any scope: without
+// store views in app/etc/config.php it fails instead of guessing
+func autoLocales(magentoRoot string) ([]string, error) {
+	sc, err := loadStoreConfig(magentoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var locales, found []string
+	seen := make(map[string]bool)
+	for _, store := range sc.Stores {
+		if store.Code == "admin" || !store.Active {
+			continue
+		}
+		locale := sc.StoreLocale(store)
+		found = append(found, locale+" ("+store.Code+")")
+		if !seen[locale] {
+			seen[locale] = true
+			locales = append(locales, locale)
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no active store views in app/etc/config.php; dump them with bin/magento app:config:dump or use --database")
+	}
+	logInfof("Locales of the store views: %s", strings.Join(found, ", "))
+	return locales, nil
+}
+
+// createStoreDeployJobs creates frontend jobs for the theme and locale of each store view
+// Other areas get their standard theme (see resolveAreaThemes) for the store locales
+func createStoreDeployJobs(magentoRoot string, storeCodes []string, areas []string, expand bool, verbose bool) ([]DeployJob, error) {
+	sc, err := loadStoreConfig(magentoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []DeployJob
+	var locales []string
+	var otherAreas []string
+	seen := make(map[DeployJob]bool)
+
+	deployFrontend := false
+	for _, area := range areas {
+		if area == "frontend" {
+			deployFrontend = true
+		} else {
+			otherAreas = append(otherAreas, area)
+		}
+	}
+
+	for _, code := range storeCodes {
+		store, ok := sc.findStore(code)
+		if !ok {
+			return nil, fmt.Errorf("unknown store view: %s", code)
+		}
+
+		locale := sc.StoreLocale(store)
+		locales = append(locales, locale)
+
+		theme, err := sc.StoreTheme(store)
+		if err != nil {
+			return nil, err
+		}
+		if verbose {
+			logDebugf("Store view %s: %s (%s)", code, theme, locale)
+		}
+
+		job := DeployJob{Locale: locale, Theme: theme, Area: "frontend"}
+		if deployFrontend && !seen[job] {
+			seen[job] = true
+			jobs = append(jobs, job)
+		}
+	}
+
+	if len(otherAreas) > 0 {
+		areaThemes := resolveAreaThemes(magentoRoot, nil, otherAreas, expand, verbose)
+		for _, job := range createDeployJobs(locales, areaThemes, otherAreas) {
+			if !seen[job] {
+				seen[job] = true
+				jobs = append(jobs, job)
+			}
+		}
+	}
+
+	return jobs, nil
+}
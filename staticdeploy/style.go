@@ -0,0 +1,85 @@
+package staticdeploy
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// Symbols marking the status of jobs and files in logs and command output; plainSymbols
+// replaces them with ASCII for dumb terminals and log collectors
+var (
+	symOK    = "✓"
+	symFail  = "✗"
+	symSkip  = "⊘"
+	symRetry = "↻"
+	symWarn  = "⚠"
+	symArrow = "→"
+	symTheme = "🎨 "
+	symRule  = "─"
+)
+
+// noColor disables colors and uses plain symbols (--no-color, NO_COLOR or TERM=dumb)
+var noColor bool
+
+func init() {
+	// Also for commands, which don't parse --no-color
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		plainSymbols()
+	}
+}
+
+// plainSymbols switches to ASCII symbols and disables colors
+func plainSymbols() {
+	noColor = true
+	symOK = "OK"
+	symFail = "FAIL"
+	symSkip = "SKIP"
+	symRetry = "RETRY"
+	symWarn = "WARN"
+	symArrow = "->"
+	symTheme = ""
+	symRule = "-"
+}
+
+// rule returns a horizontal line separating sections of the results
+func rule() string {
+	return strings.Repeat(symRule, 57)
+}
+
+// ANSI colors of the console
+const (
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiReset  = "\033[0m"
+)
+
+// useColor reports whether output to w is colored: only terminals, unless colors are disabled
+func useColor(w io.Writer) bool {
+	if noColor {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && isTerminal(f)
+}
+
+// colorize colors the status symbol or level prefix a line (after its indentation) starts with
+func colorize(line string) string {
+	trimmed := strings.TrimLeft(line, "\n ")
+	indent := line[:len(line)-len(trimmed)]
+	for _, style := range []struct{ prefix, color string }{
+		{symOK, ansiGreen},
+		{symFail, ansiRed},
+		{symSkip, ansiYellow},
+		{symRetry, ansiYellow},
+		{symWarn, ansiYellow},
+		{"Error:", ansiRed},
+		{"Warning:", ansiYellow},
+	} {
+		if strings.HasPrefix(trimmed, style.prefix) {
+			return indent + style.color + style.prefix + ansiReset + trimmed[len(style.prefix):]
+		}
+	}
+	return line
+}
@@ -0,0 +1,437 @@
+package staticdeploy
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultBundleLogs are the Magento logs included in a support bundle
+var defaultBundleLogs = []string{"var/log/exception.log", "var/log/system.log"}
+
+// maxBundleLogSize caps each log in a support bundle, only the end of a larger log is kept
+const maxBundleLogSize = 1 << 20
+
+func init() {
+	registerCommand(Command{
+		Name:        "export-support-bundle",
+		Description: "Package the report, redacted config, environment and theme resolution traces for an issue",
+		Run:         runExportSupportBundle,
+	})
+}
+
+// runExportSupportBundle implements the export-support-bundle subcommand
+func runExportSupportBundle(args []string) error {
+	flags := flag.NewFlagSet("export-support-bundle", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory")
+	configPath := flags.StringP("config", "c", "", "Path to config file (default: static-deploy.yaml/.yml/.json in the root)")
+	reportPath := flags.String("report", "", "Report of the run to diagnose, written with --report")
+	output := flags.StringP("output", "o", "", "Archive to write (default: static-deploy-support-<timestamp>.tar.gz)")
+	themes := flags.StringArrayP("theme", "t", nil, "Also trace the resolution of this theme (can be repeated)")
+	logs := flags.StringArray("log", defaultBundleLogs, "Log file to include, relative to the root (can be repeated)")
+	noLogs := flags.Bool("no-logs", false, "Leave out all logs")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s export-support-bundle [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Writes a tar.gz to attach to issues, with the report, the config (credentials and URL\n")
+		fmt.Fprintf(os.Stderr, "secrets redacted), the environment, resolution traces of the failed and skipped themes\n")
+		fmt.Fprintf(os.Stderr, "of the report, the state of an interrupted run and the end of the Magento logs\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		*output = fmt.Sprintf("static-deploy-support-%s.tar.gz", time.Now().Format("20060102-150405"))
+	}
+
+	bundle := &supportBundle{files: make(map[string][]byte)}
+
+	var report *Report
+	if *reportPath != "" {
+		var err error
+		if report, err = loadReport(*reportPath); err != nil {
+			return err
+		}
+		data, _ := json.MarshalIndent(report, "", "  ")
+		bundle.add("report.json", data)
+	}
+
+	cfg, err := loadConfig(*root, *configPath)
+	if err != nil {
+		bundle.note("config: %v", err)
+	} else if data, err := yaml.Marshal(redactConfig(cfg)); err == nil {
+		bundle.add("config.yaml", data)
+	}
+
+	bundle.add("environment.txt", []byte(describeEnvironment(*root)))
+
+	var traced strings.Builder
+	for _, job := range bundleTraceJobs(report, *themes) {
+		traceThemeResolution(&traced, *root, job.Area, job.Theme)
+	}
+	if traced.Len() > 0 {
+		bundle.add("resolution.txt", []byte(traced.String()))
+	}
+
+	if data, err := os.ReadFile(filepath.Join(*root, runStateFile)); err == nil {
+		bundle.add("run-state.json", data)
+	}
+	if !*noLogs {
+		for _, name := range *logs {
+			data, err := readLogTail(filepath.Join(*root, name), maxBundleLogSize)
+			if err != nil {
+				bundle.note("%v", err)
+				continue
+			}
+			bundle.add("logs/"+filepath.Base(name), data)
+		}
+	}
+
+	if err := bundle.write(*output); err != nil {
+		return fmt.Errorf("failed to write support bundle: %w", err)
+	}
+	fmt.Printf("Support bundle written to %s:\n", *output)
+	for _, name := range bundle.names() {
+		fmt.Printf("  %s\n", name)
+	}
+	fmt.Printf("Review it before attaching it to an issue, logs are included as they are\n")
+	return nil
+}
+
+// supportBundle collects the files of a support bundle in memory, with notes on what
+// couldn't be included
+type supportBundle struct {
+	files map[string][]byte
+	notes []string
+}
+
+// add includes a file in the bundle
+func (b *supportBundle) add(name string, data []byte) {
+	b.files[name] = data
+}
+
+// note records why something is missing from the bundle
+func (b *supportBundle) note(format string, args ...interface{}) {
+	b.notes = append(b.notes, fmt.Sprintf(format, args...))
+}
+
+// names returns the files of the bundle, sorted
+func (b *supportBundle) names() []string {
+	names := make([]string, 0, len(b.files))
+	for name := range b.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// write writes the bundle as a gzipped tarball, with the notes in missing.txt
+func (b *supportBundle) write(path string) error {
+	if len(b.notes) > 0 {
+		b.add("missing.txt", []byte(strings.Join(b.notes, "\n")+"\n"))
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, name := range b.names() {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(b.files[name])), ModTime: now}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(b.files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes(), 0600)
+}
+
+// bundleTraceJobs returns the themes to trace per area: those that failed or were skipped
+// (no files and no error, the theme wasn't found) in the report, and the given themes
+func bundleTraceJobs(report *Report, themes []string) []DeployJob {
+	var jobs []DeployJob
+	seen := make(map[string]bool)
+	add := func(area string, theme string) {
+		if !seen[area+"/"+theme] {
+			seen[area+"/"+theme] = true
+			jobs = append(jobs, DeployJob{Area: area, Theme: theme})
+		}
+	}
+	if report != nil {
+		for _, job := range report.Jobs {
+			if job.Error != "" || job.Files == 0 {
+				add(job.Area, job.Theme)
+			}
+		}
+	}
+	for _, theme := range themes {
+		add("frontend", theme)
+		add("adminhtml", theme)
+	}
+	return jobs
+}
+
+// redactConfig returns a copy of the config without secrets: credential helper commands, the
+// arguments of commands, the string values of options not known to be safe, and the user info
+// and query values of URLs; environments are redacted like the config. Credential environment
+// variables and files are only names and paths, they're kept
+func redactConfig(cfg *Config) *Config {
+	redacted := *cfg
+	redacted.HTTP.Proxy = redactURL(cfg.HTTP.Proxy)
+	redacted.Remote.Target = redactURL(cfg.Remote.Target)
+	if cfg.Credentials != nil {
+		redacted.Credentials = make(map[string]CredentialSource, len(cfg.Credentials))
+		for name, source := range cfg.Credentials {
+			if source.Command != "" {
+				source.Command = "REDACTED"
+			}
+			redacted.Credentials[name] = source
+		}
+	}
+	if cfg.ThemeBuilds != nil {
+		redacted.ThemeBuilds = make(map[string]ThemeBuild, len(cfg.ThemeBuilds))
+		for theme, build := range cfg.ThemeBuilds {
+			build.Command = redactCommand(build.Command)
+			redacted.ThemeBuilds[theme] = build
+		}
+	}
+	redacted.MagentoCommands = nil
+	for _, command := range cfg.MagentoCommands {
+		command.Command = redactCommand(command.Command)
+		redacted.MagentoCommands = append(redacted.MagentoCommands, command)
+	}
+	redacted.Hooks = Hooks{
+		PreDeploy:  redactCommands(cfg.Hooks.PreDeploy),
+		PostJob:    redactCommands(cfg.Hooks.PostJob),
+		PostDeploy: redactCommands(cfg.Hooks.PostDeploy),
+		OnFailure:  redactCommands(cfg.Hooks.OnFailure),
+	}
+	if cfg.Options != nil {
+		redacted.Options = make(map[string]any, len(cfg.Options))
+		for name, value := range cfg.Options {
+			redacted.Options[name] = redactOption(name, value)
+		}
+	}
+	if cfg.Environments != nil {
+		redacted.Environments = make(map[string]any, len(cfg.Environments))
+		for name, overrides := range cfg.Environments {
+			redacted.Environments[name] = redactEnvironment(overrides)
+		}
+	}
+	return &redacted
+}
+
+// safeOptions are the deploy options whose values are names or settings, never secrets
+var safeOptions = map[string]bool{
+	"area": true, "theme": true, "exclude-theme": true, "store": true, "language": true,
+	"strategy": true, "version-on": true, "preset": true, "mode": true, "symlink": true,
+	"images": true, "backup": true, "since": true, "compare": true, "exclude": true,
+	"log-level": true, "log-format": true, "output": true, "progress": true,
+	"otlp-protocol": true, "php-memory-limit": true, "standby": true, "only-job": true,
+}
+
+// redactOption returns the value of an option of the config file without secrets: numbers and
+// booleans are kept, strings only for safeOptions
+func redactOption(name string, value any) any {
+	switch value := value.(type) {
+	case []any:
+		items := make([]any, len(value))
+		for i, item := range value {
+			items[i] = redactOption(name, item)
+		}
+		return items
+	case string:
+		if !safeOptions[name] {
+			return "REDACTED"
+		}
+	}
+	return value
+}
+
+// redactCommand keeps the program of a command line, its arguments may hold secrets
+func redactCommand(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) <= 1 {
+		return command
+	}
+	return fields[0] + " REDACTED"
+}
+
+// redactCommands applies redactCommand to every command of a list
+func redactCommands(commands []string) []string {
+	if commands == nil {
+		return nil
+	}
+	redacted := make([]string, len(commands))
+	for i, command := range commands {
+		redacted[i] = redactCommand(command)
+	}
+	return redacted
+}
+
+// redactEnvironment redacts the section of an environment like the config it's merged over,
+// keeping only the keys the section sets
+func redactEnvironment(overrides any) any {
+	var section Config
+	data, err := yaml.Marshal(overrides)
+	if err != nil || yaml.Unmarshal(data, &section) != nil {
+		return "REDACTED"
+	}
+	section.Environments = nil
+	var redacted any
+	data, err = yaml.Marshal(redactConfig(&section))
+	if err != nil || yaml.Unmarshal(data, &redacted) != nil {
+		return "REDACTED"
+	}
+	return keepKeys(redacted, overrides)
+}
+
+// keepKeys returns the maps of redacted limited to the keys of original, recursively
+func keepKeys(redacted any, original any) any {
+	originalMap, ok := original.(map[string]any)
+	redactedMap, ok2 := redacted.(map[string]any)
+	if !ok || !ok2 {
+		return redacted
+	}
+	kept := make(map[string]any, len(originalMap))
+	for key, value := range originalMap {
+		kept[key] = keepKeys(redactedMap[key], value)
+	}
+	return kept
+}
+
+// redactURL replaces the user info and query values of a URL
+func redactURL(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "REDACTED"
+	}
+	if u.User != nil {
+		u.User = url.User("REDACTED")
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			query.Set(key, "REDACTED")
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// describeEnvironment summarizes the system, the Magento installation and the themes found,
+// as theme detection sees them
+func describeEnvironment(magentoRoot string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Generated: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&sb, "Go: %s %s/%s, %d CPUs\n", runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+	if abs, err := filepath.Abs(magentoRoot); err == nil {
+		fmt.Fprintf(&sb, "Magento root: %s\n", abs)
+	}
+	fmt.Fprintf(&sb, "Magento: %s\n", magentoVersion(magentoRoot))
+	if data, err := os.ReadFile(filepath.Join(magentoRoot, "pub/static/deployed_version.txt")); err == nil {
+		fmt.Fprintf(&sb, "Deployed version: %s\n", strings.TrimSpace(string(data)))
+	}
+
+	// Only the names of our own variables, their values may be secrets
+	sb.WriteString("\nEnvironment variables:\n")
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		switch {
+		case name == "PHP_BINARY" || name == "PHP_MEMORY_LIMIT":
+			fmt.Fprintf(&sb, "  %s=%s\n", name, value)
+		case strings.HasPrefix(name, "STATIC_DEPLOY_"):
+			fmt.Fprintf(&sb, "  %s (set)\n", name)
+		}
+	}
+
+	sb.WriteString("\nThemes:\n")
+	for _, theme := range discoverThemes(magentoRoot) {
+		rel, err := filepath.Rel(magentoRoot, theme.Path)
+		if err != nil {
+			rel = theme.Path
+		}
+		fmt.Fprintf(&sb, "  %-10s %-30s %s", theme.Area, theme.Name, rel)
+		if theme.Parent != "" {
+			fmt.Fprintf(&sb, " (parent %s)", theme.Parent)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// magentoVersion reads the installed Magento version from composer.lock
+func magentoVersion(magentoRoot string) string {
+	data, err := os.ReadFile(filepath.Join(magentoRoot, "composer.lock"))
+	if err != nil {
+		return "unknown (no composer.lock)"
+	}
+	var lock struct {
+		Packages []struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	for _, pkg := range lock.Packages {
+		switch pkg.Name {
+		case "magento/product-community-edition", "magento/product-enterprise-edition", "magento/magento2-base":
+			return pkg.Name + " " + pkg.Version
+		}
+	}
+	return "unknown (no Magento package in composer.lock)"
+}
+
+// readLogTail reads at most max bytes from the end of a log, starting at a full line
+func readLogTail(path string, max int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() <= max {
+		return io.ReadAll(f)
+	}
+
+	if _, err := f.Seek(info.Size()-max, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if i := strings.IndexByte(string(data), '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	return data, nil
+}
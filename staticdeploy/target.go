@@ -0,0 +1,235 @@
+package staticdeploy
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// targetReleasesSuffix names the directory next to a remote pub/static holding its releases
+const targetReleasesSuffix = "-releases"
+
+// Web servers and remote stores pub/static is pushed to (--target) and the SSH command to
+// reach the servers
+var (
+	targetsFlag []string
+	targetSSH   string
+)
+
+// SSHTarget is a remote web server pub/static is pushed to after a deploy (--target)
+// The remote pub/static is a symlink to a release directory; a push uploads the tree into a
+// new release with rsync, hard linking the files unchanged since the current release, and
+// switches the symlink once all servers have the new release
+type SSHTarget struct {
+	url      *url.URL
+	dir      string // the remote pub/static
+	releases string // the directory holding the releases
+	ssh      []string
+}
+
+// TargetReport summarizes a push to a target
+type TargetReport struct {
+	Target   string
+	Release  string
+	Previous string // the release that was current before, kept for pages rendered before the switch
+	Duration time.Duration
+}
+
+// openTargets opens the --target URLs: web servers, ssh://[user@]host[:port]/path or the
+// scp-like ssh://[user@]host:/path, and remote stores such as s3://bucket/prefix
+func openTargets(locations []string, sshCommand string, magentoRoot string, cfg *Config) ([]*SSHTarget, []RemoteStore, error) {
+	var targets []*SSHTarget
+	var stores []RemoteStore
+	for _, location := range locations {
+		if !strings.HasPrefix(location, "ssh://") {
+			store, err := openRemoteStore(location, magentoRoot, cfg)
+			if err != nil {
+				return nil, nil, fmt.Errorf("--target: %w", err)
+			}
+			stores = append(stores, store)
+			continue
+		}
+		target, err := openSSHTarget(location, sshCommand)
+		if err != nil {
+			return nil, nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, stores, nil
+}
+
+// openSSHTarget parses an ssh:// target
+func openSSHTarget(location string, sshCommand string) (*SSHTarget, error) {
+	if err := requireNetwork("--target"); err != nil {
+		return nil, err
+	}
+	ssh, err := splitCommandLine(sshCommand)
+	if err != nil || len(ssh) == 0 {
+		return nil, fmt.Errorf("invalid --target-ssh command %q", sshCommand)
+	}
+	if _, err := exec.LookPath("rsync"); err != nil {
+		return nil, fmt.Errorf("--target needs rsync: %w", err)
+	}
+
+	u, err := url.Parse(location)
+	if err != nil || u.Hostname() == "" || !path.IsAbs(u.Path) {
+		return nil, fmt.Errorf("invalid --target %q, expected ssh://[user@]host[:port]/path", location)
+	}
+	if strings.HasPrefix(u.Hostname(), "-") || (u.User != nil && strings.HasPrefix(u.User.Username(), "-")) {
+		return nil, fmt.Errorf("invalid --target %q: host and user must not start with '-'", location)
+	}
+	dir := path.Clean(u.Path)
+	if dir == "/" {
+		return nil, fmt.Errorf("invalid --target %q: refusing to deploy to /", location)
+	}
+	return &SSHTarget{url: u, dir: dir, releases: dir + targetReleasesSuffix, ssh: ssh}, nil
+}
+
+// String returns the target URL for messages
+func (t *SSHTarget) String() string {
+	return t.url.Redacted()
+}
+
+// pushTargets uploads the static tree to all targets in parallel and, once every upload
+// succeeded, switches them to the new release one after another, so a failed upload leaves
+// all servers on their current release
+func pushTargets(targets []*SSHTarget, staticRoot string, version string, verbose bool) ([]TargetReport, error) {
+	release := fmt.Sprintf("%s-%s", version, time.Now().UTC().Format("20060102T150405.000"))
+	reports := make([]TargetReport, len(targets))
+	errs := make([]error, len(targets))
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			reports[i] = TargetReport{Target: target.String(), Release: release}
+			reports[i].Previous, errs[i] = target.upload(staticRoot, release, verbose)
+			reports[i].Duration = time.Since(start)
+		}()
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", targets[i], err))
+		}
+	}
+	if len(failed) > 0 {
+		for _, target := range targets {
+			target.discard(release)
+		}
+		return nil, fmt.Errorf("uploading failed, no target was switched:\n  %s", strings.Join(failed, "\n  "))
+	}
+
+	for i, target := range targets {
+		start := time.Now()
+		if err := target.activate(release, reports[i].Previous); err != nil {
+			return reports[:i], fmt.Errorf("%s: switching to release %s: %w", target, release, err)
+		}
+		reports[i].Duration += time.Since(start)
+	}
+	return reports, nil
+}
+
+// upload copies the static tree into a new release directory and returns the current release
+func (t *SSHTarget) upload(staticRoot string, release string, verbose bool) (string, error) {
+	// The current release, or the existing pub/static directory before the first push,
+	// provides the hard links for the unchanged files
+	script := fmt.Sprintf("mkdir -p %[1]s && if [ -L %[2]s ]; then basename \"$(readlink %[2]s)\"; elif [ -d %[2]s ]; then echo .; fi",
+		shellQuote(t.releases), shellQuote(t.dir))
+	output, err := runSSH(t.url, t.ssh, script)
+	if err != nil {
+		return "", err
+	}
+	current := strings.TrimSpace(string(output))
+	if current == release {
+		return "", fmt.Errorf("release %s is already current", release)
+	}
+
+	args := []string{"-a", "--delete", "--protect-args", "-e", t.rsyncShell()}
+	switch current {
+	case "":
+	case ".":
+		args = append(args, "--link-dest="+t.dir)
+	default:
+		args = append(args, "--link-dest="+path.Join(t.releases, current))
+	}
+	if verbose {
+		args = append(args, "--itemize-changes")
+	}
+	args = append(args, strings.TrimSuffix(staticRoot, "/")+"/", t.remoteHost()+":"+path.Join(t.releases, release)+"/")
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("rsync", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("rsync: %w: %s", err, message)
+		}
+		return "", fmt.Errorf("rsync: %w", err)
+	}
+	if verbose {
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			if line != "" {
+				logDebugf("  %s %s", t, line)
+			}
+		}
+	}
+	return current, nil
+}
+
+// activate points the remote pub/static to the release with an atomic rename of a symlink
+// and removes the releases older than the previous one
+// Before the first push pub/static is a directory, which is moved into the releases first,
+// leaving it missing for the moment between the two renames
+func (t *SSHTarget) activate(release string, previous string) error {
+	link := t.dir + ".static-deploy-link"
+	var script strings.Builder
+	if previous == "." {
+		previous = "initial"
+		fmt.Fprintf(&script, "rm -rf %[1]s && mv %[2]s %[1]s && ", shellQuote(path.Join(t.releases, previous)), shellQuote(t.dir))
+	}
+	fmt.Fprintf(&script, "ln -sfn %s %s && mv -T %s %s",
+		shellQuote(path.Join(t.releases, release)), shellQuote(link), shellQuote(link), shellQuote(t.dir))
+	fmt.Fprintf(&script, " && cd %s && for release in *; do case \"$release\" in %s|%s) ;; *) rm -rf \"$release\" ;; esac; done",
+		shellQuote(t.releases), shellQuote(release), shellQuote(previous))
+	_, err := runSSH(t.url, t.ssh, script.String())
+	return err
+}
+
+// discard removes an uploaded release that won't be activated
+func (t *SSHTarget) discard(release string) {
+	if _, err := runSSH(t.url, t.ssh, "rm -rf "+shellQuote(path.Join(t.releases, release))); err != nil {
+		logWarnf("%s: removing unused release %s: %v", t, release, err)
+	}
+}
+
+// rsyncShell returns the remote shell rsync connects with, the --target-ssh command with the
+// port of the target
+func (t *SSHTarget) rsyncShell() string {
+	args := append([]string{}, t.ssh...)
+	if t.url.Port() != "" {
+		args = append(args, "-p", t.url.Port())
+	}
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// remoteHost returns [user@]host as given to ssh and rsync
+func (t *SSHTarget) remoteHost() string {
+	if t.url.User != nil {
+		return t.url.User.Username() + "@" + t.url.Hostname()
+	}
+	return t.url.Hostname()
+}
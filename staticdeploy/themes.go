@@ -0,0 +1,168 @@
+package staticdeploy
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ThemeInfo describes a theme discovered in app/design or vendor
+type ThemeInfo struct {
+	Name   string // Vendor/theme
+	Area   string
+	Path   string
+	Parent string
+}
+
+// themeRegistrationPattern matches theme registrations in registration.php, e.g.
+// ComponentRegistrar::register(ComponentRegistrar::THEME, 'frontend/Hyva/default', __DIR__);
+var themeRegistrationPattern = regexp.MustCompile(`ComponentRegistrar::THEME\s*,\s*['"]([a-z]+)/([^/'"]+/[^/'"]+)['"]`)
+
+// Discovered themes are cached per Magento root, the listing doesn't change during a run
+var (
+	themeListMu    sync.Mutex
+	themeListCache = make(map[string][]ThemeInfo)
+)
+
+// discoverThemes lists all themes installed in app/design/{area}/{Vendor}/{theme}
+// and in vendor packages registering a theme, sorted by area and name
+// Themes in app/design take precedence over vendor themes with the same name
+func discoverThemes(magentoRoot string) []ThemeInfo {
+	themeListMu.Lock()
+	defer themeListMu.Unlock()
+
+	if themes, ok := themeListCache[magentoRoot]; ok {
+		return themes
+	}
+
+	var themes []ThemeInfo
+	seen := make(map[string]bool)
+
+	add := func(theme ThemeInfo) {
+		key := theme.Area + "/" + theme.Name
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		theme.Parent = getThemeParent(theme.Path)
+		themes = append(themes, theme)
+	}
+
+	// app/design/{area}/{Vendor}/{theme}
+	designDirs, _ := filepath.Glob(filepath.Join(magentoRoot, "app/design", "*", "*", "*"))
+	for _, dir := range designDirs {
+		if _, err := os.Stat(filepath.Join(dir, "theme.xml")); err != nil {
+			continue
+		}
+		rel, _ := filepath.Rel(filepath.Join(magentoRoot, "app/design"), dir)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		add(ThemeInfo{
+			Name: parts[1] + "/" + parts[2],
+			Area: parts[0],
+			Path: dir,
+		})
+	}
+
+	// vendor/{vendor}/{package}/registration.php
+	registrations, _ := filepath.Glob(filepath.Join(magentoRoot, "vendor", "*", "*", "registration.php"))
+	for _, registration := range registrations {
+		data, err := os.ReadFile(registration)
+		if err != nil {
+			continue
+		}
+		for _, match := range themeRegistrationPattern.FindAllStringSubmatch(string(data), -1) {
+			add(ThemeInfo{
+				Name: match[2],
+				Area: match[1],
+				Path: filepath.Dir(registration),
+			})
+		}
+	}
+
+	sort.SliceStable(themes, func(i, j int) bool {
+		if themes[i].Area != themes[j].Area {
+			return themes[i].Area < themes[j].Area
+		}
+		return themes[i].Name < themes[j].Name
+	})
+
+	themeListCache[magentoRoot] = themes
+	return themes
+}
+
+// excludeThemePatterns removes the themes matching any of patterns (names or patterns like
+// 'Magento/*', see --exclude-theme)
+func excludeThemePatterns(themes []string, patterns []string, verbose bool) []string {
+	if len(patterns) == 0 {
+		return themes
+	}
+	var kept []string
+	for _, theme := range themes {
+		excluded := false
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, theme); matched {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, theme)
+		} else if verbose {
+			logDebugf("Excluding theme %s (--exclude-theme)", theme)
+		}
+	}
+	return kept
+}
+
+// findRegisteredTheme returns the path of a theme registered by a vendor package, or ""
+func findRegisteredTheme(magentoRoot string, area string, themeName string) string {
+	for _, theme := range discoverThemes(magentoRoot) {
+		if theme.Area == area && theme.Name == themeName {
+			return theme.Path
+		}
+	}
+	return ""
+}
+
+// isThemePattern reports whether a --theme value selects multiple themes
+func isThemePattern(theme string) bool {
+	return theme == "all" || strings.ContainsAny(theme, "*?[")
+}
+
+// expandThemePatterns resolves 'all' and glob patterns like 'Vendor/*' to the themes
+// discovered for the given area; plain theme names are kept as-is
+func expandThemePatterns(magentoRoot string, area string, patterns []string) []string {
+	var themes []string
+	seen := make(map[string]bool)
+
+	add := func(theme string) {
+		if !seen[theme] {
+			seen[theme] = true
+			themes = append(themes, theme)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !isThemePattern(pattern) {
+			add(pattern)
+			continue
+		}
+
+		for _, theme := range discoverThemes(magentoRoot) {
+			if theme.Area != area {
+				continue
+			}
+			if pattern == "all" {
+				add(theme.Name)
+			} else if matched, _ := path.Match(pattern, theme.Name); matched {
+				add(theme.Name)
+			}
+		}
+	}
+
+	return themes
+}
@@ -0,0 +1,105 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ThemeSource is an additional static source directory of a theme (the theme_sources section of
+// the config file), e.g. the compiled assets of a design system package outside app/design
+type ThemeSource struct {
+	Path     string `yaml:"path" json:"path"`         // relative to the Magento root, or absolute
+	Module   string `yaml:"module" json:"module"`     // deploy below this module, e.g. Acme_DesignSystem
+	Priority int    `yaml:"priority" json:"priority"` // relative to the standard sources, see themeSourcePriority
+}
+
+// Priorities of the standard sources; a theme source takes precedence over the standard sources
+// with the same or a lower priority, e.g. 250 overrides lib/web but not the theme chain
+const (
+	themeSourcePriority  = 300 // app/design and vendor theme web directories and module overrides
+	libSourcePriority    = 200 // lib/web
+	moduleSourcePriority = 100 // module view files
+)
+
+// themeSources are the additional sources per theme (Vendor/theme) from the config file
+var themeSources map[string][]ThemeSource
+
+// validateThemeSources checks the theme_sources section: theme names, module names and that
+// every directory exists
+func validateThemeSources(magentoRoot string, sources map[string][]ThemeSource) error {
+	for theme, list := range sources {
+		if parts := strings.Split(theme, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("theme_sources: invalid theme name %q, expected Vendor/theme", theme)
+		}
+		for _, source := range list {
+			if source.Path == "" {
+				return fmt.Errorf("theme_sources: %s has a source without path", theme)
+			}
+			if source.Module != "" && !moduleDirPattern.MatchString(source.Module) {
+				return fmt.Errorf("theme_sources: %s: invalid module name %q, expected Vendor_Module", theme, source.Module)
+			}
+			info, err := os.Stat(themeSourceDir(magentoRoot, source))
+			if err != nil {
+				return fmt.Errorf("theme_sources: %s: %w", theme, err)
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("theme_sources: %s: %s is not a directory", theme, source.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// themeSourceDir returns the directory of a theme source
+func themeSourceDir(magentoRoot string, source ThemeSource) string {
+	if filepath.IsAbs(source.Path) {
+		return source.Path
+	}
+	return filepath.Join(magentoRoot, source.Path)
+}
+
+// themeSourcesBetween returns the sources of a theme with a priority of at least low and below
+// high, highest first; sources with the same priority keep their configured order
+func themeSourcesBetween(theme string, low int, high int) []ThemeSource {
+	var selected []ThemeSource
+	for _, source := range themeSources[theme] {
+		if source.Priority >= low && source.Priority < high {
+			selected = append(selected, source)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].Priority > selected[j].Priority
+	})
+	return selected
+}
+
+// queueThemeSources queues the files of theme sources like those of the standard sources,
+// returning the number of files
+func queueThemeSources(magentoRoot string, sources []ThemeSource, destDir string, copier *fileCopier) (int64, error) {
+	var fileCount int64
+	for _, source := range sources {
+		count, err := copyDirectoryWithModulePrefix(themeSourceDir(magentoRoot, source), destDir, source.Module, copier)
+		if err != nil {
+			return fileCount, fmt.Errorf("theme source %s: %w", source.Path, err)
+		}
+		fileCount += count
+	}
+	return fileCount, nil
+}
+
+// themeSourceOf returns the themes with a source containing path (relative to the Magento root)
+func themeSourceOf(magentoRoot string, path string) []string {
+	var themes []string
+	for theme, list := range themeSources {
+		for _, source := range list {
+			rel, err := filepath.Rel(themeSourceDir(magentoRoot, source), filepath.Join(magentoRoot, path))
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+				themes = appendUnique(themes, theme)
+			}
+		}
+	}
+	return themes
+}
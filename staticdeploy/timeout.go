@@ -0,0 +1,82 @@
+package staticdeploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Limits of the deployment (--timeout) and of every job (--job-timeout), 0 for none
+var (
+	runTimeout time.Duration
+	jobTimeout time.Duration
+)
+
+// timeoutError is the error of work stopped by --timeout or --job-timeout
+type timeoutError struct {
+	flag  string
+	after time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s (%s)", e.after, e.flag)
+}
+
+// stopReason returns why ctx stopped the work: a timeoutError of --timeout, else errInterrupted
+// (a signal, or the end of the context of Deploy)
+func stopReason(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && runTimeout > 0 {
+		return &timeoutError{flag: "--timeout", after: runTimeout}
+	}
+	return errInterrupted
+}
+
+// deployWithTimeout runs a job's deploy with --job-timeout and --timeout applied
+// A copy stuck in the kernel (e.g. on a hanging NFS mount) can't be canceled, so on a timeout
+// the job is failed without waiting for it; its pool workers are abandoned
+func deployWithTimeout(ctx context.Context, pool *filePool, deploy func(ctx context.Context) (int64, error)) (int64, error) {
+	jobCtx, cancel := ctx, context.CancelFunc(func() {})
+	if jobTimeout > 0 {
+		jobCtx, cancel = context.WithTimeout(ctx, jobTimeout)
+	}
+	defer cancel()
+	start := time.Now()
+
+	// Closed on deadlines only; an interruption waits for the copies in progress
+	expired := make(chan struct{})
+	stop := context.AfterFunc(jobCtx, func() {
+		if errors.Is(jobCtx.Err(), context.DeadlineExceeded) {
+			close(expired)
+		}
+	})
+	defer stop()
+
+	reason := func() error {
+		if jobTimeout > 0 && time.Since(start) >= jobTimeout {
+			return &timeoutError{flag: "--job-timeout", after: jobTimeout}
+		}
+		return stopReason(jobCtx)
+	}
+
+	type outcome struct {
+		files int64
+		err   error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		files, err := deploy(jobCtx)
+		done <- outcome{files, err}
+	}()
+
+	select {
+	case out := <-done:
+		if out.err != nil && errors.Is(jobCtx.Err(), context.DeadlineExceeded) {
+			return out.files, reason()
+		}
+		return out.files, out.err
+	case <-expired:
+		pool.Abandon()
+		return 0, reason()
+	}
+}
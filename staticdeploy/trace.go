@@ -0,0 +1,156 @@
+package staticdeploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// traceThemes are the themes whose resolution is traced (--trace-resolution)
+var traceThemes []string
+
+// traceThemeResolution writes every candidate location of a theme in an area with whether
+// it exists, the resolved path, and the same for its parents
+func traceThemeResolution(w io.Writer, magentoRoot string, area string, theme string) {
+	fmt.Fprintf(w, "Theme resolution: %s (%s)\n", theme, area)
+	traceTheme(w, magentoRoot, area, theme, "  ", make(map[string]bool))
+	fmt.Fprintln(w)
+}
+
+// traceTheme traces a theme and, through theme.xml, its parent chain
+func traceTheme(w io.Writer, magentoRoot string, area string, theme string, indent string, visited map[string]bool) {
+	if visited[theme] {
+		fmt.Fprintf(w, "%s%s %s is its own ancestor (parent loop), stopping\n", indent, symFail, theme)
+		return
+	}
+	visited[theme] = true
+
+	if len(strings.Split(theme, "/")) != 2 {
+		fmt.Fprintf(w, "%s%s invalid theme name %q, expected Vendor/theme\n", indent, symFail, theme)
+		return
+	}
+
+	rel := func(path string) string {
+		if r, err := filepath.Rel(magentoRoot, path); err == nil && !strings.HasPrefix(r, "..") {
+			return r
+		}
+		return path
+	}
+	check := func(label string, path string) bool {
+		_, err := os.Stat(path)
+		fmt.Fprintf(w, "%s%s %-18s %s%s\n", indent, mark(err == nil), label, rel(path), statNote(err))
+		return err == nil
+	}
+
+	// Candidates in the order getThemePath checks them
+	check("app/design", filepath.Join(magentoRoot, "app/design", area, theme))
+	if vendorPath := getVendorThemePath(area, theme); vendorPath != "" {
+		check("vendor package", filepath.Join(magentoRoot, vendorPath))
+	}
+
+	registered := findRegisteredTheme(magentoRoot, area, theme)
+	if registered != "" {
+		fmt.Fprintf(w, "%s%s %-18s %s\n", indent, symOK, "registration.php", rel(filepath.Join(registered, "registration.php")))
+	} else {
+		fmt.Fprintf(w, "%s%s %-18s no vendor/*/*/registration.php registers %s/%s\n", indent, symFail, "registration.php", area, theme)
+	}
+
+	themePath := getThemePath(magentoRoot, area, theme)
+	if themePath == "" {
+		if len(visited) > 1 {
+			fmt.Fprintf(w, "%s%s not found: the files of parent theme %s are missing from the deployment\n", indent, symArrow, theme)
+		} else {
+			fmt.Fprintf(w, "%s%s not found: jobs of %s in %s are skipped (theme not found)\n", indent, symArrow, theme, area)
+		}
+		traceNearMisses(w, magentoRoot, area, theme, indent)
+		traceComposerThemes(w, magentoRoot, indent)
+		return
+	}
+	fmt.Fprintf(w, "%s%s resolved to %s\n", indent, symArrow, rel(themePath))
+
+	check("web directory", filepath.Join(themePath, "web"))
+	if !check("theme.xml", filepath.Join(themePath, "theme.xml")) {
+		return
+	}
+	parent := getThemeParent(themePath)
+	if parent == "" {
+		fmt.Fprintf(w, "%s  no parent theme\n", indent)
+		return
+	}
+	fmt.Fprintf(w, "%s  parent: %s\n", indent, parent)
+	traceTheme(w, magentoRoot, area, parent, indent+"  ", visited)
+}
+
+// traceNearMisses lists discovered themes whose name differs only in case or that exist in
+// another area, the usual causes of a theme not being found
+func traceNearMisses(w io.Writer, magentoRoot string, area string, theme string, indent string) {
+	for _, info := range discoverThemes(magentoRoot) {
+		switch {
+		case info.Area == area && strings.EqualFold(info.Name, theme):
+			fmt.Fprintf(w, "%s  did you mean %s? (%s)\n", indent, info.Name, info.Path)
+		case info.Area != area && info.Name == theme:
+			fmt.Fprintf(w, "%s  %s exists in the %s area (%s)\n", indent, theme, info.Area, info.Path)
+		}
+	}
+}
+
+// traceComposerThemes lists the installed composer packages of type magento2-theme with the
+// themes their registration.php registers
+func traceComposerThemes(w io.Writer, magentoRoot string, indent string) {
+	files, _ := filepath.Glob(filepath.Join(magentoRoot, "vendor", "*", "*", "composer.json"))
+	sort.Strings(files)
+
+	found := false
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var pkg struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(data, &pkg) != nil || pkg.Type != "magento2-theme" {
+			continue
+		}
+		if !found {
+			fmt.Fprintf(w, "%s  composer packages of type magento2-theme:\n", indent)
+			found = true
+		}
+
+		registers := "no theme registration"
+		if registration, err := os.ReadFile(filepath.Join(filepath.Dir(file), "registration.php")); err == nil {
+			var names []string
+			for _, match := range themeRegistrationPattern.FindAllStringSubmatch(string(registration), -1) {
+				names = append(names, match[1]+"/"+match[2])
+			}
+			if len(names) > 0 {
+				registers = "registers " + strings.Join(names, ", ")
+			}
+		}
+		fmt.Fprintf(w, "%s    %s (%s): %s\n", indent, pkg.Name, filepath.Dir(file), registers)
+	}
+	if !found {
+		fmt.Fprintf(w, "%s  no composer packages of type magento2-theme in vendor/\n", indent)
+	}
+}
+
+// mark returns the check mark of a trace line
+func mark(ok bool) string {
+	if ok {
+		return symOK
+	}
+	return symFail
+}
+
+// statNote explains why a candidate path can't be used, other than not existing
+func statNote(err error) string {
+	if err == nil || os.IsNotExist(err) {
+		return ""
+	}
+	return fmt.Sprintf(" (%v)", err)
+}
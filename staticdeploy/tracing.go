@@ -0,0 +1,146 @@
+package staticdeploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// OTLP trace export options
+var (
+	otlpEndpoint string // --otlp-endpoint, e.g. http://localhost:4318
+	otlpProtocol string // --otlp-protocol: grpc or http/protobuf
+)
+
+// tracerShutdownTimeout limits exporting the remaining spans at the end of a run
+const tracerShutdownTimeout = 5 * time.Second
+
+// tracerName is the instrumentation name of the spans
+const tracerName = "github.com/elgentos/magento2-static-deploy"
+
+// tracer creates the spans of the deploy pipeline; they're dropped unless setupTracing
+// configured an exporter
+var tracer trace.Tracer = noop.NewTracerProvider().Tracer(tracerName)
+
+// tracerProvider exports the spans, nil when tracing is off. It's the provider of the run
+// only, the global one of otel is left to the program
+var tracerProvider *sdktrace.TracerProvider
+
+// tracingFromEnv enables tracing with the OTEL_EXPORTER_OTLP_* variables of the process; Deploy,
+// running in another program, only traces with --otlp-endpoint
+var tracingFromEnv = true
+
+// setupTracing exports spans over OTLP when an endpoint is configured, with --otlp-endpoint or
+// the standard OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_EXPORTER_OTLP_TRACES_ENDPOINT variables;
+// headers, TLS and timeouts follow the other OTEL_EXPORTER_OTLP_* variables
+func setupTracing() error {
+	fromEnv := tracingFromEnv && (os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "")
+	if otlpEndpoint == "" && !fromEnv {
+		return nil
+	}
+	if err := requireNetwork("OTLP trace export"); err != nil {
+		return err
+	}
+
+	protocol := otlpProtocol
+	for _, env := range []string{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"} {
+		if protocol == "" && tracingFromEnv {
+			protocol = os.Getenv(env)
+		}
+	}
+
+	ctx := context.Background()
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch protocol {
+	case "grpc":
+		var opts []otlptracegrpc.Option
+		if otlpEndpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(otlpEndpoint))
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	case "", "http/protobuf":
+		var opts []otlptracehttp.Option
+		if otlpEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(otlpEndpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return fmt.Errorf("--otlp-protocol must be 'grpc' or 'http/protobuf', got '%s'", protocol)
+	}
+	if err != nil {
+		return fmt.Errorf("OTLP trace exporter: %w", err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence over the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("magento2-static-deploy")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return fmt.Errorf("OTLP trace resource: %w", err)
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	tracer = tracerProvider.Tracer(tracerName)
+	return nil
+}
+
+// finishTracing exports the remaining spans; call it before exiting
+func finishTracing() {
+	if tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracerShutdownTimeout)
+	defer cancel()
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		logWarnf("exporting traces: %v", err)
+	}
+	tracerProvider = nil
+	tracer = noop.NewTracerProvider().Tracer(tracerName)
+}
+
+// failTraced ends the root span of a failed run with err and exports its spans, returning err
+func failTraced(span trace.Span, err error) error {
+	span.SetStatus(codes.Error, "failed")
+	progressEvents.Finish(false, filesProcessed.Load())
+	span.End()
+	finishTracing()
+	return err
+}
+
+// startSpan starts a span of the deploy pipeline below the span in ctx
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends a span, recording err as its failure
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// jobSpanAttrs returns the attributes identifying a job in spans
+func jobSpanAttrs(job DeployJob) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("magento.area", job.Area),
+		attribute.String("magento.theme", job.Theme),
+		attribute.String("magento.locale", job.Locale),
+	}
+}
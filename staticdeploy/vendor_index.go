@@ -0,0 +1,188 @@
+package staticdeploy
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// VendorPackage is a composer package in vendor/ with the Magento modules it contains
+type VendorPackage struct {
+	Vendor     string
+	Path       string
+	Module     string         // module name from (src/)etc/module.xml, empty for non-modules
+	SubModules []VendorModule // modules in src/*/ (multi-module packages)
+}
+
+// VendorModule is a Magento module inside a multi-module package (src/*/etc/module.xml)
+type VendorModule struct {
+	Name string
+	Path string
+}
+
+// VendorWebDir is a view web directory of a vendor package that exists for an area
+type VendorWebDir struct {
+	Vendor string
+	Path   string
+	Module string
+}
+
+// VendorIndex is the result of a vendor scan, built once and shared by all jobs
+type VendorIndex struct {
+	Packages []VendorPackage
+
+	mu      sync.Mutex
+	webDirs map[string][]VendorWebDir // per area
+}
+
+// WebDirs returns the existing web directories of all packages for an area, in priority order:
+//   - view/{area}/web/, src/view/{area}/web/ (for some packages)
+//   - view/base/web/, src/view/base/web/ (for shared vendor modules like hyva-themes)
+//   - src/*/view/{area}/web/, src/*/view/base/web/ (for multi-module packages like
+//     elasticsuite, hyva-themes/commerce-module-cms)
+//
+// The directories are looked up once per area
+func (idx *VendorIndex) WebDirs(area string) []VendorWebDir {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if dirs, ok := idx.webDirs[area]; ok {
+		return dirs
+	}
+
+	var dirs []VendorWebDir
+	add := func(pkg VendorPackage, webDir string, module string) {
+		if _, err := os.Lstat(webDir); os.IsNotExist(err) {
+			return
+		}
+		dirs = append(dirs, VendorWebDir{Vendor: pkg.Vendor, Path: webDir, Module: module})
+	}
+	for _, pkg := range idx.Packages {
+		for _, webDir := range []string{
+			filepath.Join(pkg.Path, "view", area, "web"),
+			filepath.Join(pkg.Path, "src", "view", area, "web"),
+			filepath.Join(pkg.Path, "view", "base", "web"),
+			filepath.Join(pkg.Path, "src", "view", "base", "web"),
+		} {
+			add(pkg, webDir, pkg.Module)
+		}
+		for _, module := range pkg.SubModules {
+			add(pkg, filepath.Join(module.Path, "view", area, "web"), module.Name)
+			add(pkg, filepath.Join(module.Path, "view", "base", "web"), module.Name)
+		}
+	}
+
+	if idx.webDirs == nil {
+		idx.webDirs = make(map[string][]VendorWebDir)
+	}
+	idx.webDirs[area] = dirs
+	return dirs
+}
+
+// buildVendorIndex enumerates all vendor packages and parses their module.xml files using
+// a pool of concurrency workers (0 for the number of CPUs)
+// Packages are kept in directory order; unreadable paths are recorded in vendorScanErrors
+func buildVendorIndex(magentoRoot string, concurrency int) *VendorIndex {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	vendorDir := filepath.Join(magentoRoot, "vendor")
+	vendorEntries, err := os.ReadDir(vendorDir)
+	if err != nil {
+		vendorScanErrors.Record("vendor", vendorDir, err)
+		return &VendorIndex{}
+	}
+
+	// Enumerate the packages of each vendor in parallel, keeping the directory order
+	vendorPackages := make([][]VendorPackage, len(vendorEntries))
+	parallelFor(len(vendorEntries), concurrency, func(i int) {
+		if !vendorEntries[i].IsDir() {
+			return
+		}
+		vendorName := vendorEntries[i].Name()
+		vendorPath := filepath.Join(vendorDir, vendorName)
+		packageEntries, err := os.ReadDir(vendorPath)
+		if err != nil {
+			vendorScanErrors.Record(vendorName, vendorPath, err)
+			return
+		}
+		for _, packageEntry := range packageEntries {
+			if packageEntry.IsDir() {
+				vendorPackages[i] = append(vendorPackages[i], VendorPackage{
+					Vendor: vendorName,
+					Path:   filepath.Join(vendorPath, packageEntry.Name()),
+				})
+			}
+		}
+	})
+
+	var packages []VendorPackage
+	for _, pkgs := range vendorPackages {
+		packages = append(packages, pkgs...)
+	}
+
+	// Parse module.xml of every package and its src/* modules
+	readable := make([]bool, len(packages))
+	parallelFor(len(packages), concurrency, func(i int) {
+		pkg := &packages[i]
+
+		// Skip (and record) packages that can't be read at all
+		if _, err := os.ReadDir(pkg.Path); err != nil {
+			vendorScanErrors.Record(pkg.Vendor, pkg.Path, err)
+			return
+		}
+		readable[i] = true
+
+		pkg.Module = getModuleName(pkg.Path)
+
+		srcModulesPath := filepath.Join(pkg.Path, "src")
+		srcModuleEntries, err := os.ReadDir(srcModulesPath)
+		if err != nil && !os.IsNotExist(err) {
+			vendorScanErrors.Record(pkg.Vendor, srcModulesPath, err)
+		}
+		for _, srcModuleEntry := range srcModuleEntries {
+			if !srcModuleEntry.IsDir() {
+				continue
+			}
+			moduleDir := filepath.Join(srcModulesPath, srcModuleEntry.Name())
+			// Only include it if it has an etc/module.xml (it's a Magento module)
+			if name := getModuleName(moduleDir); name != "" {
+				pkg.SubModules = append(pkg.SubModules, VendorModule{Name: name, Path: moduleDir})
+			}
+		}
+	})
+
+	index := &VendorIndex{Packages: packages[:0]}
+	for i, pkg := range packages {
+		if readable[i] {
+			index.Packages = append(index.Packages, pkg)
+		}
+	}
+	return index
+}
+
+// parallelFor calls fn for 0..n-1 using at most concurrency goroutines
+func parallelFor(n int, concurrency int, fn func(i int)) {
+	if concurrency > n {
+		concurrency = n
+	}
+
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,103 @@
+package staticdeploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	flag "github.com/spf13/pflag"
+)
+
+// verifyListLimit is the number of paths listed per kind of difference without --verbose
+const verifyListLimit = 20
+
+func init() {
+	registerCommand(Command{
+		Name:        "verify",
+		Description: "Check the deployed files against the manifest (missing, modified and extra files)",
+		Run:         runVerify,
+	})
+}
+
+// runVerify implements the verify subcommand
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory")
+	staticDir := flags.String("static-dir", "", "Static content directory to verify (default: pub/static of the Magento root)")
+	manifestPath := flags.StringP("manifest", "m", "", "Manifest to verify against (default: "+manifestFileName+" in the static content directory)")
+	publicKey := flags.String("public-key", "", "Also check the signature of the manifest (see --sign-manifest) with this PEM encoded Ed25519 public key")
+	verbose := flags.BoolP("verbose", "v", false, "List every difference")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s verify [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Re-hashes the static content and reports files that are missing, modified or not in the\n")
+		fmt.Fprintf(os.Stderr, "manifest written by --manifest; exits with status 1 when there are differences\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *staticDir == "" {
+		*staticDir = filepath.Join(*root, "pub/static")
+	}
+	if *publicKey != "" {
+		path := *manifestPath
+		if path == "" {
+			path = filepath.Join(*staticDir, manifestFileName)
+		}
+		if err := verifyManifestSignature(path, *publicKey); err != nil {
+			return err
+		}
+	}
+	expected, diff, err := verifyStaticContent(*staticDir, *manifestPath)
+	if err != nil {
+		return err
+	}
+
+	printPaths := func(label string, paths []string) {
+		if len(paths) == 0 {
+			return
+		}
+		fmt.Printf("%s (%d):\n", label, len(paths))
+		for i, path := range paths {
+			if i == verifyListLimit && !*verbose {
+				fmt.Printf("  ... and %d more (-v lists all)\n", len(paths)-i)
+				break
+			}
+			fmt.Printf("  %s\n", path)
+		}
+	}
+	printPaths("Missing", diff.Removed)
+	printPaths("Modified", diff.Changed)
+	printPaths("Extra", diff.Added)
+
+	if len(diff.Removed)+len(diff.Changed)+len(diff.Added) > 0 {
+		return fmt.Errorf("%s doesn't match the manifest of version %s: %d missing, %d modified, %d extra",
+			*staticDir, expected.Version, len(diff.Removed), len(diff.Changed), len(diff.Added))
+	}
+	fmt.Printf("%s %d files match the manifest of version %s\n", symOK, len(expected.Files), expected.Version)
+	return nil
+}
+
+// verifyStaticContent re-hashes staticDir and compares it with the manifest at manifestPath,
+// by default the one in staticDir
+func verifyStaticContent(staticDir, manifestPath string) (*Manifest, ManifestDiff, error) {
+	if manifestPath == "" {
+		manifestPath = filepath.Join(staticDir, manifestFileName)
+	}
+	expected, err := loadManifest(manifestPath)
+	if os.IsNotExist(err) {
+		return nil, ManifestDiff{}, fmt.Errorf("no manifest at %s, deploy with --manifest first", manifestPath)
+	}
+	if err != nil {
+		return nil, ManifestDiff{}, err
+	}
+
+	// Hash with the manifest's algorithm, whatever is configured now
+	actual, err := buildManifest(staticDir, expected.Algorithm)
+	if err != nil {
+		return nil, ManifestDiff{}, err
+	}
+	return expected, diffManifests(expected, actual), nil
+}
@@ -0,0 +1,71 @@
+package staticdeploy
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// versionedDirs deploys into pub/static/version{N}/ instead of pub/static/ (--versioned-dirs)
+var versionedDirs bool
+
+// deployRoot returns the directory the themes of a deployment are written to: pub/static, or
+// pub/static/version{version} with --versioned-dirs, as used in URLs with static signing
+func deployRoot(magentoRoot string, version string) string {
+	staticRoot := filepath.Join(magentoRoot, "pub/static")
+	if versionedDirs {
+		return filepath.Join(staticRoot, "version"+version)
+	}
+	return staticRoot
+}
+
+// currentDeployRoot returns the directory holding the themes of the current deployment:
+// pub/static/version{N} for the version in deployed_version.txt when it exists, else pub/static
+func currentDeployRoot(magentoRoot string) string {
+	staticRoot := filepath.Join(magentoRoot, "pub/static")
+	data, err := os.ReadFile(filepath.Join(staticRoot, "deployed_version.txt"))
+	if err != nil {
+		return staticRoot
+	}
+	versionDir := filepath.Join(staticRoot, "version"+strings.TrimSpace(string(data)))
+	if info, err := os.Stat(versionDir); err == nil && info.IsDir() {
+		return versionDir
+	}
+	return staticRoot
+}
+
+// removeOldVersionDirs removes the pub/static/version{N} directories older than version,
+// except that of previous, the version deployed before, which pages rendered before the
+// switch may still reference
+func removeOldVersionDirs(magentoRoot string, version string, previous string) ([]string, error) {
+	staticRoot := filepath.Join(magentoRoot, "pub/static")
+	entries, err := os.ReadDir(staticRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	current, _ := strconv.ParseInt(version, 10, 64)
+	var removed []string
+	for _, entry := range entries {
+		n, ok := versionDirNumber(entry)
+		if !ok || n >= current || strconv.FormatInt(n, 10) == previous {
+			continue
+		}
+		dir := filepath.Join(staticRoot, entry.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, err
+		}
+		removed = append(removed, dir)
+	}
+	return removed, nil
+}
+
+// versionDirNumber returns N of a version{N} directory entry
+func versionDirNumber(entry os.DirEntry) (int64, bool) {
+	if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "version") {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimPrefix(entry.Name(), "version"), 10, 64)
+	return n, err == nil
+}
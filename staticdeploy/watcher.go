@@ -0,0 +1,974 @@
+package staticdeploy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	flag "github.com/spf13/pflag"
+)
+
+func init() {
+	registerCommand(Command{
+		Name:        "watch",
+		Description: "Watch theme sources and redeploy a theme locale when its files change",
+		Run:         runWatch,
+	})
+}
+
+// watchStateFile persists the watcher's file state between sessions, relative to the Magento root
+const watchStateFile = "var/.static-deploy-watch.json"
+
+// watchSyncLimit is the number of changed files of a source directory synced on their own;
+// more redeploy the jobs deployed from it
+const watchSyncLimit = 20
+
+// defaultWatchInterval is how often the sources are checked for changes when polling
+const defaultWatchInterval = 2 * time.Second
+
+// defaultWatchDebounce is the quiet period after the last change before changes are applied
+const defaultWatchDebounce = 300 * time.Millisecond
+
+// maxWatchBatchWait caps how long changes are held back by a burst that doesn't end, e.g. a
+// Tailwind build in watch mode writing continuously
+const maxWatchBatchWait = 10 * time.Second
+
+// watchState is the file state saved on exit and reloaded at start
+type watchState struct {
+	Sources map[string]map[string]string `json:"sources"` // source directory -> relative path -> mtime:size
+}
+
+// runWatch implements the watch subcommand
+func runWatch(args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	root := flags.StringP("root", "r", ".", "Path to Magento root directory")
+	configPath := flags.StringP("config", "c", "", "Path to config file")
+	areas := flags.StringArrayP("area", "a", nil, "Watch the themes of these areas (can be repeated, default frontend)")
+	themes := flags.StringArrayP("theme", "t", nil, "Watch these themes (can be repeated, supports 'Vendor/*' and 'all', default Vendor/Hyva)")
+	languages := flags.StringArrayP("language", "l", nil, "Redeploy these languages (can be repeated, supports 'auto', 'all' and locale groups, default en_US)")
+	interval := flags.Duration("interval", defaultWatchInterval, "How often the theme sources are checked for changes when polling")
+	debounce := flags.Duration("debounce", defaultWatchDebounce, "Quiet period after the last change before changes are applied, so a burst of writes deploys once (0 to apply at once)")
+	poll := flags.Bool("poll", false, "Poll for changes instead of using filesystem events, e.g. for mounts of Docker Desktop")
+	liveReload := flags.String("livereload", "", "Serve LiveReload on this address, reloading the browsers after changes (default address "+defaultLiveReloadAddr+")")
+	flags.Lookup("livereload").NoOptDefVal = defaultLiveReloadAddr
+	php := flags.String("php", "php", "Path to PHP binary for LESS compilation (env: PHP_BINARY)")
+	phpExecFlag := flags.String("php-exec", "", "Command used to run PHP instead of --php, e.g. 'docker compose exec -T php php'")
+	phpExecRootFlag := flags.String("php-exec-root", "", "Magento root path as seen by --php-exec")
+	exclude := flags.StringArray("exclude", nil, "Don't deploy files matching this pattern, in addition to the defaults (like deploy --exclude)")
+	verbose := flags.BoolP("verbose", "v", false, "Verbose output")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s watch [options] [languages]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Watches the source directories of all theme, area and locale jobs of the options, chosen\n")
+		fmt.Fprintf(os.Stderr, "like for deploy, and brings their changes to the affected jobs only, until interrupted.\n")
+		fmt.Fprintf(os.Stderr, "Changes are noticed through filesystem events; sources on network filesystems are polled\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+	if *debounce < 0 {
+		return fmt.Errorf("--debounce must not be negative")
+	}
+	if env := os.Getenv("PHP_BINARY"); env != "" && !flags.Changed("php") {
+		*php = env
+	}
+	phpRunner, err := NewPHPRunner(*root, *php, *phpExecFlag, *phpExecRootFlag, nil)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*root, *configPath)
+	if err != nil {
+		return err
+	}
+	if err := setHashAlgorithm(cfg); err != nil {
+		return err
+	}
+	localeAliases = cfg.LocaleAliases
+	if err := validateThemeSources(*root, cfg.ThemeSources); err != nil {
+		return err
+	}
+	themeSources = cfg.ThemeSources
+	if copyFilters, err = openCopyFilters(cfg.CopyFilters); err != nil {
+		return err
+	}
+
+	// The same defaults and expansions as deploy
+	locales, err := expandLocales(*root, append(*languages, flags.Args()...), cfg)
+	if err != nil {
+		return err
+	}
+	if len(locales) == 0 {
+		locales = []string{"en_US"}
+	}
+	if len(*areas) == 0 {
+		*areas = []string{"frontend"}
+	}
+	if len(*themes) == 0 {
+		*themes = []string{"Vendor/Hyva"}
+	}
+	jobs := createDeployJobs(locales, resolveAreaThemes(*root, *themes, *areas, true, *verbose), *areas)
+
+	var targets []DeployJob
+	for _, job := range jobs {
+		if !themeExists(*root, job.Area, job.Theme) {
+			logWarnf("%s (%s) not found, not watching it", job.Theme, job.Area)
+			continue
+		}
+		targets = append(targets, job)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no themes to watch")
+	}
+
+	watcher := NewFileWatcher(*root, targets, cfg, phpRunner, *interval, *debounce, *poll, *verbose)
+	watcher.excludes = append(watcher.excludes, *exclude...)
+	if *liveReload != "" {
+		if watcher.reload, err = NewLiveReloadServer(*liveReload); err != nil {
+			return err
+		}
+		defer watcher.reload.Close()
+		logInfof("LiveReload on %s, add <script src=\"http://%s/livereload.js\"></script> or use a LiveReload extension", watcher.reload.Addr(), watcher.reload.Addr())
+	}
+	watcher.Start()
+	for _, job := range targets {
+		var dirs []string
+		for _, sourceDir := range watcher.sourceDirs() {
+			for _, target := range watcher.sources[sourceDir] {
+				if target.job == job {
+					dirs = append(dirs, sourceDir)
+				}
+			}
+		}
+		logInfof("Watching %d source directories for %s/%s/%s", len(dirs), job.Area, job.Theme, job.Locale)
+		if *verbose {
+			for _, dir := range dirs {
+				logInfof("  %s", dir)
+			}
+		}
+	}
+	<-shutdownSignals.Graceful().Done()
+	watcher.Stop()
+	return nil
+}
+
+// deployWatchArgs returns the arguments of the watch command for the jobs of a deploy with
+// --watch, passing on the deploy options it shares
+func deployWatchArgs(jobs []DeployJob) []string {
+	args := []string{"--root", magentoRoot}
+	if configFile != "" {
+		args = append(args, "--config", configFile)
+	}
+	seen := make(map[string]bool)
+	for _, job := range jobs {
+		for _, arg := range [][2]string{{"--area", job.Area}, {"--theme", job.Theme}, {"--language", job.Locale}} {
+			if !seen[arg[0]+"="+arg[1]] {
+				seen[arg[0]+"="+arg[1]] = true
+				args = append(args, arg[0], arg[1])
+			}
+		}
+	}
+	// Unless given, PHP_BINARY applies to watch as well
+	for _, name := range []string{"php", "php-exec", "php-exec-root"} {
+		if flag.CommandLine.Changed(name) {
+			args = append(args, "--"+name, flag.CommandLine.Lookup(name).Value.String())
+		}
+	}
+	for _, pattern := range excludeFlag {
+		args = append(args, "--exclude="+pattern)
+	}
+	if liveReloadFlag != "" {
+		args = append(args, "--livereload="+liveReloadFlag)
+	}
+	if verboseFlag {
+		args = append(args, "--verbose")
+	}
+	return args
+}
+
+// watchRole is what a watched source directory is to a job
+type watchRole int
+
+const (
+	watchTheme  watchRole = iota // a theme of the job's theme chain
+	watchLib                     // lib/web
+	watchModule                  // the view/{area} or view/base directory of a module
+)
+
+// watchTarget is a job deploying files of a watched source directory
+type watchTarget struct {
+	job  DeployJob
+	role watchRole
+}
+
+// watchWebDir is a web directory a job deploys, below module (empty for the locale directory)
+type watchWebDir struct {
+	dir    string
+	module string
+}
+
+// FileWatcher monitors the source directories of a set of theme, area and locale jobs and
+// brings their changes to the jobs deployed from them
+type FileWatcher struct {
+	root       string
+	cfg        *Config
+	excludes   []string // patterns of files not deployed, see runExcludePatterns
+	php        *PHPRunner
+	verbose    bool
+	sources    map[string][]watchTarget    // source directory -> jobs deploying its files
+	webDirs    map[DeployJob][]watchWebDir // the web directories of a job in priority order
+	luma       map[DeployJob]bool          // deployed by bin/magento
+	interval   time.Duration
+	debounce   time.Duration // quiet period before changes are applied
+	poll       bool          // poll for changes instead of using filesystem events
+	polling    bool
+	events     *fsnotify.Watcher
+	noBuild    map[string]bool   // warned that the theme has no build hook
+	reload     *LiveReloadServer // reloads the browsers after changes, nil without --livereload
+	done       chan bool
+	mu         sync.Mutex
+	fileHashes map[string]map[string]string // source directory -> relative path -> mtime:size
+}
+
+// NewFileWatcher creates a file watcher for all sources of jobs; php compiles their LESS
+// sources and deploys Luma themes. Changes are applied once none came in for debounce
+func NewFileWatcher(root string, jobs []DeployJob, cfg *Config, php *PHPRunner, interval time.Duration, debounce time.Duration, poll bool, verbose bool) *FileWatcher {
+	w := &FileWatcher{
+		root:       root,
+		cfg:        cfg,
+		excludes:   runExcludePatterns(cfg, nil),
+		php:        php,
+		verbose:    verbose,
+		sources:    make(map[string][]watchTarget),
+		webDirs:    make(map[DeployJob][]watchWebDir),
+		luma:       make(map[DeployJob]bool),
+		interval:   interval,
+		debounce:   debounce,
+		poll:       poll,
+		noBuild:    make(map[string]bool),
+		done:       make(chan bool),
+		fileHashes: make(map[string]map[string]string),
+	}
+	index := loadVendorIndex(root, 0, true)
+	for _, job := range jobs {
+		w.addSources(job, index)
+		w.luma[job] = !isHyvaTheme(root, job.Area, job.Theme, make(map[string]bool))
+	}
+	return w
+}
+
+// addSources registers the source directories of a job and its web directories, in the order
+// queueThemeFiles deploys them: the theme chain with its module overrides, lib/web and the
+// module view directories. Theme sources of the config file aren't watched
+func (w *FileWatcher) addSources(job DeployJob, index *VendorIndex) {
+	addSource := func(dir string, role watchRole) {
+		for _, target := range w.sources[dir] {
+			if target.job == job {
+				return
+			}
+		}
+		w.sources[dir] = append(w.sources[dir], watchTarget{job, role})
+	}
+	addWebDir := func(dir string, module string) {
+		if _, err := os.Stat(dir); err != nil || slices.Contains(w.webDirs[job], watchWebDir{dir, module}) {
+			return
+		}
+		w.webDirs[job] = append(w.webDirs[job], watchWebDir{dir, module})
+	}
+
+	for _, chainTheme := range getThemeParentChain(w.root, job.Area, job.Theme) {
+		if len(strings.Split(chainTheme, "/")) != 2 {
+			continue
+		}
+		designDir := filepath.Join(w.root, "app/design", job.Area, chainTheme)
+		addWebDir(filepath.Join(designDir, "web"), "")
+		themeDir := getThemePath(w.root, job.Area, chainTheme)
+		if themeDir != "" {
+			addWebDir(filepath.Join(themeDir, "web"), "")
+			addSource(themeDir, watchTheme)
+		}
+		if entries, err := os.ReadDir(designDir); err == nil {
+			addSource(designDir, watchTheme)
+			for _, entry := range entries {
+				if entry.IsDir() && entry.Name() != "web" {
+					addWebDir(filepath.Join(designDir, entry.Name(), "web"), entry.Name())
+				}
+			}
+		}
+	}
+
+	for _, libDir := range []string{filepath.Join(w.root, "lib/web"), filepath.Join(w.root, "vendor/mage-os/magento2-base/lib/web")} {
+		if _, err := os.Stat(libDir); err == nil {
+			addWebDir(libDir, "")
+			addSource(libDir, watchLib)
+		}
+	}
+
+	// The view directory rather than its web directory, for the templates Tailwind collects
+	for _, webDir := range index.WebDirs(job.Area) {
+		addWebDir(webDir.Path, webDir.Module)
+		addSource(filepath.Dir(webDir.Path), watchModule)
+	}
+}
+
+// sourceDirs returns the watched source directories in order
+func (w *FileWatcher) sourceDirs() []string {
+	dirs := make([]string, 0, len(w.sources))
+	for dir := range w.sources {
+		dirs = append(dirs, dir)
+	}
+	slices.Sort(dirs)
+	return dirs
+}
+
+// Start begins watching for file changes, with filesystem events (inotify, kqueue) or by
+// polling every interval when a source is on a network filesystem, with --poll or when
+// events aren't available
+func (w *FileWatcher) Start() {
+	w.polling = w.poll
+	if !w.polling {
+		for _, dir := range w.sourceDirs() {
+			if network, fsType := isNetworkFilesystem(dir); network {
+				logInfof("%s is on %s, polling for changes every %s", dir, fsType, w.interval)
+				w.polling = true
+				break
+			}
+		}
+	}
+	if !w.polling {
+		if err := w.watchEvents(); err != nil {
+			logWarnf("can't watch for events, polling for changes every %s: %v", w.interval, err)
+			w.polling = true
+		}
+	}
+
+	go func() {
+		// Resume from the state of the previous session; it's validated by the first check,
+		// which deploys the changes made in between. Without a state, hash all files
+		resumed := w.loadState()
+		if !resumed {
+			w.updateHashes()
+		}
+		if w.polling {
+			w.pollChanges()
+			return
+		}
+		if resumed {
+			if changes := w.changedFiles(); len(changes) > 0 {
+				w.apply(changes)
+			}
+		}
+		w.listen()
+	}()
+}
+
+// pollChanges applies the changes a check of the file state every interval finds, until Stop.
+// Once a check finds changes, the sources are checked again after the debounce period until
+// they're quiet, so a burst of writes spanning checks is applied at once
+func (w *FileWatcher) pollChanges() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			changes := w.changedFiles()
+			if len(changes) == 0 {
+				continue
+			}
+			deadline := time.Now().Add(maxWatchBatchWait)
+			for w.debounce > 0 && time.Now().Before(deadline) {
+				select {
+				case <-time.After(w.debounce):
+				case <-w.done:
+					return
+				}
+				more := w.changedFiles()
+				if len(more) == 0 {
+					break
+				}
+				for file := range more {
+					changes[file] = true
+				}
+			}
+			w.apply(changes)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// watchEvents registers the source directories and their subdirectories for filesystem events
+func (w *FileWatcher) watchEvents() error {
+	events, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	w.events = events
+	for _, dir := range w.sourceDirs() {
+		if err := w.addDirectories(dir); err != nil {
+			events.Close()
+			w.events = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// addDirectories registers dir and its subdirectories, fsnotify doesn't watch recursively.
+// Hidden directories and node_modules are left out, their files are never deployed
+func (w *FileWatcher) addDirectories(dir string) error {
+	return walkSource(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path != dir && errors.Is(err, fs.ErrNotExist) {
+				return nil // removed while walking
+			}
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != dir && unwatchedDir(entry.Name()) {
+			return filepath.SkipDir
+		}
+		return w.events.Add(path)
+	})
+}
+
+// listen applies the changes of filesystem events until Stop. The events of a burst, until
+// none came in for the debounce period, and those arriving while deploying are applied together
+func (w *FileWatcher) listen() {
+	defer w.events.Close()
+	for {
+		select {
+		case event, ok := <-w.events.Events:
+			if !ok {
+				return
+			}
+			changes := make(map[string]bool)
+			w.collect(changes, event)
+			if !w.settle(changes) {
+				return
+			}
+			if len(changes) > 0 {
+				w.apply(changes)
+			}
+		case err, ok := <-w.events.Errors:
+			if !ok {
+				return
+			}
+			logWarnf("watching for changes: %v", err)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// settle adds the events that follow to changes until none came in for the debounce period,
+// or for at most maxWatchBatchWait; false when the watcher stopped meanwhile
+func (w *FileWatcher) settle(changes map[string]bool) bool {
+	quiet := time.NewTimer(w.debounce)
+	defer quiet.Stop()
+	deadline := time.NewTimer(maxWatchBatchWait)
+	defer deadline.Stop()
+	for {
+		select {
+		case event, ok := <-w.events.Events:
+			if !ok {
+				return false
+			}
+			w.collect(changes, event)
+			quiet.Reset(w.debounce)
+		case err, ok := <-w.events.Errors:
+			if ok {
+				logWarnf("watching for changes: %v", err)
+			}
+		case <-quiet.C:
+			return true
+		case <-deadline.C:
+			return true
+		case <-w.done:
+			return false
+		}
+	}
+}
+
+// collect adds the file of an event to changes when it may be deployed. New directories are
+// registered, with the files created in them before that as changes
+func (w *FileWatcher) collect(changes map[string]bool, event fsnotify.Event) {
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+	name := filepath.Base(event.Name)
+	if strings.HasPrefix(name, ".") || name == "node_modules" {
+		return
+	}
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+			if err := w.addDirectories(event.Name); err != nil {
+				logWarnf("watching %s: %v", event.Name, err)
+			}
+			filepath.WalkDir(event.Name, func(path string, entry fs.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+					changes[path] = true
+				}
+				return nil
+			})
+			return
+		}
+	}
+	changes[event.Name] = true
+}
+
+// watchSync is a changed file synced on its own to the locale directory of a job
+type watchSync struct {
+	job               DeployJob
+	relPath, src, dst string
+	info              os.FileInfo
+}
+
+// apply brings changed files to the jobs deployed from their source directories, redeploying
+// only the affected jobs: it rebuilds the Tailwind CSS and recompiles the LESS sources the
+// changes touch, and syncs the changed files or redeploys the jobs. Browsers then reload the
+// changed stylesheets, or the page after other changes
+func (w *FileWatcher) apply(changes map[string]bool) {
+	changed := make(map[DeployJob][]string) // job -> changed files
+	builds := make(map[string]DeployJob)    // theme directory -> a job to build it for
+	for _, file := range slices.Sorted(maps.Keys(changes)) {
+		for sourceDir, targets := range w.sources {
+			relPath, err := filepath.Rel(sourceDir, file)
+			if err != nil || !filepath.IsLocal(relPath) {
+				continue
+			}
+			for _, target := range targets {
+				if !slices.Contains(changed[target.job], file) {
+					changed[target.job] = append(changed[target.job], file)
+				}
+				// Templates of the theme chain and modules are Tailwind sources too
+				if (target.role == watchTheme && isTailwindSource(relPath)) || (target.role == watchModule && filepath.Ext(relPath) == ".phtml") {
+					if themeDir := getThemePath(w.root, target.job.Area, target.job.Theme); themeDir != "" {
+						builds[themeDir] = target.job
+					}
+				}
+			}
+		}
+	}
+
+	// The builds write their CSS into the web directory, a change synced like the others
+	for _, themeDir := range slices.Sorted(maps.Keys(builds)) {
+		w.build(themeDir, builds[themeDir])
+	}
+
+	redeploy := make(map[DeployJob]bool)
+	compile := make(map[DeployJob]bool)
+	var syncs []watchSync
+	for _, job := range sortedJobs(setOf(maps.Keys(changed))) {
+		// Luma themes are compiled and deployed by bin/magento as a whole
+		if w.luma[job] {
+			redeploy[job] = true
+			continue
+		}
+		files := changed[job]
+		if slices.ContainsFunc(files, func(file string) bool { return filepath.Ext(file) == ".less" }) {
+			compile[job] = true
+		}
+		jobSyncs, ok := w.syncFiles(job, files)
+		if !ok {
+			redeploy[job] = true
+			continue
+		}
+		syncs = append(syncs, jobSyncs...)
+	}
+
+	w.deploy(redeploy)
+	var cssPaths []string
+	full := len(redeploy) > 0
+	for _, sync := range syncs {
+		if redeploy[sync.job] {
+			continue
+		}
+		start := time.Now()
+		err := os.MkdirAll(filepath.Dir(sync.dst), 0755)
+		if err == nil {
+			err = updateFile(sync.src, sync.info, sync.dst, false, false)
+		}
+		if err != nil {
+			logErrorf("sync of %s to %s/%s/%s failed: %v", sync.relPath, sync.job.Area, sync.job.Theme, sync.job.Locale, err)
+			continue
+		}
+		logger.Info(fmt.Sprintf("%s Synced %s to %s/%s/%s in %dms", symOK, sync.relPath, sync.job.Area, sync.job.Theme, sync.job.Locale, time.Since(start).Milliseconds()),
+			append(jobAttrs(sync.job), "file", sync.relPath)...)
+		if filepath.Ext(sync.dst) == ".css" {
+			cssPaths = append(cssPaths, w.staticPath(sync.dst))
+		} else {
+			full = true
+		}
+	}
+	for _, job := range sortedJobs(compile) {
+		cssPaths = append(cssPaths, w.compileLess(job)...)
+	}
+	w.reload.Refresh(cssPaths, full)
+}
+
+// staticPath returns the path of a deployed file below pub/static, as in its URL
+func (w *FileWatcher) staticPath(file string) string {
+	relPath, _ := filepath.Rel(filepath.Join(w.root, "pub/static"), file)
+	return filepath.ToSlash(relPath)
+}
+
+// syncFiles returns the syncs of changed files for a job, false when they can't be synced on
+// their own: when there are many, a file was removed or can't be synced on its own
+// (theme.xml, ...)
+func (w *FileWatcher) syncFiles(job DeployJob, files []string) ([]watchSync, bool) {
+	if len(files) > watchSyncLimit {
+		return nil, false
+	}
+	var syncs []watchSync
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, false
+		}
+		if info.IsDir() {
+			continue
+		}
+		dst, ok := w.syncDestination(job, file)
+		if !ok {
+			return nil, false
+		}
+		if dst != "" {
+			relPath, _ := filepath.Rel(filepath.Join(w.root, "pub/static", job.Area, job.Theme, job.Locale), dst)
+			syncs = append(syncs, watchSync{job, relPath, file, dst, info})
+		}
+	}
+	return syncs, true
+}
+
+// sortedJobs returns the jobs of a set in a stable order
+func sortedJobs(set map[DeployJob]bool) []DeployJob {
+	jobs := make([]DeployJob, 0, len(set))
+	for job := range set {
+		jobs = append(jobs, job)
+	}
+	slices.SortFunc(jobs, func(a, b DeployJob) int {
+		return strings.Compare(a.Area+"/"+a.Theme+"/"+a.Locale, b.Area+"/"+b.Theme+"/"+b.Locale)
+	})
+	return jobs
+}
+
+// setOf returns the set of the jobs of a sequence
+func setOf(jobs iter.Seq[DeployJob]) map[DeployJob]bool {
+	set := make(map[DeployJob]bool)
+	for job := range jobs {
+		set[job] = true
+	}
+	return set
+}
+
+// isTailwindSource reports whether a file of a theme is an input of its Tailwind build: the
+// web/tailwind sources, or a template whose classes the build collects
+func isTailwindSource(relPath string) bool {
+	slashPath := filepath.ToSlash(relPath)
+	return strings.HasPrefix(slashPath, "web/tailwind/") || path.Ext(slashPath) == ".phtml"
+}
+
+// build runs the build hook of the theme in themeDir (see themeBuildHook), e.g. its Tailwind
+// build, once for all jobs deployed from it
+func (w *FileWatcher) build(themeDir string, job DeployJob) {
+	if _, ok := themeBuildHook(themeDir, job.Theme, w.cfg); !ok {
+		if !w.noBuild[themeDir] {
+			logWarnf("%s has no build hook (theme_builds, or with theme_build_hooks composer.json or a %s script in package.json), its CSS isn't rebuilt", job.Theme, buildScriptName)
+			w.noBuild[themeDir] = true
+		}
+		return
+	}
+	if err := runThemeBuilds(w.root, []DeployJob{job}, w.cfg, w.verbose); err != nil {
+		logErrorf("%v", err)
+	}
+}
+
+// compileLess compiles the LESS sources of a job into its locale directory, like a deploy, and
+// returns the paths of its CSS below pub/static
+func (w *FileWatcher) compileLess(job DeployJob) []string {
+	start := time.Now()
+	destDir := filepath.Join(w.root, "pub/static", job.Area, job.Theme, job.Locale)
+	preprocessor := NewLessPreprocessor(context.Background(), w.root, w.php, w.verbose, true, logger.With(jobAttrs(job)...))
+	if err := preprocessor.PreprocessAndCompile(destDir, job.Area, job.Theme, job.Locale); err != nil {
+		logErrorf("LESS compilation of %s/%s/%s failed: %v", job.Area, job.Theme, job.Locale, err)
+		return nil
+	}
+	logger.Info(fmt.Sprintf("%s Compiled the LESS of %s/%s/%s in %.1fs", symOK, job.Area, job.Theme, job.Locale, time.Since(start).Seconds()),
+		append(jobAttrs(job), "duration", time.Since(start).Seconds())...)
+
+	var cssPaths []string
+	for _, entryPoint := range findCSSEntryPoints(w.root, job.Area, job.Theme) {
+		cssFile := filepath.Join(destDir, strings.TrimSuffix(entryPoint, ".less")+".css")
+		if _, err := os.Stat(cssFile); err == nil {
+			cssPaths = append(cssPaths, w.staticPath(cssFile))
+		}
+	}
+	return cssPaths
+}
+
+// syncDestination maps a changed file to its destination in the job's locale directory,
+// applying the module prefix of its web directory and the locale of i18n files. An empty
+// destination means the file isn't deployed for the job: it's not in a web directory (e.g.
+// templates), or a file of a web directory before it (in queueThemeFiles order) or a locale
+// specific one takes its place. False means it can't be synced on its own, e.g. theme.xml
+// or with copy filters
+func (w *FileWatcher) syncDestination(job DeployJob, file string) (string, bool) {
+	webDirs := w.webDirs[job]
+	own := slices.IndexFunc(webDirs, func(webDir watchWebDir) bool {
+		relPath, err := filepath.Rel(webDir.dir, file)
+		return err == nil && filepath.IsLocal(relPath)
+	})
+	if own < 0 {
+		for sourceDir, targets := range w.sources {
+			relPath, err := filepath.Rel(sourceDir, file)
+			if err != nil || !filepath.IsLocal(relPath) || !slices.Contains(targets, watchTarget{job, watchTheme}) {
+				continue
+			}
+			if relPath == "theme.xml" || relPath == "registration.php" {
+				return "", false // parent theme and registration
+			}
+		}
+		return "", true // templates, layout, ... aren't deployed
+	}
+
+	if len(copyFilters) > 0 || len(themeSources[job.Theme]) > 0 {
+		return "", false // may move, rewrite or replace the file
+	}
+
+	// Locale specific files take priority over the others, in the order of the fallbacks
+	relPath, _ := filepath.Rel(webDirs[own].dir, file)
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	locales := localeFallbacks(job.Locale)
+	webPath := path.Join(parts...)
+	ownLocales := len(locales) // the locales before the file in its web directory
+	if parts[0] == "i18n" {
+		if len(parts) < 3 || !slices.Contains(locales, parts[1]) {
+			return "", true
+		}
+		ownLocales = slices.Index(locales, parts[1])
+		webPath = path.Join(parts[2:]...)
+	}
+	dest := path.Join(webDirs[own].module, webPath)
+
+	// The first source of a destination is deployed (see fileCopier.Claim)
+	for i, webDir := range webDirs[:own+1] {
+		destPath := dest
+		if webDir.module != "" {
+			var ok bool
+			if destPath, ok = strings.CutPrefix(dest, webDir.module+"/"); !ok {
+				continue
+			}
+		}
+		before := locales
+		if i == own {
+			before = locales[:ownLocales]
+		}
+		for _, locale := range before {
+			if _, err := os.Stat(filepath.Join(webDir.dir, "i18n", locale, destPath)); err == nil {
+				return "", true
+			}
+		}
+		if i < own {
+			if _, err := os.Stat(filepath.Join(webDir.dir, destPath)); err == nil {
+				return "", true
+			}
+		}
+	}
+
+	if excludedPath(w.excludes, webPath) {
+		return "", true
+	}
+	if imagesMode == "defer" && isImageFile(webPath) {
+		return "", true
+	}
+	return filepath.Join(w.root, "pub/static", job.Area, job.Theme, job.Locale, filepath.FromSlash(dest)), true
+}
+
+// deploy redeploys jobs: Hyvä themes like a deploy, Luma themes with bin/magento, a call per
+// theme and area for all their locales
+func (w *FileWatcher) deploy(jobs map[DeployJob]bool) {
+	luma := make(map[[2]string][]string) // area, theme -> locales
+	for _, job := range sortedJobs(jobs) {
+		if w.luma[job] {
+			key := [2]string{job.Area, job.Theme}
+			luma[key] = append(luma[key], job.Locale)
+			continue
+		}
+		logInfof("Changes detected in %s. Running deployment...", job.Theme)
+		version := fmt.Sprintf("%d", time.Now().Unix())
+		fileCount, err := deployTheme(context.Background(), w.root, job, version, false, nil, nil, w.excludes)
+		if err != nil {
+			logErrorf("deployment of %s/%s/%s failed: %v", job.Area, job.Theme, job.Locale, err)
+			continue
+		}
+		logger.Info(fmt.Sprintf("%s Deployment of %s/%s/%s complete: %d files deployed", symOK, job.Area, job.Theme, job.Locale, fileCount),
+			append(jobAttrs(job), "files", fileCount)...)
+	}
+
+	for key, locales := range luma {
+		start := time.Now()
+		// Watching is for development, where bin/magento only deploys with -f
+		if err := deployLumaThemes(context.Background(), w.root, w.php, []string{key[1]}, []string{key[0]}, locales, 0, true, w.verbose, ""); err != nil {
+			logErrorf("deployment of %s/%s with bin/magento failed: %v", key[0], key[1], err)
+			continue
+		}
+		logger.Info(fmt.Sprintf("%s Deployment of %s/%s (%s) with bin/magento complete in %.1fs", symOK, key[0], key[1], strings.Join(locales, ", "), time.Since(start).Seconds()),
+			"area", key[0], "theme", key[1], "duration", time.Since(start).Seconds())
+	}
+}
+
+// Stop stops the file watcher and saves its file state for the next session
+func (w *FileWatcher) Stop() {
+	w.done <- true
+	if !w.polling {
+		// Events don't maintain the file state
+		w.updateHashes()
+	}
+	if err := w.saveState(); err != nil {
+		logWarnf("failed to save watch state: %v", err)
+	}
+}
+
+// loadState restores the file state of the previous session; it only counts when it has
+// every source directory
+func (w *FileWatcher) loadState() bool {
+	data, err := os.ReadFile(filepath.Join(w.root, watchStateFile))
+	if err != nil {
+		return false
+	}
+	var state watchState
+	if json.Unmarshal(data, &state) != nil {
+		return false
+	}
+	for sourceDir := range w.sources {
+		if state.Sources[sourceDir] == nil {
+			return false
+		}
+	}
+
+	w.mu.Lock()
+	for sourceDir := range w.sources {
+		w.fileHashes[sourceDir] = state.Sources[sourceDir]
+	}
+	w.mu.Unlock()
+	return true
+}
+
+// saveState writes the current file state to watchStateFile
+func (w *FileWatcher) saveState() error {
+	w.mu.Lock()
+	data, err := json.Marshal(watchState{Sources: w.fileHashes})
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(w.root, watchStateFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// walkSource walks a source directory like filepath.WalkDir, also when it's a symlink, e.g. a
+// package of a composer path repository, passing the paths below dir
+func walkSource(dir string, fn fs.WalkDirFunc) error {
+	target, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fn(dir, nil, err)
+	}
+	return filepath.WalkDir(target, func(path string, entry fs.DirEntry, err error) error {
+		relPath, _ := filepath.Rel(target, path)
+		return fn(filepath.Join(dir, relPath), entry, err)
+	})
+}
+
+// unwatchedDir reports whether the directories of a source with this name aren't watched:
+// hidden ones and node_modules, which only hold files that aren't deployed
+func unwatchedDir(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "node_modules"
+}
+
+// hashFiles returns the modification time and size of all files in a source directory, except
+// those of unwatched directories
+func hashFiles(sourceDir string) map[string]string {
+	hashes := make(map[string]string)
+	walkSource(sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if path != sourceDir && unwatchedDir(entry.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(sourceDir, path)
+		hashes[relPath] = fmt.Sprintf("%d:%d", info.ModTime().Unix(), info.Size())
+		return nil
+	})
+	return hashes
+}
+
+// updateHashes computes hashes of all files in the source directories
+func (w *FileWatcher) updateHashes() {
+	for sourceDir := range w.sources {
+		hashes := hashFiles(sourceDir)
+		w.mu.Lock()
+		w.fileHashes[sourceDir] = hashes
+		w.mu.Unlock()
+	}
+}
+
+// changedFiles returns the files added, modified or removed since the last check
+func (w *FileWatcher) changedFiles() map[string]bool {
+	changes := make(map[string]bool)
+	for sourceDir := range w.sources {
+		currentHashes := hashFiles(sourceDir)
+
+		w.mu.Lock()
+		// Check for new or modified files
+		for relPath, currentHash := range currentHashes {
+			if prevHash, exists := w.fileHashes[sourceDir][relPath]; !exists || prevHash != currentHash {
+				changes[filepath.Join(sourceDir, relPath)] = true
+			}
+		}
+
+		// Check for deleted files
+		for relPath := range w.fileHashes[sourceDir] {
+			if _, exists := currentHashes[relPath]; !exists {
+				changes[filepath.Join(sourceDir, relPath)] = true
+			}
+		}
+		w.fileHashes[sourceDir] = currentHashes
+		w.mu.Unlock()
+	}
+	return changes
+}
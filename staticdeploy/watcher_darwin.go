@@ -0,0 +1,23 @@
+package staticdeploy
+
+import "golang.org/x/sys/unix"
+
+// networkFilesystems are the filesystems whose changes made elsewhere kqueue doesn't see
+var networkFilesystems = map[string]string{
+	"nfs":     "NFS",
+	"smbfs":   "SMB",
+	"afpfs":   "AFP",
+	"webdav":  "WebDAV",
+	"osxfuse": "FUSE",
+	"macfuse": "FUSE",
+}
+
+// isNetworkFilesystem reports whether path is on a network filesystem, and which
+func isNetworkFilesystem(path string) (bool, string) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false, ""
+	}
+	name, ok := networkFilesystems[unix.ByteSliceToString(st.Fstypename[:])]
+	return ok, name
+}
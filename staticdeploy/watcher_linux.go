@@ -0,0 +1,25 @@
+package staticdeploy
+
+import "golang.org/x/sys/unix"
+
+// networkFilesystems are the filesystems whose changes made elsewhere inotify doesn't see
+var networkFilesystems = map[uint32]string{
+	unix.NFS_SUPER_MAGIC:  "NFS",
+	unix.SMB_SUPER_MAGIC:  "SMB",
+	unix.CIFS_SUPER_MAGIC: "CIFS",
+	unix.SMB2_SUPER_MAGIC: "SMB",
+	unix.FUSE_SUPER_MAGIC: "FUSE", // sshfs, Docker Desktop and VirtioFS mounts
+	unix.V9FS_MAGIC:       "9P",   // WSL 2 mounts of Windows drives
+	unix.CEPH_SUPER_MAGIC: "Ceph",
+	unix.AFS_SUPER_MAGIC:  "AFS",
+}
+
+// isNetworkFilesystem reports whether path is on a network filesystem, and which
+func isNetworkFilesystem(path string) (bool, string) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false, ""
+	}
+	name, ok := networkFilesystems[uint32(st.Type)]
+	return ok, name
+}
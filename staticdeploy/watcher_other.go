@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package staticdeploy
+
+// isNetworkFilesystem can't tell filesystems apart on this platform; --poll forces polling
+func isNetworkFilesystem(path string) (bool, string) {
+	return false, ""
+}
@@ -0,0 +1,25 @@
+package staticdeploy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashFilesSkipsUnwatchedDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"js/app.js", ".hidden", "node_modules/pkg/index.js", ".git/HEAD", "web/node_modules/x.js"} {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hashes := hashFiles(dir)
+	if len(hashes) != 1 || hashes[filepath.Join("js", "app.js")] == "" {
+		t.Errorf("hashFiles = %v, want only js/app.js", hashes)
+	}
+}